@@ -0,0 +1,92 @@
+package dataset
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+)
+
+// LoadCSV reads a CSV file with a header row.
+func LoadCSV(path string) (*Dataset, error) {
+	return Load(path, CSV)
+}
+
+// ReadCSV parses CSV data with a header row. A column is numeric when every
+// non-empty value parses as a number; otherwise it is kept as strings.
+// Empty fields are treated as missing values.
+func ReadCSV(r io.Reader) (*Dataset, error) {
+	return readDelimited(r, ',')
+}
+
+// readDelimited parses CSV-style data whose fields are separated by comma.
+func readDelimited(r io.Reader, comma rune) (*Dataset, error) {
+	cr := csv.NewReader(r)
+	cr.Comma = comma
+	records, err := cr.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, fmt.Errorf("missing header row")
+	}
+
+	header, rows := records[0], records[1:]
+	columns := make([]*Column, len(header))
+	for j, name := range header {
+		raw := make([]string, len(rows))
+		for i, row := range rows {
+			raw[i] = row[j]
+		}
+		columns[j] = inferColumn(name, raw)
+	}
+	return New(columns...)
+}
+
+// inferColumn builds a numeric column when possible and a text column otherwise.
+func inferColumn(name string, raw []string) *Column {
+	numbers := make([]float64, len(raw))
+	for i, s := range raw {
+		if s == "" {
+			numbers[i] = math.NaN()
+			continue
+		}
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return NewText(name, raw)
+		}
+		numbers[i] = f
+	}
+	return NewNumeric(name, numbers)
+}
+
+// WriteCSV writes the dataset with a header row.
+func (d *Dataset) WriteCSV(w io.Writer) error {
+	return d.writeDelimited(w, ',')
+}
+
+func (d *Dataset) writeDelimited(w io.Writer, comma rune) error {
+	cw := csv.NewWriter(w)
+	cw.Comma = comma
+	if err := cw.Write(d.Names()); err != nil {
+		return err
+	}
+	record := make([]string, len(d.Columns))
+	for i := 0; i < d.NumRows(); i++ {
+		for j, c := range d.Columns {
+			record[j] = c.Format(i)
+		}
+		if err := cw.Write(record); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// formatNumber prints whole numbers without a trailing ".0" so integer
+// columns survive a load/save round trip unchanged.
+func formatNumber(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
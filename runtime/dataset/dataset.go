@@ -0,0 +1,193 @@
+// Package dataset is MLite's native, in-memory table. It replaces the
+// pandas DataFrame the Python helpers used to build for every command.
+package dataset
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// ColumnType is the element type of a column.
+type ColumnType string
+
+const (
+	Numeric ColumnType = "numeric"
+	Text    ColumnType = "string"
+)
+
+// Column is a named, typed vector of values. Only the slice matching the
+// column's Type is populated.
+type Column struct {
+	Name    string
+	Type    ColumnType
+	Numbers []float64 // Numeric columns; NaN marks a missing value
+	Strings []string  // Text columns; "" marks a missing value
+}
+
+// NewNumeric creates a numeric column.
+func NewNumeric(name string, values []float64) *Column {
+	return &Column{Name: name, Type: Numeric, Numbers: values}
+}
+
+// NewText creates a string column.
+func NewText(name string, values []string) *Column {
+	return &Column{Name: name, Type: Text, Strings: values}
+}
+
+// Len returns the number of values in the column.
+func (c *Column) Len() int {
+	if c.Type == Numeric {
+		return len(c.Numbers)
+	}
+	return len(c.Strings)
+}
+
+// IsMissing reports whether row i holds no value.
+func (c *Column) IsMissing(i int) bool {
+	if c.Type == Numeric {
+		return math.IsNaN(c.Numbers[i])
+	}
+	return c.Strings[i] == ""
+}
+
+// Format renders row i the way it would appear in a CSV file.
+func (c *Column) Format(i int) string {
+	if c.IsMissing(i) {
+		return ""
+	}
+	if c.Type == Numeric {
+		return formatNumber(c.Numbers[i])
+	}
+	return c.Strings[i]
+}
+
+// String renders the column name and its first few values, e.g.
+// "price[180000, 225000, 270000, ... 25 values]".
+func (c *Column) String() string {
+	const shown = 5
+	n := c.Len()
+	parts := make([]string, 0, shown+1)
+	for i := 0; i < n && i < shown; i++ {
+		parts = append(parts, c.Format(i))
+	}
+	if n > shown {
+		parts = append(parts, fmt.Sprintf("... %d values", n))
+	}
+	return fmt.Sprintf("%s[%s]", c.Name, strings.Join(parts, ", "))
+}
+
+// Dataset is an ordered collection of equal-length columns.
+type Dataset struct {
+	Columns []*Column
+
+	// Transforms are the fitted preprocessing steps the data went through,
+	// in order. Models trained on the data keep them to replay on new data.
+	Transforms []Transform
+}
+
+// New creates a dataset from columns, which must all have the same length.
+func New(columns ...*Column) (*Dataset, error) {
+	seen := make(map[string]bool)
+	for _, c := range columns {
+		if seen[c.Name] {
+			return nil, fmt.Errorf("duplicate column %q", c.Name)
+		}
+		seen[c.Name] = true
+		if c.Len() != columns[0].Len() {
+			return nil, fmt.Errorf("column %q has %d rows, expected %d", c.Name, c.Len(), columns[0].Len())
+		}
+	}
+	return &Dataset{Columns: columns}, nil
+}
+
+// NumRows returns the number of rows.
+func (d *Dataset) NumRows() int {
+	if len(d.Columns) == 0 {
+		return 0
+	}
+	return d.Columns[0].Len()
+}
+
+// Names returns the column names in order.
+func (d *Dataset) Names() []string {
+	names := make([]string, len(d.Columns))
+	for i, c := range d.Columns {
+		names[i] = c.Name
+	}
+	return names
+}
+
+// Column looks up a column by name.
+func (d *Dataset) Column(name string) (*Column, error) {
+	for _, c := range d.Columns {
+		if c.Name == name {
+			return c, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown column %q (have %s)", name, strings.Join(d.Names(), ", "))
+}
+
+// SetColumn appends c, or replaces the column of the same name, in place.
+func (d *Dataset) SetColumn(c *Column) error {
+	if len(d.Columns) > 0 && c.Len() != d.NumRows() {
+		return fmt.Errorf("column %q has %d rows, expected %d", c.Name, c.Len(), d.NumRows())
+	}
+	for j, existing := range d.Columns {
+		if existing.Name == c.Name {
+			d.Columns[j] = c
+			return nil
+		}
+	}
+	d.Columns = append(d.Columns, c)
+	return nil
+}
+
+// WithColumn returns a copy of d with c appended or replaced, leaving d as is.
+// The other columns are shared, not copied.
+func (d *Dataset) WithColumn(c *Column) (*Dataset, error) {
+	out := &Dataset{Columns: append([]*Column(nil), d.Columns...), Transforms: d.Transforms}
+	if err := out.SetColumn(c); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// Numbers returns the values of a numeric column.
+func (d *Dataset) Numbers(name string) ([]float64, error) {
+	c, err := d.Column(name)
+	if err != nil {
+		return nil, err
+	}
+	if c.Type != Numeric {
+		return nil, fmt.Errorf("column %q is not numeric", name)
+	}
+	return c.Numbers, nil
+}
+
+// Matrix returns the named numeric columns as a row-major matrix, the
+// layout models are fitted on.
+func (d *Dataset) Matrix(names []string) ([][]float64, error) {
+	columns := make([][]float64, len(names))
+	for j, name := range names {
+		values, err := d.Numbers(name)
+		if err != nil {
+			return nil, err
+		}
+		columns[j] = values
+	}
+
+	rows := make([][]float64, d.NumRows())
+	for i := range rows {
+		rows[i] = make([]float64, len(names))
+		for j := range names {
+			rows[i][j] = columns[j][i]
+		}
+	}
+	return rows, nil
+}
+
+// String renders a short description, e.g. "dataset(25 rows: sqft, price)".
+func (d *Dataset) String() string {
+	return fmt.Sprintf("dataset(%d rows: %s)", d.NumRows(), strings.Join(d.Names(), ", "))
+}
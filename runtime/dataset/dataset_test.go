@@ -0,0 +1,586 @@
+package dataset
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const housing = `sqft,bedrooms,city,price
+1200,2,austin,180000
+1500,,dallas,225000
+1800,3,,270000
+`
+
+// Checks that column types are inferred and empty fields become missing values.
+func TestReadCSVInfersTypes(t *testing.T) {
+	d, err := ReadCSV(strings.NewReader(housing))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.NumRows() != 3 || len(d.Columns) != 4 {
+		t.Fatalf("got %d rows x %d columns, want 3 x 4", d.NumRows(), len(d.Columns))
+	}
+
+	bedrooms, _ := d.Column("bedrooms")
+	if bedrooms.Type != Numeric || !math.IsNaN(bedrooms.Numbers[1]) {
+		t.Errorf("bedrooms: got %+v, want numeric with a missing second value", bedrooms)
+	}
+	city, _ := d.Column("city")
+	if city.Type != Text || !city.IsMissing(2) {
+		t.Errorf("city: got %+v, want text with a missing third value", city)
+	}
+}
+
+// Checks that Matrix lays features out row by row and rejects text columns.
+func TestMatrix(t *testing.T) {
+	d, _ := ReadCSV(strings.NewReader(housing))
+
+	X, err := d.Matrix([]string{"sqft", "price"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if X[2][0] != 1800 || X[2][1] != 270000 {
+		t.Errorf("row 2: got %v, want [1800 270000]", X[2])
+	}
+
+	if _, err := d.Matrix([]string{"city"}); err == nil {
+		t.Error("expected an error for a text column")
+	}
+	if _, err := d.Matrix([]string{"garage"}); err == nil {
+		t.Error("expected an error for an unknown column")
+	}
+}
+
+// Checks that a dataset survives a CSV write/read round trip unchanged.
+func TestWriteCSVRoundTrip(t *testing.T) {
+	d, _ := ReadCSV(strings.NewReader(housing))
+
+	var buf bytes.Buffer
+	if err := d.WriteCSV(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != housing {
+		t.Errorf("round trip:\ngot:\n%s\nwant:\n%s", buf.String(), housing)
+	}
+}
+
+// Checks that every format writes and reads back the same table.
+func TestFormatsRoundTrip(t *testing.T) {
+	d, _ := ReadCSV(strings.NewReader(housing))
+	for _, format := range Formats {
+		var buf bytes.Buffer
+		if err := d.Write(&buf, format); err != nil {
+			t.Fatalf("%s: %v", format, err)
+		}
+		back, err := Read(&buf, format)
+		if err != nil {
+			t.Fatalf("%s: %v", format, err)
+		}
+		var csv bytes.Buffer
+		back.WriteCSV(&csv)
+		if csv.String() != housing {
+			t.Errorf("%s round trip:\ngot:\n%s\nwant:\n%s", format, csv.String(), housing)
+		}
+	}
+}
+
+// Checks that the format comes from the extension, looking past a
+// compression suffix, and that unknown names are rejected.
+func TestDetectFormat(t *testing.T) {
+	cases := map[string]Format{
+		"housing.csv":         CSV,
+		"housing.TSV":         TSV,
+		"prices.jsonl.gz":     JSONLines,
+		"prices.json":         JSON,
+		"extract.parquet":     Parquet,
+		"housing.csv.zst":     CSV,
+		"no_extension":        CSV,
+		"archive/housing.txt": CSV,
+	}
+	for path, want := range cases {
+		if got := DetectFormat(path); got != want {
+			t.Errorf("%s: got %s, want %s", path, got, want)
+		}
+	}
+	if _, err := ParseFormat("xlsx"); err == nil {
+		t.Error("expected an error for an unknown format")
+	}
+}
+
+// Checks that JSON records keep their key order, fill absent keys and nulls
+// with missing values, and keep booleans and mixed columns as text.
+func TestReadJSONRecords(t *testing.T) {
+	const lines = `{"sqft": 1200, "city": "austin", "garage": true}
+{"city": null, "sqft": 1500, "zip": "78701"}
+{"sqft": 1800, "zip": 73301}
+`
+	d, err := Read(strings.NewReader(lines), JSONLines)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(d.Names(), ","); got != "sqft,city,garage,zip" {
+		t.Fatalf("columns %s", got)
+	}
+	sqft, _ := d.Column("sqft")
+	city, _ := d.Column("city")
+	garage, _ := d.Column("garage")
+	zip, _ := d.Column("zip")
+	if sqft.Type != Numeric || sqft.Numbers[2] != 1800 {
+		t.Errorf("sqft %+v", sqft)
+	}
+	if !city.IsMissing(1) || !city.IsMissing(2) || garage.Strings[0] != "true" || !garage.IsMissing(1) {
+		t.Errorf("city %+v, garage %+v", city, garage)
+	}
+	if zip.Type != Text || zip.Strings[1] != "78701" || zip.Strings[2] != "73301" {
+		t.Errorf("zip %+v", zip)
+	}
+
+	if _, err := Read(strings.NewReader(lines), JSON); err == nil {
+		t.Error("expected an error reading JSON Lines as a JSON array")
+	}
+}
+
+// housingZstd is the housing CSV compressed by the zstd command line tool.
+const housingZstd = "KLUv/SRRPQIAYsQOEpDPAdwOGzuAzf9fzLMknH8+n4CZmfQvyug+Na2Z9DOPALiEP1apNe8zdwAKsRl/K0OnDsKZ1HldkgYDAADEm9cSAMpkOxJd"
+
+// Checks that gzip and zstd input is decompressed, zstd when streamed too,
+// and that Save gzip-compresses names ending in .gz.
+func TestLoadCompressed(t *testing.T) {
+	compressed, _ := base64.StdEncoding.DecodeString(housingZstd)
+	d, err := Read(bytes.NewReader(compressed), CSV)
+	if err != nil || d.NumRows() != 3 {
+		t.Fatalf("zstd: %v, %v", d, err)
+	}
+	zst := filepath.Join(t.TempDir(), "housing.csv.zst")
+	if err := os.WriteFile(zst, compressed, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	rows := 0
+	s, err := OpenStream(zst, CSV, 15)
+	if err == nil {
+		err = s.Each(func(d *Dataset) error {
+			rows += d.NumRows()
+			return nil
+		})
+	}
+	if err != nil || rows != 3 {
+		t.Errorf("streamed zstd: %d rows, %v", rows, err)
+	}
+
+	path := filepath.Join(t.TempDir(), "housing.tsv.gz")
+	if err := d.Save(path, ""); err != nil {
+		t.Fatal(err)
+	}
+	back, err := Load(path, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var csv bytes.Buffer
+	back.WriteCSV(&csv)
+	if csv.String() != housing {
+		t.Errorf("gzip round trip:\n%s", csv.String())
+	}
+	if err := d.Save(filepath.Join(t.TempDir(), "housing.csv.zst"), ""); err == nil {
+		t.Error("expected an error writing zstd")
+	}
+}
+
+// Checks that a stratified split keeps each class's share on both sides and
+// that the same seed reproduces the same split.
+func TestSplitRowsStratified(t *testing.T) {
+	strata := make([]string, 100)
+	for i := range strata {
+		strata[i] = "a"
+		if i%4 == 0 {
+			strata[i] = "b" // 25% minority class
+		}
+	}
+
+	fold, err := SplitRows(len(strata), 0.2, 42, strata)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fold.Test) != 20 || len(fold.Train) != 80 {
+		t.Fatalf("got %d/%d train/test rows, want 80/20", len(fold.Train), len(fold.Test))
+	}
+	minority := 0
+	for _, r := range fold.Test {
+		if strata[r] == "b" {
+			minority++
+		}
+	}
+	if minority != 5 {
+		t.Errorf("test set has %d minority rows, want 5", minority)
+	}
+
+	again, _ := SplitRows(len(strata), 0.2, 42, strata)
+	for i := range fold.Test {
+		if fold.Test[i] != again.Test[i] {
+			t.Fatal("same seed produced a different split")
+		}
+	}
+}
+
+// Checks that k folds partition the rows: every row is tested exactly once
+// and never trains on the fold that tests it.
+func TestKFoldRowsPartition(t *testing.T) {
+	for _, strata := range [][]string{nil, {"x", "y", "x", "y", "x", "y", "x", "y", "x", "y", "x"}} {
+		folds, err := KFoldRows(11, 3, 7, strata)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tested := make([]int, 11)
+		for _, f := range folds {
+			if len(f.Train)+len(f.Test) != 11 {
+				t.Errorf("fold covers %d rows, want 11", len(f.Train)+len(f.Test))
+			}
+			for _, r := range f.Test {
+				tested[r]++
+			}
+		}
+		for r, n := range tested {
+			if n != 1 {
+				t.Errorf("row %d tested %d times", r, n)
+			}
+		}
+	}
+
+	if _, err := KFoldRows(3, 5, 0, nil); err == nil {
+		t.Error("expected an error when k exceeds the row count")
+	}
+}
+
+// Checks that Take copies the selected rows in order.
+func TestTake(t *testing.T) {
+	d, _ := ReadCSV(strings.NewReader(housing))
+	sub := d.Take([]int{2, 0})
+	city, _ := sub.Column("city")
+	sqft, _ := sub.Numbers("sqft")
+	if sub.NumRows() != 2 || sqft[0] != 1800 || city.Strings[1] != "austin" {
+		t.Errorf("unexpected rows: %v %v", sqft, city.Strings)
+	}
+}
+
+// Checks that WithColumn leaves the original untouched and that SetColumn
+// replaces a column of the same name and rejects a wrong length.
+func TestWithAndSetColumn(t *testing.T) {
+	d, _ := ReadCSV(strings.NewReader(housing))
+	out, err := d.WithColumn(NewNumeric("price_hat", []float64{1, 2, 3}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(d.Columns) != 4 || len(out.Columns) != 5 {
+		t.Errorf("got %d and %d columns, want 4 and 5", len(d.Columns), len(out.Columns))
+	}
+
+	if err := d.SetColumn(NewNumeric("price", []float64{0, 0, 0})); err != nil || len(d.Columns) != 4 {
+		t.Errorf("replacing price: %v, %d columns", err, len(d.Columns))
+	}
+	if err := d.SetColumn(NewNumeric("short", []float64{1})); err == nil {
+		t.Error("expected an error for a column of the wrong length")
+	}
+}
+
+// Checks that fitted steps transform new data with the statistics of the
+// data they were fitted on, and that Replay skips steps already applied.
+func TestPreprocessSteps(t *testing.T) {
+	d, _ := ReadCSV(strings.NewReader(housing))
+	impute, err := FitImpute(d, "bedrooms", "median", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	scale, err := FitStandardize(d, []string{"sqft"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	city, err := FitOneHot(d, "city")
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := d.Apply(impute, scale, city)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bedrooms, _ := out.Numbers("bedrooms")
+	sqft, _ := out.Numbers("sqft")
+	if bedrooms[1] != 2.5 || math.Abs(sqft[1]) > 1e-12 {
+		t.Errorf("bedrooms %v, sqft %v", bedrooms, sqft)
+	}
+	if got := strings.Join(out.Names(), ","); got != "sqft,bedrooms,city_austin,city_dallas,price" {
+		t.Errorf("columns %s", got)
+	}
+
+	fresh, _ := ReadCSV(strings.NewReader("sqft,bedrooms,city,price\n1500,,paris,0\n"))
+	again, err := fresh.Replay(out.Transforms)
+	if err != nil {
+		t.Fatal(err)
+	}
+	twice, err := out.Replay(out.Transforms)
+	if err != nil {
+		t.Fatal(err)
+	}
+	austin, _ := again.Numbers("city_austin")
+	sqft, _ = twice.Numbers("sqft")
+	if austin[0] != 0 || math.Abs(sqft[1]) > 1e-12 {
+		t.Errorf("replayed: city_austin %v, sqft %v", austin, sqft)
+	}
+
+	steps, err := MarshalTransforms(out.Transforms)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := UnmarshalTransforms(steps)
+	if err != nil || len(decoded) != 3 || decoded[2].String() != city.String() {
+		t.Errorf("decoded %v, %v", decoded, err)
+	}
+}
+
+// Checks that select, filter, sort, head, tail and sample pick the right
+// rows and columns, with missing values sorted last either way.
+func TestQuery(t *testing.T) {
+	d, _ := ReadCSV(strings.NewReader(housing))
+	picked, err := d.Select([]string{"price", "sqft"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(picked.Names(), ","); got != "price,sqft" {
+		t.Errorf("select gave %s", got)
+	}
+	if _, err := d.Select([]string{"sqft", "sqft"}); err == nil {
+		t.Error("selecting a column twice should fail")
+	}
+
+	kept, err := d.Filter([]bool{true, false, true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sqft, _ := kept.Numbers("sqft"); len(sqft) != 2 || sqft[1] != 1800 {
+		t.Errorf("filter kept sqft %v", sqft)
+	}
+
+	for _, desc := range []bool{false, true} {
+		sorted, err := d.Sort([]string{"bedrooms"}, desc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sqft, _ := sorted.Numbers("sqft")
+		want := []float64{1200, 1800, 1500}
+		if desc {
+			want = []float64{1800, 1200, 1500}
+		}
+		for i := range want {
+			if sqft[i] != want[i] {
+				t.Errorf("sort desc=%v gave sqft %v, want %v", desc, sqft, want)
+				break
+			}
+		}
+	}
+
+	if h, _ := d.Head(2).Numbers("sqft"); len(h) != 2 || h[0] != 1200 {
+		t.Errorf("head gave %v", h)
+	}
+	if tl, _ := d.Tail(10).Numbers("sqft"); len(tl) != 3 {
+		t.Errorf("tail gave %v", tl)
+	}
+	s, err := d.Sample(2, 7)
+	if err != nil || s.NumRows() != 2 {
+		t.Fatalf("sample gave %v, %v", s, err)
+	}
+	if again, _ := d.Sample(2, 7); again.Columns[0].Numbers[0] != s.Columns[0].Numbers[0] {
+		t.Error("sample with the same seed drew different rows")
+	}
+	if _, err := d.Sample(4, 0); err == nil {
+		t.Error("sampling more rows than there are should fail")
+	}
+}
+
+// Checks that groups are ordered by key with missing keys last, that
+// aggregations skip missing values, and that each kind of join keeps the
+// right rows and suffixes clashing columns.
+func TestGroupByAndJoin(t *testing.T) {
+	d, _ := ReadCSV(strings.NewReader("bedrooms,price,city\n3,300,austin\n2,200,dallas\n3,,austin\n,100,\n2,220,austin\n"))
+	g, err := d.GroupBy([]string{"bedrooms"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := g.Agg([]Aggregation{{Func: "mean", Column: "price"}, {Func: "count"}, {Func: "n_unique", Column: "city"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(out.Names(), ","); got != "bedrooms,mean_price,count,n_unique_city" {
+		t.Errorf("columns %s", got)
+	}
+	keys, _ := out.Numbers("bedrooms")
+	means, _ := out.Numbers("mean_price")
+	counts, _ := out.Numbers("count")
+	unique, _ := out.Numbers("n_unique_city")
+	if keys[0] != 2 || keys[1] != 3 || !math.IsNaN(keys[2]) {
+		t.Errorf("keys %v, want [2 3 NaN]", keys)
+	}
+	if means[0] != 210 || means[1] != 300 || counts[1] != 2 || unique[0] != 2 || unique[2] != 0 {
+		t.Errorf("means %v, counts %v, unique %v", means, counts, unique)
+	}
+	if _, err := g.Agg([]Aggregation{{Func: "mean", Column: "city"}}); err == nil {
+		t.Error("mean of a text column should fail")
+	}
+
+	a, _ := ReadCSV(strings.NewReader("id,x\n1,10\n2,20\n3,30\n"))
+	b, _ := ReadCSV(strings.NewReader("id,x,y\n2,200,b\n4,400,d\n2,201,c\n"))
+	for _, tc := range []struct {
+		how, ids string
+	}{
+		{"inner", "2,2"},
+		{"left", "1,2,2,3"},
+		{"right", "2,4,2"},
+		{"outer", "1,2,2,3,4"},
+	} {
+		j, err := a.Join(b, []string{"id"}, tc.how)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := strings.Join(j.Names(), ","); got != "id,x_x,x_y,y" {
+			t.Errorf("%s join columns %s", tc.how, got)
+		}
+		ids, _ := j.Column("id")
+		var got []string
+		for i := 0; i < ids.Len(); i++ {
+			got = append(got, ids.Format(i))
+		}
+		if strings.Join(got, ",") != tc.ids {
+			t.Errorf("%s join ids %v, want %s", tc.how, got, tc.ids)
+		}
+	}
+	if _, err := a.Join(b, []string{"id"}, "cross"); err == nil {
+		t.Error("unknown join kind should fail")
+	}
+}
+
+// Checks that a profile counts missing values, interpolates quartiles,
+// lists the most frequent values first, correlates numeric columns over
+// rows where both are present, and writes null for what does not apply.
+func TestDescribe(t *testing.T) {
+	d, _ := ReadCSV(strings.NewReader(housing + "1400,3,austin,\n"))
+	p := d.Describe()
+	if p.Rows != 4 || len(p.Columns) != 4 {
+		t.Fatalf("profile of %d rows, %d columns", p.Rows, len(p.Columns))
+	}
+	sqft, city, price := p.Columns[0], p.Columns[2], p.Columns[3]
+	if *sqft.Q25 != 1350 || *sqft.Median != 1450 || *sqft.Std != 250 {
+		t.Errorf("sqft quartiles %v %v, std %v", *sqft.Q25, *sqft.Median, *sqft.Std)
+	}
+	if price.Count != 3 || price.Missing != 1 || *price.Mean != 225000 {
+		t.Errorf("price count %d, missing %d, mean %v", price.Count, price.Missing, *price.Mean)
+	}
+	if city.Mean != nil || city.Distinct != 2 || city.Top[0] != (ValueCount{Value: "austin", Count: 2}) {
+		t.Errorf("city profile %+v", city)
+	}
+	if got := strings.Join(p.Correlation.Columns, ","); got != "sqft,bedrooms,price" {
+		t.Errorf("correlated columns %s", got)
+	}
+	if r := p.Correlation.Matrix[0][2]; r == nil || math.Abs(*r-1) > 1e-12 {
+		t.Errorf("sqft-price correlation %v, want 1", r)
+	}
+
+	encoded, err := json.Marshal(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(encoded), `"name":"city","type":"string","count":3,"missing":1,"distinct":2,"mean":null`) {
+		t.Errorf("json %s", encoded)
+	}
+	if text := p.String(); !strings.Contains(text, "austin (2), dallas (1)") || !strings.Contains(text, "correlation") {
+		t.Errorf("text profile:\n%s", text)
+	}
+}
+
+// Checks that a stream reads the file in batches of about the requested
+// size, applies its steps to each, and profiles the same as a whole load.
+func TestStream(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "housing.csv")
+	if err := os.WriteFile(path, []byte(housing+"1400,3,austin,\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	s, err := OpenStream(path, "", 15)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var sizes []int
+	if err := s.Each(func(d *Dataset) error {
+		sizes = append(sizes, d.NumRows())
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if len(sizes) != 4 {
+		t.Errorf("batch sizes %v, want one row per batch", sizes)
+	}
+
+	streamed, err := s.Describe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	whole, _ := LoadCSV(path)
+	got, _ := json.Marshal(streamed)
+	want, _ := json.Marshal(whole.Describe())
+	if string(got) != string(want) {
+		t.Errorf("streamed profile\n%s\nwant\n%s", got, want)
+	}
+
+	cities, err := s.Then(func(d *Dataset) (*Dataset, error) { return d.Select([]string{"city"}) })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(cities.Names(), ","); got != "city" || len(s.Names()) != 4 {
+		t.Errorf("projected stream has columns %s, source %v", got, s.Names())
+	}
+	if _, err := s.Then(func(d *Dataset) (*Dataset, error) { return d.Select([]string{"area"}) }); err == nil {
+		t.Error("selecting an unknown column should fail before a pass")
+	}
+
+	if err := os.WriteFile(path, []byte("sqft\n1200\nlarge\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	s, _ = OpenStream(path, CSV, 1)
+	err = s.Each(func(*Dataset) error { return nil })
+	if err == nil || !strings.Contains(err.Error(), `"large" is not a number`) {
+		t.Errorf("expected a type error in a later batch, got %v", err)
+	}
+}
+
+// Checks that a dataset survives a trip through a SQLite table, with
+// missing values as NULL, and that a query's named parameters bind.
+func TestSQLiteRoundTrip(t *testing.T) {
+	d, _ := ReadCSV(strings.NewReader(housing))
+	path := filepath.Join(t.TempDir(), "houses.db")
+	if err := d.SaveSQLite(path, "houses"); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.SaveSQLite(path, "houses"); err != nil {
+		t.Fatalf("replacing the table: %v", err)
+	}
+	back, err := LoadSQLite(path, `SELECT * FROM houses WHERE price > :floor OR city IS NULL`, sql.Named("floor", 200000.0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	back.WriteCSV(&buf)
+	if want := "sqft,bedrooms,city,price\n1500,,dallas,225000\n1800,3,,270000\n"; buf.String() != want {
+		t.Errorf("got\n%s\nwant\n%s", buf.String(), want)
+	}
+	if _, err := LoadSQLite(filepath.Join(t.TempDir(), "missing.db"), "SELECT 1"); err == nil {
+		t.Error("loading a missing database file should fail")
+	}
+
+	query := `SELECT ':skipped', "@skipped" FROM t -- $skipped
+		WHERE a = :a AND b > @b_2 AND c = $a /* :skipped */ AND d = ?`
+	if got := strings.Join(QueryParameters(query), ","); got != "a,b_2" {
+		t.Errorf("parameters %s, want a,b_2", got)
+	}
+}
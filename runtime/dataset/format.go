@@ -0,0 +1,365 @@
+package dataset
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"mlite/dataset/internal/parquet"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Format is a file format Load and Save understand.
+type Format string
+
+const (
+	CSV       Format = "csv"
+	TSV       Format = "tsv"
+	JSON      Format = "json"  // an array of records
+	JSONLines Format = "jsonl" // one record per line
+	Parquet   Format = "parquet"
+)
+
+// Formats lists the supported formats.
+var Formats = []Format{CSV, TSV, JSON, JSONLines, Parquet}
+
+var extensions = map[string]Format{
+	".csv":     CSV,
+	".tsv":     TSV,
+	".tab":     TSV,
+	".json":    JSON,
+	".jsonl":   JSONLines,
+	".ndjson":  JSONLines,
+	".parquet": Parquet,
+	".pq":      Parquet,
+}
+
+// DetectFormat returns the format a file name's extension implies,
+// looking past a .gz or .zst suffix: "prices.jsonl.gz" is JSON Lines.
+// Unknown extensions are read as CSV.
+func DetectFormat(path string) Format {
+	ext := strings.ToLower(filepath.Ext(path))
+	if ext == ".gz" || ext == ".zst" {
+		ext = strings.ToLower(filepath.Ext(strings.TrimSuffix(path, filepath.Ext(path))))
+	}
+	if f, ok := extensions[ext]; ok {
+		return f
+	}
+	return CSV
+}
+
+// ParseFormat checks a format name, where "" stands for detection from the
+// file name.
+func ParseFormat(name string) (Format, error) {
+	for _, f := range Formats {
+		if string(f) == name {
+			return f, nil
+		}
+	}
+	if name == "" {
+		return "", nil
+	}
+	return "", fmt.Errorf("unknown format %q (expected one of %s)", name, formatList())
+}
+
+func formatList() string {
+	names := make([]string, len(Formats))
+	for i, f := range Formats {
+		names[i] = string(f)
+	}
+	return strings.Join(names, ", ")
+}
+
+// Load reads a file in the given format, or the one its name implies when
+// format is empty. Gzip and zstd compressed files are decompressed
+// whatever their name.
+func Load(path string, format Format) (*Dataset, error) {
+	if format == "" {
+		format = DetectFormat(path)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	d, err := Read(f, format)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return d, nil
+}
+
+// Read parses data in a format, decompressing it first when it starts
+// with a gzip or zstd header.
+func Read(r io.Reader, format Format) (*Dataset, error) {
+	r, err := decompress(r)
+	if err != nil {
+		return nil, err
+	}
+	switch format {
+	case CSV:
+		return ReadCSV(r)
+	case TSV:
+		return readDelimited(r, '\t')
+	case JSON:
+		return readJSON(r, true)
+	case JSONLines:
+		return readJSON(r, false)
+	case Parquet:
+		data, err := io.ReadAll(r)
+		if err != nil {
+			return nil, err
+		}
+		return readParquet(data)
+	}
+	return nil, fmt.Errorf("unknown format %q (expected one of %s)", format, formatList())
+}
+
+// zstdMagic starts every zstd frame.
+var zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+
+// decompress unwraps gzip and zstd input, recognized by its magic number.
+// Both are decoded as they are read.
+func decompress(r io.Reader) (io.Reader, error) {
+	br := bufio.NewReader(r)
+	head, _ := br.Peek(4)
+	switch {
+	case len(head) >= 2 && head[0] == 0x1f && head[1] == 0x8b:
+		return gzip.NewReader(br)
+	case bytes.Equal(head, zstdMagic):
+		// One goroutine-free decoder per file, so nothing needs closing.
+		return zstd.NewReader(br, zstd.WithDecoderConcurrency(1))
+	}
+	return br, nil
+}
+
+// Save writes the dataset to a file in the given format, or the one its
+// name implies when format is empty. A name ending in .gz is written
+// gzip-compressed.
+func (d *Dataset) Save(path string, format Format) error {
+	if format == "" {
+		format = DetectFormat(path)
+	}
+	if strings.EqualFold(filepath.Ext(path), ".zst") {
+		return fmt.Errorf("%s: writing zstd-compressed files is not supported", path)
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	var w io.Writer = f
+	var zw *gzip.Writer
+	if strings.EqualFold(filepath.Ext(path), ".gz") {
+		zw = gzip.NewWriter(f)
+		w = zw
+	}
+	err = d.Write(w, format)
+	if zw != nil && err == nil {
+		err = zw.Close()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	return nil
+}
+
+// Write encodes the dataset in a format.
+func (d *Dataset) Write(w io.Writer, format Format) error {
+	switch format {
+	case CSV:
+		return d.WriteCSV(w)
+	case TSV:
+		return d.writeDelimited(w, '\t')
+	case JSON, JSONLines:
+		return d.writeJSON(w, format == JSONLines)
+	case Parquet:
+		columns := make([]parquet.Column, len(d.Columns))
+		for j, c := range d.Columns {
+			columns[j] = parquet.Column{Name: c.Name, Text: c.Type == Text, Numbers: c.Numbers, Strings: c.Strings}
+		}
+		return parquet.Write(w, columns)
+	}
+	return fmt.Errorf("unknown format %q (expected one of %s)", format, formatList())
+}
+
+func readParquet(data []byte) (*Dataset, error) {
+	columns, err := parquet.Read(data)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]*Column, len(columns))
+	for j, c := range columns {
+		if c.Text {
+			out[j] = NewText(c.Name, c.Strings)
+		} else {
+			out[j] = NewNumeric(c.Name, c.Numbers)
+		}
+	}
+	return New(out...)
+}
+
+// readJSON parses records, either as one JSON array or as a stream of
+// objects, one per line. Columns appear in the order their keys are first
+// seen. A column is numeric when every present value is a number; null
+// and absent keys are missing values; booleans, nested objects and arrays
+// are kept as their JSON text.
+func readJSON(r io.Reader, array bool) (*Dataset, error) {
+	dec := json.NewDecoder(r)
+	if array {
+		if tok, err := dec.Token(); err != nil || tok != json.Delim('[') {
+			return nil, fmt.Errorf("expected a JSON array of records")
+		}
+	}
+
+	var names []string
+	index := map[string]int{}
+	var raw [][]string // raw[j][i] is column j of row i
+	var text []bool
+	rows := 0
+	for dec.More() {
+		var record json.RawMessage
+		if err := dec.Decode(&record); err != nil {
+			return nil, fmt.Errorf("record %d: %w", rows+1, err)
+		}
+		fields, err := recordFields(record)
+		if err != nil {
+			return nil, fmt.Errorf("record %d: %w", rows+1, err)
+		}
+		for _, f := range fields {
+			j, ok := index[f.name]
+			if !ok {
+				j = len(names)
+				index[f.name] = j
+				names = append(names, f.name)
+				raw = append(raw, make([]string, rows))
+				text = append(text, false)
+			}
+			if len(raw[j]) == rows {
+				raw[j] = append(raw[j], "")
+			}
+			value, number := jsonValue(f.value)
+			raw[j][rows] = value
+			text[j] = text[j] || value != "" && !number
+		}
+		rows++
+		for j := range raw {
+			if len(raw[j]) < rows {
+				raw[j] = append(raw[j], "")
+			}
+		}
+	}
+	if array {
+		if _, err := dec.Token(); err != nil {
+			return nil, err
+		}
+	}
+
+	columns := make([]*Column, len(names))
+	for j, name := range names {
+		if text[j] {
+			columns[j] = NewText(name, raw[j])
+		} else {
+			columns[j] = inferColumn(name, raw[j])
+		}
+	}
+	return New(columns...)
+}
+
+type jsonField struct {
+	name  string
+	value json.RawMessage
+}
+
+// recordFields splits a JSON object into its fields in document order,
+// which decoding into a map would lose.
+func recordFields(record json.RawMessage) ([]jsonField, error) {
+	dec := json.NewDecoder(bytes.NewReader(record))
+	if tok, err := dec.Token(); err != nil || tok != json.Delim('{') {
+		return nil, fmt.Errorf("expected a JSON object")
+	}
+	var fields []jsonField
+	for dec.More() {
+		key, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		var value json.RawMessage
+		if err := dec.Decode(&value); err != nil {
+			return nil, err
+		}
+		fields = append(fields, jsonField{name: key.(string), value: value})
+	}
+	return fields, nil
+}
+
+// jsonValue renders a JSON value as a CSV-style field and reports whether
+// it is a number. null becomes the empty, missing field.
+func jsonValue(value json.RawMessage) (string, bool) {
+	switch {
+	case string(value) == "null":
+		return "", false
+	case value[0] == '"':
+		var s string
+		json.Unmarshal(value, &s)
+		return s, false
+	case value[0] == '-' || value[0] >= '0' && value[0] <= '9':
+		return string(value), true
+	}
+	var compact bytes.Buffer
+	json.Compact(&compact, value)
+	return compact.String(), false
+}
+
+// writeJSON writes the dataset as an array of records, or as one record
+// per line. Missing values are written as null.
+func (d *Dataset) writeJSON(w io.Writer, lines bool) error {
+	bw := bufio.NewWriter(w)
+	if !lines {
+		bw.WriteByte('[')
+	}
+	names := make([][]byte, len(d.Columns))
+	for j, c := range d.Columns {
+		names[j], _ = json.Marshal(c.Name)
+	}
+	for i := 0; i < d.NumRows(); i++ {
+		if i > 0 && !lines {
+			bw.WriteByte(',')
+		}
+		bw.WriteByte('{')
+		for j, c := range d.Columns {
+			if j > 0 {
+				bw.WriteByte(',')
+			}
+			bw.Write(names[j])
+			bw.WriteByte(':')
+			switch {
+			case c.IsMissing(i) || c.Type == Numeric && math.IsInf(c.Numbers[i], 0):
+				bw.WriteString("null")
+			case c.Type == Numeric:
+				bw.WriteString(formatNumber(c.Numbers[i]))
+			default:
+				s, _ := json.Marshal(c.Strings[i])
+				bw.Write(s)
+			}
+		}
+		bw.WriteByte('}')
+		if lines {
+			bw.WriteByte('\n')
+		}
+	}
+	if !lines {
+		bw.WriteString("]\n")
+	}
+	return bw.Flush()
+}
@@ -0,0 +1,409 @@
+package dataset
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Groups are the rows of a dataset partitioned by the values of key
+// columns, ready to aggregate.
+type Groups struct {
+	Data *Dataset
+	Keys []string
+	rows [][]int // row indices of each group, groups ordered by key
+}
+
+// GroupBy partitions the rows of d by the values of the key columns.
+// Groups are ordered by key, ascending, with missing values last; a missing
+// key value forms a group of its own.
+func (d *Dataset) GroupBy(keys []string) (*Groups, error) {
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("group_by needs a column")
+	}
+	columns := make([]*Column, len(keys))
+	for j, name := range keys {
+		c, err := d.Column(name)
+		if err != nil {
+			return nil, err
+		}
+		columns[j] = c
+	}
+	index := make(map[string]int)
+	var rows [][]int
+	for i := 0; i < d.NumRows(); i++ {
+		k := rowKey(columns, i)
+		g, ok := index[k]
+		if !ok {
+			g = len(rows)
+			index[k] = g
+			rows = append(rows, nil)
+		}
+		rows[g] = append(rows[g], i)
+	}
+	sort.SliceStable(rows, func(a, b int) bool {
+		for _, c := range columns {
+			if cmp := compareRows(c, rows[a][0], rows[b][0], false); cmp != 0 {
+				return cmp < 0
+			}
+		}
+		return false
+	})
+	return &Groups{Data: d, Keys: keys, rows: rows}, nil
+}
+
+// rowKey renders the values of columns in row i as a single map key.
+func rowKey(columns []*Column, i int) string {
+	parts := make([]string, len(columns))
+	for j, c := range columns {
+		switch {
+		case c.IsMissing(i):
+			parts[j] = "\x01"
+		case c.Type == Numeric:
+			parts[j] = strconv.FormatFloat(c.Numbers[i], 'g', -1, 64)
+		default:
+			parts[j] = c.Strings[i]
+		}
+	}
+	return strings.Join(parts, "\x00")
+}
+
+// Len returns the number of groups.
+func (g *Groups) Len() int {
+	return len(g.rows)
+}
+
+// String describes the grouping, e.g. "groups by [bedrooms] (3 groups)".
+func (g *Groups) String() string {
+	return fmt.Sprintf("groups by [%s] (%d groups)", strings.Join(g.Keys, ", "), len(g.rows))
+}
+
+// Aggregation summarizes one column within each group. Func is one of
+// AggregateFuncs; count with no Column counts rows.
+type Aggregation struct {
+	Func   string
+	Column string
+}
+
+// AggregateFuncs lists the Func values Agg understands.
+var AggregateFuncs = []string{"count", "sum", "mean", "median", "min", "max", "std", "n_unique"}
+
+// Name returns the name of the column the aggregation produces, e.g.
+// "mean_price", or "count" for a row count.
+func (a Aggregation) Name() string {
+	if a.Column == "" {
+		return a.Func
+	}
+	return a.Func + "_" + a.Column
+}
+
+// Agg returns one row per group: the key values followed by one column per
+// aggregation. Missing values are skipped; a group with no values left
+// gets a missing mean, median, min, max or std and a sum of 0. std is the
+// sample standard deviation.
+func (g *Groups) Agg(aggs []Aggregation) (*Dataset, error) {
+	firsts := make([]int, len(g.rows))
+	for j, rows := range g.rows {
+		firsts[j] = rows[0]
+	}
+	keys, err := g.Data.Select(g.Keys)
+	if err != nil {
+		return nil, err
+	}
+	out := keys.Take(firsts)
+	out.Transforms = nil
+	for _, a := range aggs {
+		c, err := g.aggregate(a)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := out.Column(c.Name); err == nil {
+			return nil, fmt.Errorf("aggregation %s repeats column %q", a.Func, c.Name)
+		}
+		out.Columns = append(out.Columns, c)
+	}
+	return out, nil
+}
+
+func (g *Groups) aggregate(a Aggregation) (*Column, error) {
+	values := make([]float64, len(g.rows))
+	if a.Column == "" {
+		if a.Func != "count" {
+			return nil, fmt.Errorf("%s needs a column", a.Func)
+		}
+		for j, rows := range g.rows {
+			values[j] = float64(len(rows))
+		}
+		return NewNumeric(a.Name(), values), nil
+	}
+	c, err := g.Data.Column(a.Column)
+	if err != nil {
+		return nil, err
+	}
+
+	switch a.Func {
+	case "count", "n_unique":
+		for j, rows := range g.rows {
+			seen := make(map[string]bool)
+			for _, i := range rows {
+				if !c.IsMissing(i) {
+					seen[rowKey([]*Column{c}, i)] = true
+					values[j]++
+				}
+			}
+			if a.Func == "n_unique" {
+				values[j] = float64(len(seen))
+			}
+		}
+		return NewNumeric(a.Name(), values), nil
+	case "sum", "mean", "median", "min", "max", "std":
+	default:
+		return nil, fmt.Errorf("unknown aggregation %q (have %s)", a.Func, strings.Join(AggregateFuncs, ", "))
+	}
+	if c.Type != Numeric {
+		return nil, fmt.Errorf("%s needs a numeric column, %q is text", a.Func, c.Name)
+	}
+	for j, rows := range g.rows {
+		var present []float64
+		for _, i := range rows {
+			if !c.IsMissing(i) {
+				present = append(present, c.Numbers[i])
+			}
+		}
+		values[j] = summarize(a.Func, present)
+	}
+	return NewNumeric(a.Name(), values), nil
+}
+
+// summarize applies a numeric aggregation to values with none missing.
+func summarize(fn string, values []float64) float64 {
+	if len(values) == 0 {
+		if fn == "sum" {
+			return 0
+		}
+		return math.NaN()
+	}
+	sum := 0.0
+	for _, v := range values {
+		sum += v
+	}
+	mean := sum / float64(len(values))
+	switch fn {
+	case "sum":
+		return sum
+	case "mean":
+		return mean
+	case "median":
+		sorted := append([]float64(nil), values...)
+		sort.Float64s(sorted)
+		mid := len(sorted) / 2
+		if len(sorted)%2 == 1 {
+			return sorted[mid]
+		}
+		return (sorted[mid-1] + sorted[mid]) / 2
+	case "min", "max":
+		best := values[0]
+		for _, v := range values[1:] {
+			if (fn == "min" && v < best) || (fn == "max" && v > best) {
+				best = v
+			}
+		}
+		return best
+	}
+	// std
+	if len(values) < 2 {
+		return math.NaN()
+	}
+	ss := 0.0
+	for _, v := range values {
+		ss += (v - mean) * (v - mean)
+	}
+	return math.Sqrt(ss / float64(len(values)-1))
+}
+
+// JoinKinds lists the how values Join understands.
+var JoinKinds = []string{"inner", "left", "right", "outer"}
+
+// Join matches rows of d and other with equal values in the on columns,
+// using a hash table of other's rows. how is inner, left, right or outer;
+// rows without a match are kept by left, right and outer joins with
+// missing values for the other side. A missing key matches nothing.
+//
+// The result has the key columns once, then the other columns of d, then
+// those of other; a name both sides use gets the suffix _x on d's column
+// and _y on other's. Rows follow d, each with its matches in other's order,
+// except that a right join follows other, and an outer join puts other's
+// unmatched rows last.
+func (d *Dataset) Join(other *Dataset, on []string, how string) (*Dataset, error) {
+	switch how {
+	case "inner", "left", "right", "outer":
+	default:
+		return nil, fmt.Errorf("unknown join %q (have %s)", how, strings.Join(JoinKinds, ", "))
+	}
+	if len(on) == 0 {
+		return nil, fmt.Errorf("join needs a column")
+	}
+	if how == "right" {
+		out, err := other.Join(d, on, "left")
+		if err != nil {
+			return nil, err
+		}
+		return out.swapSides(d, other, on)
+	}
+
+	leftKeys, rightKeys := make([]*Column, len(on)), make([]*Column, len(on))
+	for j, name := range on {
+		l, err := d.Column(name)
+		if err != nil {
+			return nil, err
+		}
+		r, err := other.Column(name)
+		if err != nil {
+			return nil, err
+		}
+		if l.Type != r.Type {
+			return nil, fmt.Errorf("cannot join %s column %q with %s column", l.Type, name, r.Type)
+		}
+		leftKeys[j], rightKeys[j] = l, r
+	}
+
+	table := make(map[string][]int)
+	for i := 0; i < other.NumRows(); i++ {
+		if !anyMissing(rightKeys, i) {
+			k := rowKey(rightKeys, i)
+			table[k] = append(table[k], i)
+		}
+	}
+
+	var leftRows, rightRows []int // -1 marks no row
+	matched := make([]bool, other.NumRows())
+	for i := 0; i < d.NumRows(); i++ {
+		var matches []int
+		if !anyMissing(leftKeys, i) {
+			matches = table[rowKey(leftKeys, i)]
+		}
+		for _, r := range matches {
+			leftRows = append(leftRows, i)
+			rightRows = append(rightRows, r)
+			matched[r] = true
+		}
+		if len(matches) == 0 && how != "inner" {
+			leftRows = append(leftRows, i)
+			rightRows = append(rightRows, -1)
+		}
+	}
+	if how == "outer" {
+		for r, m := range matched {
+			if !m {
+				leftRows = append(leftRows, -1)
+				rightRows = append(rightRows, r)
+			}
+		}
+	}
+
+	isKey := make(map[string]bool)
+	for _, name := range on {
+		isKey[name] = true
+	}
+	out := &Dataset{}
+	for j := range on {
+		c := takeOrMissing(leftKeys[j], leftRows)
+		for i, r := range rightRows {
+			if leftRows[i] < 0 {
+				copyRow(c, i, rightKeys[j], r)
+			}
+		}
+		out.Columns = append(out.Columns, c)
+	}
+	for _, c := range d.Columns {
+		if !isKey[c.Name] {
+			nc := takeOrMissing(c, leftRows)
+			if _, err := other.Column(c.Name); err == nil {
+				nc.Name += "_x"
+			}
+			out.Columns = append(out.Columns, nc)
+		}
+	}
+	for _, c := range other.Columns {
+		if !isKey[c.Name] {
+			nc := takeOrMissing(c, rightRows)
+			if _, err := d.Column(c.Name); err == nil {
+				nc.Name += "_y"
+			}
+			out.Columns = append(out.Columns, nc)
+		}
+	}
+	return out, nil
+}
+
+// swapSides reorders the columns of other.Join(d, on, "left") to those of
+// d.Join(other, on, "right"), renaming the suffixes to match.
+func (out *Dataset) swapSides(d, other *Dataset, on []string) (*Dataset, error) {
+	names := append([]string(nil), on...)
+	isKey := make(map[string]bool)
+	for _, name := range on {
+		isKey[name] = true
+	}
+	rename := make(map[string]string)
+	for _, side := range []struct {
+		data, opposite *Dataset
+		from, to       string
+	}{{d, other, "_y", "_x"}, {other, d, "_x", "_y"}} {
+		for _, c := range side.data.Columns {
+			if isKey[c.Name] {
+				continue
+			}
+			name := c.Name
+			if _, err := side.opposite.Column(name); err == nil {
+				rename[name+side.from] = name + side.to
+				name += side.to
+			}
+			names = append(names, name)
+		}
+	}
+	for _, c := range out.Columns {
+		if to, ok := rename[c.Name]; ok {
+			c.Name = to
+		}
+	}
+	return out.Select(names)
+}
+
+func anyMissing(columns []*Column, i int) bool {
+	for _, c := range columns {
+		if c.IsMissing(i) {
+			return true
+		}
+	}
+	return false
+}
+
+// takeOrMissing is Take for one column, with -1 giving a missing value.
+func takeOrMissing(c *Column, rows []int) *Column {
+	nc := &Column{Name: c.Name, Type: c.Type}
+	if c.Type == Numeric {
+		nc.Numbers = make([]float64, len(rows))
+	} else {
+		nc.Strings = make([]string, len(rows))
+	}
+	for i, r := range rows {
+		if r < 0 {
+			if c.Type == Numeric {
+				nc.Numbers[i] = math.NaN()
+			}
+			continue
+		}
+		copyRow(nc, i, c, r)
+	}
+	return nc
+}
+
+func copyRow(dst *Column, i int, src *Column, r int) {
+	if dst.Type == Numeric {
+		dst.Numbers[i] = src.Numbers[r]
+	} else {
+		dst.Strings[i] = src.Strings[r]
+	}
+}
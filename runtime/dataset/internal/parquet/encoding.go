@@ -0,0 +1,183 @@
+package parquet
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+)
+
+var errData = errors.New("parquet: corrupt page")
+
+// readHybrid decodes n values of the RLE/bit-packing hybrid encoding used
+// for definition levels and dictionary indices.
+func readHybrid(data []byte, width uint, n int) ([]uint32, error) {
+	if width > 32 {
+		return nil, errData
+	}
+	out := make([]uint32, 0, n)
+	byteWidth := int(width+7) / 8
+	for len(out) < n {
+		header, k := binary.Uvarint(data)
+		if k <= 0 {
+			return nil, errData
+		}
+		data = data[k:]
+		if header&1 == 0 {
+			// A run of one value repeated header/2 times.
+			if len(data) < byteWidth {
+				return nil, errData
+			}
+			run := int(min(header>>1, uint64(n-len(out))))
+			var v uint32
+			for j := 0; j < byteWidth; j++ {
+				v |= uint32(data[j]) << (8 * j)
+			}
+			data = data[byteWidth:]
+			for j := 0; j < run; j++ {
+				out = append(out, v)
+			}
+			continue
+		}
+		// header/2 groups of 8 bit-packed values, least significant bit first.
+		groups := header >> 1
+		if groups > uint64(len(data)) {
+			return nil, errData
+		}
+		size := int(groups) * int(width)
+		if len(data) < size {
+			return nil, errData
+		}
+		for j := 0; j < int(groups)*8 && len(out) < n; j++ {
+			var v uint32
+			for b := uint(0); b < width; b++ {
+				bit := uint(j)*width + b
+				v |= uint32(data[bit/8]>>(bit%8)&1) << b
+			}
+			out = append(out, v)
+		}
+		data = data[size:]
+	}
+	return out, nil
+}
+
+// appendRuns encodes values with the hybrid encoding as runs only.
+func appendRuns(buf []byte, values []uint32, width uint) []byte {
+	byteWidth := int(width+7) / 8
+	for i := 0; i < len(values); {
+		j := i
+		for j < len(values) && values[j] == values[i] {
+			j++
+		}
+		buf = binary.AppendUvarint(buf, uint64(j-i)<<1)
+		for b := 0; b < byteWidth; b++ {
+			buf = append(buf, byte(values[i]>>(8*b)))
+		}
+		i = j
+	}
+	return buf
+}
+
+// values holds decoded column values: numbers for numeric physical types,
+// strings for byte arrays.
+type values struct {
+	numbers []float64
+	strings []string
+}
+
+func (v *values) len() int {
+	if v.strings != nil {
+		return len(v.strings)
+	}
+	return len(v.numbers)
+}
+
+// readPlain decodes n PLAIN-encoded values of a physical type.
+func readPlain(data []byte, kind int64, n int) (*values, error) {
+	v := &values{}
+	switch kind {
+	case typeBoolean:
+		if len(data)*8 < n {
+			return nil, errData
+		}
+		v.numbers = make([]float64, n)
+		for i := range v.numbers {
+			v.numbers[i] = float64(data[i/8] >> (i % 8) & 1)
+		}
+	case typeInt32, typeFloat:
+		if len(data) < 4*n {
+			return nil, errData
+		}
+		v.numbers = make([]float64, n)
+		for i := range v.numbers {
+			bits := binary.LittleEndian.Uint32(data[4*i:])
+			if kind == typeInt32 {
+				v.numbers[i] = float64(int32(bits))
+			} else {
+				v.numbers[i] = float64(math.Float32frombits(bits))
+			}
+		}
+	case typeInt64, typeDouble:
+		if len(data) < 8*n {
+			return nil, errData
+		}
+		v.numbers = make([]float64, n)
+		for i := range v.numbers {
+			bits := binary.LittleEndian.Uint64(data[8*i:])
+			if kind == typeInt64 {
+				v.numbers[i] = float64(int64(bits))
+			} else {
+				v.numbers[i] = math.Float64frombits(bits)
+			}
+		}
+	case typeByteArray:
+		v.strings = make([]string, n)
+		for i := range v.strings {
+			if len(data) < 4 {
+				return nil, errData
+			}
+			size := binary.LittleEndian.Uint32(data)
+			if uint64(size) > uint64(len(data)-4) {
+				return nil, errData
+			}
+			v.strings[i] = string(data[4 : 4+size])
+			data = data[4+size:]
+		}
+	default:
+		return nil, fmt.Errorf("parquet: unsupported physical type %d", kind)
+	}
+	return v, nil
+}
+
+// lookup decodes dictionary indices: a bit width byte, then the hybrid
+// encoding.
+func (dict *values) lookup(data []byte, n int) (*values, error) {
+	if dict == nil {
+		return nil, fmt.Errorf("parquet: dictionary page missing")
+	}
+	if len(data) < 1 {
+		return nil, errData
+	}
+	indices, err := readHybrid(data[1:], uint(data[0]), n)
+	if err != nil {
+		return nil, err
+	}
+	v := &values{}
+	size := dict.len()
+	if dict.strings != nil {
+		v.strings = make([]string, n)
+	} else {
+		v.numbers = make([]float64, n)
+	}
+	for i, index := range indices {
+		if int(index) >= size {
+			return nil, errData
+		}
+		if dict.strings != nil {
+			v.strings[i] = dict.strings[index]
+		} else {
+			v.numbers[i] = dict.numbers[index]
+		}
+	}
+	return v, nil
+}
@@ -0,0 +1,466 @@
+// Package parquet reads and writes flat Apache Parquet files. It reads the
+// files pyarrow, pandas and Spark write: PLAIN and dictionary encodings in
+// version 1 data pages, their default, or version 2 ones, uncompressed or
+// compressed with Snappy, gzip or zstd. It writes one row group of
+// gzip-compressed PLAIN pages with every column optional. Nested and
+// repeated columns are not supported.
+package parquet
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+
+	"github.com/klauspost/compress/snappy"
+	"github.com/klauspost/compress/zstd"
+)
+
+// Column is one column of a file. Numeric columns hold Numbers, with NaN
+// for nulls; text columns hold Strings, with "" for nulls.
+type Column struct {
+	Name    string
+	Text    bool
+	Numbers []float64
+	Strings []string
+}
+
+var magic = []byte("PAR1")
+
+// Physical types.
+const (
+	typeBoolean   = 0
+	typeInt32     = 1
+	typeInt64     = 2
+	typeInt96     = 3
+	typeFloat     = 4
+	typeDouble    = 5
+	typeByteArray = 6
+	typeFixed     = 7
+)
+
+// Codecs, encodings, page types and repetitions used here.
+const (
+	codecNone   = 0
+	codecSnappy = 1
+	codecGzip   = 2
+	codecZstd   = 6
+
+	encodingPlain         = 0
+	encodingPlainDict     = 2
+	encodingRLE           = 3
+	encodingRLEDictionary = 8
+
+	pageData       = 0
+	pageDictionary = 2
+	pageDataV2     = 3
+
+	repetitionOptional = 1
+	repetitionRepeated = 2
+	convertedUTF8      = 0
+	convertedDecimal   = 5
+
+	maxPageSize = 1 << 31
+	maxRows     = 1 << 26
+)
+
+// IsFile reports whether data starts like a Parquet file.
+func IsFile(data []byte) bool {
+	return bytes.HasPrefix(data, magic)
+}
+
+// Read decodes the columns of a Parquet file.
+func Read(data []byte) ([]Column, error) {
+	if len(data) < 12 || !bytes.HasPrefix(data, magic) || !bytes.HasSuffix(data, magic) {
+		return nil, fmt.Errorf("parquet: not a parquet file")
+	}
+	footer := int(binary.LittleEndian.Uint32(data[len(data)-8:]))
+	if footer > len(data)-12 {
+		return nil, errThrift
+	}
+	r := &thriftReader{data: data[len(data)-8-footer : len(data)-8]}
+	meta, err := r.readStruct(0)
+	if err != nil {
+		return nil, err
+	}
+
+	schema := meta.list(2)
+	if len(schema) < 1 {
+		return nil, errThrift
+	}
+	var leaves []thriftStructValue
+	for _, e := range schema[1:] {
+		element, _ := e.(thriftStructValue)
+		if element == nil {
+			return nil, errThrift
+		}
+		name := element.string(4)
+		if element.int(5) > 0 || element.int(3) == repetitionRepeated {
+			return nil, fmt.Errorf("parquet: column %q is nested or repeated, which is not supported", name)
+		}
+		switch element.int(1) {
+		case typeInt96, typeFixed:
+			return nil, fmt.Errorf("parquet: column %q has an unsupported type", name)
+		}
+		leaves = append(leaves, element)
+	}
+
+	rows := meta.int(3)
+	if rows < 0 || rows > maxRows {
+		return nil, errThrift
+	}
+	columns := make([]Column, len(leaves))
+	for j, leaf := range leaves {
+		columns[j] = Column{Name: leaf.string(4), Text: leaf.int(1) == typeByteArray}
+		if columns[j].Text {
+			columns[j].Strings = make([]string, 0, rows)
+		} else {
+			columns[j].Numbers = make([]float64, 0, rows)
+		}
+	}
+	for _, g := range meta.list(4) {
+		group, _ := g.(thriftStructValue)
+		chunks := group.list(1)
+		if len(chunks) != len(leaves) {
+			return nil, errThrift
+		}
+		for j, c := range chunks {
+			chunk, _ := c.(thriftStructValue)
+			if err := readChunk(data, chunk.structure(3), leaves[j], &columns[j]); err != nil {
+				return nil, fmt.Errorf("parquet: column %q: %w", columns[j].Name, err)
+			}
+		}
+	}
+	return columns, nil
+}
+
+// readChunk appends the values of one column chunk to c.
+func readChunk(file []byte, meta, leaf thriftStructValue, c *Column) error {
+	if meta == nil {
+		return errThrift
+	}
+	start := meta.int(9)
+	if dict := meta.int(11); meta.has(11) && dict > 0 && dict < start {
+		start = dict
+	}
+	size := meta.int(7)
+	if start < 4 || size < 0 || start+size > int64(len(file)) {
+		return errThrift
+	}
+	data := file[start : start+size]
+	codec := meta.int(4)
+	kind := leaf.int(1)
+	optional := leaf.int(3) == repetitionOptional
+	scale := 1.0
+	if leaf.int(6) == convertedDecimal && leaf.has(7) {
+		scale = math.Pow(10, float64(leaf.int(7)))
+	}
+
+	var dict *values
+	remaining := meta.int(5)
+	for remaining > 0 {
+		r := &thriftReader{data: data}
+		header, err := r.readStruct(0)
+		if err != nil {
+			return err
+		}
+		compressedSize, uncompressedSize := header.int(3), header.int(2)
+		if compressedSize < 0 || compressedSize > int64(len(data)-r.pos) || uncompressedSize < 0 || uncompressedSize > maxPageSize {
+			return errData
+		}
+		body := data[r.pos : r.pos+int(compressedSize)]
+		data = data[r.pos+int(compressedSize):]
+
+		switch header.int(1) {
+		case pageDictionary:
+			dh := header.structure(7)
+			if body, err = decompress(codec, body, uncompressedSize); err != nil {
+				return err
+			}
+			if dict, err = readPlain(body, kind, int(dh.int(1))); err != nil {
+				return err
+			}
+			continue
+		case pageData:
+			dh := header.structure(5)
+			if body, err = decompress(codec, body, uncompressedSize); err != nil {
+				return err
+			}
+			n := int(dh.int(1))
+			var defined []uint32
+			if optional {
+				if len(body) < 4 {
+					return errData
+				}
+				length := int(binary.LittleEndian.Uint32(body))
+				if length > len(body)-4 {
+					return errData
+				}
+				if defined, err = readHybrid(body[4:4+length], 1, n); err != nil {
+					return err
+				}
+				body = body[4+length:]
+			}
+			if err := appendValues(c, body, kind, int(dh.int(2)), n, defined, dict, scale); err != nil {
+				return err
+			}
+			remaining -= int64(n)
+		case pageDataV2:
+			dh := header.structure(8)
+			n := int(dh.int(1))
+			defLength, repLength := dh.int(5), dh.int(6)
+			if defLength < 0 || repLength < 0 || defLength+repLength > int64(len(body)) {
+				return errData
+			}
+			var defined []uint32
+			if optional {
+				if defined, err = readHybrid(body[repLength:repLength+defLength], 1, n); err != nil {
+					return err
+				}
+			}
+			body = body[repLength+defLength:]
+			if dh.bool(7, true) {
+				if body, err = decompress(codec, body, uncompressedSize-defLength-repLength); err != nil {
+					return err
+				}
+			}
+			if err := appendValues(c, body, kind, int(dh.int(4)), n, defined, dict, scale); err != nil {
+				return err
+			}
+			remaining -= int64(n)
+		default:
+			// Index pages and unknown pages carry no values.
+		}
+		if len(data) == 0 && remaining > 0 {
+			return errData
+		}
+	}
+	return nil
+}
+
+// appendValues decodes the values of a data page and appends them to c,
+// with nulls where defined is 0.
+func appendValues(c *Column, body []byte, kind int64, encoding, n int, defined []uint32, dict *values, scale float64) error {
+	present := n
+	if defined != nil {
+		present = 0
+		for _, d := range defined {
+			present += int(d)
+		}
+	}
+	var v *values
+	var err error
+	switch {
+	case encoding == encodingPlain:
+		v, err = readPlain(body, kind, present)
+	case encoding == encodingPlainDict, encoding == encodingRLEDictionary:
+		v, err = dict.lookup(body, present)
+	case encoding == encodingRLE && kind == typeBoolean:
+		var bits []uint32
+		if len(body) < 4 {
+			return errData
+		}
+		if bits, err = readHybrid(body[4:], 1, present); err == nil {
+			v = &values{numbers: make([]float64, present)}
+			for i, b := range bits {
+				v.numbers[i] = float64(b)
+			}
+		}
+	default:
+		return fmt.Errorf("unsupported encoding %d", encoding)
+	}
+	if err != nil {
+		return err
+	}
+
+	next := 0
+	for i := 0; i < n; i++ {
+		isNull := defined != nil && defined[i] == 0
+		switch {
+		case c.Text && isNull:
+			c.Strings = append(c.Strings, "")
+		case c.Text:
+			c.Strings = append(c.Strings, v.strings[next])
+		case isNull:
+			c.Numbers = append(c.Numbers, math.NaN())
+		case kind == typeInt32 || kind == typeInt64:
+			c.Numbers = append(c.Numbers, v.numbers[next]/scale)
+		default:
+			c.Numbers = append(c.Numbers, v.numbers[next])
+		}
+		if !isNull {
+			next++
+		}
+	}
+	return nil
+}
+
+// zstdDecoder decodes zstd pages whole. DecodeAll is safe for concurrent
+// use, so one decoder serves every file.
+var zstdDecoder, _ = zstd.NewReader(nil)
+
+func decompress(codec int64, data []byte, size int64) ([]byte, error) {
+	var out []byte
+	var err error
+	switch codec {
+	case codecNone:
+		return data, nil
+	case codecSnappy:
+		out, err = snappy.Decode(nil, data)
+	case codecGzip:
+		var r *gzip.Reader
+		if r, err = gzip.NewReader(bytes.NewReader(data)); err == nil {
+			out, err = io.ReadAll(io.LimitReader(r, size+1))
+		}
+	case codecZstd:
+		out, err = zstdDecoder.DecodeAll(data, nil)
+	default:
+		return nil, fmt.Errorf("unsupported compression codec %d", codec)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(out)) != size {
+		return nil, errData
+	}
+	return out, nil
+}
+
+// Write encodes columns, which must have equal lengths, as a Parquet file.
+func Write(w io.Writer, columns []Column) error {
+	rows := 0
+	if len(columns) > 0 {
+		rows = max(len(columns[0].Numbers), len(columns[0].Strings))
+	}
+	file := append([]byte(nil), magic...)
+	type written struct {
+		offset, compressed, uncompressed int64
+	}
+	chunks := make([]written, len(columns))
+	for j, c := range columns {
+		page, err := encodePage(c, rows)
+		if err != nil {
+			return err
+		}
+		var compressed bytes.Buffer
+		zw := gzip.NewWriter(&compressed)
+		zw.Write(page)
+		if err := zw.Close(); err != nil {
+			return err
+		}
+
+		h := &thriftWriter{}
+		h.beginStruct(0)
+		h.i32(1, pageData)
+		h.i32(2, int32(len(page)))
+		h.i32(3, int32(compressed.Len()))
+		h.beginStruct(5)
+		h.i32(1, int32(rows))
+		h.i32(2, encodingPlain)
+		h.i32(3, encodingRLE)
+		h.i32(4, encodingRLE)
+		h.endStruct()
+		h.endStruct()
+
+		chunks[j] = written{
+			offset:       int64(len(file)),
+			compressed:   int64(len(h.buf) + compressed.Len()),
+			uncompressed: int64(len(h.buf) + len(page)),
+		}
+		file = append(file, h.buf...)
+		file = append(file, compressed.Bytes()...)
+	}
+
+	m := &thriftWriter{}
+	m.beginStruct(0)
+	m.i32(1, 1)
+	m.list(2, thriftStruct, len(columns)+1)
+	m.beginListElement()
+	m.binary(4, "schema")
+	m.i32(5, int32(len(columns)))
+	m.endStruct()
+	for _, c := range columns {
+		m.beginListElement()
+		if c.Text {
+			m.i32(1, typeByteArray)
+		} else {
+			m.i32(1, typeDouble)
+		}
+		m.i32(3, repetitionOptional)
+		m.binary(4, c.Name)
+		if c.Text {
+			m.i32(6, convertedUTF8)
+			m.beginStruct(10)
+			m.beginStruct(1) // StringType
+			m.endStruct()
+			m.endStruct()
+		}
+		m.endStruct()
+	}
+	m.i64(3, int64(rows))
+	m.list(4, thriftStruct, 1)
+	m.beginListElement()
+	m.list(1, thriftStruct, len(columns))
+	total := int64(0)
+	for j, c := range columns {
+		m.beginListElement()
+		m.i64(2, chunks[j].offset)
+		m.beginStruct(3)
+		if c.Text {
+			m.i32(1, typeByteArray)
+		} else {
+			m.i32(1, typeDouble)
+		}
+		m.list(2, thriftI32, 2)
+		m.listI32(encodingPlain)
+		m.listI32(encodingRLE)
+		m.list(3, thriftBinary, 1)
+		m.listBinary(c.Name)
+		m.i32(4, codecGzip)
+		m.i64(5, int64(rows))
+		m.i64(6, chunks[j].uncompressed)
+		m.i64(7, chunks[j].compressed)
+		m.i64(9, chunks[j].offset)
+		m.endStruct()
+		m.endStruct()
+		total += chunks[j].uncompressed
+	}
+	m.i64(2, total)
+	m.i64(3, int64(rows))
+	m.endStruct()
+	m.binary(6, "mlite")
+	m.endStruct()
+
+	file = append(file, m.buf...)
+	file = binary.LittleEndian.AppendUint32(file, uint32(len(m.buf)))
+	file = append(file, magic...)
+	_, err := w.Write(file)
+	return err
+}
+
+// encodePage encodes a column's definition levels and PLAIN values.
+func encodePage(c Column, rows int) ([]byte, error) {
+	if max(len(c.Numbers), len(c.Strings)) != rows {
+		return nil, fmt.Errorf("parquet: column %q has %d rows, expected %d", c.Name, max(len(c.Numbers), len(c.Strings)), rows)
+	}
+	levels := make([]uint32, rows)
+	var values []byte
+	for i := range levels {
+		if c.Text {
+			if s := c.Strings[i]; s != "" {
+				levels[i] = 1
+				values = binary.LittleEndian.AppendUint32(values, uint32(len(s)))
+				values = append(values, s...)
+			}
+		} else if v := c.Numbers[i]; !math.IsNaN(v) {
+			levels[i] = 1
+			values = binary.LittleEndian.AppendUint64(values, math.Float64bits(v))
+		}
+	}
+	encoded := appendRuns(nil, levels, 1)
+	page := binary.LittleEndian.AppendUint32(nil, uint32(len(encoded)))
+	page = append(page, encoded...)
+	return append(page, values...), nil
+}
@@ -0,0 +1,206 @@
+package parquet
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/klauspost/compress/snappy"
+	"github.com/klauspost/compress/zstd"
+)
+
+// Checks that written files read back with their names, types and nulls.
+func TestWriteReadRoundTrip(t *testing.T) {
+	columns := []Column{
+		{Name: "price", Numbers: []float64{180000, math.NaN(), 270000.5}},
+		{Name: "city", Text: true, Strings: []string{"austin", "", "dallas"}},
+	}
+	var buf bytes.Buffer
+	if err := Write(&buf, columns); err != nil {
+		t.Fatal(err)
+	}
+	if !IsFile(buf.Bytes()) {
+		t.Fatal("written file does not start with the Parquet magic")
+	}
+	got, err := Read(buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || got[0].Name != "price" || got[0].Text || !got[1].Text {
+		t.Fatalf("got columns %+v", got)
+	}
+	if got[0].Numbers[0] != 180000 || !math.IsNaN(got[0].Numbers[1]) || got[0].Numbers[2] != 270000.5 {
+		t.Errorf("price: got %v", got[0].Numbers)
+	}
+	if !reflect.DeepEqual(got[1].Strings, columns[1].Strings) {
+		t.Errorf("city: got %q", got[1].Strings)
+	}
+}
+
+// Checks that a dictionary page followed by a data page decodes, for the
+// version 1 Snappy pages pyarrow writes by default (data_page_version
+// "1.0") and for version 2 and zstd pages.
+func TestReadDictionaryPage(t *testing.T) {
+	zstdEncoder, _ := zstd.NewWriter(nil)
+	defer zstdEncoder.Close()
+	snappyBlock := func(b []byte) []byte { return snappy.Encode(nil, b) }
+	zstdFrame := func(b []byte) []byte { return zstdEncoder.EncodeAll(b, nil) }
+	for _, c := range []struct {
+		name     string
+		version  int32
+		codec    int32
+		compress func([]byte) []byte
+	}{
+		{"v1 snappy", pageData, codecSnappy, snappyBlock},
+		{"v2 snappy", pageDataV2, codecSnappy, snappyBlock},
+		{"v1 zstd", pageData, codecZstd, zstdFrame},
+	} {
+		got, err := Read(dictionaryFile(c.version, c.codec, c.compress))
+		if err != nil {
+			t.Errorf("%s: %v", c.name, err)
+			continue
+		}
+		want := []string{"dallas", "austin", "", "dallas", "dallas"}
+		if len(got) != 1 || !reflect.DeepEqual(got[0].Strings, want) {
+			t.Errorf("%s: got %+v, want city %q", c.name, got, want)
+		}
+	}
+}
+
+// Checks that a file written by another implementation decodes. The
+// fixture is examples/flat.parquet.snappy of github.com/xitongsys/parquet-go-source
+// (Apache-2.0), written by xitongsys/parquet-go's memfs_write.go example:
+// Snappy-compressed version 1 data pages, required columns, and a
+// dictionary-encoded name column.
+func TestReadParquetGoFile(t *testing.T) {
+	data, err := os.ReadFile("testdata/parquet-go-flat.parquet")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := Read(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, c := range got {
+		names = append(names, c.Name)
+	}
+	if want := []string{"name", "age", "id", "weight", "sex", "day"}; !reflect.DeepEqual(names, want) {
+		t.Fatalf("got columns %q, want %q", names, want)
+	}
+	// The example writes row i as age 20 + i%5, id i, weight
+	// float32(50 + 0.1i), sex i%2 == 0 and the same day for every row.
+	for i := 0; i < 10; i++ {
+		row := []float64{got[1].Numbers[i], got[2].Numbers[i], got[3].Numbers[i], got[4].Numbers[i], got[5].Numbers[i]}
+		want := []float64{float64(20 + i%5), float64(i), float64(float32(50.0 + float32(i)*0.1)), 0, 18040}
+		if i%2 == 0 {
+			want[3] = 1
+		}
+		if got[0].Strings[i] != "StudentName" || !reflect.DeepEqual(row, want) {
+			t.Errorf("row %d: got %q %v, want \"StudentName\" %v", i, got[0].Strings[i], row, want)
+		}
+	}
+	if !got[0].Text || got[1].Text {
+		t.Errorf("name should be text and age numeric, got %+v", got[:2])
+	}
+}
+
+// dictionaryFile is a file with one optional text column, city, written as
+// a dictionary page and a data page of the given type and codec. The
+// dictionary holds "austin" and "dallas"; five rows index it as 1, 0,
+// null, 1, 1.
+func dictionaryFile(pageType, codec int32, compress func([]byte) []byte) []byte {
+	var dict []byte
+	for _, s := range []string{"austin", "dallas"} {
+		dict = binary.LittleEndian.AppendUint32(dict, uint32(len(s)))
+		dict = append(dict, s...)
+	}
+	levels := appendRuns(nil, []uint32{1, 1, 0, 1, 1}, 1)
+	indices := append([]byte{1}, appendRuns(nil, []uint32{1, 0, 1, 1}, 1)...)
+
+	file := append([]byte(nil), magic...)
+	start := int64(len(file))
+	h := &thriftWriter{}
+	h.beginStruct(0)
+	h.i32(1, pageDictionary)
+	h.i32(2, int32(len(dict)))
+	h.i32(3, int32(len(compress(dict))))
+	h.beginStruct(7)
+	h.i32(1, 2)
+	h.i32(2, encodingPlain)
+	h.endStruct()
+	h.endStruct()
+	file = append(append(file, h.buf...), compress(dict)...)
+
+	dataOffset := int64(len(file))
+	h = &thriftWriter{}
+	h.beginStruct(0)
+	h.i32(1, pageType)
+	var body []byte
+	if pageType == pageDataV2 {
+		// Levels stay uncompressed ahead of the compressed values.
+		body = append(append([]byte(nil), levels...), compress(indices)...)
+		h.i32(2, int32(len(levels)+len(indices)))
+		h.i32(3, int32(len(body)))
+		h.beginStruct(8)
+		h.i32(1, 5)
+		h.i32(2, 1)
+		h.i32(3, 5)
+		h.i32(4, encodingRLEDictionary)
+		h.i32(5, int32(len(levels)))
+		h.i32(6, 0)
+		h.endStruct()
+	} else {
+		// Length-prefixed levels and the values are compressed together.
+		raw := binary.LittleEndian.AppendUint32(nil, uint32(len(levels)))
+		raw = append(append(raw, levels...), indices...)
+		body = compress(raw)
+		h.i32(2, int32(len(raw)))
+		h.i32(3, int32(len(body)))
+		h.beginStruct(5)
+		h.i32(1, 5)
+		h.i32(2, encodingRLEDictionary)
+		h.i32(3, encodingRLE)
+		h.i32(4, encodingRLE)
+		h.endStruct()
+	}
+	h.endStruct()
+	file = append(append(file, h.buf...), body...)
+
+	m := &thriftWriter{}
+	m.beginStruct(0)
+	m.i32(1, 1)
+	m.list(2, thriftStruct, 2)
+	m.beginListElement()
+	m.binary(4, "schema")
+	m.i32(5, 1)
+	m.endStruct()
+	m.beginListElement()
+	m.i32(1, typeByteArray)
+	m.i32(3, repetitionOptional)
+	m.binary(4, "city")
+	m.endStruct()
+	m.i64(3, 5)
+	m.list(4, thriftStruct, 1)
+	m.beginListElement()
+	m.list(1, thriftStruct, 1)
+	m.beginListElement()
+	m.beginStruct(3)
+	m.i32(1, typeByteArray)
+	m.i32(4, codec)
+	m.i64(5, 5)
+	m.i64(7, int64(len(file))-start)
+	m.i64(9, dataOffset)
+	m.i64(11, start)
+	m.endStruct()
+	m.endStruct()
+	m.i64(3, 5)
+	m.endStruct()
+	m.endStruct()
+	file = append(file, m.buf...)
+	file = binary.LittleEndian.AppendUint32(file, uint32(len(m.buf)))
+	return append(file, magic...)
+}
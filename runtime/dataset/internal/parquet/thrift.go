@@ -0,0 +1,283 @@
+package parquet
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+)
+
+// Parquet metadata is serialized with Thrift's compact protocol. The
+// reader decodes it generically: a struct becomes a map from field id to
+// value, a list a []interface{}, integers int64, binary []byte.
+
+const (
+	thriftStop   = 0
+	thriftTrue   = 1
+	thriftFalse  = 2
+	thriftByte   = 3
+	thriftI16    = 4
+	thriftI32    = 5
+	thriftI64    = 6
+	thriftDouble = 7
+	thriftBinary = 8
+	thriftList   = 9
+	thriftSet    = 10
+	thriftMap    = 11
+	thriftStruct = 12
+
+	maxThriftDepth = 64
+)
+
+var errThrift = errors.New("parquet: corrupt metadata")
+
+type thriftStructValue map[int16]interface{}
+
+type thriftReader struct {
+	data []byte
+	pos  int
+}
+
+func (r *thriftReader) byte() (byte, error) {
+	if r.pos >= len(r.data) {
+		return 0, errThrift
+	}
+	b := r.data[r.pos]
+	r.pos++
+	return b, nil
+}
+
+func (r *thriftReader) varint() (uint64, error) {
+	v, n := binary.Uvarint(r.data[r.pos:])
+	if n <= 0 {
+		return 0, errThrift
+	}
+	r.pos += n
+	return v, nil
+}
+
+func (r *thriftReader) zigzag() (int64, error) {
+	v, err := r.varint()
+	return int64(v>>1) ^ -int64(v&1), err
+}
+
+// readStruct reads the fields of a struct up to its stop marker.
+func (r *thriftReader) readStruct(depth int) (thriftStructValue, error) {
+	if depth > maxThriftDepth {
+		return nil, errThrift
+	}
+	s := thriftStructValue{}
+	var id int16
+	for {
+		header, err := r.byte()
+		if err != nil {
+			return nil, err
+		}
+		kind := header & 0x0F
+		if kind == thriftStop {
+			return s, nil
+		}
+		if delta := header >> 4; delta != 0 {
+			id += int16(delta)
+		} else {
+			v, err := r.zigzag()
+			if err != nil {
+				return nil, err
+			}
+			id = int16(v)
+		}
+		if kind == thriftTrue || kind == thriftFalse {
+			s[id] = kind == thriftTrue
+			continue
+		}
+		if s[id], err = r.readValue(kind, depth); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (r *thriftReader) readValue(kind byte, depth int) (interface{}, error) {
+	switch kind {
+	case thriftTrue, thriftFalse:
+		// Booleans inside lists are a byte each.
+		b, err := r.byte()
+		return b == thriftTrue, err
+	case thriftByte:
+		b, err := r.byte()
+		return int64(int8(b)), err
+	case thriftI16, thriftI32, thriftI64:
+		return r.zigzag()
+	case thriftDouble:
+		if r.pos+8 > len(r.data) {
+			return nil, errThrift
+		}
+		v := math.Float64frombits(binary.LittleEndian.Uint64(r.data[r.pos:]))
+		r.pos += 8
+		return v, nil
+	case thriftBinary:
+		n, err := r.varint()
+		if err != nil || n > uint64(len(r.data)-r.pos) {
+			return nil, errThrift
+		}
+		b := r.data[r.pos : r.pos+int(n)]
+		r.pos += int(n)
+		return b, nil
+	case thriftList, thriftSet:
+		header, err := r.byte()
+		if err != nil {
+			return nil, err
+		}
+		size := uint64(header >> 4)
+		if size == 15 {
+			if size, err = r.varint(); err != nil {
+				return nil, err
+			}
+		}
+		if size > uint64(len(r.data)-r.pos) {
+			return nil, errThrift
+		}
+		list := make([]interface{}, size)
+		for j := range list {
+			if list[j], err = r.readValue(header&0x0F, depth+1); err != nil {
+				return nil, err
+			}
+		}
+		return list, nil
+	case thriftMap:
+		size, err := r.varint()
+		if err != nil || size > uint64(len(r.data)-r.pos) {
+			return nil, errThrift
+		}
+		if size == 0 {
+			return nil, nil
+		}
+		types, err := r.byte()
+		if err != nil {
+			return nil, err
+		}
+		for j := uint64(0); j < size; j++ {
+			if _, err := r.readValue(types>>4, depth+1); err != nil {
+				return nil, err
+			}
+			if _, err := r.readValue(types&0x0F, depth+1); err != nil {
+				return nil, err
+			}
+		}
+		return nil, nil // no map Parquet defines is needed here
+	case thriftStruct:
+		return r.readStruct(depth + 1)
+	}
+	return nil, errThrift
+}
+
+func (s thriftStructValue) int(id int16) int64 {
+	v, _ := s[id].(int64)
+	return v
+}
+
+func (s thriftStructValue) has(id int16) bool {
+	_, ok := s[id]
+	return ok
+}
+
+func (s thriftStructValue) string(id int16) string {
+	v, _ := s[id].([]byte)
+	return string(v)
+}
+
+func (s thriftStructValue) bool(id int16, def bool) bool {
+	if v, ok := s[id].(bool); ok {
+		return v
+	}
+	return def
+}
+
+func (s thriftStructValue) structure(id int16) thriftStructValue {
+	v, _ := s[id].(thriftStructValue)
+	return v
+}
+
+func (s thriftStructValue) list(id int16) []interface{} {
+	v, _ := s[id].([]interface{})
+	return v
+}
+
+// thriftWriter writes the compact protocol. Fields must be written in
+// increasing id order within a struct.
+type thriftWriter struct {
+	buf  []byte
+	last []int16 // last field id of each open struct
+}
+
+func (w *thriftWriter) field(id int16, kind byte) {
+	last := &w.last[len(w.last)-1]
+	if delta := id - *last; delta > 0 && delta <= 15 {
+		w.buf = append(w.buf, byte(delta)<<4|kind)
+	} else {
+		w.buf = append(w.buf, kind)
+		w.buf = binary.AppendUvarint(w.buf, uint64(uint16(id<<1^id>>15)))
+	}
+	*last = id
+}
+
+func (w *thriftWriter) i32(id int16, v int32) {
+	w.field(id, thriftI32)
+	w.buf = binary.AppendUvarint(w.buf, uint64(uint32(v<<1^v>>31)))
+}
+
+func (w *thriftWriter) i64(id int16, v int64) {
+	w.field(id, thriftI64)
+	w.buf = binary.AppendUvarint(w.buf, uint64(v<<1^v>>63))
+}
+
+func (w *thriftWriter) binary(id int16, v string) {
+	w.field(id, thriftBinary)
+	w.buf = binary.AppendUvarint(w.buf, uint64(len(v)))
+	w.buf = append(w.buf, v...)
+}
+
+func (w *thriftWriter) bool(id int16, v bool) {
+	kind := byte(thriftFalse)
+	if v {
+		kind = thriftTrue
+	}
+	w.field(id, kind)
+}
+
+// beginStruct opens a struct field, or the top-level struct when id is 0
+// and nothing is open.
+func (w *thriftWriter) beginStruct(id int16) {
+	if len(w.last) > 0 {
+		w.field(id, thriftStruct)
+	}
+	w.last = append(w.last, 0)
+}
+
+// beginListElement opens a struct that is an element of a list.
+func (w *thriftWriter) beginListElement() {
+	w.last = append(w.last, 0)
+}
+
+func (w *thriftWriter) endStruct() {
+	w.buf = append(w.buf, thriftStop)
+	w.last = w.last[:len(w.last)-1]
+}
+
+// list writes a list field header for n elements of kind.
+func (w *thriftWriter) list(id int16, kind byte, n int) {
+	w.field(id, thriftList)
+	if n < 15 {
+		w.buf = append(w.buf, byte(n)<<4|kind)
+		return
+	}
+	w.buf = append(w.buf, 0xF0|kind)
+	w.buf = binary.AppendUvarint(w.buf, uint64(n))
+}
+
+func (w *thriftWriter) listI32(v int32) {
+	w.buf = binary.AppendUvarint(w.buf, uint64(uint32(v<<1^v>>31)))
+}
+
+func (w *thriftWriter) listBinary(v string) {
+	w.buf = binary.AppendUvarint(w.buf, uint64(len(v)))
+	w.buf = append(w.buf, v...)
+}
@@ -0,0 +1,580 @@
+package dataset
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+)
+
+// Transform is a fitted preprocessing step. It is fitted once, on training
+// data, and then rewrites any dataset the same way, so a model sees test and
+// scoring data exactly as it saw its training data.
+//
+// A step only touches the columns it names that the dataset has; a step
+// whose columns are all absent leaves the dataset unchanged. That lets a
+// step chain be replayed on data that already went through part of it.
+type Transform interface {
+	// Apply returns a transformed copy of d. Unchanged columns are shared.
+	Apply(d *Dataset) (*Dataset, error)
+	// String describes the step, e.g. "standardize(sqft, age)".
+	String() string
+}
+
+// Apply applies steps to d in order and records them in the result's
+// Transforms, after those d already carries.
+func (d *Dataset) Apply(steps ...Transform) (*Dataset, error) {
+	out := d
+	for _, step := range steps {
+		next, err := step.Apply(out)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", step, err)
+		}
+		next.Transforms = append(append([]Transform(nil), out.Transforms...), step)
+		out = next
+	}
+	return out, nil
+}
+
+// Replay applies the steps of chain that d has not been through yet: those
+// after the longest prefix of chain that d's own Transforms share.
+func (d *Dataset) Replay(chain []Transform) (*Dataset, error) {
+	done := 0
+	for done < len(chain) && done < len(d.Transforms) && chain[done] == d.Transforms[done] {
+		done++
+	}
+	return d.Apply(chain[done:]...)
+}
+
+// copyColumns returns a dataset sharing d's columns in a new slice, ready
+// for SetColumn without touching d.
+func (d *Dataset) copyColumns() *Dataset {
+	return &Dataset{Columns: append([]*Column(nil), d.Columns...)}
+}
+
+// numericColumn returns column name of d if it exists, rejecting text columns.
+func numericColumn(d *Dataset, name string) (*Column, bool, error) {
+	c, err := d.Column(name)
+	if err != nil {
+		return nil, false, nil
+	}
+	if c.Type != Numeric {
+		return nil, false, fmt.Errorf("column %q is not numeric", name)
+	}
+	return c, true, nil
+}
+
+// mapNumbers applies fn to every non-missing value of the named columns,
+// skipping columns d does not have.
+func mapNumbers(d *Dataset, names []string, fn func(j int, v float64) float64) (*Dataset, error) {
+	out := d.copyColumns()
+	for j, name := range names {
+		c, ok, err := numericColumn(d, name)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			continue
+		}
+		values := make([]float64, len(c.Numbers))
+		for i, v := range c.Numbers {
+			values[i] = v
+			if !math.IsNaN(v) {
+				values[i] = fn(j, v)
+			}
+		}
+		out.SetColumn(NewNumeric(name, values))
+	}
+	return out, nil
+}
+
+// present returns the non-missing values of a numeric column.
+func present(c *Column) []float64 {
+	var out []float64
+	for _, v := range c.Numbers {
+		if !math.IsNaN(v) {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+// fitColumns looks up the named numeric columns for fitting, which must all
+// exist and hold at least one value.
+func fitColumns(d *Dataset, names []string) ([][]float64, error) {
+	if len(names) == 0 {
+		return nil, fmt.Errorf("no columns given")
+	}
+	out := make([][]float64, len(names))
+	for j, name := range names {
+		values, err := d.Numbers(name)
+		if err != nil {
+			return nil, err
+		}
+		out[j] = present(NewNumeric(name, values))
+		if len(out[j]) == 0 {
+			return nil, fmt.Errorf("column %q has no values", name)
+		}
+	}
+	return out, nil
+}
+
+// Standardize rescales columns to zero mean and unit variance.
+type Standardize struct {
+	Columns []string
+	Mean    []float64
+	Scale   []float64 // population standard deviation; 1 for constant columns
+}
+
+// FitStandardize learns the mean and standard deviation of each column,
+// ignoring missing values.
+func FitStandardize(d *Dataset, columns []string) (*Standardize, error) {
+	values, err := fitColumns(d, columns)
+	if err != nil {
+		return nil, err
+	}
+	s := &Standardize{Columns: columns, Mean: make([]float64, len(columns)), Scale: make([]float64, len(columns))}
+	for j, vs := range values {
+		for _, v := range vs {
+			s.Mean[j] += v / float64(len(vs))
+		}
+		for _, v := range vs {
+			s.Scale[j] += (v - s.Mean[j]) * (v - s.Mean[j]) / float64(len(vs))
+		}
+		s.Scale[j] = math.Sqrt(s.Scale[j])
+		if s.Scale[j] == 0 {
+			s.Scale[j] = 1
+		}
+	}
+	return s, nil
+}
+
+func (s *Standardize) Apply(d *Dataset) (*Dataset, error) {
+	return mapNumbers(d, s.Columns, func(j int, v float64) float64 { return (v - s.Mean[j]) / s.Scale[j] })
+}
+
+func (s *Standardize) String() string {
+	return "standardize(" + strings.Join(s.Columns, ", ") + ")"
+}
+
+// MinMaxScale maps each column's training range onto [Low, High].
+type MinMaxScale struct {
+	Columns   []string
+	Min       []float64
+	Max       []float64
+	Low, High float64
+}
+
+// FitMinMaxScale learns the range of each column, ignoring missing values.
+func FitMinMaxScale(d *Dataset, columns []string, low, high float64) (*MinMaxScale, error) {
+	if low >= high {
+		return nil, fmt.Errorf("the target range [%v, %v] is empty", low, high)
+	}
+	values, err := fitColumns(d, columns)
+	if err != nil {
+		return nil, err
+	}
+	s := &MinMaxScale{Columns: columns, Min: make([]float64, len(columns)), Max: make([]float64, len(columns)), Low: low, High: high}
+	for j, vs := range values {
+		s.Min[j], s.Max[j] = vs[0], vs[0]
+		for _, v := range vs {
+			s.Min[j] = math.Min(s.Min[j], v)
+			s.Max[j] = math.Max(s.Max[j], v)
+		}
+	}
+	return s, nil
+}
+
+func (s *MinMaxScale) Apply(d *Dataset) (*Dataset, error) {
+	return mapNumbers(d, s.Columns, func(j int, v float64) float64 {
+		span := s.Max[j] - s.Min[j]
+		if span == 0 {
+			span = 1 // a constant column maps to Low, as in scikit-learn
+		}
+		return s.Low + (v-s.Min[j])/span*(s.High-s.Low)
+	})
+}
+
+func (s *MinMaxScale) String() string {
+	return "minmax_scale(" + strings.Join(s.Columns, ", ") + ")"
+}
+
+// Clip bounds column values to [Lower, Upper]; a nil bound is open.
+type Clip struct {
+	Columns      []string
+	Lower, Upper *float64
+}
+
+func (c *Clip) Apply(d *Dataset) (*Dataset, error) {
+	return mapNumbers(d, c.Columns, func(_ int, v float64) float64 {
+		if c.Lower != nil {
+			v = math.Max(*c.Lower, v)
+		}
+		if c.Upper != nil {
+			v = math.Min(*c.Upper, v)
+		}
+		return v
+	})
+}
+
+func (c *Clip) String() string {
+	return "clip(" + strings.Join(c.Columns, ", ") + ")"
+}
+
+// categories returns the distinct non-missing values of c as rendered by
+// Format, in ascending order of value.
+func categories(c *Column) []string {
+	seen := map[string]bool{}
+	var rows []int
+	for i := 0; i < c.Len(); i++ {
+		if v := c.Format(i); !c.IsMissing(i) && !seen[v] {
+			seen[v] = true
+			rows = append(rows, i)
+		}
+	}
+	sort.Slice(rows, func(a, b int) bool {
+		if c.Type == Numeric {
+			return c.Numbers[rows[a]] < c.Numbers[rows[b]]
+		}
+		return c.Strings[rows[a]] < c.Strings[rows[b]]
+	})
+	out := make([]string, len(rows))
+	for k, i := range rows {
+		out[k] = c.Format(i)
+	}
+	return out
+}
+
+// OneHot replaces a column with one 0/1 indicator column per category,
+// named column_category. Missing and unseen values get all zeros.
+type OneHot struct {
+	Column     string
+	Categories []string
+}
+
+// FitOneHot learns the categories of a text or numeric column.
+func FitOneHot(d *Dataset, column string) (*OneHot, error) {
+	c, err := d.Column(column)
+	if err != nil {
+		return nil, err
+	}
+	cats := categories(c)
+	if len(cats) == 0 {
+		return nil, fmt.Errorf("column %q has no values", column)
+	}
+	return &OneHot{Column: column, Categories: cats}, nil
+}
+
+// Names returns the indicator column names.
+func (o *OneHot) Names() []string {
+	names := make([]string, len(o.Categories))
+	for k, cat := range o.Categories {
+		names[k] = o.Column + "_" + cat
+	}
+	return names
+}
+
+func (o *OneHot) Apply(d *Dataset) (*Dataset, error) {
+	c, err := d.Column(o.Column)
+	if err != nil {
+		return d, nil
+	}
+	index := map[string]int{}
+	for k, cat := range o.Categories {
+		index[cat] = k
+	}
+	indicators := make([]*Column, len(o.Categories))
+	for k, name := range o.Names() {
+		indicators[k] = NewNumeric(name, make([]float64, c.Len()))
+	}
+	for i := 0; i < c.Len(); i++ {
+		if k, ok := index[c.Format(i)]; ok && !c.IsMissing(i) {
+			indicators[k].Numbers[i] = 1
+		}
+	}
+
+	// The indicators take the original column's place.
+	out := &Dataset{}
+	for _, existing := range d.Columns {
+		if existing.Name != o.Column {
+			out.Columns = append(out.Columns, existing)
+			continue
+		}
+		for _, ind := range indicators {
+			if _, clash := d.Column(ind.Name); clash == nil {
+				return nil, fmt.Errorf("indicator column %q already exists", ind.Name)
+			}
+			out.Columns = append(out.Columns, ind)
+		}
+	}
+	return out, nil
+}
+
+func (o *OneHot) String() string {
+	return "one_hot(" + o.Column + ")"
+}
+
+// LabelEncode replaces a text column with the index of each value among
+// the sorted categories seen in training. Missing values stay missing;
+// unseen values are an error.
+type LabelEncode struct {
+	Column  string
+	Classes []string
+}
+
+// FitLabelEncode learns the categories of a text column.
+func FitLabelEncode(d *Dataset, column string) (*LabelEncode, error) {
+	c, err := d.Column(column)
+	if err != nil {
+		return nil, err
+	}
+	if c.Type != Text {
+		return nil, fmt.Errorf("column %q is already numeric", column)
+	}
+	classes := categories(c)
+	if len(classes) == 0 {
+		return nil, fmt.Errorf("column %q has no values", column)
+	}
+	return &LabelEncode{Column: column, Classes: classes}, nil
+}
+
+// Apply encodes the column. A numeric column is taken to hold codes already.
+func (l *LabelEncode) Apply(d *Dataset) (*Dataset, error) {
+	c, err := d.Column(l.Column)
+	if err != nil || c.Type == Numeric {
+		return d, nil
+	}
+	index := map[string]int{}
+	for k, class := range l.Classes {
+		index[class] = k
+	}
+	codes := make([]float64, len(c.Strings))
+	for i, v := range c.Strings {
+		k, ok := index[v]
+		switch {
+		case v == "":
+			codes[i] = math.NaN()
+		case !ok:
+			return nil, fmt.Errorf("column %q has value %q, which was not seen in training", l.Column, v)
+		default:
+			codes[i] = float64(k)
+		}
+	}
+	out := d.copyColumns()
+	out.SetColumn(NewNumeric(l.Column, codes))
+	return out, nil
+}
+
+func (l *LabelEncode) String() string {
+	return "label_encode(" + l.Column + ")"
+}
+
+// Impute fills missing values of a column with a value learned in training.
+type Impute struct {
+	Column   string
+	Strategy string  // "mean", "median", "most_frequent" or "constant"
+	Number   float64 // the fill value of a numeric column
+	Text     string  // the fill value of a text column
+}
+
+// FitImpute learns the fill value of column. Text columns support only the
+// most_frequent and constant strategies; constant uses value, which must
+// match the column's type.
+func FitImpute(d *Dataset, column, strategy string, value interface{}) (*Impute, error) {
+	c, err := d.Column(column)
+	if err != nil {
+		return nil, err
+	}
+	m := &Impute{Column: column, Strategy: strategy}
+	if strategy == "constant" {
+		switch v := value.(type) {
+		case float64:
+			m.Number = v
+		case string:
+			m.Text = v
+		}
+		if _, isNumber := value.(float64); value == nil || isNumber != (c.Type == Numeric) {
+			return nil, fmt.Errorf("constant imputation of %s column %q needs a %s value", c.Type, column, c.Type)
+		}
+		return m, nil
+	}
+
+	cats := categories(c)
+	if len(cats) == 0 {
+		return nil, fmt.Errorf("column %q has no values", column)
+	}
+	switch {
+	case strategy == "most_frequent":
+		counts := map[string]int{}
+		for i := 0; i < c.Len(); i++ {
+			if !c.IsMissing(i) {
+				counts[c.Format(i)]++
+			}
+		}
+		best := cats[0]
+		for _, cat := range cats {
+			if counts[cat] > counts[best] {
+				best = cat
+			}
+		}
+		if c.Type == Text {
+			m.Text = best
+		} else {
+			// Ties go to the smallest value, as in scikit-learn.
+			m.Number = math.Inf(1)
+			for i, v := range c.Numbers {
+				if c.Format(i) == best {
+					m.Number = math.Min(m.Number, v)
+				}
+			}
+		}
+	case c.Type == Text:
+		return nil, fmt.Errorf("column %q is text; use strategy \"most_frequent\" or \"constant\"", column)
+	case strategy == "mean":
+		vs := present(c)
+		for _, v := range vs {
+			m.Number += v / float64(len(vs))
+		}
+	case strategy == "median":
+		vs := present(c)
+		sort.Float64s(vs)
+		m.Number = (vs[(len(vs)-1)/2] + vs[len(vs)/2]) / 2
+	default:
+		return nil, fmt.Errorf(`strategy must be "mean", "median", "most_frequent" or "constant", got %q`, strategy)
+	}
+	return m, nil
+}
+
+func (m *Impute) Apply(d *Dataset) (*Dataset, error) {
+	c, err := d.Column(m.Column)
+	if err != nil {
+		return d, nil
+	}
+	var filled *Column
+	if c.Type == Numeric {
+		values := append([]float64(nil), c.Numbers...)
+		for i, v := range values {
+			if math.IsNaN(v) {
+				values[i] = m.Number
+			}
+		}
+		filled = NewNumeric(m.Column, values)
+	} else {
+		values := append([]string(nil), c.Strings...)
+		for i, v := range values {
+			if v == "" {
+				values[i] = m.Text
+			}
+		}
+		filled = NewText(m.Column, values)
+	}
+	out := d.copyColumns()
+	out.SetColumn(filled)
+	return out, nil
+}
+
+func (m *Impute) String() string {
+	return fmt.Sprintf("impute(%s, strategy: %q)", m.Column, m.Strategy)
+}
+
+// DropNA returns the rows of d with no missing value in the named columns,
+// or in any column when none are named.
+func (d *Dataset) DropNA(columns []string) (*Dataset, error) {
+	check := d.Columns
+	if len(columns) > 0 {
+		check = make([]*Column, len(columns))
+		for j, name := range columns {
+			c, err := d.Column(name)
+			if err != nil {
+				return nil, err
+			}
+			check[j] = c
+		}
+	}
+	var rows []int
+	for i := 0; i < d.NumRows(); i++ {
+		complete := true
+		for _, c := range check {
+			if c.IsMissing(i) {
+				complete = false
+				break
+			}
+		}
+		if complete {
+			rows = append(rows, i)
+		}
+	}
+	return d.Take(rows), nil
+}
+
+// MarshalTransforms encodes a step chain as JSON, for saved models.
+func MarshalTransforms(steps []Transform) ([]byte, error) {
+	type entry struct {
+		Kind string    `json:"kind"`
+		Step Transform `json:"step"`
+	}
+	entries := make([]entry, len(steps))
+	for i, step := range steps {
+		kind, ok := transformKind(step)
+		if !ok {
+			return nil, fmt.Errorf("%s cannot be saved", step)
+		}
+		entries[i] = entry{Kind: kind, Step: step}
+	}
+	return json.Marshal(entries)
+}
+
+// UnmarshalTransforms decodes a chain written by MarshalTransforms.
+func UnmarshalTransforms(data []byte) ([]Transform, error) {
+	var entries []struct {
+		Kind string          `json:"kind"`
+		Step json.RawMessage `json:"step"`
+	}
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, err
+	}
+	steps := make([]Transform, len(entries))
+	for i, e := range entries {
+		var step Transform
+		switch e.Kind {
+		case "standardize":
+			step = &Standardize{}
+		case "minmax_scale":
+			step = &MinMaxScale{}
+		case "clip":
+			step = &Clip{}
+		case "one_hot":
+			step = &OneHot{}
+		case "label_encode":
+			step = &LabelEncode{}
+		case "impute":
+			step = &Impute{}
+		default:
+			return nil, fmt.Errorf("unknown preprocessing step %q", e.Kind)
+		}
+		if err := json.Unmarshal(e.Step, step); err != nil {
+			return nil, fmt.Errorf("%s: %w", e.Kind, err)
+		}
+		steps[i] = step
+	}
+	return steps, nil
+}
+
+func transformKind(step Transform) (string, bool) {
+	switch step.(type) {
+	case *Standardize:
+		return "standardize", true
+	case *MinMaxScale:
+		return "minmax_scale", true
+	case *Clip:
+		return "clip", true
+	case *OneHot:
+		return "one_hot", true
+	case *LabelEncode:
+		return "label_encode", true
+	case *Impute:
+		return "impute", true
+	}
+	return "", false
+}
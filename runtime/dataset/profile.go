@@ -0,0 +1,377 @@
+package dataset
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+// Profile summarizes a dataset column by column, with the correlations
+// between its numeric columns. It marshals to the JSON the workbench shows;
+// statistics that do not apply or cannot be computed are null.
+type Profile struct {
+	Rows        int             `json:"rows"`
+	Columns     []ColumnProfile `json:"columns"`
+	Correlation Correlation     `json:"correlation"`
+
+	// Approximate is set on a streamed profile whose quantiles or distinct
+	// counts had to be estimated; see Stream.Describe.
+	Approximate bool `json:"approximate,omitempty"`
+}
+
+// ColumnProfile holds the statistics of one column. Count and Missing
+// split its rows; the numeric statistics skip missing values, and Std is
+// the sample standard deviation.
+type ColumnProfile struct {
+	Name     string       `json:"name"`
+	Type     ColumnType   `json:"type"`
+	Count    int          `json:"count"`
+	Missing  int          `json:"missing"`
+	Distinct int          `json:"distinct"`
+	Mean     *float64     `json:"mean"`
+	Std      *float64     `json:"std"`
+	Min      *float64     `json:"min"`
+	Q25      *float64     `json:"q25"`
+	Median   *float64     `json:"median"`
+	Q75      *float64     `json:"q75"`
+	Max      *float64     `json:"max"`
+	Top      []ValueCount `json:"top"`
+}
+
+// ValueCount is a value and the number of rows holding it.
+type ValueCount struct {
+	Value string `json:"value"`
+	Count int    `json:"count"`
+}
+
+// Correlation is the Pearson correlation matrix of the numeric columns,
+// each pair computed over the rows where both are present. A pair with
+// fewer than two such rows or no variation has a null correlation.
+type Correlation struct {
+	Columns []string     `json:"columns"`
+	Matrix  [][]*float64 `json:"matrix"`
+}
+
+// TopValues is how many of the most frequent values a profile lists.
+const TopValues = 5
+
+// Describe profiles d.
+func (d *Dataset) Describe() *Profile {
+	p := &Profile{Rows: d.NumRows(), Columns: make([]ColumnProfile, len(d.Columns))}
+	var numeric []*Column
+	for j, c := range d.Columns {
+		p.Columns[j] = profileColumn(c)
+		if c.Type == Numeric {
+			numeric = append(numeric, c)
+		}
+	}
+	p.Correlation.Columns = make([]string, len(numeric))
+	p.Correlation.Matrix = make([][]*float64, len(numeric))
+	for a, x := range numeric {
+		p.Correlation.Columns[a] = x.Name
+		p.Correlation.Matrix[a] = make([]*float64, len(numeric))
+		for b, y := range numeric {
+			if b < a {
+				p.Correlation.Matrix[a][b] = p.Correlation.Matrix[b][a]
+				continue
+			}
+			p.Correlation.Matrix[a][b] = optional(pearson(x.Numbers, y.Numbers))
+		}
+	}
+	return p
+}
+
+func profileColumn(c *Column) ColumnProfile {
+	p := ColumnProfile{Name: c.Name, Type: c.Type}
+	counts := make(map[string]int)
+	var present []float64
+	for i := 0; i < c.Len(); i++ {
+		if c.IsMissing(i) {
+			p.Missing++
+			continue
+		}
+		p.Count++
+		counts[c.Format(i)]++
+		if c.Type == Numeric {
+			present = append(present, c.Numbers[i])
+		}
+	}
+	p.Distinct = len(counts)
+	p.Top = topValues(counts)
+
+	if c.Type != Numeric || len(present) == 0 {
+		return p
+	}
+	sort.Float64s(present)
+	p.Mean = optional(summarize("mean", present))
+	p.Std = optional(summarize("std", present))
+	p.Min = optional(present[0])
+	p.Q25 = optional(quantile(present, 0.25))
+	p.Median = optional(quantile(present, 0.5))
+	p.Q75 = optional(quantile(present, 0.75))
+	p.Max = optional(present[len(present)-1])
+	return p
+}
+
+// topValues returns the TopValues most frequent values, ties broken by value.
+func topValues(counts map[string]int) []ValueCount {
+	var top []ValueCount
+	for value, n := range counts {
+		top = append(top, ValueCount{Value: value, Count: n})
+	}
+	sort.Slice(top, func(a, b int) bool {
+		if top[a].Count != top[b].Count {
+			return top[a].Count > top[b].Count
+		}
+		return top[a].Value < top[b].Value
+	})
+	if len(top) > TopValues {
+		top = top[:TopValues]
+	}
+	return top
+}
+
+// quantile interpolates linearly between the sorted values around q, as
+// pandas and numpy do by default.
+func quantile(sorted []float64, q float64) float64 {
+	pos := q * float64(len(sorted)-1)
+	lo := int(math.Floor(pos))
+	if lo+1 >= len(sorted) {
+		return sorted[lo]
+	}
+	return sorted[lo] + (pos-float64(lo))*(sorted[lo+1]-sorted[lo])
+}
+
+// pearson correlates x and y over the rows where both are present.
+func pearson(x, y []float64) float64 {
+	var xs, ys []float64
+	for i := range x {
+		if !math.IsNaN(x[i]) && !math.IsNaN(y[i]) {
+			xs = append(xs, x[i])
+			ys = append(ys, y[i])
+		}
+	}
+	if len(xs) < 2 {
+		return math.NaN()
+	}
+	mx, my := summarize("mean", xs), summarize("mean", ys)
+	var sxy, sxx, syy float64
+	for i := range xs {
+		dx, dy := xs[i]-mx, ys[i]-my
+		sxy += dx * dy
+		sxx += dx * dx
+		syy += dy * dy
+	}
+	if sxx == 0 || syy == 0 {
+		return math.NaN()
+	}
+	return sxy / math.Sqrt(sxx*syy)
+}
+
+// streamSample bounds the memory of a streamed profile: it keeps this many
+// values of each numeric column for quantiles, and counts this many
+// distinct values of each column.
+const streamSample = 10000
+
+// profiler accumulates a profile batch by batch.
+type profiler struct {
+	rows    int
+	columns []*columnStats
+	numeric []int          // indices of the numeric columns
+	pairs   [][]*pairStats // pairs[a][b] for numeric columns a <= b
+	rng     *rand.Rand
+	approx  bool
+}
+
+type columnStats struct {
+	ColumnProfile
+	present  float64 // numeric values seen
+	mean, m2 float64
+	min, max float64
+	sample   []float64
+	counts   map[string]int
+}
+
+// pairStats are the running co-moments of two columns over the rows where
+// both are present.
+type pairStats struct {
+	n, mx, my, cxx, cyy, cxy float64
+}
+
+func newProfiler(schema *Dataset) *profiler {
+	p := &profiler{rng: rand.New(rand.NewSource(1))}
+	for j, c := range schema.Columns {
+		p.columns = append(p.columns, &columnStats{
+			ColumnProfile: ColumnProfile{Name: c.Name, Type: c.Type},
+			min:           math.Inf(1),
+			max:           math.Inf(-1),
+			counts:        make(map[string]int),
+		})
+		if c.Type == Numeric {
+			p.numeric = append(p.numeric, j)
+		}
+	}
+	p.pairs = make([][]*pairStats, len(p.numeric))
+	for a := range p.pairs {
+		p.pairs[a] = make([]*pairStats, len(p.numeric))
+		for b := a; b < len(p.numeric); b++ {
+			p.pairs[a][b] = &pairStats{}
+		}
+	}
+	return p
+}
+
+func (p *profiler) add(d *Dataset) {
+	p.rows += d.NumRows()
+	for j, c := range d.Columns {
+		stats := p.columns[j]
+		for i := 0; i < c.Len(); i++ {
+			if c.IsMissing(i) {
+				stats.Missing++
+				continue
+			}
+			stats.Count++
+			if value := c.Format(i); stats.counts[value] > 0 || len(stats.counts) < streamSample {
+				stats.counts[value]++
+			} else {
+				p.approx = true
+			}
+			if c.Type != Numeric {
+				continue
+			}
+			v := c.Numbers[i]
+			stats.present++
+			delta := v - stats.mean
+			stats.mean += delta / stats.present
+			stats.m2 += delta * (v - stats.mean)
+			stats.min, stats.max = math.Min(stats.min, v), math.Max(stats.max, v)
+			// Reservoir sampling keeps a uniform sample of the values.
+			if len(stats.sample) < streamSample {
+				stats.sample = append(stats.sample, v)
+				continue
+			}
+			p.approx = true
+			if k := p.rng.Int63n(int64(stats.present)); k < streamSample {
+				stats.sample[k] = v
+			}
+		}
+	}
+	for a, ja := range p.numeric {
+		x := d.Columns[ja].Numbers
+		for b := a; b < len(p.numeric); b++ {
+			y, pair := d.Columns[p.numeric[b]].Numbers, p.pairs[a][b]
+			for i := range x {
+				if math.IsNaN(x[i]) || math.IsNaN(y[i]) {
+					continue
+				}
+				pair.n++
+				dx, dy := x[i]-pair.mx, y[i]-pair.my
+				pair.mx += dx / pair.n
+				pair.my += dy / pair.n
+				pair.cxx += dx * (x[i] - pair.mx)
+				pair.cyy += dy * (y[i] - pair.my)
+				pair.cxy += dx * (y[i] - pair.my)
+			}
+		}
+	}
+}
+
+func (p *profiler) profile() *Profile {
+	out := &Profile{Rows: p.rows, Columns: make([]ColumnProfile, len(p.columns)), Approximate: p.approx}
+	for j, stats := range p.columns {
+		c := stats.ColumnProfile
+		c.Distinct = len(stats.counts)
+		c.Top = topValues(stats.counts)
+		if c.Type == Numeric && stats.present > 0 {
+			sort.Float64s(stats.sample)
+			c.Mean = optional(stats.mean)
+			if stats.present >= 2 {
+				c.Std = optional(math.Sqrt(stats.m2 / (stats.present - 1)))
+			}
+			c.Min = optional(stats.min)
+			c.Q25 = optional(quantile(stats.sample, 0.25))
+			c.Median = optional(quantile(stats.sample, 0.5))
+			c.Q75 = optional(quantile(stats.sample, 0.75))
+			c.Max = optional(stats.max)
+		}
+		out.Columns[j] = c
+	}
+	out.Correlation.Columns = make([]string, len(p.numeric))
+	out.Correlation.Matrix = make([][]*float64, len(p.numeric))
+	for a, ja := range p.numeric {
+		out.Correlation.Columns[a] = p.columns[ja].Name
+		out.Correlation.Matrix[a] = make([]*float64, len(p.numeric))
+		for b := range p.numeric {
+			if b < a {
+				out.Correlation.Matrix[a][b] = out.Correlation.Matrix[b][a]
+				continue
+			}
+			pair := p.pairs[a][b]
+			if pair.n >= 2 && pair.cxx > 0 && pair.cyy > 0 {
+				out.Correlation.Matrix[a][b] = optional(pair.cxy / math.Sqrt(pair.cxx*pair.cyy))
+			}
+		}
+	}
+	return out
+}
+
+// optional returns v for JSON, or nil when it is NaN.
+func optional(v float64) *float64 {
+	if math.IsNaN(v) {
+		return nil
+	}
+	return &v
+}
+
+// String renders the profile as text: one row per column, then the
+// correlation matrix.
+func (p *Profile) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d rows, %d columns\n", p.Rows, len(p.Columns))
+	if p.Approximate {
+		b.WriteString("quantiles and distinct counts are estimated from a sample\n")
+	}
+	b.WriteString("\n")
+	w := tabwriter.NewWriter(&b, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "column\ttype\tcount\tmissing\tmean\tstd\tmin\t25%\t50%\t75%\tmax\tdistinct\ttop")
+	for _, c := range p.Columns {
+		top := make([]string, len(c.Top))
+		for j, v := range c.Top {
+			top[j] = fmt.Sprintf("%s (%d)", v.Value, v.Count)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%d\t%d\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%d\t%s\n",
+			c.Name, c.Type, c.Count, c.Missing, statistic(c.Mean), statistic(c.Std),
+			statistic(c.Min), statistic(c.Q25), statistic(c.Median), statistic(c.Q75), statistic(c.Max),
+			c.Distinct, strings.Join(top, ", "))
+	}
+	w.Flush()
+
+	if len(p.Correlation.Columns) < 2 {
+		return b.String()
+	}
+	b.WriteString("\ncorrelation\n")
+	w = tabwriter.NewWriter(&b, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "\t"+strings.Join(p.Correlation.Columns, "\t"))
+	for a, row := range p.Correlation.Matrix {
+		cells := make([]string, len(row))
+		for j, r := range row {
+			cells[j] = "-"
+			if r != nil {
+				cells[j] = fmt.Sprintf("%.3f", *r)
+			}
+		}
+		fmt.Fprintln(w, p.Correlation.Columns[a]+"\t"+strings.Join(cells, "\t"))
+	}
+	w.Flush()
+	return b.String()
+}
+
+func statistic(v *float64) string {
+	if v == nil {
+		return "-"
+	}
+	return fmt.Sprintf("%.6g", *v)
+}
@@ -0,0 +1,127 @@
+package dataset
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"strings"
+)
+
+// Select returns the named columns of d, in the given order.
+func (d *Dataset) Select(names []string) (*Dataset, error) {
+	out := &Dataset{Columns: make([]*Column, len(names)), Transforms: d.Transforms}
+	for j, name := range names {
+		c, err := d.Column(name)
+		if err != nil {
+			return nil, err
+		}
+		for _, prev := range names[:j] {
+			if prev == name {
+				return nil, fmt.Errorf("column %q selected twice", name)
+			}
+		}
+		out.Columns[j] = c
+	}
+	return out, nil
+}
+
+// Filter returns the rows of d whose entry in keep is true.
+func (d *Dataset) Filter(keep []bool) (*Dataset, error) {
+	if len(keep) != d.NumRows() {
+		return nil, fmt.Errorf("filter has %d values for %d rows", len(keep), d.NumRows())
+	}
+	var rows []int
+	for i, k := range keep {
+		if k {
+			rows = append(rows, i)
+		}
+	}
+	return d.Take(rows), nil
+}
+
+// Sort returns d ordered by the named columns, the first one deciding
+// first. Numbers sort numerically and text lexically; missing values go
+// last either way, and ties keep their order.
+func (d *Dataset) Sort(by []string, desc bool) (*Dataset, error) {
+	if len(by) == 0 {
+		return nil, fmt.Errorf("sort needs a column")
+	}
+	keys := make([]*Column, len(by))
+	for j, name := range by {
+		c, err := d.Column(name)
+		if err != nil {
+			return nil, err
+		}
+		keys[j] = c
+	}
+	rows := make([]int, d.NumRows())
+	for i := range rows {
+		rows[i] = i
+	}
+	sort.SliceStable(rows, func(a, b int) bool {
+		for _, c := range keys {
+			if cmp := compareRows(c, rows[a], rows[b], desc); cmp != 0 {
+				return cmp < 0
+			}
+		}
+		return false
+	})
+	return d.Take(rows), nil
+}
+
+// compareRows orders rows a and b of c, reversed by desc except that
+// missing values always come last.
+func compareRows(c *Column, a, b int, desc bool) int {
+	ma, mb := c.IsMissing(a), c.IsMissing(b)
+	switch {
+	case ma && mb:
+		return 0
+	case ma:
+		return 1
+	case mb:
+		return -1
+	}
+	cmp := 0
+	if c.Type == Numeric {
+		switch {
+		case c.Numbers[a] < c.Numbers[b]:
+			cmp = -1
+		case c.Numbers[a] > c.Numbers[b]:
+			cmp = 1
+		}
+	} else {
+		cmp = strings.Compare(c.Strings[a], c.Strings[b])
+	}
+	if desc {
+		return -cmp
+	}
+	return cmp
+}
+
+// Head returns the first n rows of d, or all of them if it has fewer.
+func (d *Dataset) Head(n int) *Dataset {
+	return d.Take(rowRange(0, min(max(n, 0), d.NumRows())))
+}
+
+// Tail returns the last n rows of d, or all of them if it has fewer.
+func (d *Dataset) Tail(n int) *Dataset {
+	return d.Take(rowRange(max(d.NumRows()-max(n, 0), 0), d.NumRows()))
+}
+
+// Sample returns n rows of d drawn without replacement with seed, in the
+// order they were drawn.
+func (d *Dataset) Sample(n int, seed int64) (*Dataset, error) {
+	if n < 0 || n > d.NumRows() {
+		return nil, fmt.Errorf("cannot sample %d of %d rows", n, d.NumRows())
+	}
+	rng := rand.New(rand.NewSource(seed))
+	return d.Take(rng.Perm(d.NumRows())[:n]), nil
+}
+
+func rowRange(from, to int) []int {
+	rows := make([]int, 0, to-from)
+	for i := from; i < to; i++ {
+		rows = append(rows, i)
+	}
+	return rows
+}
@@ -0,0 +1,138 @@
+package dataset
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+)
+
+// Take returns a new dataset holding the given rows, in that order.
+func (d *Dataset) Take(rows []int) *Dataset {
+	out := &Dataset{Columns: make([]*Column, len(d.Columns)), Transforms: d.Transforms}
+	for j, c := range d.Columns {
+		nc := &Column{Name: c.Name, Type: c.Type}
+		if c.Type == Numeric {
+			nc.Numbers = make([]float64, len(rows))
+			for i, r := range rows {
+				nc.Numbers[i] = c.Numbers[r]
+			}
+		} else {
+			nc.Strings = make([]string, len(rows))
+			for i, r := range rows {
+				nc.Strings[i] = c.Strings[r]
+			}
+		}
+		out.Columns[j] = nc
+	}
+	return out
+}
+
+// Strata returns the rendered value of column name for every row, for use as
+// the strata of a stratified split.
+func (d *Dataset) Strata(name string) ([]string, error) {
+	c, err := d.Column(name)
+	if err != nil {
+		return nil, err
+	}
+	keys := make([]string, c.Len())
+	for i := range keys {
+		keys[i] = c.Format(i)
+	}
+	return keys, nil
+}
+
+// Fold is one train/test partition of row indices.
+type Fold struct {
+	Train []int
+	Test  []int
+}
+
+// SplitRows shuffles n rows with seed and holds out testFraction of them.
+// When strata is non-nil every stratum is split separately, so each class
+// keeps its share of rows in both parts.
+func SplitRows(n int, testFraction float64, seed int64, strata []string) (Fold, error) {
+	if testFraction <= 0 || testFraction >= 1 {
+		return Fold{}, fmt.Errorf("test fraction must be in (0, 1), got %v", testFraction)
+	}
+	rng := rand.New(rand.NewSource(seed))
+
+	var fold Fold
+	for _, group := range groups(n, strata) {
+		rng.Shuffle(len(group), func(a, b int) { group[a], group[b] = group[b], group[a] })
+		k := int(math.Round(testFraction * float64(len(group))))
+		fold.Test = append(fold.Test, group[:k]...)
+		fold.Train = append(fold.Train, group[k:]...)
+	}
+	if len(fold.Train) == 0 || len(fold.Test) == 0 {
+		return Fold{}, fmt.Errorf("a %.0f%% test split of %d rows leaves one side empty", testFraction*100, n)
+	}
+	rng.Shuffle(len(fold.Train), func(a, b int) { fold.Train[a], fold.Train[b] = fold.Train[b], fold.Train[a] })
+	rng.Shuffle(len(fold.Test), func(a, b int) { fold.Test[a], fold.Test[b] = fold.Test[b], fold.Test[a] })
+	return fold, nil
+}
+
+// KFoldRows shuffles n rows with seed and deals them into k folds; each fold
+// is the test set once and the other folds train. With strata, rows of each
+// stratum are dealt round-robin so every fold sees every class.
+func KFoldRows(n, k int, seed int64, strata []string) ([]Fold, error) {
+	if k < 2 || k > n {
+		return nil, fmt.Errorf("k must be between 2 and the number of rows (%d), got %d", n, k)
+	}
+	rng := rand.New(rand.NewSource(seed))
+
+	assignment := make([]int, n)
+	if strata == nil {
+		// Contiguous chunks of the shuffled order, like sklearn's KFold.
+		for pos, r := range rng.Perm(n) {
+			assignment[r] = pos * k / n
+		}
+	} else {
+		next := 0
+		for _, group := range groups(n, strata) {
+			rng.Shuffle(len(group), func(a, b int) { group[a], group[b] = group[b], group[a] })
+			for _, r := range group {
+				assignment[r] = next % k
+				next++
+			}
+		}
+	}
+
+	folds := make([]Fold, k)
+	for r, f := range assignment {
+		for j := range folds {
+			if j == f {
+				folds[j].Test = append(folds[j].Test, r)
+			} else {
+				folds[j].Train = append(folds[j].Train, r)
+			}
+		}
+	}
+	return folds, nil
+}
+
+// groups partitions 0..n-1 by stratum key, in sorted key order so results
+// are reproducible. Without strata everything is one group.
+func groups(n int, strata []string) [][]int {
+	if strata == nil {
+		rows := make([]int, n)
+		for i := range rows {
+			rows[i] = i
+		}
+		return [][]int{rows}
+	}
+	byKey := map[string][]int{}
+	for i, key := range strata {
+		byKey[key] = append(byKey[key], i)
+	}
+	keys := make([]string, 0, len(byKey))
+	for key := range byKey {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	out := make([][]int, len(keys))
+	for i, key := range keys {
+		out[i] = byKey[key]
+	}
+	return out
+}
@@ -0,0 +1,230 @@
+package dataset
+
+import (
+	"database/sql"
+	"fmt"
+	"math"
+	"os"
+	"strings"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3" // registers the "sqlite3" driver
+)
+
+// LoadSQLite runs a query against a SQLite database file and returns its
+// rows. args bind the query's parameters; see ReadSQL.
+func LoadSQLite(path, query string, args ...any) (*Dataset, error) {
+	if _, err := os.Stat(path); err != nil {
+		return nil, err
+	}
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+	return ReadSQL(db, query, args...)
+}
+
+// SaveSQLite writes the dataset to a table of a SQLite database file,
+// creating the file if needed and replacing the table if it exists.
+func (d *Dataset) SaveSQLite(path, table string) error {
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	return d.WriteSQL(db, table)
+}
+
+// ReadSQL runs a query and collects its rows. A column is numeric when
+// every non-NULL value the database returns is a number; otherwise numbers
+// are kept as text. NULL is a missing value. args bind the query's
+// parameters, e.g. sql.Named("city", "austin") for :city.
+func ReadSQL(db *sql.DB, query string, args ...any) (*Dataset, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	names, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+
+	values := make([][]any, len(names))
+	record := make([]any, len(names))
+	pointers := make([]any, len(names))
+	for j := range record {
+		pointers[j] = &record[j]
+	}
+	for rows.Next() {
+		if err := rows.Scan(pointers...); err != nil {
+			return nil, err
+		}
+		for j, v := range record {
+			values[j] = append(values[j], v)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	columns := make([]*Column, len(names))
+	for j, name := range names {
+		columns[j] = sqlColumn(name, values[j])
+	}
+	return New(columns...)
+}
+
+// sqlColumn builds a column from the values a driver scanned.
+func sqlColumn(name string, values []any) *Column {
+	numbers := make([]float64, len(values))
+	numeric := true
+	for i, v := range values {
+		switch v := v.(type) {
+		case nil:
+			numbers[i] = math.NaN()
+		case int64:
+			numbers[i] = float64(v)
+		case float64:
+			numbers[i] = v
+		case bool:
+			numbers[i] = 0
+			if v {
+				numbers[i] = 1
+			}
+		default:
+			numeric = false
+		}
+	}
+	if numeric {
+		return NewNumeric(name, numbers)
+	}
+	text := make([]string, len(values))
+	for i, v := range values {
+		switch v := v.(type) {
+		case nil:
+		case []byte:
+			text[i] = string(v)
+		case time.Time:
+			text[i] = v.Format(time.RFC3339)
+		case float64:
+			text[i] = formatNumber(v)
+		default:
+			text[i] = fmt.Sprint(v)
+		}
+	}
+	return NewText(name, text)
+}
+
+// WriteSQL replaces table with the dataset's rows in one transaction.
+// Numeric columns are stored as REAL and text columns as TEXT, with
+// missing values as NULL.
+func (d *Dataset) WriteSQL(db *sql.DB, table string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	definitions := make([]string, len(d.Columns))
+	placeholders := make([]string, len(d.Columns))
+	for j, c := range d.Columns {
+		definitions[j] = quoteIdentifier(c.Name) + " TEXT"
+		if c.Type == Numeric {
+			definitions[j] = quoteIdentifier(c.Name) + " REAL"
+		}
+		placeholders[j] = "?"
+	}
+	if _, err := tx.Exec("DROP TABLE IF EXISTS " + quoteIdentifier(table)); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(fmt.Sprintf("CREATE TABLE %s (%s)", quoteIdentifier(table), strings.Join(definitions, ", "))); err != nil {
+		return err
+	}
+	insert, err := tx.Prepare(fmt.Sprintf("INSERT INTO %s VALUES (%s)", quoteIdentifier(table), strings.Join(placeholders, ", ")))
+	if err != nil {
+		return err
+	}
+	defer insert.Close()
+
+	record := make([]any, len(d.Columns))
+	for i := 0; i < d.NumRows(); i++ {
+		for j, c := range d.Columns {
+			switch {
+			case c.IsMissing(i):
+				record[j] = nil
+			case c.Type == Numeric:
+				record[j] = c.Numbers[i]
+			default:
+				record[j] = c.Strings[i]
+			}
+		}
+		if _, err := insert.Exec(record...); err != nil {
+			return fmt.Errorf("row %d: %w", i+1, err)
+		}
+	}
+	return tx.Commit()
+}
+
+// quoteIdentifier quotes a table or column name for SQL.
+func quoteIdentifier(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+// QueryParameters returns the names of the named parameters in a SQL
+// query, such as city for :city, @city or $city, in order of first use.
+// Quoted strings, quoted identifiers and comments are skipped.
+func QueryParameters(query string) []string {
+	var names []string
+	seen := map[string]bool{}
+	for i := 0; i < len(query); i++ {
+		switch c := query[i]; {
+		case c == '\'' || c == '"' || c == '`':
+			if end := strings.IndexByte(query[i+1:], c); end >= 0 {
+				i += end + 1
+			} else {
+				i = len(query)
+			}
+		case c == '[':
+			if end := strings.IndexByte(query[i+1:], ']'); end >= 0 {
+				i += end + 1
+			} else {
+				i = len(query)
+			}
+		case strings.HasPrefix(query[i:], "--"):
+			if end := strings.IndexByte(query[i:], '\n'); end >= 0 {
+				i += end
+			} else {
+				i = len(query)
+			}
+		case strings.HasPrefix(query[i:], "/*"):
+			if end := strings.Index(query[i+2:], "*/"); end >= 0 {
+				i += end + 3
+			} else {
+				i = len(query)
+			}
+		case c == ':' || c == '@' || c == '$':
+			j := i + 1
+			for j < len(query) && isIdentifierByte(query[j], j > i+1) {
+				j++
+			}
+			if name := query[i+1 : j]; name != "" && !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+			i = j - 1
+		}
+	}
+	return names
+}
+
+func isIdentifierByte(c byte, digitsAllowed bool) bool {
+	switch {
+	case c == '_', c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z':
+		return true
+	case c >= '0' && c <= '9':
+		return digitsAllowed
+	}
+	return false
+}
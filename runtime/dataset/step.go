@@ -0,0 +1,127 @@
+package dataset
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Step describes a preprocessing step before it is fitted: the builtin that
+// fits it, the columns it works on and that builtin's other arguments.
+// Pipelines hold steps and fit them on whatever data they are trained on.
+type Step struct {
+	Kind    string                 `json:"kind"`
+	Columns []string               `json:"columns"`
+	Options map[string]interface{} `json:"options,omitempty"`
+}
+
+// StepKinds lists the Kind values Fit understands.
+var StepKinds = []string{"standardize", "minmax_scale", "one_hot", "label_encode", "impute", "clip"}
+
+// Fit fits the step on d. Options are those of the builtin of the same
+// name: min and max for minmax_scale, strategy and value for impute, lower
+// and upper for clip.
+func (s Step) Fit(d *Dataset) (Transform, error) {
+	if len(s.Columns) == 0 {
+		return nil, fmt.Errorf("%s needs a column", s.Kind)
+	}
+	switch s.Kind {
+	case "standardize":
+		return FitStandardize(d, s.Columns)
+	case "minmax_scale":
+		return FitMinMaxScale(d, s.Columns, s.number("min", 0), s.number("max", 1))
+	case "one_hot":
+		return FitOneHot(d, s.Columns[0])
+	case "label_encode":
+		return FitLabelEncode(d, s.Columns[0])
+	case "impute":
+		return s.fitImpute(d)
+	case "clip":
+		return s.fitClip(d)
+	}
+	return nil, fmt.Errorf("unknown preprocessing step %q (have %s)", s.Kind, strings.Join(StepKinds, ", "))
+}
+
+// fitImpute defaults the strategy to constant when a value is given, and
+// otherwise to mean for numbers and most_frequent for text.
+func (s Step) fitImpute(d *Dataset) (Transform, error) {
+	column := s.Columns[0]
+	value := s.Options["value"]
+	strategy, _ := s.Options["strategy"].(string)
+	switch {
+	case strategy != "":
+	case value != nil:
+		strategy = "constant"
+	default:
+		strategy = "mean"
+		if c, err := d.Column(column); err == nil && c.Type == Text {
+			strategy = "most_frequent"
+		}
+	}
+	return FitImpute(d, column, strategy, value)
+}
+
+func (s Step) fitClip(d *Dataset) (Transform, error) {
+	c := &Clip{Columns: s.Columns}
+	if v, ok := s.Options["lower"].(float64); ok {
+		c.Lower = &v
+	}
+	if v, ok := s.Options["upper"].(float64); ok {
+		c.Upper = &v
+	}
+	if c.Lower == nil && c.Upper == nil {
+		return nil, fmt.Errorf("clip needs a lower or upper bound")
+	}
+	for _, name := range s.Columns {
+		if _, err := d.Numbers(name); err != nil {
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+func (s Step) number(name string, def float64) float64 {
+	if v, ok := s.Options[name].(float64); ok {
+		return v
+	}
+	return def
+}
+
+// String renders the step as the builtin call that makes it, e.g.
+// "impute(age, strategy: median)".
+func (s Step) String() string {
+	parts := []string{strings.Join(s.Columns, ", ")}
+	if len(s.Columns) > 1 {
+		parts[0] = "[" + parts[0] + "]"
+	}
+	for _, name := range []string{"min", "max", "strategy", "value", "lower", "upper"} {
+		if v, ok := s.Options[name]; ok {
+			parts = append(parts, fmt.Sprintf("%s: %v", name, v))
+		}
+	}
+	return s.Kind + "(" + strings.Join(parts, ", ") + ")"
+}
+
+// ExpandColumns replaces names of columns that a one-hot step of d's
+// Transforms encoded with the columns that step wrote, so features can be
+// named as they were before encoding.
+func (d *Dataset) ExpandColumns(names []string) []string {
+	var out []string
+	for _, name := range names {
+		if _, err := d.Column(name); err == nil {
+			out = append(out, name)
+			continue
+		}
+		expanded := false
+		for _, t := range d.Transforms {
+			if o, ok := t.(*OneHot); ok && o.Column == name {
+				out = append(out, o.Names()...)
+				expanded = true
+				break
+			}
+		}
+		if !expanded {
+			out = append(out, name)
+		}
+	}
+	return out
+}
@@ -0,0 +1,225 @@
+package dataset
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Stream is a CSV or TSV file read in batches of rows rather than all at
+// once, so files larger than memory can be filtered, profiled and trained
+// on. Every pass reopens the file; gzip input is decompressed as it is
+// read.
+//
+// Column types are inferred from the first batch. A later value that does
+// not parse as a number in a numeric column is an error.
+type Stream struct {
+	Path       string
+	Format     Format
+	BatchBytes int64 // decompressed bytes of the file read per batch
+
+	header []string
+	types  []ColumnType
+	steps  []func(*Dataset) (*Dataset, error)
+	schema *Dataset // the columns of a batch after the steps, without rows
+}
+
+var errStop = errors.New("stop")
+
+// OpenStream prepares to read a file in batches of about batchBytes,
+// reading its first batch to infer the column types. The format is
+// detected from the file name when empty.
+func OpenStream(path string, format Format, batchBytes int64) (*Stream, error) {
+	if format == "" {
+		format = DetectFormat(path)
+	}
+	if format != CSV && format != TSV {
+		return nil, fmt.Errorf("%s: only csv and tsv files can be streamed, not %s", path, format)
+	}
+	if batchBytes < 1 {
+		return nil, fmt.Errorf("batch size must be at least 1 byte, got %d", batchBytes)
+	}
+	s := &Stream{Path: path, Format: format, BatchBytes: batchBytes}
+	err := s.read(func(raw [][]string) error {
+		columns := make([]*Column, len(s.header))
+		s.types = make([]ColumnType, len(s.header))
+		for j, name := range s.header {
+			columns[j] = inferColumn(name, raw[j])
+			s.types[j] = columns[j].Type
+		}
+		first, err := New(columns...)
+		if err != nil {
+			return err
+		}
+		s.schema = first.Take(nil)
+		return errStop
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Names returns the column names of the stream's batches.
+func (s *Stream) Names() []string {
+	return s.schema.Names()
+}
+
+// Schema returns the columns of the stream's batches, without rows.
+func (s *Stream) Schema() *Dataset {
+	return s.schema
+}
+
+// Then returns a stream whose batches also go through fn, such as a
+// filter or a projection. fn is tried on an empty batch first, so a step
+// naming an unknown column fails here rather than midway through a pass.
+func (s *Stream) Then(fn func(*Dataset) (*Dataset, error)) (*Stream, error) {
+	schema, err := fn(s.schema)
+	if err != nil {
+		return nil, err
+	}
+	out := *s
+	out.steps = append(append([]func(*Dataset) (*Dataset, error){}, s.steps...), fn)
+	out.schema = schema
+	return &out, nil
+}
+
+// Each reads the file once, calling fn with every batch that has rows
+// left after the stream's steps.
+func (s *Stream) Each(fn func(*Dataset) error) error {
+	return s.read(func(raw [][]string) error {
+		columns := make([]*Column, len(s.header))
+		for j, name := range s.header {
+			c, err := parseColumn(name, s.types[j], raw[j])
+			if err != nil {
+				return err
+			}
+			columns[j] = c
+		}
+		d, err := New(columns...)
+		if err != nil {
+			return err
+		}
+		for _, step := range s.steps {
+			if d, err = step(d); err != nil {
+				return err
+			}
+		}
+		if d.NumRows() == 0 {
+			return nil
+		}
+		return fn(d)
+	})
+}
+
+// read passes the file's rows to fn in batches, as raw fields by column.
+// fn may return errStop to end the pass early.
+func (s *Stream) read(fn func(raw [][]string) error) error {
+	f, err := os.Open(s.Path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	r, err := decompress(f)
+	if err != nil {
+		return fmt.Errorf("%s: %w", s.Path, err)
+	}
+
+	cr := csv.NewReader(r)
+	if s.Format == TSV {
+		cr.Comma = '\t'
+	}
+	header, err := cr.Read()
+	if err == io.EOF {
+		return fmt.Errorf("%s: missing header row", s.Path)
+	} else if err != nil {
+		return fmt.Errorf("%s: %w", s.Path, err)
+	}
+	if s.header == nil {
+		s.header = header
+	} else if strings.Join(header, "\x00") != strings.Join(s.header, "\x00") {
+		return fmt.Errorf("%s: the header changed since the stream was opened", s.Path)
+	}
+
+	raw := make([][]string, len(header))
+	rows := 0
+	start := cr.InputOffset()
+	for {
+		record, err := cr.Read()
+		if err != nil && err != io.EOF {
+			return fmt.Errorf("%s: %w", s.Path, err)
+		}
+		if err == nil {
+			for j, v := range record {
+				raw[j] = append(raw[j], v)
+			}
+			rows++
+		}
+		if rows > 0 && (err == io.EOF || cr.InputOffset()-start >= s.BatchBytes) {
+			if err := fn(raw); err == errStop {
+				return nil
+			} else if err != nil {
+				return fmt.Errorf("%s: %w", s.Path, err)
+			}
+			raw = make([][]string, len(header))
+			rows = 0
+			start = cr.InputOffset()
+		}
+		if err == io.EOF {
+			break
+		}
+	}
+	if s.types == nil {
+		// A file without rows: every column is an empty numeric one.
+		if err := fn(raw); err != errStop {
+			return err
+		}
+	}
+	return nil
+}
+
+// parseColumn converts raw fields to a column of a known type.
+func parseColumn(name string, typ ColumnType, raw []string) (*Column, error) {
+	if typ == Text {
+		return NewText(name, raw), nil
+	}
+	numbers := make([]float64, len(raw))
+	for i, s := range raw {
+		if s == "" {
+			numbers[i] = math.NaN()
+			continue
+		}
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return nil, fmt.Errorf("column %s: %q is not a number; column types come from the first batch of rows", name, s)
+		}
+		numbers[i] = f
+	}
+	return NewNumeric(name, numbers), nil
+}
+
+// Describe profiles the stream in one pass with bounded memory. Counts,
+// means, standard deviations, extremes and correlations are exact;
+// quantiles come from a uniform sample of each column, and distinct
+// values are only counted up to a limit. The profile says when either
+// was needed.
+func (s *Stream) Describe() (*Profile, error) {
+	p := newProfiler(s.schema)
+	if err := s.Each(func(d *Dataset) error {
+		p.add(d)
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	return p.profile(), nil
+}
+
+// String describes the stream, e.g. "housing.csv (streamed: sqft, price)".
+func (s *Stream) String() string {
+	return fmt.Sprintf("%s (streamed: %s)", s.Path, strings.Join(s.Names(), ", "))
+}
@@ -1,3 +1,9 @@
 module mlite
 
 go 1.23.2
+
+require (
+	github.com/klauspost/compress v1.18.0
+	github.com/mattn/go-sqlite3 v1.14.33
+	google.golang.org/protobuf v1.36.11
+)
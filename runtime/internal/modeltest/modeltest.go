@@ -0,0 +1,46 @@
+// Package modeltest holds the training data the model export tests share.
+package modeltest
+
+import (
+	"testing"
+
+	"mlite/dataset"
+	"mlite/model"
+)
+
+// Features are the columns Train fits on.
+var Features = []string{"x1", "x2"}
+
+// Data is y = 2·x1 - x2 + 1 with a label for x1 + x2 > 10, and a text
+// column no model is trained on.
+func Data() *dataset.Dataset {
+	x1 := []float64{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12}
+	x2 := []float64{5, 3, 4, 1, 2, 8, 6, 9, 7, 10, 0, 2}
+	city := []string{"austin", "dallas", "", "austin", "waco", "dallas", "austin", "waco", "dallas", "austin", "waco", "austin"}
+	y := make([]float64, len(x1))
+	label := make([]float64, len(x1))
+	for i := range x1 {
+		y[i] = 2*x1[i] - x2[i] + 1
+		if x1[i]+x2[i] > 10 {
+			label[i] = 1
+		}
+	}
+	d, _ := dataset.New(dataset.NewNumeric("x1", x1), dataset.NewNumeric("x2", x2), dataset.NewText("city", city),
+		dataset.NewNumeric("y", y), dataset.NewNumeric("label", label))
+	return d
+}
+
+// Train fits spec on Data to predict target ("y" or "label") and returns
+// the estimator with the data it was trained on.
+func Train(t *testing.T, spec model.Spec, target string) (*model.Estimator, *dataset.Dataset) {
+	t.Helper()
+	est, err := model.NewEstimator(spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := Data()
+	if err := est.Fit(d, Features, target); err != nil {
+		t.Fatal(err)
+	}
+	return est, d
+}
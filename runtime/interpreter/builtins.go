@@ -0,0 +1,506 @@
+package interpreter
+
+import (
+	"fmt"
+	"math"
+	"mlite/dataset"
+	"mlite/metrics"
+	"mlite/model"
+	"mlite/onnx"
+	"mlite/parser"
+	"mlite/pmml"
+	"slices"
+	"strings"
+)
+
+// builtin is a function callable from MLite. Params names the arguments in
+// positional order; any of them may also be passed by name. A last param
+// written "...name" collects the remaining positional arguments as an array.
+type builtin struct {
+	params []string
+	run    func(a *args) interface{}
+}
+
+var builtins map[string]builtin
+
+func init() {
+	builtins = map[string]builtin{
+		"split":          {params: []string{"data", "test", "seed", "stratify"}, run: builtinSplit},
+		"kfold":          {params: []string{"data", "k", "seed", "stratify"}, run: builtinKFold},
+		"cross_validate": {params: []string{"model", "data", "k", "seed", "stratify", "features", "target"}, run: builtinCrossValidate},
+		"evaluate":       {params: []string{"model", "data"}, run: builtinEvaluate},
+		"predict":        {params: []string{"model", "data", "into"}, run: builtinPredict},
+		"save_model":     {params: []string{"model", "path"}, run: builtinSaveModel},
+		"load_model":     {params: []string{"path"}, run: builtinLoadModel},
+		"export_onnx":    {params: []string{"model", "path"}, run: builtinExportONNX},
+		"export_pmml":    {params: []string{"model", "path", "data"}, run: builtinExportPMML},
+		"search":         {params: []string{"model", "data", "grid", "cv", "metric", "n_iter", "seed", "workers", "stratify", "features", "target"}, run: builtinSearch},
+		"group_by":       {params: []string{"data", "by"}, run: builtinGroupBy},
+		"agg":            {params: []string{"groups", "...aggregations"}, run: builtinAgg},
+		"join":           {params: []string{"left", "right", "on", "how"}, run: builtinJoin},
+
+		// Queries; see query.go.
+		"select":      {params: []string{"data", "columns"}, run: builtinSelect},
+		"filter":      {params: []string{"data", "condition"}, run: builtinFilter},
+		"sort":        {params: []string{"data", "by", "desc"}, run: builtinSort},
+		"with_column": {params: []string{"data", "name", "value"}, run: builtinWithColumn},
+		"head":        {params: []string{"data", "n"}, run: builtinHead},
+		"tail":        {params: []string{"data", "n"}, run: builtinTail},
+		"sample":      {params: []string{"data", "n", "seed"}, run: builtinSample},
+		"describe":    {params: []string{"data"}, run: builtinDescribe},
+
+		// Preprocessing; see preprocess.go.
+		"standardize":  {params: []string{"columns", "data"}, run: builtinPreprocess},
+		"minmax_scale": {params: []string{"columns", "data", "min", "max"}, run: builtinPreprocess},
+		"one_hot":      {params: []string{"column", "data"}, run: builtinPreprocess},
+		"label_encode": {params: []string{"column", "data"}, run: builtinPreprocess},
+		"impute":       {params: []string{"column", "strategy", "value", "data"}, run: builtinPreprocess},
+		"clip":         {params: []string{"columns", "lower", "upper", "data"}, run: builtinPreprocess},
+		"drop_na":      {params: []string{"columns", "data"}, run: builtinDropNA},
+		"pipeline":     {params: []string{"steps"}, run: builtinPipeline},
+
+		// Metrics take (y_true, y_pred) columns or arrays, or (model, data).
+		"mae":              metricBuiltin("mae", metrics.MAE),
+		"mse":              metricBuiltin("mse", metrics.MSE),
+		"rmse":             metricBuiltin("rmse", metrics.RMSE),
+		"r2":               metricBuiltin("r2", metrics.R2),
+		"mape":             metricBuiltin("mape", metrics.MAPE),
+		"accuracy":         metricBuiltin("accuracy", metrics.Accuracy),
+		"precision":        metricBuiltin("precision", metrics.Precision),
+		"recall":           metricBuiltin("recall", metrics.Recall),
+		"f1":               metricBuiltin("f1", metrics.F1),
+		"roc_auc":          {params: []string{"y_true", "y_pred"}, run: builtinROCAUC},
+		"log_loss":         {params: []string{"y_true", "y_pred"}, run: builtinLogLoss},
+		"confusion_matrix": {params: []string{"y_true", "y_pred"}, run: builtinConfusionMatrix},
+	}
+}
+
+// callFunction evaluates a CALL expression. Calling a registered model type,
+// e.g. gbm_regressor(n_estimators: 200), declares an untrained model.
+func callFunction(call *parser.ExpressionNode, variables map[string]interface{}, events EventSink) interface{} {
+	name := call.Value.(string)
+	if model.IsRegistered(name) {
+		return declareModel(call, variables, events)
+	}
+	fn, ok := builtins[name]
+	if !ok {
+		panic(fmt.Sprintf("Unknown function: %s", name))
+	}
+	return fn.run(bindArgs(name, fn.params, call, variables, events))
+}
+
+func declareModel(call *parser.ExpressionNode, variables map[string]interface{}, events EventSink) interface{} {
+	name := call.Value.(string)
+	a := bindArgs(name, model.Positional(name), call, variables, events)
+	params := model.Params{}
+	for key := range a.raw {
+		params[key] = a.value(key)
+	}
+
+	est, err := model.NewEstimator(model.Spec{Type: name, Params: params})
+	if err != nil {
+		panic(fmt.Sprintf("%s: %s", name, err))
+	}
+	return est
+}
+
+// args holds the unevaluated arguments of a call by parameter name. Builtins
+// evaluate what they need: most arguments are values, but column arguments
+// such as stratify: label are bare names.
+type args struct {
+	fn        string
+	raw       map[string]*parser.ExpressionNode
+	variables map[string]interface{}
+	events    EventSink
+}
+
+func bindArgs(fn string, params []string, call *parser.ExpressionNode, variables map[string]interface{}, events EventSink) *args {
+	a := &args{fn: fn, raw: map[string]*parser.ExpressionNode{}, variables: variables, events: events}
+	accepted := make([]string, len(params))
+	for j, param := range params {
+		accepted[j] = strings.TrimPrefix(param, "...")
+	}
+	if last := len(params) - 1; last >= 0 && strings.HasPrefix(params[last], "...") {
+		call, params = collectRest(call, params)
+	}
+	if len(call.Args) > len(params) {
+		panic(fmt.Sprintf("%s takes at most %d positional argument(s), got %d", fn, len(params), len(call.Args)))
+	}
+	for j, arg := range call.Args {
+		a.raw[params[j]] = arg
+	}
+	for _, kw := range call.Keywords {
+		if _, dup := a.raw[kw.Name]; dup {
+			panic(fmt.Sprintf("%s: argument %s given twice", fn, kw.Name))
+		}
+		// A model's keywords are its hyperparameters, which the model
+		// checks itself.
+		if !model.IsRegistered(fn) && !slices.Contains(accepted, kw.Name) {
+			panic(fmt.Sprintf("%s: unknown argument %s (accepted: %s)", fn, kw.Name, strings.Join(accepted, ", ")))
+		}
+		a.raw[kw.Name] = kw.Value
+	}
+	return a
+}
+
+func (a *args) has(name string) bool {
+	_, ok := a.raw[name]
+	return ok
+}
+
+func (a *args) value(name string) interface{} {
+	e, ok := a.raw[name]
+	if !ok {
+		panic(fmt.Sprintf("%s: missing argument %s", a.fn, name))
+	}
+	return evaluateExpression(e, a.variables, a.events)
+}
+
+func (a *args) float(name string, def float64) float64 {
+	if !a.has(name) {
+		return def
+	}
+	f, ok := a.value(name).(float64)
+	if !ok {
+		panic(fmt.Sprintf("%s: %s must be a number", a.fn, name))
+	}
+	return f
+}
+
+func (a *args) int(name string, def int) int {
+	f := a.float(name, float64(def))
+	if f != math.Trunc(f) {
+		panic(fmt.Sprintf("%s: %s must be a whole number, got %v", a.fn, name, f))
+	}
+	return int(f)
+}
+
+func (a *args) dataset(name string) *dataset.Dataset {
+	d, s := a.source(name)
+	if s != nil {
+		panic(fmt.Sprintf("%s: %s is streamed from disk; only filter, select, describe and train work on it", a.fn, name))
+	}
+	return d
+}
+
+// source returns the dataset or the stream argument name holds.
+func (a *args) source(name string) (*dataset.Dataset, *dataset.Stream) {
+	switch d := a.value(name).(type) {
+	case *dataset.Dataset:
+		return d, nil
+	case *dataset.Stream:
+		return nil, d
+	}
+	panic(fmt.Sprintf("%s: %s must be a dataset", a.fn, name))
+}
+
+func (a *args) estimator(name string) *model.Estimator {
+	est, ok := a.value(name).(*model.Estimator)
+	if !ok {
+		panic(fmt.Sprintf("%s: %s must be a model", a.fn, name))
+	}
+	return est
+}
+
+func (a *args) string(name string) string {
+	s, ok := a.value(name).(string)
+	if !ok {
+		panic(fmt.Sprintf("%s: %s must be a string", a.fn, name))
+	}
+	return s
+}
+
+// column returns a column-name argument written as a bare name or a string,
+// or "" when it was not given.
+func (a *args) column(name string) string {
+	e, ok := a.raw[name]
+	if !ok {
+		return ""
+	}
+	if e.Type != parser.IDENTIFIER && e.Type != parser.STRING {
+		panic(fmt.Sprintf("%s: %s must be a column name", a.fn, name))
+	}
+	return e.Value.(string)
+}
+
+// columns returns a column-list argument: one name or an array of names.
+func (a *args) columns(name string) []string {
+	e, ok := a.raw[name]
+	if !ok {
+		return nil
+	}
+	if e.Type != parser.ARRAY {
+		return []string{a.column(name)}
+	}
+	names := make([]string, len(e.Args))
+	for j, el := range e.Args {
+		if el.Type != parser.IDENTIFIER && el.Type != parser.STRING {
+			panic(fmt.Sprintf("%s: %s must list column names", a.fn, name))
+		}
+		names[j] = el.Value.(string)
+	}
+	return names
+}
+
+// strata returns the stratify column's values, or nil when not stratifying.
+func (a *args) strata(d *dataset.Dataset) []string {
+	col := a.column("stratify")
+	if col == "" {
+		return nil
+	}
+	keys, err := d.Strata(col)
+	if err != nil {
+		panic(fmt.Sprintf("%s: %s", a.fn, err))
+	}
+	return keys
+}
+
+// split(df, test: 0.2, seed: 42, stratify: label) returns [train, test].
+func builtinSplit(a *args) interface{} {
+	d := a.dataset("data")
+	fold, err := dataset.SplitRows(d.NumRows(), a.float("test", 0.25), int64(a.int("seed", 0)), a.strata(d))
+	if err != nil {
+		panic(fmt.Sprintf("split: %s", err))
+	}
+	return []interface{}{d.Take(fold.Train), d.Take(fold.Test)}
+}
+
+// kfold(df, k: 5, seed: 0) returns one [train, test] pair per fold.
+func builtinKFold(a *args) interface{} {
+	d := a.dataset("data")
+	folds, err := dataset.KFoldRows(d.NumRows(), a.int("k", 5), int64(a.int("seed", 0)), a.strata(d))
+	if err != nil {
+		panic(fmt.Sprintf("kfold: %s", err))
+	}
+	out := make([]interface{}, len(folds))
+	for j, f := range folds {
+		out[j] = []interface{}{d.Take(f.Train), d.Take(f.Test)}
+	}
+	return out
+}
+
+// cross_validate(model, df, k: 5) refits the model's spec on every fold and
+// returns {folds: [...], mean: {...}}. Features and target default to the
+// ones the model was last trained on.
+func builtinCrossValidate(a *args) interface{} {
+	est := a.estimator("model")
+	d := a.dataset("data")
+
+	features, target := a.columns("features"), a.column("target")
+	if features == nil {
+		features = est.Features
+	}
+	if target == "" {
+		target = est.Target
+	}
+	if features == nil || target == "" {
+		panic("cross_validate: the model has not been trained yet; pass features: and target:")
+	}
+
+	folds, err := dataset.KFoldRows(d.NumRows(), a.int("k", 5), int64(a.int("seed", 0)), a.strata(d))
+	if err != nil {
+		panic(fmt.Sprintf("cross_validate: %s", err))
+	}
+	result, err := model.CrossValidate(est.Spec, d, features, target, folds)
+	if err != nil {
+		panic(fmt.Sprintf("cross_validate: %s", err))
+	}
+
+	perFold := make([]interface{}, len(result.Folds))
+	for j, scores := range result.Folds {
+		perFold[j] = record(scores)
+	}
+	return map[string]interface{}{"folds": perFold, "mean": record(result.Mean)}
+}
+
+// predict(model, te) returns the prediction column; with into: "price_hat"
+// it returns a copy of te with that column appended instead. predict(model,
+// [1.5, 2.0]) predicts a single row.
+func builtinPredict(a *args) interface{} {
+	est := a.estimator("model")
+	if !est.Trained() {
+		panic(fmt.Sprintf("predict: %s has not been trained", est))
+	}
+	if _, ok := a.value("data").([]interface{}); ok {
+		if a.has("into") {
+			panic("predict: into: needs a dataset, not a single row")
+		}
+		prediction, err := est.PredictRow(a.numbers("data"))
+		if err != nil {
+			panic(fmt.Sprintf("predict: %s", err))
+		}
+		return prediction
+	}
+
+	d := a.dataset("data")
+	into := ""
+	if a.has("into") {
+		into = a.string("into")
+	}
+	column := predictColumn(est, d, into)
+	if into == "" {
+		return column
+	}
+	out, err := d.WithColumn(column)
+	if err != nil {
+		panic(fmt.Sprintf("predict: %s", err))
+	}
+	return out
+}
+
+// save_model(model, "m.mlm") writes a trained model in the .mlm format.
+func builtinSaveModel(a *args) interface{} {
+	est, path := a.estimator("model"), a.string("path")
+	if err := est.Save(path); err != nil {
+		panic(fmt.Sprintf("Error saving model to '%s': %s", path, err))
+	}
+	logf(a.events, "Saved %s to %s", est, path)
+	return nil
+}
+
+// load_model("m.mlm") reads a model written by save_model.
+func builtinLoadModel(a *args) interface{} {
+	path := a.string("path")
+	est, err := model.Load(path)
+	if err != nil {
+		panic(fmt.Sprintf("Error loading model from '%s': %s", path, err))
+	}
+	return est
+}
+
+// export_onnx(model, "m.onnx") writes a trained linear, logistic or
+// gradient boosting model as an ONNX graph for serving.
+func builtinExportONNX(a *args) interface{} {
+	est, path := a.estimator("model"), a.string("path")
+	if err := onnx.WriteFile(est, path); err != nil {
+		panic(fmt.Sprintf("Error exporting model to '%s': %s", path, err))
+	}
+	logf(a.events, "Exported %s to %s", est, path)
+	return nil
+}
+
+// export_pmml(model, "m.pmml") writes a trained linear, logistic or gradient
+// boosting model as a PMML 4.4 document. Its data dictionary describes the
+// columns of data, which defaults to df.
+func builtinExportPMML(a *args) interface{} {
+	est, path := a.estimator("model"), a.string("path")
+	d := datasetVariable(a.variables, "")
+	if a.has("data") {
+		d = a.dataset("data")
+	}
+	if err := pmml.WriteFile(est, d, path); err != nil {
+		panic(fmt.Sprintf("Error exporting model to '%s': %s", path, err))
+	}
+	logf(a.events, "Exported %s to %s", est, path)
+	return nil
+}
+
+// search(gbm_regressor, df, grid: {max_depth: [3, 5]}, cv: 5, metric: "rmse")
+// cross-validates every grid point in parallel, prints the leaderboard and
+// returns the best model refitted on all of data. With n_iter: k only k
+// random grid points are tried. The model may be a type name or a model
+// variable, whose parameters every candidate then shares.
+func builtinSearch(a *args) interface{} {
+	var base *model.Estimator
+	spec := model.Spec{}
+	if name := a.column("model"); name != "" && model.IsRegistered(name) && a.variables[name] == nil {
+		spec.Type = name
+	} else {
+		base = a.estimator("model")
+		spec = base.Spec
+	}
+	d := datasetVariable(a.variables, "")
+	if a.has("data") {
+		d = a.dataset("data")
+	}
+
+	features, target := a.columns("features"), a.column("target")
+	if base != nil && features == nil {
+		features = base.Features
+	}
+	if base != nil && target == "" {
+		target = base.Target
+	}
+	if features == nil || target == "" {
+		panic("search: pass features: and target:, or search from a trained model")
+	}
+
+	grid := map[string][]interface{}{}
+	entries, ok := a.value("grid").(map[string]interface{})
+	if !ok {
+		panic("search: grid must be a map such as {max_depth: [3, 5]}")
+	}
+	for name, v := range entries {
+		values, ok := v.([]interface{})
+		if !ok {
+			values = []interface{}{v}
+		}
+		grid[name] = values
+	}
+
+	metric := ""
+	if a.has("metric") {
+		metric = a.string("metric")
+	}
+
+	folds, err := dataset.KFoldRows(d.NumRows(), a.int("cv", 5), int64(a.int("seed", 0)), a.strata(d))
+	if err != nil {
+		panic(fmt.Sprintf("search: %s", err))
+	}
+	result, err := model.Search(d, model.SearchConfig{
+		Base:     spec,
+		Grid:     grid,
+		Features: features,
+		Target:   target,
+		Folds:    folds,
+		Metric:   metric,
+		NIter:    a.int("n_iter", 0),
+		Seed:     int64(a.int("seed", 0)),
+		Workers:  a.int("workers", 0),
+	})
+	if err != nil {
+		panic(fmt.Sprintf("search: %s", err))
+	}
+
+	leaderboard := fmt.Sprintf("Searched %d %s candidates by %s (%d-fold cv):", len(result.Candidates), spec.Type, result.Metric, len(folds))
+	for _, c := range result.Candidates {
+		leaderboard += fmt.Sprintf("\n  %2d. %s=%.6g  %s", c.Rank, result.Metric, c.Score, c)
+	}
+	logf(a.events, "%s", leaderboard)
+	return result.Best
+}
+
+// record converts metric scores into an MLite record value.
+func record(scores map[string]float64) map[string]interface{} {
+	out := make(map[string]interface{}, len(scores))
+	for name, v := range scores {
+		out[name] = v
+	}
+	return out
+}
+
+// collectRest rewrites a call to a builtin whose last param is "...name",
+// passing the positional arguments from that one on as name: [...].
+func collectRest(call *parser.ExpressionNode, params []string) (*parser.ExpressionNode, []string) {
+	last := len(params) - 1
+	name := strings.TrimPrefix(params[last], "...")
+	rest := &parser.ExpressionNode{Type: parser.ARRAY}
+	positional := call.Args
+	if len(positional) > last {
+		positional, rest.Args = positional[:last], positional[last:]
+	}
+	keywords := call.Keywords
+	if len(rest.Args) > 0 || !hasKeyword(call, name) {
+		keywords = append(keywords[:len(keywords):len(keywords)], &parser.KeywordArg{Name: name, Value: rest})
+	}
+	return &parser.ExpressionNode{Type: call.Type, Value: call.Value, Args: positional, Keywords: keywords}, params[:last]
+}
+
+func hasKeyword(call *parser.ExpressionNode, name string) bool {
+	for _, kw := range call.Keywords {
+		if kw.Name == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,131 @@
+package interpreter
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"mlite/parser"
+	"strings"
+	"sync"
+)
+
+// EventType names what an Event reports.
+type EventType string
+
+const (
+	StatementStart EventType = "statement_start"
+	StatementEnd   EventType = "statement_end"
+	VariableChange EventType = "variable"       // a let, a set, or a preprocessing statement updating its data
+	BranchTaken    EventType = "branch"         // an if, with whether its commands ran
+	LoopIteration  EventType = "loop_iteration" // the start of one pass of a loop
+	ModelTrained   EventType = "model_trained"
+	MetricComputed EventType = "metric" // a metric called as a statement, or evaluate
+	Log            EventType = "log"    // anything else worth telling, such as a loaded file
+)
+
+// Event is one thing the interpreter did. Every event but the statement
+// ones carries the line the interpreter has always printed for it in
+// Message; the other fields hold the same facts for programs to read.
+type Event struct {
+	Type      EventType          `json:"type"`
+	Statement string             `json:"statement,omitempty"` // the kind of statement, such as "let"
+	Span      *parser.Span       `json:"span,omitempty"`      // where the statement is, when the parser made it
+	Name      string             `json:"name,omitempty"`      // the variable, model or metric
+	Value     string             `json:"value,omitempty"`     // the variable's new value, as printed
+	Condition string             `json:"condition,omitempty"` // the if condition with its operands' values
+	Taken     bool               `json:"taken,omitempty"`
+	Iteration int                `json:"iteration,omitempty"` // 1-based
+	Count     int                `json:"count,omitempty"`     // the loop's number of iterations
+	Metrics   map[string]float64 `json:"metrics,omitempty"`
+	Error     string             `json:"error,omitempty"` // why the statement failed, on statement_end
+	Message   string             `json:"message,omitempty"`
+}
+
+// EventSink receives the events of a run as they happen.
+type EventSink interface {
+	Emit(Event)
+}
+
+// TextSink writes each event's message as a line, which is what the
+// interpreter printed before it had sinks. Statement events have no
+// message and write nothing.
+type TextSink struct {
+	w io.Writer
+}
+
+func NewTextSink(w io.Writer) *TextSink {
+	return &TextSink{w: w}
+}
+
+func (s *TextSink) Emit(e Event) {
+	if e.Message != "" {
+		fmt.Fprintln(s.w, e.Message)
+	}
+}
+
+// JSONSink writes each event as a line of JSON. A run does not stop when
+// writing fails; Err reports the first failure.
+type JSONSink struct {
+	enc *json.Encoder
+	err error
+}
+
+func NewJSONSink(w io.Writer) *JSONSink {
+	return &JSONSink{enc: json.NewEncoder(w)}
+}
+
+func (s *JSONSink) Emit(e Event) {
+	if s.err == nil {
+		s.err = s.enc.Encode(e)
+	}
+}
+
+// Err returns the first error writing an event, or nil.
+func (s *JSONSink) Err() error {
+	return s.err
+}
+
+// MemorySink keeps the events in memory, for tests and for callers that
+// want to look at a run after it ends.
+type MemorySink struct {
+	mu     sync.Mutex
+	events []Event
+}
+
+func (s *MemorySink) Emit(e Event) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.events = append(s.events, e)
+}
+
+// Events returns the events received so far.
+func (s *MemorySink) Events() []Event {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Event(nil), s.events...)
+}
+
+// MultiSink sends every event to each of sinks in turn.
+func MultiSink(sinks ...EventSink) EventSink {
+	return multiSink(sinks)
+}
+
+type multiSink []EventSink
+
+func (m multiSink) Emit(e Event) {
+	for _, s := range m {
+		s.Emit(e)
+	}
+}
+
+// statementKind names a statement as it is written: LetNode is "let".
+func statementKind(node parser.Node) string {
+	kind := fmt.Sprintf("%T", node)
+	kind = kind[strings.LastIndex(kind, ".")+1:]
+	return strings.ToLower(strings.TrimSuffix(kind, "Node"))
+}
+
+// logf emits a log event.
+func logf(sink EventSink, format string, a ...interface{}) {
+	sink.Emit(Event{Type: Log, Message: fmt.Sprintf(format, a...)})
+}
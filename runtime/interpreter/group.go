@@ -0,0 +1,69 @@
+package interpreter
+
+import (
+	"fmt"
+	"mlite/dataset"
+	"mlite/parser"
+)
+
+// group_by(df, [bedrooms]) partitions the rows for agg.
+func builtinGroupBy(a *args) interface{} {
+	g, err := a.dataset("data").GroupBy(a.requiredColumns("by"))
+	if err != nil {
+		panic(fmt.Sprintf("group_by: %s", err))
+	}
+	return g
+}
+
+// agg(groups, mean(price), count()) returns one row per group. It is
+// usually written as a method: group_by(df, [bedrooms]).agg(mean(price)).
+// The aggregations are not functions in their own right; each names a
+// dataset.AggregateFuncs entry and the column it summarizes.
+func builtinAgg(a *args) interface{} {
+	g, ok := a.value("groups").(*dataset.Groups)
+	if !ok {
+		panic("agg: groups must come from group_by")
+	}
+	var aggs []dataset.Aggregation
+	for _, e := range a.raw["aggregations"].Args {
+		aggs = append(aggs, aggregation(e))
+	}
+	if len(aggs) == 0 {
+		panic("agg: needs an aggregation such as mean(price) or count()")
+	}
+	out, err := g.Agg(aggs)
+	if err != nil {
+		panic(fmt.Sprintf("agg: %s", err))
+	}
+	return out
+}
+
+// aggregation reads an aggregation written as fn(column) or fn().
+func aggregation(e *parser.ExpressionNode) dataset.Aggregation {
+	if e.Type != parser.CALL || len(e.Args) > 1 || len(e.Keywords) > 0 {
+		panic("agg: aggregations are written as mean(price) or count()")
+	}
+	a := dataset.Aggregation{Func: e.Value.(string)}
+	if len(e.Args) == 1 {
+		column := e.Args[0]
+		if column.Type != parser.IDENTIFIER && column.Type != parser.STRING {
+			panic(fmt.Sprintf("agg: %s takes a column name", a.Func))
+		}
+		a.Column = column.Value.(string)
+	}
+	return a
+}
+
+// join(a, b, on: id, how: "left") matches rows with equal key values.
+// how is inner (the default), left, right or outer.
+func builtinJoin(a *args) interface{} {
+	how := "inner"
+	if a.has("how") {
+		how = a.string("how")
+	}
+	out, err := a.dataset("left").Join(a.dataset("right"), a.requiredColumns("on"), how)
+	if err != nil {
+		panic(fmt.Sprintf("join: %s", err))
+	}
+	return out
+}
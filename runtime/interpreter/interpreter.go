@@ -1,18 +1,39 @@
 package interpreter
 
 import (
+	"database/sql"
 	"fmt"
+	"math"
+	"mlite/dataset"
+	"mlite/model"
 	"mlite/parser"
+	"os"
+	"sort"
 	"strconv"
+	"strings"
 )
 
 type Interpreter struct {
-	variables map[string]interface{}
+	variables    map[string]interface{}
+	memoryBudget int64
+	events       EventSink
 }
 
-// Create a new Interpreter
-func NewInterpreter() *Interpreter {
-	return &Interpreter{variables: make(map[string]interface{})}
+// Create a new Interpreter that reports what it does to events. A nil sink
+// prints the messages to standard output.
+func NewInterpreter(events EventSink) *Interpreter {
+	if events == nil {
+		events = NewTextSink(os.Stdout)
+	}
+	return &Interpreter{variables: make(map[string]interface{}), events: events}
+}
+
+// SetMemoryBudget limits how much memory, in bytes, a loaded dataset may
+// take. A CSV or TSV file larger than the budget is streamed in batches
+// instead of loaded: filter, select, describe and train then work batch by
+// batch. 0, the default, loads every file whole.
+func (i *Interpreter) SetMemoryBudget(bytes int64) {
+	i.memoryBudget = bytes
 }
 
 // Convert a value to float64
@@ -34,20 +55,68 @@ func toFloat(value interface{}) float64 {
 }
 
 // Evaluate an expression
-func evaluateExpression(expr *parser.ExpressionNode, variables map[string]interface{}) interface{} {
+func evaluateExpression(expr *parser.ExpressionNode, variables map[string]interface{}, events EventSink) interface{} {
 	switch expr.Type {
-	case parser.LITERAL: // Handle literal values
+	case parser.LITERAL: // Number literals arrive as their source text
+		return toFloat(expr.Value)
+	case parser.STRING:
 		return expr.Value
 	case parser.IDENTIFIER: // Resolve variable references
 		if val, ok := variables[expr.Value.(string)]; ok {
 			return val
 		}
+		switch expr.Value {
+		case "true":
+			return true
+		case "false":
+			return false
+		}
 		panic(fmt.Sprintf("Undefined variable: %s", expr.Value))
+	case parser.ARRAY:
+		elements := make([]interface{}, len(expr.Args))
+		for j, e := range expr.Args {
+			elements[j] = evaluateExpression(e, variables, events)
+		}
+		return elements
+	case parser.MAP:
+		entries := make(map[string]interface{}, len(expr.Keywords))
+		for _, kw := range expr.Keywords {
+			entries[kw.Name] = evaluateExpression(kw.Value, variables, events)
+		}
+		return entries
+	case parser.CALL:
+		return callFunction(expr, variables, events)
+	case parser.MEMBER:
+		return member(evaluateExpression(expr.Args[0], variables, events), expr.Value.(string))
+	case parser.BINARY:
+		return operate(expr.Value.(string), evaluateExpression(expr.Args[0], variables, events), evaluateExpression(expr.Args[1], variables, events))
+	case parser.UNARY:
+		return negate(expr.Value.(string), evaluateExpression(expr.Args[0], variables, events))
 	default:
 		panic(fmt.Sprintf("Unsupported expression type: %v", expr.Type))
 	}
 }
 
+// member resolves object.field: a column of a dataset or a field of a record.
+func member(object interface{}, field string) interface{} {
+	switch o := object.(type) {
+	case *dataset.Dataset:
+		c, err := o.Column(field)
+		if err != nil {
+			panic(fmt.Sprintf("Error reading .%s: %s", field, err))
+		}
+		return c
+	case map[string]interface{}:
+		v, ok := o[field]
+		if !ok {
+			panic(fmt.Sprintf("Record %s has no field %s", formatValue(o), field))
+		}
+		return v
+	default:
+		panic(fmt.Sprintf("Cannot read .%s of %s", field, formatValue(object)))
+	}
+}
+
 func contains(slice []int, value int) bool {
     for _, v := range slice {
         if v == value {
@@ -66,82 +135,333 @@ func (i *Interpreter) StepRun(node parser.Node) {
 // Run executes the parsed nodes
 func (i *Interpreter) Run(nodes []parser.Node) {
 	for _, node := range nodes {
-		switch n := node.(type) {
-		case *parser.LetNode: // Handle "let" statements
-			value := evaluateExpression(n.Value, i.variables)
-			i.variables[n.Variable] = value
-			fmt.Printf("Declared variable %s = %v\n", n.Variable, value)
-
-		case *parser.SetNode:
-			value := evaluateExpression(n.Value, i.variables)
-			i.variables[n.Variable] = value
-			fmt.Printf("Set variable %s = %v\n", n.Variable, value)
-
-		case *parser.LoadNode:
-			fmt.Printf("Loading file: %s\n", n.File)
-
-		case *parser.SaveNode:
-			fmt.Printf("Saving to file: %s\n", n.File)
-
-		case *parser.TrainNode:
-			pythonCode := fmt.Sprintf(
-				"from sklearn.linear_model import LinearRegression\n"+
-					"%s = LinearRegression()\n"+
-					"%s.fit(%s, %s)\n",
-				n.Model, n.Model, n.Features, n.Target,
-			)
-			executePython(pythonCode)
-			fmt.Printf("Trained model '%s' successfully\n", n.Model)
-		
-		case *parser.PredictNode:
-			pythonCode := fmt.Sprintf(
-				"prediction = %s.predict([%v])\nprint(prediction)",
-				n.Model, n.Input,
-			)
-			executePython(pythonCode)
-			fmt.Printf("Prediction for input %v\n", n.Input)
-		
-
-		case *parser.LoopNode:
-			countValue := evaluateExpression(n.Count, i.variables)
-			count, ok := countValue.(int)
-			if !ok {
-				panic(fmt.Sprintf("Invalid loop count: %v", countValue))
+		if _, ok := node.(*parser.CommentNode); !ok {
+			i.execute(node)
+		}
+	}
+}
+
+// execute runs one statement between its statement_start and
+// statement_end events. A statement that panics ends with the error, and
+// the panic goes on.
+func (i *Interpreter) execute(node parser.Node) {
+	start := Event{Type: StatementStart, Statement: statementKind(node)}
+	if span := parser.SpanOf(node); span != (parser.Span{}) {
+		start.Span = &span
+	}
+	i.events.Emit(start)
+	end := start
+	end.Type = StatementEnd
+	defer func() {
+		if r := recover(); r != nil {
+			end.Error = fmt.Sprint(r)
+			i.events.Emit(end)
+			panic(r)
+		}
+		i.events.Emit(end)
+	}()
+
+	switch n := node.(type) {
+	case *parser.LetNode: // Handle "let" statements
+		value := evaluateExpression(n.Value, i.variables, i.events)
+		if n.Names != nil {
+			values, ok := value.([]interface{})
+			if !ok || len(values) != len(n.Names) {
+				panic(fmt.Sprintf("Cannot unpack %s into %d variables", formatValue(value), len(n.Names)))
+			}
+			for j, name := range n.Names {
+				i.setVariable(name, values[j], "Declared variable %s = %s")
+			}
+			break
+		}
+		i.setVariable(n.Variable, value, "Declared variable %s = %s")
+
+	case *parser.SetNode:
+		value := evaluateExpression(n.Value, i.variables, i.events)
+		i.setVariable(n.Variable, value, "Set variable %s = %s")
+
+	// The loaded dataset is bound to "df", the same name the
+	// transpiler gives the pandas DataFrame.
+	case *parser.LoadNode:
+		if n.SQLite != "" {
+			data, err := dataset.LoadSQLite(n.SQLite, n.Query, queryArgs(n.Query, i.variables)...)
+			if err != nil {
+				panic(fmt.Sprintf("Error loading '%s': %s", n.SQLite, err))
 			}
+			i.variables["df"] = data
+			i.changed("df", fmt.Sprintf("Loaded %d rows from %s: columns %s", data.NumRows(), n.SQLite, strings.Join(data.Names(), ", ")))
+			break
+		}
+		if stream := i.openStream(n.File, fileFormat(n.Format)); stream != nil {
+			i.variables["df"] = stream
+			i.changed("df", fmt.Sprintf("Streaming %s in batches of %s: columns %s", n.File, formatBytes(stream.BatchBytes), strings.Join(stream.Names(), ", ")))
+			break
+		}
+		data, err := dataset.Load(n.File, fileFormat(n.Format))
+		if err != nil {
+			panic(fmt.Sprintf("Error loading '%s': %s", n.File, err))
+		}
+		i.variables["df"] = data
+		i.changed("df", fmt.Sprintf("Loaded %s: %d rows, columns %s", n.File, data.NumRows(), strings.Join(data.Names(), ", ")))
 
-			for j := 0; j < count; j++ {
-				fmt.Printf("Iteration %d of %d\n", j+1, count)
-				i.Run(n.Commands)
+	case *parser.SaveNode:
+		data := i.dataset(n.Data)
+		if n.SQLite != "" {
+			if err := data.SaveSQLite(n.SQLite, n.Table); err != nil {
+				panic(fmt.Sprintf("Error saving '%s': %s", n.SQLite, err))
 			}
+			logf(i.events, "Saved %d rows to %s, table %s", data.NumRows(), n.SQLite, n.Table)
+			break
+		}
+		if err := data.Save(n.File, fileFormat(n.Format)); err != nil {
+			panic(fmt.Sprintf("Error saving '%s': %s", n.File, err))
+		}
+		logf(i.events, "Saved %s: %d rows", n.File, data.NumRows())
+
+	case *parser.TrainNode:
+		est := i.estimatorFor(n.Model)
+		if r, ok := est.Model.(model.Reporter); ok {
+			r.OnProgress(func(p model.Progress) {
+				i.events.Emit(Event{Type: Log, Name: n.Model, Iteration: p.Iteration, Metrics: p.Metrics,
+					Message: fmt.Sprintf("  %s iteration %d: %s", n.Model, p.Iteration, formatMetrics(p.Metrics))})
+			})
+		}
+		var err error
+		if stream, ok := i.variables[dataName(n.Data)].(*dataset.Stream); ok {
+			err = est.FitStream(stream, n.Features, n.Target)
+		} else {
+			err = est.Fit(i.dataset(n.Data), n.Features, n.Target)
+		}
+		if err != nil {
+			panic(fmt.Sprintf("Error training '%s': %s", n.Model, err))
+		}
+		i.variables[n.Model] = est
+		i.events.Emit(Event{Type: ModelTrained, Name: n.Model, Value: formatValue(est),
+			Message: fmt.Sprintf("Trained model '%s' successfully", n.Model)})
 
-		case *parser.IfNode:
-			leftValue := evaluateExpression(n.Left, i.variables)
-			rightValue := evaluateExpression(n.Right, i.variables)
-
-			condition := false
-			switch n.Operator {
-			case "==":
-				condition = leftValue == rightValue
-			case ">":
-				condition = toFloat(leftValue) > toFloat(rightValue)
-			case "<":
-				condition = toFloat(leftValue) < toFloat(rightValue)
-			case ">=":
-				condition = toFloat(leftValue) >= toFloat(rightValue)
-			case "<=":
-				condition = toFloat(leftValue) <= toFloat(rightValue)
-			default:
-				panic(fmt.Sprintf("Unsupported operator: %s", n.Operator))
+	case *parser.PredictNode:
+		est, ok := i.variables[n.Model].(*model.Estimator)
+		if !ok || !est.Trained() {
+			panic(fmt.Sprintf("Model '%s' has not been trained", n.Model))
+		}
+		if n.Input != nil {
+			prediction, err := est.PredictRow(n.Input)
+			if err != nil {
+				panic(fmt.Sprintf("Error predicting with '%s': %s", n.Model, err))
 			}
+			logf(i.events, "Prediction for input %v: %v", n.Input, prediction)
+			break
+		}
+
+		data := i.dataset(n.Data)
+		column := predictColumn(est, data, n.Into)
+		if n.Into == "" {
+			logf(i.events, "Predictions of '%s' on %s: %s", n.Model, n.Data, column)
+			break
+		}
+		if err := data.SetColumn(column); err != nil {
+			panic(fmt.Sprintf("Error adding column '%s': %s", n.Into, err))
+		}
+		i.changed(dataName(n.Data), fmt.Sprintf("Added %d predictions of '%s' to %s as column '%s'", column.Len(), n.Model, n.Data, n.Into))
 
-			if condition {
-				fmt.Printf("Condition '%v %s %v' is true; executing commands.\n", leftValue, n.Operator, rightValue)
-				i.Run(n.Commands)
-			} else {
-				fmt.Printf("Condition '%v %s %v' is false; skipping commands.\n", leftValue, n.Operator, rightValue)
+	// A builtin called as a statement prints its result, if it has one.
+	// Every builtin that returns a number is a metric.
+	case *parser.CallNode:
+		result := callFunction(n.Call, i.variables, i.events)
+		name := n.Call.Value.(string)
+		if target, ok := inPlaceTarget(n.Call, i.variables); ok {
+			i.setVariable(target, result, "%s = %s")
+		} else if score, ok := result.(float64); ok {
+			i.events.Emit(Event{Type: MetricComputed, Name: name, Metrics: map[string]float64{name: score},
+				Message: fmt.Sprintf("%s = %s", name, formatValue(result))})
+		} else if result != nil {
+			logf(i.events, "%s = %s", name, formatValue(result))
+		}
+
+	case *parser.EvaluateNode:
+		est, ok := i.variables[n.Model].(*model.Estimator)
+		if !ok {
+			panic(fmt.Sprintf("'%s' is not a model", n.Model))
+		}
+		data := i.dataset(n.Data)
+		report := evaluate(est, data)
+		message := fmt.Sprintf("Evaluated '%s' on %d rows: %s", n.Model, data.NumRows(), formatMetrics(report.Metrics))
+		if report.Confusion != nil {
+			message += fmt.Sprintf("\nConfusion matrix (rows = true %s, columns = predicted):", est.Target)
+			for j, row := range report.Confusion {
+				message += fmt.Sprintf("\n  %s: %v", formatValue(report.Labels[j]), row)
 			}
+		}
+		i.events.Emit(Event{Type: MetricComputed, Name: n.Model, Metrics: report.Metrics, Message: message})
+
+	case *parser.LoopNode:
+		countValue := evaluateExpression(n.Count, i.variables, i.events)
+		count, ok := countValue.(float64)
+		if !ok || count < 0 || count != math.Trunc(count) {
+			panic(fmt.Sprintf("Invalid loop count: %v", countValue))
+		}
+
+		for j := 0; j < int(count); j++ {
+			i.events.Emit(Event{Type: LoopIteration, Iteration: j + 1, Count: int(count),
+				Message: fmt.Sprintf("Iteration %d of %d", j+1, int(count))})
+			i.Run(n.Commands)
+		}
+
+	case *parser.IfNode:
+		leftValue := evaluateExpression(n.Left, i.variables, i.events)
+		rightValue := evaluateExpression(n.Right, i.variables, i.events)
+
+		condition, ok := operate(n.Operator, leftValue, rightValue).(bool)
+		if !ok {
+			panic(fmt.Sprintf("Condition '%v %s %v' is not true or false", formatValue(leftValue), n.Operator, formatValue(rightValue)))
+		}
+
+		branch := Event{Type: BranchTaken, Condition: fmt.Sprintf("%v %s %v", leftValue, n.Operator, rightValue), Taken: condition}
+		if condition {
+			branch.Message = fmt.Sprintf("Condition '%s' is true; executing commands.", branch.Condition)
+			i.events.Emit(branch)
+			i.Run(n.Commands)
+		} else {
+			branch.Message = fmt.Sprintf("Condition '%s' is false; skipping commands.", branch.Condition)
+			i.events.Emit(branch)
+		}
+
+	default:
+		panic(fmt.Sprintf("Unsupported node type: %T", n))
+	}
+}
+
+// setVariable binds name to value and reports it with format, which takes
+// the name and the printed value.
+func (i *Interpreter) setVariable(name string, value interface{}, format string) {
+	i.variables[name] = value
+	i.changed(name, fmt.Sprintf(format, name, formatValue(value)))
+}
+
+// changed reports the new value of variable name with message.
+func (i *Interpreter) changed(name, message string) {
+	i.events.Emit(Event{Type: VariableChange, Name: name, Value: formatValue(i.variables[name]), Message: message})
+}
+
+// estimatorFor resolves the model argument of train: a variable holding a
+// declared model, a registered model type name, or — as before native
+// models existed — a new name that gets a linear regression.
+func (i *Interpreter) estimatorFor(name string) *model.Estimator {
+	spec := model.Spec{Type: "linear_regression"}
+	if v, ok := i.variables[name]; ok {
+		est, ok := v.(*model.Estimator)
+		if !ok {
+			panic(fmt.Sprintf("'%s' is not a model", name))
+		}
+		spec = est.Spec
+	} else if model.IsRegistered(name) {
+		spec = model.Spec{Type: name}
+	}
+
+	// Always train a fresh instance so retraining in a loop starts over.
+	est, err := model.NewEstimator(spec)
+	if err != nil {
+		panic(fmt.Sprintf("Error creating model '%s': %s", name, err))
+	}
+	return est
+}
+
+// predictColumn predicts every row of data, as a column named into
+// ("prediction" when into is empty).
+func predictColumn(est *model.Estimator, data *dataset.Dataset, into string) *dataset.Column {
+	predictions, err := est.Predict(data)
+	if err != nil {
+		panic(fmt.Sprintf("Error predicting with %s: %s", est, err))
+	}
+	if into == "" {
+		into = "prediction"
+	}
+	return dataset.NewNumeric(into, predictions)
+}
+
+// fileFormat checks the format: argument of load and save.
+func fileFormat(name string) dataset.Format {
+	format, err := dataset.ParseFormat(name)
+	if err != nil {
+		panic(fmt.Sprintf("Invalid format argument: %s", err))
+	}
+	return format
+}
+
+// queryArgs binds the named parameters of a SQL query to the MLite
+// variables of the same names.
+func queryArgs(query string, variables map[string]interface{}) []any {
+	var args []any
+	for _, name := range dataset.QueryParameters(query) {
+		v, ok := variables[name]
+		if !ok {
+			panic(fmt.Sprintf("Query parameter :%s is not a defined variable", name))
+		}
+		switch v.(type) {
+		case float64, string, bool:
 		default:
-			panic(fmt.Sprintf("Unsupported node type: %T", n))
+			panic(fmt.Sprintf("Query parameter :%s must be a number, string or boolean, got %s", name, formatValue(v)))
 		}
+		args = append(args, sql.Named(name, v))
+	}
+	return args
+}
+
+// openStream opens path for streaming when it is larger than the memory
+// budget, and returns nil when it fits. A batch takes roughly as much
+// memory as its text and a filter may copy it, so batches get a quarter of
+// the budget.
+func (i *Interpreter) openStream(path string, format dataset.Format) *dataset.Stream {
+	info, err := os.Stat(path)
+	if i.memoryBudget <= 0 || err != nil || info.Size() <= i.memoryBudget {
+		return nil
+	}
+	stream, err := dataset.OpenStream(path, format, max(i.memoryBudget/4, 1))
+	if err != nil {
+		panic(fmt.Sprintf("Error loading '%s': the file is larger than the memory budget of %s, and %s", path, formatBytes(i.memoryBudget), err))
+	}
+	return stream
+}
+
+// dataset returns the dataset held by variable name, or the loaded df when
+// name is empty.
+func (i *Interpreter) dataset(name string) *dataset.Dataset {
+	return datasetVariable(i.variables, name)
+}
+
+func datasetVariable(variables map[string]interface{}, name string) *dataset.Dataset {
+	name = dataName(name)
+	v, ok := variables[name]
+	if !ok && name == "df" {
+		panic("No dataset loaded; call load(\"file.csv\") first")
+	}
+	switch data := v.(type) {
+	case *dataset.Dataset:
+		return data
+	case *dataset.Stream:
+		panic(fmt.Sprintf("'%s' is streamed from disk; only filter, select, describe and train work on it", name))
+	}
+	panic(fmt.Sprintf("'%s' is not a dataset", name))
+}
+
+// dataName is the variable a data argument names, df when it is empty.
+func dataName(name string) string {
+	if name == "" {
+		return "df"
+	}
+	return name
+}
+
+// formatMetrics renders metrics as "loss=0.25 val_loss=0.31", sorted by name.
+func formatMetrics(metrics map[string]float64) string {
+	names := make([]string, 0, len(metrics))
+	for name := range metrics {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	parts := make([]string, len(names))
+	for j, name := range names {
+		parts[j] = fmt.Sprintf("%s=%.6g", name, metrics[name])
 	}
+	return strings.Join(parts, " ")
 }
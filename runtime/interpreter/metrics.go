@@ -0,0 +1,215 @@
+package interpreter
+
+import (
+	"fmt"
+	"mlite/dataset"
+	"mlite/metrics"
+	"mlite/model"
+)
+
+// scorer computes a metric from true and predicted values.
+type scorer func(yTrue, yPred []float64) (float64, error)
+
+// metricBuiltin makes a metric callable as name(y_true, y_pred) on two
+// columns or arrays, or as name(model, data) on a trained model's
+// predictions for data.
+func metricBuiltin(name string, score scorer) builtin {
+	return builtin{params: []string{"y_true", "y_pred"}, run: func(a *args) interface{} {
+		yTrue, yPred := a.truthAndPredictions()
+		v, err := score(yTrue, yPred)
+		if err != nil {
+			panic(fmt.Sprintf("%s: %s", name, err))
+		}
+		return v
+	}}
+}
+
+// truthAndPredictions resolves the two arguments of a metric builtin.
+func (a *args) truthAndPredictions() (yTrue, yPred []float64) {
+	if est, ok := a.value("y_true").(*model.Estimator); ok {
+		d := a.dataset("y_pred")
+		return a.target(est, d), a.predictions(est, d)
+	}
+	return a.numbers("y_true"), a.numbers("y_pred")
+}
+
+// target returns the column est was trained to predict, taken from d.
+func (a *args) target(est *model.Estimator, d *dataset.Dataset) []float64 {
+	if !est.Trained() {
+		panic(fmt.Sprintf("%s: the model has not been trained", a.fn))
+	}
+	d, err := est.Prepare(d)
+	if err != nil {
+		panic(fmt.Sprintf("%s: %s", a.fn, err))
+	}
+	y, err := d.Numbers(est.Target)
+	if err != nil {
+		panic(fmt.Sprintf("%s: %s", a.fn, err))
+	}
+	return y
+}
+
+func (a *args) predictions(est *model.Estimator, d *dataset.Dataset) []float64 {
+	pred, err := est.Predict(d)
+	if err != nil {
+		panic(fmt.Sprintf("%s: %s", a.fn, err))
+	}
+	return pred
+}
+
+// numbers returns a numeric argument given as a column (df.price) or an
+// array of numbers.
+func (a *args) numbers(name string) []float64 {
+	switch v := a.value(name).(type) {
+	case *dataset.Column:
+		if v.Type != dataset.Numeric {
+			panic(fmt.Sprintf("%s: column %s is not numeric", a.fn, v.Name))
+		}
+		return v.Numbers
+	case []interface{}:
+		out := make([]float64, len(v))
+		for j, el := range v {
+			f, ok := el.(float64)
+			if !ok {
+				panic(fmt.Sprintf("%s: %s must hold only numbers", a.fn, name))
+			}
+			out[j] = f
+		}
+		return out
+	default:
+		panic(fmt.Sprintf("%s: %s must be a column or an array of numbers", a.fn, name))
+	}
+}
+
+// roc_auc(model, data) scores the predicted probability of the larger
+// class; roc_auc(y_true, scores) takes the scores directly.
+func builtinROCAUC(a *args) interface{} {
+	yTrue, scores := a.truthAndProbabilities()
+	auc, err := metrics.ROCAUC(yTrue, scores)
+	if err != nil {
+		panic(fmt.Sprintf("roc_auc: %s", err))
+	}
+	return auc
+}
+
+// log_loss(model, data) uses every class probability; log_loss(y_true, p)
+// takes the probability of the larger of two classes.
+func builtinLogLoss(a *args) interface{} {
+	var (
+		yTrue   []float64
+		proba   [][]float64
+		classes []float64
+	)
+	if est, ok := a.value("y_true").(*model.Estimator); ok {
+		d := a.dataset("y_pred")
+		yTrue = a.target(est, d)
+		proba, classes = a.probabilities(est, d)
+	} else {
+		yTrue = a.numbers("y_true")
+		positive := a.numbers("y_pred")
+		if classes = metrics.Labels(yTrue, nil); len(classes) != 2 {
+			panic(fmt.Sprintf("log_loss: a probability column needs exactly 2 classes in y_true, found %d", len(classes)))
+		}
+		proba = make([][]float64, len(positive))
+		for i, p := range positive {
+			proba[i] = []float64{1 - p, p}
+		}
+	}
+	loss, err := metrics.LogLoss(yTrue, proba, classes)
+	if err != nil {
+		panic(fmt.Sprintf("log_loss: %s", err))
+	}
+	return loss
+}
+
+func (a *args) truthAndProbabilities() (yTrue, scores []float64) {
+	est, ok := a.value("y_true").(*model.Estimator)
+	if !ok {
+		return a.numbers("y_true"), a.numbers("y_pred")
+	}
+	d := a.dataset("y_pred")
+	proba, classes := a.probabilities(est, d)
+	if len(classes) != 2 {
+		panic(fmt.Sprintf("%s: the model has %d classes; ROC AUC needs 2", a.fn, len(classes)))
+	}
+	scores = make([]float64, len(proba))
+	for i, p := range proba {
+		scores[i] = p[1]
+	}
+	return a.target(est, d), scores
+}
+
+// probabilities returns est's class probabilities for every row of d.
+func (a *args) probabilities(est *model.Estimator, d *dataset.Dataset) ([][]float64, []float64) {
+	c, ok := est.Model.(model.Classifier)
+	if !ok || !model.IsClassifier(est.Model) {
+		panic(fmt.Sprintf("%s: %s is not a classifier", a.fn, est))
+	}
+	X, err := d.Matrix(est.Features)
+	if err != nil {
+		panic(fmt.Sprintf("%s: %s", a.fn, err))
+	}
+	proba, err := c.PredictProba(X)
+	if err != nil {
+		panic(fmt.Sprintf("%s: %s", a.fn, err))
+	}
+	return proba, c.Classes()
+}
+
+// confusion_matrix(y_true, y_pred) or confusion_matrix(model, data) returns
+// {labels: [...], matrix: [[...]]}, rows being true classes.
+func builtinConfusionMatrix(a *args) interface{} {
+	yTrue, yPred := a.truthAndPredictions()
+	labels, matrix, err := metrics.ConfusionMatrix(yTrue, yPred)
+	if err != nil {
+		panic(fmt.Sprintf("confusion_matrix: %s", err))
+	}
+	return confusionRecord(labels, matrix)
+}
+
+func confusionRecord(labels []float64, matrix [][]int) map[string]interface{} {
+	labelValues := make([]interface{}, len(labels))
+	rows := make([]interface{}, len(matrix))
+	for i := range matrix {
+		labelValues[i] = labels[i]
+		row := make([]interface{}, len(matrix[i]))
+		for j, n := range matrix[i] {
+			row[j] = float64(n)
+		}
+		rows[i] = row
+	}
+	return map[string]interface{}{"labels": labelValues, "matrix": rows}
+}
+
+// evaluate(model, data) returns every applicable metric as a record;
+// classifiers also get a confusion_matrix entry. Data defaults to df.
+func builtinEvaluate(a *args) interface{} {
+	est := a.estimator("model")
+	var d *dataset.Dataset
+	if a.has("data") {
+		d = a.dataset("data")
+	} else {
+		d = datasetVariable(a.variables, "")
+	}
+	report := evaluate(est, d)
+	return reportRecord(report)
+}
+
+func evaluate(est *model.Estimator, d *dataset.Dataset) *model.Report {
+	if !est.Trained() {
+		panic(fmt.Sprintf("evaluate: %s has not been trained", est))
+	}
+	report, err := model.Evaluate(est, d)
+	if err != nil {
+		panic(fmt.Sprintf("Error evaluating %s: %s", est, err))
+	}
+	return report
+}
+
+func reportRecord(report *model.Report) map[string]interface{} {
+	out := record(report.Metrics)
+	if report.Confusion != nil {
+		out["confusion_matrix"] = confusionRecord(report.Labels, report.Confusion)
+	}
+	return out
+}
@@ -0,0 +1,239 @@
+package interpreter
+
+import (
+	"fmt"
+	"math"
+	"mlite/dataset"
+)
+
+// operate applies a binary operator. Numbers, strings and booleans combine
+// as scalars. When either side is a column or a row mask ([]bool, what
+// comparing a column gives) the operator applies row by row, scalars are
+// broadcast, and the result is a column or a mask:
+//
+//	price / sqft          a numeric column
+//	price > 100000        a mask
+//	city == "austin" && age < 20
+//
+// Missing values compare unequal to everything, and arithmetic on them
+// gives a missing value.
+func operate(op string, left, right interface{}) interface{} {
+	n, vector := rows(left)
+	if m, ok := rows(right); ok {
+		if vector && m != n {
+			panic(fmt.Sprintf("Cannot combine %d rows with %d rows in '%s'", n, m, op))
+		}
+		n, vector = m, true
+	}
+	if !vector {
+		return scalarOp(op, left, right)
+	}
+	if n == 0 {
+		return empty(op != "+" && op != "-" && op != "*" && op != "/")
+	}
+	results := make([]interface{}, n)
+	for i := range results {
+		l, r := element(left, i), element(right, i)
+		switch {
+		case !isMissing(l) && !isMissing(r):
+			results[i] = scalarOp(op, l, r)
+		case op == "==", op == "<", op == "<=", op == ">", op == ">=":
+			results[i] = false
+		case op == "!=":
+			results[i] = true
+		default:
+			// Arithmetic on NaN stays NaN; text has no such value.
+			results[i] = scalarOp(op, l, r)
+			if _, ok := results[i].(string); ok {
+				results[i] = ""
+			}
+		}
+	}
+	return collect(results)
+}
+
+// negate applies a prefix operator: - to numbers, ! to booleans.
+func negate(op string, operand interface{}) interface{} {
+	n, vector := rows(operand)
+	if !vector {
+		return scalarNegate(op, operand)
+	}
+	if n == 0 {
+		return empty(op == "!")
+	}
+	results := make([]interface{}, n)
+	for i := range results {
+		results[i] = scalarNegate(op, element(operand, i))
+	}
+	return collect(results)
+}
+
+// rows returns the length of a column or mask operand.
+func rows(v interface{}) (int, bool) {
+	switch v := v.(type) {
+	case *dataset.Column:
+		return v.Len(), true
+	case []bool:
+		return len(v), true
+	}
+	return 0, false
+}
+
+// element returns row i of a vector operand, or a scalar operand itself.
+// Missing text is the empty string, as in columns.
+func element(v interface{}, i int) interface{} {
+	switch v := v.(type) {
+	case *dataset.Column:
+		if v.Type == dataset.Numeric {
+			return v.Numbers[i]
+		}
+		return v.Strings[i]
+	case []bool:
+		return v[i]
+	}
+	return v
+}
+
+// empty returns the result of an operator over no rows: a mask when the
+// operator gives booleans, otherwise a numeric column.
+func empty(boolean bool) interface{} {
+	if boolean {
+		return []bool{}
+	}
+	return dataset.NewNumeric("", nil)
+}
+
+// collect turns row results into a mask, a numeric column or a text column.
+func collect(results []interface{}) interface{} {
+	switch results[0].(type) {
+	case bool:
+		mask := make([]bool, len(results))
+		for i, r := range results {
+			mask[i] = r.(bool)
+		}
+		return mask
+	case string:
+		values := make([]string, len(results))
+		for i, r := range results {
+			values[i] = r.(string)
+		}
+		return dataset.NewText("", values)
+	}
+	values := make([]float64, len(results))
+	for i, r := range results {
+		values[i] = r.(float64)
+	}
+	return dataset.NewNumeric("", values)
+}
+
+func scalarOp(op string, left, right interface{}) interface{} {
+	switch op {
+	case "&&", "||":
+		l, lok := left.(bool)
+		r, rok := right.(bool)
+		if !lok || !rok {
+			panic(fmt.Sprintf("'%s' needs true/false operands, got %s and %s", op, formatValue(left), formatValue(right)))
+		}
+		if op == "&&" {
+			return l && r
+		}
+		return l || r
+	}
+
+	if l, ok := left.(string); ok {
+		r, ok := right.(string)
+		if !ok {
+			panic(fmt.Sprintf("Cannot apply '%s' to text %q and %s", op, l, formatValue(right)))
+		}
+		switch op {
+		case "+":
+			return l + r
+		case "==":
+			return l == r
+		case "!=":
+			return l != r
+		case "<":
+			return l < r
+		case "<=":
+			return l <= r
+		case ">":
+			return l > r
+		case ">=":
+			return l >= r
+		}
+		panic(fmt.Sprintf("Cannot apply '%s' to text", op))
+	}
+
+	l, r := number(left, op), number(right, op)
+	switch op {
+	case "+":
+		return l + r
+	case "-":
+		return l - r
+	case "*":
+		return l * r
+	case "/":
+		return l / r
+	case "==":
+		return l == r
+	case "!=":
+		return l != r
+	case "<":
+		return l < r
+	case "<=":
+		return l <= r
+	case ">":
+		return l > r
+	case ">=":
+		return l >= r
+	}
+	panic(fmt.Sprintf("Unsupported operator: %s", op))
+}
+
+func scalarNegate(op string, operand interface{}) interface{} {
+	if op == "!" {
+		b, ok := operand.(bool)
+		if !ok {
+			panic(fmt.Sprintf("'!' needs a true/false operand, got %s", formatValue(operand)))
+		}
+		return !b
+	}
+	return -number(operand, op)
+}
+
+// number returns a numeric operand of op.
+func number(v interface{}, op string) float64 {
+	switch v := v.(type) {
+	case float64:
+		return v
+	case int:
+		return float64(v)
+	}
+	panic(fmt.Sprintf("'%s' needs numbers, got %s", op, formatValue(v)))
+}
+
+// columnScope returns variables with the columns of d added, so column
+// expressions such as price / sqft can name columns directly. A column
+// hides a variable of the same name.
+func columnScope(d *dataset.Dataset, variables map[string]interface{}) map[string]interface{} {
+	scope := make(map[string]interface{}, len(variables)+len(d.Columns))
+	for name, v := range variables {
+		scope[name] = v
+	}
+	for _, c := range d.Columns {
+		scope[c.Name] = c
+	}
+	return scope
+}
+
+// isMissing reports whether a column element is a missing value: NaN or
+// empty text.
+func isMissing(v interface{}) bool {
+	switch v := v.(type) {
+	case float64:
+		return math.IsNaN(v)
+	case string:
+		return v == ""
+	}
+	return false
+}
@@ -0,0 +1,169 @@
+package interpreter
+
+import (
+	"fmt"
+	"mlite/dataset"
+	"mlite/model"
+	"mlite/parser"
+	"strings"
+)
+
+// Preprocessing builtins fit a step on their data (df by default) and return
+// the transformed copy, which remembers the step so models trained on it
+// replay the step when they predict. Called as a statement they update the
+// data variable in place instead:
+//
+//	standardize([sqft, age])            // df is standardized
+//	let scaled :: standardize(sqft, data: tr);
+var preprocessing = map[string]bool{
+	"standardize":  true,
+	"minmax_scale": true,
+	"one_hot":      true,
+	"label_encode": true,
+	"impute":       true,
+	"drop_na":      true,
+	"clip":         true,
+}
+
+// inPlaceTarget returns the variable a preprocessing statement updates: the
+// data argument when it names a variable, else df.
+func inPlaceTarget(call *parser.ExpressionNode, variables map[string]interface{}) (string, bool) {
+	name := call.Value.(string)
+	if !preprocessing[name] {
+		return "", false
+	}
+	a := bindArgs(name, builtins[name].params, call, variables, nil)
+	e, ok := a.raw["data"]
+	switch {
+	case !ok:
+		return "df", true
+	case e.Type == parser.IDENTIFIER:
+		return e.Value.(string), true
+	}
+	return "", false
+}
+
+// preprocessData returns the data argument, defaulting to df.
+func (a *args) preprocessData() *dataset.Dataset {
+	if a.has("data") {
+		return a.dataset("data")
+	}
+	return datasetVariable(a.variables, "")
+}
+
+// step builds the unfitted step a preprocessing call describes:
+//
+//	standardize([sqft, age])             zero mean and unit variance
+//	minmax_scale(sqft, min: -1, max: 1)  the range mapped onto [min, max], [0, 1] by default
+//	one_hot(city)                        a 0/1 column per category in place of city
+//	label_encode(city)                   category codes in place of a text column
+//	impute(age, strategy: "median")      missing values filled; see dataset.Step
+//	clip(price, lower: 0)                values bounded by lower:, upper: or both
+func (a *args) step() dataset.Step {
+	s := dataset.Step{Kind: a.fn, Options: map[string]interface{}{}}
+	switch a.fn {
+	case "one_hot", "label_encode", "impute":
+		s.Columns = []string{a.requiredColumn("column")}
+	default:
+		s.Columns = a.requiredColumns("columns")
+	}
+	for _, name := range []string{"min", "max", "lower", "upper"} {
+		if a.has(name) {
+			s.Options[name] = a.float(name, 0)
+		}
+	}
+	if a.has("strategy") {
+		s.Options["strategy"] = a.string("strategy")
+	}
+	if a.has("value") {
+		s.Options["value"] = a.value("value")
+	}
+	if a.fn == "clip" && !a.has("lower") && !a.has("upper") {
+		panic("clip: give lower:, upper: or both")
+	}
+	return s
+}
+
+// builtinPreprocess fits the step of a preprocessing call on its data and
+// applies it.
+func builtinPreprocess(a *args) interface{} {
+	step := a.step()
+	d := a.preprocessData()
+	t, err := step.Fit(d)
+	if err != nil {
+		panic(fmt.Sprintf("%s: %s", a.fn, err))
+	}
+	out, err := d.Apply(t)
+	if err != nil {
+		panic(fmt.Sprintf("%s: %s", a.fn, err))
+	}
+	return out
+}
+
+// requiredColumns returns a column-list argument that must be given.
+func (a *args) requiredColumns(name string) []string {
+	columns := a.columns(name)
+	if columns == nil {
+		panic(fmt.Sprintf("%s: missing argument %s", a.fn, name))
+	}
+	return columns
+}
+
+// requiredColumn returns a single column-name argument that must be given.
+func (a *args) requiredColumn(name string) string {
+	column := a.column(name)
+	if column == "" {
+		panic(fmt.Sprintf("%s: missing argument %s", a.fn, name))
+	}
+	return column
+}
+
+// drop_na() drops rows with a missing value in any column, or in the given
+// columns. It is not replayed at prediction time: every row gets a prediction.
+func builtinDropNA(a *args) interface{} {
+	out, err := a.preprocessData().DropNA(a.columns("columns"))
+	if err != nil {
+		panic(fmt.Sprintf("drop_na: %s", err))
+	}
+	return out
+}
+
+// pipeline([standardize(sqft), one_hot(city), linreg()]) bundles
+// preprocessing steps with a model. Nothing is fitted here: train fits the
+// steps on the training data and then the model, which replays the fitted
+// steps wherever it predicts. The model may also be a type name or a model
+// variable.
+func builtinPipeline(a *args) interface{} {
+	list, ok := a.raw["steps"]
+	if !ok || list.Type != parser.ARRAY || len(list.Args) == 0 {
+		panic("pipeline: give a list of preprocessing steps ending with a model")
+	}
+	var steps []dataset.Step
+	for _, e := range list.Args[:len(list.Args)-1] {
+		name, _ := e.Value.(string)
+		if e.Type != parser.CALL || !preprocessing[name] || name == "drop_na" {
+			panic(fmt.Sprintf("pipeline: %v is not a preprocessing step (have %s)", e.Value, strings.Join(dataset.StepKinds, ", ")))
+		}
+		step := bindArgs(name, builtins[name].params, e, a.variables, a.events)
+		if step.has("data") {
+			panic(fmt.Sprintf("pipeline: %s takes no data: inside a pipeline", name))
+		}
+		steps = append(steps, step.step())
+	}
+
+	last := list.Args[len(list.Args)-1]
+	var spec model.Spec
+	if name, ok := last.Value.(string); ok && last.Type == parser.IDENTIFIER && model.IsRegistered(name) && a.variables[name] == nil {
+		spec = model.Spec{Type: name}
+	} else if est, ok := evaluateExpression(last, a.variables, a.events).(*model.Estimator); ok {
+		spec = est.Spec
+	} else {
+		panic("pipeline: the last step must be a model")
+	}
+	spec.Steps = append(steps, spec.Steps...)
+	est, err := model.NewEstimator(spec)
+	if err != nil {
+		panic(fmt.Sprintf("pipeline: %s", err))
+	}
+	return est
+}
@@ -0,0 +1,197 @@
+package interpreter
+
+import (
+	"fmt"
+	"mlite/dataset"
+	"mlite/parser"
+)
+
+// Query builtins return a new dataset and leave their input untouched.
+// Expressions in filter and with_column name columns of the data directly:
+//
+//	let recent :: filter(df, price > 100000 && age < 20);
+//	let priced :: with_column(recent, "ppsf", price / sqft);
+
+// select(df, [a, b]) keeps the named columns, in that order. On a
+// streamed dataset it applies to every batch as it is read.
+func builtinSelect(a *args) interface{} {
+	columns := a.requiredColumns("columns")
+	data, s := a.source("data")
+	if s != nil {
+		return a.stream(s.Then(func(d *dataset.Dataset) (*dataset.Dataset, error) {
+			return d.Select(columns)
+		}))
+	}
+	out, err := data.Select(columns)
+	if err != nil {
+		panic(fmt.Sprintf("select: %s", err))
+	}
+	return out
+}
+
+// filter(df, price > 100000) keeps the rows where the condition holds. On a
+// streamed dataset it applies to every batch as it is read, with the
+// variables the condition names as they are now.
+func builtinFilter(a *args) interface{} {
+	e, ok := a.raw["condition"]
+	if !ok {
+		panic("filter: missing argument condition")
+	}
+	data, s := a.source("data")
+	if s == nil {
+		return filterRows(data, e, a.variables, a.events)
+	}
+	variables := make(map[string]interface{}, len(a.variables))
+	for name, v := range a.variables {
+		variables[name] = v
+	}
+	return a.stream(s.Then(func(d *dataset.Dataset) (*dataset.Dataset, error) {
+		return filterRows(d, e, variables, a.events), nil
+	}))
+}
+
+func filterRows(d *dataset.Dataset, e *parser.ExpressionNode, variables map[string]interface{}, events EventSink) *dataset.Dataset {
+	var keep []bool
+	switch c := evaluateExpression(e, columnScope(d, variables), events).(type) {
+	case []bool:
+		keep = c
+	case bool:
+		keep = make([]bool, d.NumRows())
+		for i := range keep {
+			keep[i] = c
+		}
+	default:
+		panic(fmt.Sprintf("filter: the condition must compare columns, got %s", formatValue(c)))
+	}
+	out, err := d.Filter(keep)
+	if err != nil {
+		panic(fmt.Sprintf("filter: %s", err))
+	}
+	return out
+}
+
+// sort(df, by: price, desc: true) orders rows by one column or a list of
+// them, ascending unless desc: true. Missing values go last.
+func builtinSort(a *args) interface{} {
+	out, err := a.dataset("data").Sort(a.requiredColumns("by"), a.bool("desc", false))
+	if err != nil {
+		panic(fmt.Sprintf("sort: %s", err))
+	}
+	return out
+}
+
+// with_column(df, "ppsf", price / sqft) adds a column computed from the
+// others, or replaces the column of that name. A condition gives a 0/1
+// column and a plain value fills every row.
+func builtinWithColumn(a *args) interface{} {
+	d := a.dataset("data")
+	name := a.column("name")
+	if name == "" {
+		panic("with_column: missing argument name")
+	}
+	e, ok := a.raw["value"]
+	if !ok {
+		panic("with_column: missing argument value")
+	}
+
+	var c *dataset.Column
+	switch v := evaluateExpression(e, columnScope(d, a.variables), a.events).(type) {
+	case *dataset.Column:
+		c = &dataset.Column{Name: name, Type: v.Type, Numbers: v.Numbers, Strings: v.Strings}
+	case []bool:
+		values := make([]float64, len(v))
+		for i, b := range v {
+			if b {
+				values[i] = 1
+			}
+		}
+		c = dataset.NewNumeric(name, values)
+	case float64:
+		values := make([]float64, d.NumRows())
+		for i := range values {
+			values[i] = v
+		}
+		c = dataset.NewNumeric(name, values)
+	case string:
+		values := make([]string, d.NumRows())
+		for i := range values {
+			values[i] = v
+		}
+		c = dataset.NewText(name, values)
+	default:
+		panic(fmt.Sprintf("with_column: cannot make a column of %s", formatValue(v)))
+	}
+	out, err := d.WithColumn(c)
+	if err != nil {
+		panic(fmt.Sprintf("with_column: %s", err))
+	}
+	return out
+}
+
+// head(df, 10) returns the first rows, 5 by default.
+func builtinHead(a *args) interface{} {
+	return a.dataset("data").Head(a.int("n", 5))
+}
+
+// tail(df, 10) returns the last rows, 5 by default.
+func builtinTail(a *args) interface{} {
+	return a.dataset("data").Tail(a.int("n", 5))
+}
+
+// sample(df, 100, seed: 1) draws rows at random without replacement.
+func builtinSample(a *args) interface{} {
+	if !a.has("n") {
+		panic("sample: missing argument n")
+	}
+	out, err := a.dataset("data").Sample(a.int("n", 0), int64(a.int("seed", 0)))
+	if err != nil {
+		panic(fmt.Sprintf("sample: %s", err))
+	}
+	return out
+}
+
+// describe(df) profiles every column: type, counts, summary statistics,
+// distinct and most frequent values, and the correlations between numeric
+// columns. df defaults to the loaded data.
+//
+// A streamed dataset is profiled in one pass; see dataset.Stream.Describe.
+func builtinDescribe(a *args) interface{} {
+	if s, ok := a.variables["df"].(*dataset.Stream); ok && !a.has("data") {
+		return a.describeStream(s)
+	}
+	if !a.has("data") {
+		return datasetVariable(a.variables, "").Describe()
+	}
+	data, s := a.source("data")
+	if s != nil {
+		return a.describeStream(s)
+	}
+	return data.Describe()
+}
+
+func (a *args) describeStream(s *dataset.Stream) *dataset.Profile {
+	p, err := s.Describe()
+	if err != nil {
+		panic(fmt.Sprintf("describe: %s", err))
+	}
+	return p
+}
+
+// stream returns the stream a query built, or panics with its error.
+func (a *args) stream(s *dataset.Stream, err error) *dataset.Stream {
+	if err != nil {
+		panic(fmt.Sprintf("%s: %s", a.fn, err))
+	}
+	return s
+}
+
+func (a *args) bool(name string, def bool) bool {
+	if !a.has(name) {
+		return def
+	}
+	b, ok := a.value(name).(bool)
+	if !ok {
+		panic(fmt.Sprintf("%s: %s must be true or false", a.fn, name))
+	}
+	return b
+}
@@ -0,0 +1,109 @@
+package interpreter
+
+import (
+	"maps"
+	"mlite/trace"
+	"time"
+)
+
+// TraceRecorder is an EventSink that records a run as a trace.json for
+// the workbench debugger: every statement that ran, where it is in the
+// source, what it changed and how long it took.
+//
+//	recorder := NewTraceRecorder("housing.mlite")
+//	NewInterpreter(MultiSink(NewTextSink(os.Stdout), recorder)).Run(nodes)
+//	trace.Write("trace.json", recorder.Trace())
+type TraceRecorder struct {
+	trace     trace.Trace
+	started   time.Time
+	open      []int // the steps that have started and not ended, innermost last
+	iteration []int // for each open step, the loop pass its block is in
+	variables map[string]string
+}
+
+func NewTraceRecorder(source string) *TraceRecorder {
+	now := time.Now()
+	return &TraceRecorder{
+		trace:     trace.Trace{Version: trace.Version, Source: source, Started: now.UTC(), Steps: []trace.Step{}},
+		started:   now,
+		variables: map[string]string{},
+	}
+}
+
+func (r *TraceRecorder) Emit(e Event) {
+	if e.Type == StatementStart {
+		r.start(e)
+		return
+	}
+	if len(r.open) == 0 {
+		return
+	}
+	step := &r.trace.Steps[r.open[len(r.open)-1]]
+	if e.Message != "" {
+		step.Output = append(step.Output, e.Message)
+	}
+	switch e.Type {
+	case StatementEnd:
+		step.DurationMS = r.since() - step.StartMS
+		step.Error = e.Error
+		step.Variables = maps.Clone(r.variables)
+		r.open, r.iteration = r.open[:len(r.open)-1], r.iteration[:len(r.iteration)-1]
+	case VariableChange, ModelTrained:
+		r.variables[e.Name] = e.Value
+		if step.Changes == nil {
+			step.Changes = map[string]string{}
+		}
+		step.Changes[e.Name] = e.Value
+	case LoopIteration:
+		count := e.Count
+		step.Iterations = &count
+		r.iteration[len(r.iteration)-1] = e.Iteration
+	case BranchTaken:
+		step.Branch = &trace.Branch{Condition: e.Condition, Taken: e.Taken}
+	case MetricComputed:
+		if step.Metrics == nil {
+			step.Metrics = map[string]float64{}
+		}
+		maps.Copy(step.Metrics, e.Metrics)
+	case Log:
+		if e.Iteration > 0 && e.Metrics != nil {
+			step.Progress = append(step.Progress, trace.Progress{Iteration: e.Iteration, Metrics: e.Metrics})
+		}
+	}
+}
+
+// start opens a step for a statement, under the innermost open one.
+func (r *TraceRecorder) start(e Event) {
+	step := trace.Step{Index: len(r.trace.Steps), Statement: e.Statement, Span: e.Span, StartMS: r.since(), Variables: maps.Clone(r.variables)}
+	if n := len(r.open); n > 0 {
+		parent := r.open[n-1]
+		step.Parent = &parent
+		step.Depth = r.trace.Steps[parent].Depth + 1
+		step.Iteration = r.iteration[n-1]
+	}
+	if step.Statement == "loop" {
+		zero := 0
+		step.Iterations = &zero
+	}
+	r.trace.Steps = append(r.trace.Steps, step)
+	r.open = append(r.open, step.Index)
+	r.iteration = append(r.iteration, 0)
+}
+
+// since returns the milliseconds since the run started.
+func (r *TraceRecorder) since() float64 {
+	return float64(time.Since(r.started)) / float64(time.Millisecond)
+}
+
+// Trace returns the trace recorded so far. A run that panicked leaves its
+// error on the statement that failed, and on the trace.
+func (r *TraceRecorder) Trace() *trace.Trace {
+	t := r.trace
+	t.Error = ""
+	for _, s := range t.Steps {
+		if s.Error != "" && s.Parent == nil {
+			t.Error = s.Error
+		}
+	}
+	return &t
+}
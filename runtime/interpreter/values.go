@@ -0,0 +1,65 @@
+package interpreter
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// formatValue renders an MLite value for output: whole numbers without an
+// exponent, other numbers to 6 significant digits, arrays as [a, b] and
+// records as {name: value} with keys sorted, so printed results are stable.
+// Row masks show their first values, as columns do.
+func formatValue(value interface{}) string {
+	switch v := value.(type) {
+	case float64:
+		if v == math.Trunc(v) && math.Abs(v) < 1e15 {
+			return strconv.FormatFloat(v, 'f', -1, 64)
+		}
+		return fmt.Sprintf("%.6g", v)
+	case []bool:
+		parts := make([]string, 0, 6)
+		for j := 0; j < len(v) && j < 5; j++ {
+			parts = append(parts, strconv.FormatBool(v[j]))
+		}
+		if len(v) > 5 {
+			parts = append(parts, fmt.Sprintf("... %d values", len(v)))
+		}
+		return "[" + strings.Join(parts, ", ") + "]"
+	case []interface{}:
+		parts := make([]string, len(v))
+		for j, el := range v {
+			parts[j] = formatValue(el)
+		}
+		return "[" + strings.Join(parts, ", ") + "]"
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		parts := make([]string, len(keys))
+		for j, k := range keys {
+			parts[j] = k + ": " + formatValue(v[k])
+		}
+		return "{" + strings.Join(parts, ", ") + "}"
+	default:
+		return fmt.Sprintf("%v", v)
+	}
+}
+
+// formatBytes renders a size in bytes with a binary unit, e.g. "64 MiB".
+func formatBytes(n int64) string {
+	const units = "KMGTPE"
+	if n < 1024 {
+		return fmt.Sprintf("%d B", n)
+	}
+	v, unit := float64(n)/1024, 0
+	for v >= 1024 && unit < len(units)-1 {
+		v /= 1024
+		unit++
+	}
+	return formatValue(math.Round(v*10)/10) + " " + units[unit:unit+1] + "iB"
+}
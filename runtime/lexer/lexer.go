@@ -3,25 +3,73 @@ package lexer
 import (
 	"fmt"
 	"mlite/token"
+	"sort"
 	"strings"
 )
 
 type Lexer struct {
-	input string
-	pos   int
+	input      string
+	pos        int
+	lineStarts []int // byte offset of the start of each line
 }
 
 func NewLexer(input string) *Lexer {
-	return &Lexer{input: input}
+	l := &Lexer{input: input, lineStarts: []int{0}}
+	for i := 0; i < len(input); i++ {
+		if input[i] == '\n' {
+			l.lineStarts = append(l.lineStarts, i+1)
+		}
+	}
+	return l
 }
 
 func (l *Lexer) NextToken() token.Token {
-	// fmt.Printf("Processing char: %q at position %d\n", l.input[l.pos], l.pos)
-	// Skip whitespace
-	for l.pos < len(l.input) && (l.input[l.pos] == ' ' || l.input[l.pos] == '\t' || l.input[l.pos] == '\n' || l.input[l.pos] == '\r') {
-		l.pos++
+	comment := l.skipSpace()
+	start := l.position(l.pos)
+	tok := l.next()
+	tok.Comment = comment
+	tok.Start, tok.End = start, l.position(l.pos)
+	return tok
+}
+
+// position turns a byte offset into a line and column.
+func (l *Lexer) position(offset int) token.Position {
+	line := sort.Search(len(l.lineStarts), func(i int) bool { return l.lineStarts[i] > offset })
+	return token.Position{Line: line, Column: offset - l.lineStarts[line-1] + 1}
+}
+
+// skipSpace skips whitespace and # comments, returning the text of the
+// comments on lines of their own, one line each. A comment after code on
+// the same line is skipped but not returned, as it does not document the
+// token that follows it.
+func (l *Lexer) skipSpace() string {
+	var lines []string
+	ownLine := l.pos == 0
+	for l.pos < len(l.input) {
+		switch l.input[l.pos] {
+		case '\n':
+			ownLine = true
+			l.pos++
+		case ' ', '\t', '\r':
+			l.pos++
+		case '#':
+			end := strings.IndexByte(l.input[l.pos:], '\n')
+			if end < 0 {
+				end = len(l.input) - l.pos
+			}
+			if ownLine {
+				lines = append(lines, strings.TrimSpace(l.input[l.pos+1:l.pos+end]))
+			}
+			l.pos += end
+		default:
+			return strings.Join(lines, "\n")
+		}
 	}
+	return strings.Join(lines, "\n")
+}
 
+func (l *Lexer) next() token.Token {
+	// fmt.Printf("Processing char: %q at position %d\n", l.input[l.pos], l.pos)
 	if l.pos >= len(l.input) {
 		// fmt.Println("End of input reached")
 		return token.Token{Type: token.EOF}
@@ -54,15 +102,45 @@ func (l *Lexer) NextToken() token.Token {
 	case strings.HasPrefix(l.input[l.pos:], "predict") && (l.pos+7 >= len(l.input) || !isLetterOrDigit(l.input[l.pos+7])):
 		l.pos += 7
 		return token.Token{Type: token.PREDICT, Literal: "predict"}
+	case strings.HasPrefix(l.input[l.pos:], "evaluate") && (l.pos+8 >= len(l.input) || !isLetterOrDigit(l.input[l.pos+8])):
+		l.pos += 8
+		return token.Token{Type: token.EVALUATE, Literal: "evaluate"}
 	case strings.HasPrefix(l.input[l.pos:], "::"):
 		l.pos += 2
 		return token.Token{Type: token.ASSIGN, Literal: "::"}
+	case ch == ':':
+		l.pos++
+		return token.Token{Type: token.COLON, Literal: ":"}
 	case l.input[l.pos] == ';':
 		l.pos++
 		return token.Token{Type: token.SEMICOLON, Literal: ";"}
 	case strings.HasPrefix(l.input[l.pos:], "=="):
 		l.pos += 2
 		return token.Token{Type: token.EQ, Literal: "=="}
+	case strings.HasPrefix(l.input[l.pos:], "!="):
+		l.pos += 2
+		return token.Token{Type: token.NOT_EQ, Literal: "!="}
+	case strings.HasPrefix(l.input[l.pos:], "&&"):
+		l.pos += 2
+		return token.Token{Type: token.AND, Literal: "&&"}
+	case strings.HasPrefix(l.input[l.pos:], "||"):
+		l.pos += 2
+		return token.Token{Type: token.OR, Literal: "||"}
+	case ch == '!':
+		l.pos++
+		return token.Token{Type: token.BANG, Literal: "!"}
+	case ch == '+':
+		l.pos++
+		return token.Token{Type: token.PLUS, Literal: "+"}
+	case ch == '-':
+		l.pos++
+		return token.Token{Type: token.MINUS, Literal: "-"}
+	case ch == '*':
+		l.pos++
+		return token.Token{Type: token.ASTERISK, Literal: "*"}
+	case ch == '/':
+		l.pos++
+		return token.Token{Type: token.SLASH, Literal: "/"}
 	case strings.HasPrefix(l.input[l.pos:], ">="):
 		l.pos += 2
 		return token.Token{Type: token.GTE, Literal: ">="}
@@ -99,6 +177,9 @@ func (l *Lexer) NextToken() token.Token {
 	case ch == ',':
 		l.pos++
 		return token.Token{Type: token.COMMA, Literal: ","}
+	case ch == '.':
+		l.pos++
+		return token.Token{Type: token.DOT, Literal: "."}
 	case ch == '"':
 		l.pos++ // Skip opening quote
 		start := l.pos
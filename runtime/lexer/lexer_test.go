@@ -51,3 +51,84 @@ func TestIdentifier(t *testing.T) {
         t.Fatalf("expected 'data', got %s", tok.Literal)
     }
 }
+
+func TestNamedArgumentColon(t *testing.T) {
+	lex := NewLexer("let m :: gbm_regressor(max_depth: 3);")
+	want := []token.TokenType{
+		token.LET, token.IDENTIFIER, token.ASSIGN, token.IDENTIFIER, token.LPAREN,
+		token.IDENTIFIER, token.COLON, token.NUMBER, token.RPAREN, token.SEMICOLON, token.EOF,
+	}
+	for i, expected := range want {
+		if tok := lex.NextToken(); tok.Type != expected {
+			t.Fatalf("test[%d] - expected=%q, got=%q (%q)", i, expected, tok.Type, tok.Literal)
+		}
+	}
+}
+
+func TestEvaluateAndMemberAccess(t *testing.T) {
+	lex := NewLexer("evaluate(m, te) let r :: rmse(te.price, p); let x :: 1.5;")
+	want := []token.TokenType{
+		token.EVALUATE, token.LPAREN, token.IDENTIFIER, token.COMMA, token.IDENTIFIER, token.RPAREN,
+		token.LET, token.IDENTIFIER, token.ASSIGN, token.IDENTIFIER, token.LPAREN,
+		token.IDENTIFIER, token.DOT, token.IDENTIFIER, token.COMMA, token.IDENTIFIER, token.RPAREN, token.SEMICOLON,
+		token.LET, token.IDENTIFIER, token.ASSIGN, token.NUMBER, token.SEMICOLON, token.EOF,
+	}
+	for i, expected := range want {
+		if tok := lex.NextToken(); tok.Type != expected {
+			t.Fatalf("test[%d] - expected=%q, got=%q (%q)", i, expected, tok.Type, tok.Literal)
+		}
+	}
+}
+
+// Checks that operators lex as single tokens, longest match first.
+func TestOperators(t *testing.T) {
+	want := []token.TokenType{
+		token.IDENTIFIER, token.GTE, token.NUMBER, token.AND, token.BANG, token.IDENTIFIER, token.OR,
+		token.MINUS, token.IDENTIFIER, token.ASTERISK, token.IDENTIFIER, token.SLASH, token.NUMBER,
+		token.PLUS, token.NUMBER, token.NOT_EQ, token.STRING, token.EOF,
+	}
+	lex := NewLexer(`a >= 1 && !b || -c * d / 2 + 3 != "x"`)
+	for i, expected := range want {
+		if tok := lex.NextToken(); tok.Type != expected {
+			t.Fatalf("token %d: got %s (%q), want %s", i, tok.Type, tok.Literal, expected)
+		}
+	}
+}
+
+// Checks that # comments are skipped, and that those on lines of their own
+// are attached to the next token while one after code is dropped.
+func TestComments(t *testing.T) {
+	lex := NewLexer("# Load the data\n#   twice\nload(\"a.csv\") # trailing\n\n# Train\ntrain(m, x, y) #")
+	var comments []string
+	for tok := lex.NextToken(); tok.Type != token.EOF; tok = lex.NextToken() {
+		if tok.Comment != "" {
+			comments = append(comments, tok.Literal+": "+tok.Comment)
+		}
+	}
+	want := []string{"load: Load the data\ntwice", "train: Train"}
+	if len(comments) != len(want) || comments[0] != want[0] || comments[1] != want[1] {
+		t.Fatalf("comments: got %q, want %q", comments, want)
+	}
+}
+
+// Checks that tokens carry 1-based line and column positions, including
+// after a string spanning lines.
+func TestPositions(t *testing.T) {
+	lex := NewLexer("load(\"a.csv\")\n  let s :: \"x\ny\";")
+	want := []struct{ start, end token.Position }{
+		{token.Position{Line: 1, Column: 1}, token.Position{Line: 1, Column: 5}},
+		{token.Position{Line: 1, Column: 5}, token.Position{Line: 1, Column: 6}},
+		{token.Position{Line: 1, Column: 6}, token.Position{Line: 1, Column: 13}},
+		{token.Position{Line: 1, Column: 13}, token.Position{Line: 1, Column: 14}},
+		{token.Position{Line: 2, Column: 3}, token.Position{Line: 2, Column: 6}},
+		{token.Position{Line: 2, Column: 7}, token.Position{Line: 2, Column: 8}},
+		{token.Position{Line: 2, Column: 9}, token.Position{Line: 2, Column: 11}},
+		{token.Position{Line: 2, Column: 12}, token.Position{Line: 3, Column: 3}},
+		{token.Position{Line: 3, Column: 3}, token.Position{Line: 3, Column: 4}},
+	}
+	for i, w := range want {
+		if tok := lex.NextToken(); tok.Start != w.start || tok.End != w.end {
+			t.Errorf("token %d (%q): got %s-%s, want %s-%s", i, tok.Literal, tok.Start, tok.End, w.start, w.end)
+		}
+	}
+}
@@ -8,9 +8,27 @@ import (
 	"mlite/lexer"
 	"mlite/parser"
 	"mlite/token"
+	"os"
 )
 
 func main() {
+	// mlite profile data.csv summarizes a dataset instead of running a script.
+	if len(os.Args) > 1 && os.Args[1] == "profile" {
+		os.Exit(runProfile(os.Args[2:]))
+	}
+	// mlite transpile script.mlite writes the script as Python, R or a notebook.
+	if len(os.Args) > 1 && os.Args[1] == "transpile" {
+		os.Exit(runTranspile(os.Args[2:]))
+	}
+	// mlite run script.mlite runs a script, recording trace.json with -trace.
+	if len(os.Args) > 1 && os.Args[1] == "run" {
+		os.Exit(runScript(os.Args[2:]))
+	}
+	// mlite traceback script.py.map maps a Python traceback back to MLite lines.
+	if len(os.Args) > 1 && os.Args[1] == "traceback" {
+		os.Exit(runTraceback(os.Args[2:]))
+	}
+
 	// Example DSL input
 	input := `
 	load("data.csv")
@@ -39,6 +57,6 @@ func main() {
 	nodes := pars.Parse()
 
 	// Step 3: Interpretation (Execute the nodes)
-	interp := interpreter.NewInterpreter()
+	interp := interpreter.NewInterpreter(interpreter.NewTextSink(os.Stdout))
 	interp.Run(nodes)
 }
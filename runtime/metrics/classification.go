@@ -0,0 +1,158 @@
+package metrics
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+// Labels returns the sorted distinct values of yTrue and yPred together.
+func Labels(yTrue, yPred []float64) []float64 {
+	seen := map[float64]bool{}
+	var labels []float64
+	for _, ys := range [][]float64{yTrue, yPred} {
+		for _, v := range ys {
+			if !seen[v] {
+				seen[v] = true
+				labels = append(labels, v)
+			}
+		}
+	}
+	sort.Float64s(labels)
+	return labels
+}
+
+// ConfusionMatrix counts predictions per true class: matrix[i][j] is the
+// number of rows with true label labels[i] predicted as labels[j].
+func ConfusionMatrix(yTrue, yPred []float64) (labels []float64, matrix [][]int, err error) {
+	if err := check(yTrue, yPred); err != nil {
+		return nil, nil, err
+	}
+	labels = Labels(yTrue, yPred)
+	index := make(map[float64]int, len(labels))
+	for i, l := range labels {
+		index[l] = i
+	}
+	matrix = make([][]int, len(labels))
+	for i := range matrix {
+		matrix[i] = make([]int, len(labels))
+	}
+	for i := range yTrue {
+		matrix[index[yTrue[i]]][index[yPred[i]]]++
+	}
+	return labels, matrix, nil
+}
+
+// Precision is tp / (tp + fp). With two classes the larger label is the
+// positive class; with more, the unweighted mean over classes is returned
+// (sklearn's average="macro").
+func Precision(yTrue, yPred []float64) (float64, error) {
+	return perClass(yTrue, yPred, func(tp, fp, fn int) float64 { return ratio(tp, tp+fp) })
+}
+
+// Recall is tp / (tp + fn), averaged like Precision.
+func Recall(yTrue, yPred []float64) (float64, error) {
+	return perClass(yTrue, yPred, func(tp, fp, fn int) float64 { return ratio(tp, tp+fn) })
+}
+
+// F1 is the harmonic mean of precision and recall, averaged like Precision.
+func F1(yTrue, yPred []float64) (float64, error) {
+	return perClass(yTrue, yPred, func(tp, fp, fn int) float64 { return ratio(2*tp, 2*tp+fp+fn) })
+}
+
+func perClass(yTrue, yPred []float64, score func(tp, fp, fn int) float64) (float64, error) {
+	labels, matrix, err := ConfusionMatrix(yTrue, yPred)
+	if err != nil {
+		return 0, err
+	}
+	classScore := func(k int) float64 {
+		tp, fp, fn := matrix[k][k], 0, 0
+		for j := range labels {
+			if j != k {
+				fp += matrix[j][k]
+				fn += matrix[k][j]
+			}
+		}
+		return score(tp, fp, fn)
+	}
+	if len(labels) <= 2 {
+		return classScore(len(labels) - 1), nil
+	}
+	sum := 0.0
+	for k := range labels {
+		sum += classScore(k)
+	}
+	return sum / float64(len(labels)), nil
+}
+
+// ratio returns num/den, or 0 when den is 0 (sklearn's zero_division=0).
+func ratio(num, den int) float64 {
+	if den == 0 {
+		return 0
+	}
+	return float64(num) / float64(den)
+}
+
+// ROCAUC is the area under the ROC curve for a binary target, where scores
+// are the predicted probabilities (or any ranking) of the larger label.
+// Tied scores count half, which makes it equal to the Mann-Whitney U statistic.
+func ROCAUC(yTrue, scores []float64) (float64, error) {
+	if err := check(yTrue, scores); err != nil {
+		return 0, err
+	}
+	labels := Labels(yTrue, nil)
+	if len(labels) != 2 {
+		return 0, fmt.Errorf("ROC AUC needs exactly 2 classes in the target, found %d", len(labels))
+	}
+
+	order := make([]int, len(scores))
+	for i := range order {
+		order[i] = i
+	}
+	sort.Slice(order, func(a, b int) bool { return scores[order[a]] < scores[order[b]] })
+
+	// Average ranks over ties, then sum the ranks of the positive rows.
+	rankSum, positives := 0.0, 0
+	for start := 0; start < len(order); {
+		end := start
+		for end < len(order) && scores[order[end]] == scores[order[start]] {
+			end++
+		}
+		rank := float64(start+end+1) / 2 // 1-based mean rank of the tie group
+		for _, r := range order[start:end] {
+			if yTrue[r] == labels[1] {
+				rankSum += rank
+				positives++
+			}
+		}
+		start = end
+	}
+	negatives := len(yTrue) - positives
+	return (rankSum - float64(positives*(positives+1))/2) / float64(positives*negatives), nil
+}
+
+// LogLoss is the mean negative log-likelihood of the true labels, where
+// proba[i][k] is the predicted probability of classes[k] for row i.
+// Probabilities are clipped to [1e-15, 1-1e-15] as in sklearn.
+func LogLoss(yTrue []float64, proba [][]float64, classes []float64) (float64, error) {
+	if len(yTrue) != len(proba) {
+		return 0, fmt.Errorf("%d true values but %d probability rows", len(yTrue), len(proba))
+	}
+	if len(yTrue) == 0 {
+		return 0, fmt.Errorf("no values to score")
+	}
+	index := make(map[float64]int, len(classes))
+	for k, c := range classes {
+		index[c] = k
+	}
+	sum := 0.0
+	for i, y := range yTrue {
+		k, ok := index[y]
+		if !ok {
+			return 0, fmt.Errorf("row %d has label %v, which the model never saw", i, y)
+		}
+		p := math.Min(math.Max(proba[i][k], 1e-15), 1-1e-15)
+		sum -= math.Log(p)
+	}
+	return sum / float64(len(yTrue)), nil
+}
@@ -0,0 +1,103 @@
+// Package metrics scores predictions against true values. Every function
+// takes the true values first, like sklearn.metrics.
+package metrics
+
+import (
+	"fmt"
+	"math"
+)
+
+// MAE is the mean absolute error.
+func MAE(yTrue, yPred []float64) (float64, error) {
+	if err := check(yTrue, yPred); err != nil {
+		return 0, err
+	}
+	sum := 0.0
+	for i := range yTrue {
+		sum += math.Abs(yTrue[i] - yPred[i])
+	}
+	return sum / float64(len(yTrue)), nil
+}
+
+// MSE is the mean squared error.
+func MSE(yTrue, yPred []float64) (float64, error) {
+	if err := check(yTrue, yPred); err != nil {
+		return 0, err
+	}
+	sum := 0.0
+	for i := range yTrue {
+		d := yTrue[i] - yPred[i]
+		sum += d * d
+	}
+	return sum / float64(len(yTrue)), nil
+}
+
+// RMSE is the square root of the mean squared error.
+func RMSE(yTrue, yPred []float64) (float64, error) {
+	mse, err := MSE(yTrue, yPred)
+	return math.Sqrt(mse), err
+}
+
+// R2 is the coefficient of determination: 1 - SS_res / SS_tot. A constant
+// yTrue scores 1 for a perfect prediction and 0 otherwise, as in sklearn.
+func R2(yTrue, yPred []float64) (float64, error) {
+	if err := check(yTrue, yPred); err != nil {
+		return 0, err
+	}
+	mean := 0.0
+	for _, v := range yTrue {
+		mean += v / float64(len(yTrue))
+	}
+	ssRes, ssTot := 0.0, 0.0
+	for i, v := range yTrue {
+		ssRes += (v - yPred[i]) * (v - yPred[i])
+		ssTot += (v - mean) * (v - mean)
+	}
+	if ssTot == 0 {
+		if ssRes == 0 {
+			return 1, nil
+		}
+		return 0, nil
+	}
+	return 1 - ssRes/ssTot, nil
+}
+
+// Accuracy is the fraction of exact matches.
+func Accuracy(yTrue, yPred []float64) (float64, error) {
+	if err := check(yTrue, yPred); err != nil {
+		return 0, err
+	}
+	correct := 0
+	for i := range yTrue {
+		if yTrue[i] == yPred[i] {
+			correct++
+		}
+	}
+	return float64(correct) / float64(len(yTrue)), nil
+}
+
+func check(yTrue, yPred []float64) error {
+	if len(yTrue) != len(yPred) {
+		return fmt.Errorf("%d true values but %d predictions", len(yTrue), len(yPred))
+	}
+	if len(yTrue) == 0 {
+		return fmt.Errorf("no values to score")
+	}
+	return nil
+}
+
+// MAPE is the mean absolute percentage error, as a fraction (0.05 = 5%).
+// Rows whose true value is zero are rejected rather than dividing by zero.
+func MAPE(yTrue, yPred []float64) (float64, error) {
+	if err := check(yTrue, yPred); err != nil {
+		return 0, err
+	}
+	sum := 0.0
+	for i := range yTrue {
+		if yTrue[i] == 0 {
+			return 0, fmt.Errorf("MAPE is undefined: row %d has a true value of 0", i)
+		}
+		sum += math.Abs((yTrue[i] - yPred[i]) / yTrue[i])
+	}
+	return sum / float64(len(yTrue)), nil
+}
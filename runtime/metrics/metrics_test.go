@@ -0,0 +1,101 @@
+package metrics
+
+import (
+	"math"
+	"testing"
+)
+
+// Checks the regression metrics against hand-computed values.
+func TestRegressionMetrics(t *testing.T) {
+	yTrue := []float64{3, -0.5, 2, 7}
+	yPred := []float64{2.5, 0, 2, 8}
+
+	cases := []struct {
+		name string
+		fn   func(a, b []float64) (float64, error)
+		want float64
+	}{
+		{"MAE", MAE, 0.5},
+		{"MSE", MSE, 0.375},
+		{"RMSE", RMSE, math.Sqrt(0.375)},
+		{"R2", R2, 0.9486081370449679},
+	}
+	for _, c := range cases {
+		got, err := c.fn(yTrue, yPred)
+		if err != nil || math.Abs(got-c.want) > 1e-12 {
+			t.Errorf("%s: got %v (%v), want %v", c.name, got, err, c.want)
+		}
+	}
+}
+
+// Checks accuracy and the length validation shared by every metric.
+func TestAccuracy(t *testing.T) {
+	got, _ := Accuracy([]float64{0, 1, 1, 0}, []float64{0, 1, 0, 0})
+	if got != 0.75 {
+		t.Errorf("accuracy: got %v, want 0.75", got)
+	}
+	if _, err := Accuracy([]float64{1}, []float64{1, 0}); err == nil {
+		t.Error("expected an error for mismatched lengths")
+	}
+}
+
+// Checks MAPE and its rejection of zero true values.
+func TestMAPE(t *testing.T) {
+	got, err := MAPE([]float64{100, 200}, []float64{110, 190})
+	if err != nil || math.Abs(got-0.075) > 1e-12 {
+		t.Errorf("MAPE: got %v (%v), want 0.075", got, err)
+	}
+	if _, err := MAPE([]float64{0}, []float64{1}); err == nil {
+		t.Error("expected an error for a zero true value")
+	}
+}
+
+// Checks binary precision, recall and F1 against a hand-built confusion matrix:
+// tp=2, fp=1, fn=1, tn=2.
+func TestBinaryClassificationMetrics(t *testing.T) {
+	yTrue := []float64{1, 1, 1, 0, 0, 0}
+	yPred := []float64{1, 1, 0, 1, 0, 0}
+
+	labels, matrix, _ := ConfusionMatrix(yTrue, yPred)
+	if labels[0] != 0 || matrix[0][0] != 2 || matrix[0][1] != 1 || matrix[1][0] != 1 || matrix[1][1] != 2 {
+		t.Errorf("confusion matrix: got %v %v", labels, matrix)
+	}
+	for name, fn := range map[string]func(a, b []float64) (float64, error){"precision": Precision, "recall": Recall, "F1": F1} {
+		if got, _ := fn(yTrue, yPred); math.Abs(got-2.0/3) > 1e-12 {
+			t.Errorf("%s: got %v, want 2/3", name, got)
+		}
+	}
+}
+
+// Checks that precision is macro-averaged across three classes.
+func TestMulticlassPrecision(t *testing.T) {
+	// class 0: 1/1, class 1: 1/2, class 2: 1/1
+	got, _ := Precision([]float64{0, 1, 2, 2}, []float64{0, 1, 1, 2})
+	if math.Abs(got-2.5/3) > 1e-12 {
+		t.Errorf("macro precision: got %v, want %v", got, 2.5/3)
+	}
+}
+
+// Checks ROC AUC including tied scores, which count half.
+func TestROCAUC(t *testing.T) {
+	got, _ := ROCAUC([]float64{0, 0, 1, 1}, []float64{0.1, 0.4, 0.35, 0.8})
+	if math.Abs(got-0.75) > 1e-12 {
+		t.Errorf("AUC: got %v, want 0.75", got)
+	}
+	got, _ = ROCAUC([]float64{0, 1}, []float64{0.5, 0.5})
+	if got != 0.5 {
+		t.Errorf("AUC with a tie: got %v, want 0.5", got)
+	}
+}
+
+// Checks log loss against the closed form for two rows.
+func TestLogLoss(t *testing.T) {
+	got, _ := LogLoss([]float64{1, 0}, [][]float64{{0.2, 0.8}, {0.6, 0.4}}, []float64{0, 1})
+	want := -(math.Log(0.8) + math.Log(0.6)) / 2
+	if math.Abs(got-want) > 1e-12 {
+		t.Errorf("log loss: got %v, want %v", got, want)
+	}
+	if _, err := LogLoss([]float64{5}, [][]float64{{0.5, 0.5}}, []float64{0, 1}); err == nil {
+		t.Error("expected an error for an unseen label")
+	}
+}
@@ -0,0 +1,295 @@
+package model
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+)
+
+func init() {
+	Register("gbm_regressor", func(p Params) (Model, error) { return newGradientBoosting(p, "squared") })
+	Register("gbm_classifier", func(p Params) (Model, error) { return newGradientBoosting(p, "log") })
+}
+
+// GradientBoosting is gradient-boosted regression trees. With squared loss it
+// is a regressor; with log loss it is a binary classifier whose raw score is
+// the log-odds of the second class.
+type GradientBoosting struct {
+	Loss               string // "squared" or "log"
+	NEstimators        int
+	LearningRate       float64
+	MaxDepth           int
+	MinSamplesLeaf     int
+	Subsample          float64 // fraction of training rows sampled per tree
+	ValidationFraction float64 // held out for early stopping
+	NIterNoChange      int     // stop after this many rounds without improvement; 0 disables
+	Tol                float64
+	Seed               int64
+
+	Init    float64 // initial raw score
+	Trees   []*Tree
+	Labels  []float64 // the two class labels, classifier only
+	observe func(Progress)
+}
+
+var gbmParams = []string{
+	"loss", "n_estimators", "learning_rate", "max_depth", "min_samples_leaf",
+	"subsample", "validation_fraction", "n_iter_no_change", "tol", "seed",
+}
+
+// newGradientBoosting builds the regressor or the classifier, whose loss is
+// fixed by the task: a classifier fitted on squared loss would predict
+// scores, not labels.
+func newGradientBoosting(p Params, taskLoss string) (Model, error) {
+	if err := p.Check(gbmParams...); err != nil {
+		return nil, err
+	}
+	r := p.reader()
+	g := &GradientBoosting{
+		Loss:               r.String("loss", taskLoss),
+		NEstimators:        r.Int("n_estimators", 100),
+		LearningRate:       r.Float("learning_rate", 0.1),
+		MaxDepth:           r.Int("max_depth", 3),
+		MinSamplesLeaf:     r.Int("min_samples_leaf", 1),
+		Subsample:          r.Float("subsample", 1),
+		ValidationFraction: r.Float("validation_fraction", 0.1),
+		NIterNoChange:      r.Int("n_iter_no_change", 0),
+		Tol:                r.Float("tol", 1e-4),
+		Seed:               int64(r.Int("seed", 0)),
+	}
+	if err := r.Err(); err != nil {
+		return nil, err
+	}
+
+	switch {
+	case g.Loss != "squared" && g.Loss != "log":
+		return nil, fmt.Errorf(`loss must be "squared" or "log", got %q`, g.Loss)
+	case g.Loss != taskLoss:
+		return nil, fmt.Errorf(`loss %q does not fit the task: gbm_regressor takes "squared" and gbm_classifier "log"`, g.Loss)
+	case g.NEstimators < 1:
+		return nil, fmt.Errorf("n_estimators must be >= 1, got %d", g.NEstimators)
+	case g.LearningRate <= 0:
+		return nil, fmt.Errorf("learning_rate must be > 0, got %v", g.LearningRate)
+	case g.MaxDepth < 1:
+		return nil, fmt.Errorf("max_depth must be >= 1, got %d", g.MaxDepth)
+	case g.MinSamplesLeaf < 1:
+		return nil, fmt.Errorf("min_samples_leaf must be >= 1, got %d", g.MinSamplesLeaf)
+	case g.Subsample <= 0 || g.Subsample > 1:
+		return nil, fmt.Errorf("subsample must be in (0, 1], got %v", g.Subsample)
+	case g.ValidationFraction <= 0 || g.ValidationFraction >= 1:
+		return nil, fmt.Errorf("validation_fraction must be in (0, 1), got %v", g.ValidationFraction)
+	case g.NIterNoChange < 0:
+		return nil, fmt.Errorf("n_iter_no_change must be >= 0, got %d", g.NIterNoChange)
+	}
+	return g, nil
+}
+
+// OnProgress registers fn to receive the training and validation loss after
+// every boosting round.
+func (g *GradientBoosting) OnProgress(fn func(Progress)) {
+	g.observe = fn
+}
+
+// Fit boosts trees on the negative gradient of the loss. When
+// NIterNoChange > 0 a validation split is held out and training stops once
+// its loss has not improved by Tol for that many rounds.
+func (g *GradientBoosting) Fit(X [][]float64, y []float64) error {
+	if err := checkTrainingData(X, y); err != nil {
+		return err
+	}
+	target := y
+	if g.Loss == "log" {
+		labels, encoded, err := binaryLabels(y)
+		if err != nil {
+			return err
+		}
+		g.Labels, target = labels, encoded
+	}
+
+	rng := rand.New(rand.NewSource(g.Seed))
+	train, val := allRows(len(X)), []int(nil)
+	if g.NIterNoChange > 0 {
+		train, val = holdOut(rng, len(X), g.ValidationFraction)
+		if len(val) == 0 || len(train) == 0 {
+			return fmt.Errorf("too few rows (%d) for a %.0f%% validation split", len(X), g.ValidationFraction*100)
+		}
+	}
+
+	g.Init = g.initialScore(target, train)
+	g.Trees = nil
+	score := make([]float64, len(X))
+	for i := range score {
+		score[i] = g.Init
+	}
+
+	residual := make([]float64, len(X))
+	var hess []float64
+	if g.Loss == "log" {
+		hess = make([]float64, len(X))
+	}
+	cfg := treeConfig{maxDepth: g.MaxDepth, minSamplesLeaf: g.MinSamplesLeaf}
+	best, sinceBest := math.Inf(1), 0
+
+	for round := 1; round <= g.NEstimators; round++ {
+		for _, r := range train {
+			if g.Loss == "log" {
+				p := sigmoid(score[r])
+				residual[r] = target[r] - p
+				hess[r] = p * (1 - p)
+			} else {
+				residual[r] = target[r] - score[r]
+			}
+		}
+
+		tree := fitTree(X, residual, hess, g.sample(rng, train), cfg)
+		g.Trees = append(g.Trees, tree)
+		for i, row := range X {
+			score[i] += g.LearningRate * tree.Predict(row)
+		}
+
+		metrics := map[string]float64{"loss": g.loss(target, score, train)}
+		if val != nil {
+			metrics["val_loss"] = g.loss(target, score, val)
+		}
+		if g.observe != nil {
+			g.observe(Progress{Iteration: round, Metrics: metrics})
+		}
+
+		if val != nil {
+			if metrics["val_loss"] < best-g.Tol {
+				best, sinceBest = metrics["val_loss"], 0
+			} else if sinceBest++; sinceBest >= g.NIterNoChange {
+				break
+			}
+		}
+	}
+	return nil
+}
+
+// Predict returns the regression value, or the predicted class label.
+func (g *GradientBoosting) Predict(X [][]float64) ([]float64, error) {
+	scores, err := g.rawScores(X)
+	if err != nil {
+		return nil, err
+	}
+	if g.Loss == "log" {
+		for i, s := range scores {
+			if sigmoid(s) >= 0.5 {
+				scores[i] = g.Labels[1]
+			} else {
+				scores[i] = g.Labels[0]
+			}
+		}
+	}
+	return scores, nil
+}
+
+// Classes returns the two labels seen during Fit.
+func (g *GradientBoosting) Classes() []float64 {
+	return g.Labels
+}
+
+// PredictProba returns [P(Labels[0]), P(Labels[1])] for each row.
+func (g *GradientBoosting) PredictProba(X [][]float64) ([][]float64, error) {
+	if g.Loss != "log" {
+		return nil, fmt.Errorf("probabilities need loss \"log\"")
+	}
+	scores, err := g.rawScores(X)
+	if err != nil {
+		return nil, err
+	}
+	out := make([][]float64, len(scores))
+	for i, s := range scores {
+		p := sigmoid(s)
+		out[i] = []float64{1 - p, p}
+	}
+	return out, nil
+}
+
+func (g *GradientBoosting) rawScores(X [][]float64) ([]float64, error) {
+	if g.Trees == nil {
+		return nil, fmt.Errorf("model has not been trained")
+	}
+	out := make([]float64, len(X))
+	for i, row := range X {
+		out[i] = g.Init
+		for _, t := range g.Trees {
+			out[i] += g.LearningRate * t.Predict(row)
+		}
+	}
+	return out, nil
+}
+
+func (g *GradientBoosting) initialScore(target []float64, rows []int) float64 {
+	mean := 0.0
+	for _, r := range rows {
+		mean += target[r] / float64(len(rows))
+	}
+	if g.Loss == "log" {
+		mean = math.Min(math.Max(mean, 1e-6), 1-1e-6)
+		return math.Log(mean / (1 - mean))
+	}
+	return mean
+}
+
+// loss is the mean squared error or mean log loss over rows.
+func (g *GradientBoosting) loss(target, score []float64, rows []int) float64 {
+	sum := 0.0
+	for _, r := range rows {
+		if g.Loss == "log" {
+			// log(1 + e^s) - y*s, written to avoid overflow for large |s|
+			s := score[r]
+			sum += math.Max(s, 0) + math.Log1p(math.Exp(-math.Abs(s))) - target[r]*s
+		} else {
+			d := target[r] - score[r]
+			sum += d * d
+		}
+	}
+	return sum / float64(len(rows))
+}
+
+// sample draws Subsample of rows without replacement.
+func (g *GradientBoosting) sample(rng *rand.Rand, rows []int) []int {
+	if g.Subsample >= 1 {
+		return rows
+	}
+	k := int(math.Max(1, math.Round(g.Subsample*float64(len(rows)))))
+	picked := make([]int, len(rows))
+	copy(picked, rows)
+	rng.Shuffle(len(picked), func(a, b int) { picked[a], picked[b] = picked[b], picked[a] })
+	return picked[:k]
+}
+
+// binaryLabels maps the two distinct values of y to 0 and 1.
+func binaryLabels(y []float64) ([]float64, []float64, error) {
+	labels := distinct(y)
+	if len(labels) != 2 {
+		return nil, nil, fmt.Errorf("log loss needs exactly 2 classes in the target, found %d", len(labels))
+	}
+	encoded := make([]float64, len(y))
+	for i, v := range y {
+		if v == labels[1] {
+			encoded[i] = 1
+		}
+	}
+	return labels, encoded, nil
+}
+
+func allRows(n int) []int {
+	rows := make([]int, n)
+	for i := range rows {
+		rows[i] = i
+	}
+	return rows
+}
+
+// holdOut shuffles rows and splits off fraction of them for validation.
+func holdOut(rng *rand.Rand, n int, fraction float64) (train, val []int) {
+	rows := rng.Perm(n)
+	k := int(math.Round(fraction * float64(n)))
+	return rows[k:], rows[:k]
+}
+
+func sigmoid(x float64) float64 {
+	return 1 / (1 + math.Exp(-x))
+}
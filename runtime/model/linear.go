@@ -0,0 +1,357 @@
+package model
+
+import (
+	"fmt"
+	"math"
+)
+
+func init() {
+	Register("linear_regression", newLinearRegression)
+	Register("linreg", newLinearRegression)
+}
+
+// LinearRegression is ordinary least squares, or ridge regression when
+// Alpha > 0. The intercept is never penalised. When the features are
+// collinear, as every one-hot column is with the others of its category,
+// the fit is the least-squares one with the smallest coefficients, as
+// scikit-learn's is.
+//
+// It is also Incremental: the normal equations only need the means and
+// centred cross-products of the data, which merge exactly batch by batch,
+// so one pass over a streamed dataset gives the same fit as the whole of it.
+type LinearRegression struct {
+	Alpha     float64
+	Coef      []float64
+	Intercept float64
+
+	// Running statistics: rows seen, means, XcᵀXc and Xcᵀyc.
+	n     float64
+	xMean []float64
+	yMean float64
+	xx    [][]float64
+	xy    []float64
+}
+
+func newLinearRegression(p Params) (Model, error) {
+	if err := p.Check("alpha"); err != nil {
+		return nil, err
+	}
+	alpha, err := p.Float("alpha", 0)
+	if err != nil {
+		return nil, err
+	}
+	if alpha < 0 {
+		return nil, fmt.Errorf("alpha must be >= 0, got %v", alpha)
+	}
+	return &LinearRegression{Alpha: alpha}, nil
+}
+
+// Fit solves the normal equations on mean-centred data.
+func (m *LinearRegression) Fit(X [][]float64, y []float64) error {
+	m.Reset()
+	if err := m.PartialFit(X, y); err != nil {
+		return err
+	}
+	return m.Finish()
+}
+
+// Finish fails when the rows seen leave the coefficients undetermined: no
+// feature has varied yet.
+func (m *LinearRegression) Finish() error {
+	if m.Coef == nil {
+		return fmt.Errorf("no feature varies in the training rows")
+	}
+	return nil
+}
+
+// Epochs is 1: the statistics of one pass determine the fit.
+func (m *LinearRegression) Epochs() int {
+	return 1
+}
+
+// Reset forgets the fitted coefficients and running statistics.
+func (m *LinearRegression) Reset() {
+	*m = LinearRegression{Alpha: m.Alpha}
+}
+
+// PartialFit merges the batch's statistics into the running ones, using
+// the pairwise update of Chan et al., and solves for the coefficients.
+// Until some feature varies, as in a first batch of one row, the model
+// stays untrained; see Finish.
+func (m *LinearRegression) PartialFit(X [][]float64, y []float64) error {
+	if err := checkTrainingData(X, y); err != nil {
+		return err
+	}
+	n, p := len(X), len(X[0])
+	if m.xx == nil {
+		m.xMean, m.xy = make([]float64, p), make([]float64, p)
+		m.xx = make([][]float64, p)
+		for j := range m.xx {
+			m.xx[j] = make([]float64, p)
+		}
+	} else if len(m.xMean) != p {
+		return fmt.Errorf("expected %d features, got %d", len(m.xMean), p)
+	}
+
+	xMean := make([]float64, p)
+	yMean := 0.0
+	for i, row := range X {
+		for j, v := range row {
+			xMean[j] += v / float64(n)
+		}
+		yMean += y[i] / float64(n)
+	}
+
+	// The batch's own XcᵀXc and Xcᵀyc, centred on its means.
+	xx := make([][]float64, p)
+	for j := range xx {
+		xx[j] = make([]float64, p)
+	}
+	xy := make([]float64, p)
+	for i, row := range X {
+		yc := y[i] - yMean
+		for j := 0; j < p; j++ {
+			xj := row[j] - xMean[j]
+			xy[j] += xj * yc
+			for k := 0; k <= j; k++ {
+				xx[j][k] += xj * (row[k] - xMean[k])
+			}
+		}
+	}
+
+	total := m.n + float64(n)
+	weight := m.n * float64(n) / total
+	dy := yMean - m.yMean
+	for j := 0; j < p; j++ {
+		dj := xMean[j] - m.xMean[j]
+		m.xy[j] += xy[j] + weight*dj*dy
+		for k := 0; k <= j; k++ {
+			m.xx[j][k] += xx[j][k] + weight*dj*(xMean[k]-m.xMean[k])
+		}
+	}
+	for j := range m.xMean {
+		m.xMean[j] += (xMean[j] - m.xMean[j]) * float64(n) / total
+	}
+	m.yMean += dy * float64(n) / total
+	m.n = total
+
+	// A = XcᵀXc + αI, b = Xcᵀyc
+	A := make([][]float64, p)
+	for j := range A {
+		A[j] = make([]float64, p)
+		for k := 0; k <= j; k++ {
+			A[j][k], A[k][j] = m.xx[j][k], m.xx[j][k]
+		}
+		A[j][j] += m.Alpha
+	}
+	coef, err := solve(clone(A), append([]float64(nil), m.xy...))
+	if err != nil {
+		coef, err = leastSquares(A, m.xy)
+	}
+	if err != nil {
+		m.Coef = nil
+		return nil
+	}
+
+	m.Coef = coef
+	m.Intercept = m.yMean
+	for j, c := range coef {
+		m.Intercept -= c * m.xMean[j]
+	}
+	return nil
+}
+
+// Predict returns Xw + b.
+func (m *LinearRegression) Predict(X [][]float64) ([]float64, error) {
+	if m.Coef == nil {
+		return nil, fmt.Errorf("model has not been trained")
+	}
+	out := make([]float64, len(X))
+	for i, row := range X {
+		if len(row) != len(m.Coef) {
+			return nil, fmt.Errorf("expected %d features, got %d", len(m.Coef), len(row))
+		}
+		out[i] = m.Intercept + dot(m.Coef, row)
+	}
+	return out, nil
+}
+
+// solve solves Ax = b by Gaussian elimination with partial pivoting. A and b
+// are overwritten. A pivot that is tiny next to A's diagonal counts as
+// zero, so round-off cannot pass off a singular A as solvable.
+func solve(A [][]float64, b []float64) ([]float64, error) {
+	n := len(b)
+	tol := 1e-12 * math.Max(1, maxDiagonal(A))
+	for col := 0; col < n; col++ {
+		pivot := col
+		for r := col + 1; r < n; r++ {
+			if math.Abs(A[r][col]) > math.Abs(A[pivot][col]) {
+				pivot = r
+			}
+		}
+		if math.Abs(A[pivot][col]) < tol {
+			return nil, fmt.Errorf("singular matrix")
+		}
+		A[col], A[pivot] = A[pivot], A[col]
+		b[col], b[pivot] = b[pivot], b[col]
+
+		for r := col + 1; r < n; r++ {
+			f := A[r][col] / A[col][col]
+			for c := col; c < n; c++ {
+				A[r][c] -= f * A[col][c]
+			}
+			b[r] -= f * b[col]
+		}
+	}
+
+	x := make([]float64, n)
+	for r := n - 1; r >= 0; r-- {
+		sum := b[r]
+		for c := r + 1; c < n; c++ {
+			sum -= A[r][c] * x[c]
+		}
+		x[r] = sum / A[r][r]
+	}
+	return x, nil
+}
+
+// leastSquares returns the x with the smallest norm among those that
+// minimise |Ax - b| for a symmetric positive semi-definite A: the
+// pseudo-inverse of A times b. Eigenvalues below a relative tolerance are
+// taken as zero, as numpy's lstsq does with its rcond. It fails when A is
+// zero.
+func leastSquares(A [][]float64, b []float64) ([]float64, error) {
+	values, vectors := eigenSymmetric(A)
+	largest := 0.0
+	for _, v := range values {
+		largest = math.Max(largest, v)
+	}
+	if largest <= 0 {
+		return nil, fmt.Errorf("singular matrix")
+	}
+	x := make([]float64, len(b))
+	for k, v := range values {
+		if v <= 1e-10*largest {
+			continue
+		}
+		proj := 0.0
+		for j := range b {
+			proj += vectors[j][k] * b[j]
+		}
+		for j := range x {
+			x[j] += vectors[j][k] * proj / v
+		}
+	}
+	return x, nil
+}
+
+// eigenSymmetric diagonalises a symmetric matrix with cyclic Jacobi
+// rotations, returning its eigenvalues and the eigenvectors as the columns
+// of the second result. A is left unchanged.
+func eigenSymmetric(A [][]float64) ([]float64, [][]float64) {
+	n := len(A)
+	a := clone(A)
+	v := make([][]float64, n)
+	for i := range v {
+		v[i] = make([]float64, n)
+		v[i][i] = 1
+	}
+	for sweep := 0; sweep < 100; sweep++ {
+		off, norm := 0.0, 0.0
+		for i := 0; i < n; i++ {
+			for j := 0; j < n; j++ {
+				if i != j {
+					off += a[i][j] * a[i][j]
+				}
+				norm += a[i][j] * a[i][j]
+			}
+		}
+		if off <= 1e-30*norm {
+			break
+		}
+		for p := 0; p < n-1; p++ {
+			for q := p + 1; q < n; q++ {
+				if a[p][q] == 0 {
+					continue
+				}
+				theta := (a[q][q] - a[p][p]) / (2 * a[p][q])
+				t := 1 / (math.Abs(theta) + math.Sqrt(theta*theta+1))
+				if theta < 0 {
+					t = -t
+				}
+				c := 1 / math.Sqrt(t*t+1)
+				s := t * c
+				for k := 0; k < n; k++ {
+					akp, akq := a[k][p], a[k][q]
+					a[k][p], a[k][q] = c*akp-s*akq, s*akp+c*akq
+				}
+				for k := 0; k < n; k++ {
+					apk, aqk := a[p][k], a[q][k]
+					a[p][k], a[q][k] = c*apk-s*aqk, s*apk+c*aqk
+				}
+				for k := 0; k < n; k++ {
+					vkp, vkq := v[k][p], v[k][q]
+					v[k][p], v[k][q] = c*vkp-s*vkq, s*vkp+c*vkq
+				}
+			}
+		}
+	}
+	values := make([]float64, n)
+	for i := range values {
+		values[i] = a[i][i]
+	}
+	return values, v
+}
+
+// maxDiagonal returns the largest absolute value on A's diagonal.
+func maxDiagonal(A [][]float64) float64 {
+	largest := 0.0
+	for i := range A {
+		largest = math.Max(largest, math.Abs(A[i][i]))
+	}
+	return largest
+}
+
+func clone(A [][]float64) [][]float64 {
+	out := make([][]float64, len(A))
+	for i, row := range A {
+		out[i] = append([]float64(nil), row...)
+	}
+	return out
+}
+
+func dot(a, b []float64) float64 {
+	sum := 0.0
+	for i := range a {
+		sum += a[i] * b[i]
+	}
+	return sum
+}
+
+// checkTrainingData rejects empty, ragged or mismatched inputs before any
+// model starts allocating.
+func checkTrainingData(X [][]float64, y []float64) error {
+	if len(X) == 0 {
+		return fmt.Errorf("no training rows")
+	}
+	if len(X) != len(y) {
+		return fmt.Errorf("%d feature rows but %d targets", len(X), len(y))
+	}
+	if len(X[0]) == 0 {
+		return fmt.Errorf("no feature columns")
+	}
+	for i, row := range X {
+		if len(row) != len(X[0]) {
+			return fmt.Errorf("row %d has %d features, expected %d", i, len(row), len(X[0]))
+		}
+		for _, v := range row {
+			if math.IsNaN(v) {
+				return fmt.Errorf("row %d has a missing feature value", i)
+			}
+		}
+		if math.IsNaN(y[i]) {
+			return fmt.Errorf("row %d has a missing target value", i)
+		}
+	}
+	return nil
+}
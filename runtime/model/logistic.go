@@ -0,0 +1,196 @@
+package model
+
+import (
+	"fmt"
+	"math"
+)
+
+func init() {
+	Register("logistic_regression", newLogisticRegression)
+}
+
+// LogisticRegression is a linear classifier. Two classes share one sigmoid
+// output; more classes get one softmax output each (multinomial).
+//
+// It minimises the mean cross-entropy plus ‖w‖²/(2·C·n) by full-batch
+// gradient descent on standardised features, which is sklearn's objective
+// for a LogisticRegression behind a StandardScaler. The fitted coefficients
+// are mapped back so Coef and Intercept apply to raw inputs.
+type LogisticRegression struct {
+	C       float64 // inverse regularisation strength, as in sklearn
+	MaxIter int
+	Tol     float64 // stop when no gradient component exceeds this
+
+	Coef      [][]float64 // one row per output; a single row for two classes
+	Intercept []float64
+	Labels    []float64
+}
+
+func newLogisticRegression(p Params) (Model, error) {
+	if err := p.Check("C", "max_iter", "tol"); err != nil {
+		return nil, err
+	}
+	r := p.reader()
+	m := &LogisticRegression{
+		C:       r.Float("C", 1),
+		MaxIter: r.Int("max_iter", 1000),
+		Tol:     r.Float("tol", 1e-6),
+	}
+	if err := r.Err(); err != nil {
+		return nil, err
+	}
+	switch {
+	case m.C <= 0:
+		return nil, fmt.Errorf("C must be > 0, got %v", m.C)
+	case m.MaxIter < 1:
+		return nil, fmt.Errorf("max_iter must be >= 1, got %d", m.MaxIter)
+	}
+	return m, nil
+}
+
+// Fit runs gradient descent with a step of 1/L, where L bounds the
+// curvature of the objective on standardised data.
+func (m *LogisticRegression) Fit(X [][]float64, y []float64) error {
+	if err := checkTrainingData(X, y); err != nil {
+		return err
+	}
+	m.Labels = distinct(y)
+	if len(m.Labels) < 2 {
+		return fmt.Errorf("the target needs at least 2 classes, found %d", len(m.Labels))
+	}
+	outputs := len(m.Labels)
+	if outputs == 2 {
+		outputs = 1
+	}
+
+	n, p := len(X), len(X[0])
+	mean, scale := standardization(X)
+	Z := make([][]float64, n)
+	for i, row := range X {
+		Z[i] = make([]float64, p)
+		for j, v := range row {
+			Z[i][j] = (v - mean[j]) / scale[j]
+		}
+	}
+	class := make([]int, n)
+	for i, v := range y {
+		for k, label := range m.Labels {
+			if v == label {
+				class[i] = k
+			}
+		}
+	}
+
+	penalty := 1 / (m.C * float64(n))
+	step := 1 / (0.5*float64(p+1) + penalty)
+	W := make([][]float64, outputs)
+	for k := range W {
+		W[k] = make([]float64, p)
+	}
+	b := make([]float64, outputs)
+	gradW := make([][]float64, outputs)
+	for k := range gradW {
+		gradW[k] = make([]float64, p)
+	}
+	gradB := make([]float64, outputs)
+
+	for iter := 0; iter < m.MaxIter; iter++ {
+		for k := range W {
+			for j := range gradW[k] {
+				gradW[k][j] = penalty * W[k][j]
+			}
+			gradB[k] = 0
+		}
+		for i, row := range Z {
+			// Output error: predicted probability minus the one-hot target.
+			errs := m.probabilities(W, b, row)
+			if outputs == 1 {
+				errs = errs[1:]
+				if class[i] == 1 {
+					errs[0]--
+				}
+			} else {
+				errs[class[i]]--
+			}
+			for k, e := range errs {
+				for j, v := range row {
+					gradW[k][j] += e * v / float64(n)
+				}
+				gradB[k] += e / float64(n)
+			}
+		}
+
+		largest := 0.0
+		for k := range W {
+			for j := range W[k] {
+				W[k][j] -= step * gradW[k][j]
+				largest = math.Max(largest, math.Abs(gradW[k][j]))
+			}
+			b[k] -= step * gradB[k]
+			largest = math.Max(largest, math.Abs(gradB[k]))
+		}
+		if largest < m.Tol {
+			break
+		}
+	}
+
+	// Fold the standardisation into the coefficients.
+	m.Coef = make([][]float64, outputs)
+	m.Intercept = make([]float64, outputs)
+	for k := range W {
+		m.Coef[k] = make([]float64, p)
+		m.Intercept[k] = b[k]
+		for j := range W[k] {
+			m.Coef[k][j] = W[k][j] / scale[j]
+			m.Intercept[k] -= W[k][j] * mean[j] / scale[j]
+		}
+	}
+	return nil
+}
+
+// probabilities returns one probability per class for row under weights W, b.
+func (m *LogisticRegression) probabilities(W [][]float64, b []float64, row []float64) []float64 {
+	if len(W) == 1 {
+		p := sigmoid(dot(W[0], row) + b[0])
+		return []float64{1 - p, p}
+	}
+	z := make([]float64, len(W))
+	for k := range W {
+		z[k] = dot(W[k], row) + b[k]
+	}
+	softmax(z)
+	return z
+}
+
+// Predict returns the most probable class label for each row.
+func (m *LogisticRegression) Predict(X [][]float64) ([]float64, error) {
+	proba, err := m.PredictProba(X)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]float64, len(proba))
+	for i, p := range proba {
+		out[i] = m.Labels[argmax(p)]
+	}
+	return out, nil
+}
+
+// Classes returns the labels seen during Fit, in ascending order.
+func (m *LogisticRegression) Classes() []float64 {
+	return m.Labels
+}
+
+// PredictProba returns one probability per class for every row.
+func (m *LogisticRegression) PredictProba(X [][]float64) ([][]float64, error) {
+	if m.Coef == nil {
+		return nil, fmt.Errorf("model has not been trained")
+	}
+	out := make([][]float64, len(X))
+	for i, row := range X {
+		if len(row) != len(m.Coef[0]) {
+			return nil, fmt.Errorf("row %d has %d features, expected %d", i, len(row), len(m.Coef[0]))
+		}
+		out[i] = m.probabilities(m.Coef, m.Intercept, row)
+	}
+	return out, nil
+}
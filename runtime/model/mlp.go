@@ -0,0 +1,504 @@
+package model
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+)
+
+func init() {
+	Register("mlp", func(p Params) (Model, error) { return newMLP(p, false) }, "hidden")
+	Register("mlp_classifier", func(p Params) (Model, error) { return newMLP(p, true) }, "hidden")
+}
+
+// MLP is a fully connected feed-forward network trained with mini-batch
+// gradient descent. The regressor has one linear output trained on mean
+// squared error; the classifier has a softmax output trained on cross-entropy.
+//
+// Inputs are standardised with the training mean and standard deviation, and
+// so is the regression target, so raw columns such as prices in the hundreds
+// of thousands train with the default learning rates.
+type MLP struct {
+	Hidden             []int
+	Activation         string // "relu", "tanh" or "sigmoid"
+	Optimizer          string // "sgd", "momentum" or "adam"
+	LearningRate       float64
+	Momentum           float64
+	BatchSize          int
+	Epochs             int
+	Alpha              float64 // L2 penalty
+	ValidationFraction float64 // held out to report val_loss; 0 disables
+	Seed               int64
+	Classify           bool
+
+	Layers      []DenseLayer
+	Labels      []float64 // class labels, classifier only
+	InputMean   []float64
+	InputScale  []float64
+	TargetMean  float64
+	TargetScale float64
+	observe     func(Progress)
+}
+
+// DenseLayer computes W·x + B; W has one row per output unit.
+type DenseLayer struct {
+	W [][]float64
+	B []float64
+}
+
+var mlpParams = []string{
+	"hidden", "activation", "optimizer", "learning_rate", "momentum", "batch_size",
+	"epochs", "alpha", "validation_fraction", "seed",
+}
+
+func newMLP(p Params, classify bool) (Model, error) {
+	if err := p.Check(mlpParams...); err != nil {
+		return nil, err
+	}
+	r := p.reader()
+	m := &MLP{
+		Hidden:             r.Ints("hidden", []int{100}),
+		Activation:         r.String("activation", "relu"),
+		Optimizer:          r.String("optimizer", "adam"),
+		Momentum:           r.Float("momentum", 0.9),
+		BatchSize:          r.Int("batch_size", 32),
+		Epochs:             r.Int("epochs", 200),
+		Alpha:              r.Float("alpha", 0.0001),
+		ValidationFraction: r.Float("validation_fraction", 0),
+		Seed:               int64(r.Int("seed", 0)),
+		Classify:           classify,
+	}
+	defaultRate := 0.001
+	if m.Optimizer != "adam" {
+		defaultRate = 0.01
+	}
+	m.LearningRate = r.Float("learning_rate", defaultRate)
+	if err := r.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, units := range m.Hidden {
+		if units < 1 {
+			return nil, fmt.Errorf("hidden layer sizes must be >= 1, got %v", m.Hidden)
+		}
+	}
+	switch {
+	case m.Activation != "relu" && m.Activation != "tanh" && m.Activation != "sigmoid":
+		return nil, fmt.Errorf(`activation must be "relu", "tanh" or "sigmoid", got %q`, m.Activation)
+	case m.Optimizer != "sgd" && m.Optimizer != "momentum" && m.Optimizer != "adam":
+		return nil, fmt.Errorf(`optimizer must be "sgd", "momentum" or "adam", got %q`, m.Optimizer)
+	case m.LearningRate <= 0:
+		return nil, fmt.Errorf("learning_rate must be > 0, got %v", m.LearningRate)
+	case m.Momentum < 0 || m.Momentum >= 1:
+		return nil, fmt.Errorf("momentum must be in [0, 1), got %v", m.Momentum)
+	case m.BatchSize < 1:
+		return nil, fmt.Errorf("batch_size must be >= 1, got %d", m.BatchSize)
+	case m.Epochs < 1:
+		return nil, fmt.Errorf("epochs must be >= 1, got %d", m.Epochs)
+	case m.Alpha < 0:
+		return nil, fmt.Errorf("alpha must be >= 0, got %v", m.Alpha)
+	case m.ValidationFraction < 0 || m.ValidationFraction >= 1:
+		return nil, fmt.Errorf("validation_fraction must be in [0, 1), got %v", m.ValidationFraction)
+	}
+	return m, nil
+}
+
+// OnProgress registers fn to receive the loss (and, for classifiers, the
+// accuracy) after every epoch.
+func (m *MLP) OnProgress(fn func(Progress)) {
+	m.observe = fn
+}
+
+// Fit trains the network for Epochs passes over shuffled mini-batches.
+func (m *MLP) Fit(X [][]float64, y []float64) error {
+	if err := checkTrainingData(X, y); err != nil {
+		return err
+	}
+	rng := rand.New(rand.NewSource(m.Seed))
+
+	m.InputMean, m.InputScale = standardization(X)
+	inputs := make([][]float64, len(X))
+	for i, row := range X {
+		inputs[i] = m.scale(row)
+	}
+
+	// Targets become one-hot rows for classification and standardised
+	// single values for regression.
+	var targets [][]float64
+	outputs := 1
+	if m.Classify {
+		m.Labels = distinct(y)
+		if len(m.Labels) < 2 {
+			return fmt.Errorf("classification needs at least 2 classes in the target, found %d", len(m.Labels))
+		}
+		outputs = len(m.Labels)
+		targets = make([][]float64, len(y))
+		for i, v := range y {
+			targets[i] = make([]float64, outputs)
+			targets[i][sort.SearchFloat64s(m.Labels, v)] = 1
+		}
+	} else {
+		m.TargetMean, m.TargetScale = meanStd(y)
+		targets = make([][]float64, len(y))
+		for i, v := range y {
+			targets[i] = []float64{(v - m.TargetMean) / m.TargetScale}
+		}
+	}
+
+	train, val := allRows(len(X)), []int(nil)
+	if m.ValidationFraction > 0 {
+		train, val = holdOut(rng, len(X), m.ValidationFraction)
+		if len(val) == 0 || len(train) == 0 {
+			return fmt.Errorf("too few rows (%d) for a %.0f%% validation split", len(X), m.ValidationFraction*100)
+		}
+	}
+
+	m.initLayers(rng, len(X[0]), outputs)
+	opt := newOptimizer(m)
+
+	for epoch := 1; epoch <= m.Epochs; epoch++ {
+		rng.Shuffle(len(train), func(a, b int) { train[a], train[b] = train[b], train[a] })
+		for start := 0; start < len(train); start += m.BatchSize {
+			end := start + m.BatchSize
+			if end > len(train) {
+				end = len(train)
+			}
+			grads := m.backprop(inputs, targets, train[start:end])
+			opt.step(m.Layers, grads)
+		}
+
+		metrics := map[string]float64{}
+		metrics["loss"], metrics["accuracy"] = m.evaluate(inputs, targets, train)
+		if val != nil {
+			metrics["val_loss"], metrics["val_accuracy"] = m.evaluate(inputs, targets, val)
+		}
+		if !m.Classify {
+			delete(metrics, "accuracy")
+			delete(metrics, "val_accuracy")
+		}
+		for name, v := range metrics {
+			if math.IsNaN(v) || math.IsInf(v, 0) {
+				return fmt.Errorf("training diverged at epoch %d (%s is %v); lower learning_rate", epoch, name, v)
+			}
+		}
+		if m.observe != nil {
+			m.observe(Progress{Iteration: epoch, Metrics: metrics})
+		}
+	}
+	return nil
+}
+
+// Predict returns the regression value or the most probable class label.
+func (m *MLP) Predict(X [][]float64) ([]float64, error) {
+	if m.Layers == nil {
+		return nil, fmt.Errorf("model has not been trained")
+	}
+	out := make([]float64, len(X))
+	for i, row := range X {
+		if len(row) != len(m.InputMean) {
+			return nil, fmt.Errorf("expected %d features, got %d", len(m.InputMean), len(row))
+		}
+		acts := m.forward(m.scale(row))
+		last := acts[len(acts)-1]
+		if m.Classify {
+			out[i] = m.Labels[argmax(last)]
+		} else {
+			out[i] = last[0]*m.TargetScale + m.TargetMean
+		}
+	}
+	return out, nil
+}
+
+// Classes returns the labels seen during Fit.
+func (m *MLP) Classes() []float64 {
+	return m.Labels
+}
+
+// PredictProba returns the softmax output for each row.
+func (m *MLP) PredictProba(X [][]float64) ([][]float64, error) {
+	if !m.Classify {
+		return nil, fmt.Errorf("probabilities need mlp_classifier")
+	}
+	if m.Layers == nil {
+		return nil, fmt.Errorf("model has not been trained")
+	}
+	out := make([][]float64, len(X))
+	for i, row := range X {
+		acts := m.forward(m.scale(row))
+		out[i] = acts[len(acts)-1]
+	}
+	return out, nil
+}
+
+// initLayers draws weights with He initialisation for ReLU and Glorot
+// initialisation otherwise; biases start at zero.
+func (m *MLP) initLayers(rng *rand.Rand, inputs, outputs int) {
+	sizes := append(append([]int{inputs}, m.Hidden...), outputs)
+	m.Layers = make([]DenseLayer, len(sizes)-1)
+	for l := range m.Layers {
+		in, out := sizes[l], sizes[l+1]
+		limit := math.Sqrt(6 / float64(in+out))
+		if m.Activation == "relu" {
+			limit = math.Sqrt(6 / float64(in))
+		}
+		layer := DenseLayer{W: make([][]float64, out), B: make([]float64, out)}
+		for o := range layer.W {
+			layer.W[o] = make([]float64, in)
+			for j := range layer.W[o] {
+				layer.W[o][j] = (rng.Float64()*2 - 1) * limit
+			}
+		}
+		m.Layers[l] = layer
+	}
+}
+
+// forward returns the activations of every layer, input first.
+func (m *MLP) forward(x []float64) [][]float64 {
+	acts := [][]float64{x}
+	for l, layer := range m.Layers {
+		z := make([]float64, len(layer.B))
+		for o := range z {
+			z[o] = layer.B[o] + dot(layer.W[o], acts[l])
+		}
+		switch {
+		case l < len(m.Layers)-1:
+			for o := range z {
+				z[o] = activate(m.Activation, z[o])
+			}
+		case m.Classify:
+			softmax(z)
+		}
+		acts = append(acts, z)
+	}
+	return acts
+}
+
+// backprop returns the mean gradient of the loss over batch for every layer.
+func (m *MLP) backprop(inputs, targets [][]float64, batch []int) []DenseLayer {
+	grads := make([]DenseLayer, len(m.Layers))
+	for l, layer := range m.Layers {
+		grads[l] = DenseLayer{W: make([][]float64, len(layer.W)), B: make([]float64, len(layer.B))}
+		for o := range layer.W {
+			grads[l].W[o] = make([]float64, len(layer.W[o]))
+		}
+	}
+
+	n := float64(len(batch))
+	for _, r := range batch {
+		acts := m.forward(inputs[r])
+		// Both MSE with a linear output and cross-entropy with softmax give
+		// output - target as the error at the last layer.
+		out := acts[len(acts)-1]
+		delta := make([]float64, len(out))
+		for o := range out {
+			delta[o] = (out[o] - targets[r][o]) / n
+		}
+
+		for l := len(m.Layers) - 1; l >= 0; l-- {
+			in := acts[l]
+			for o, d := range delta {
+				grads[l].B[o] += d
+				for j, x := range in {
+					grads[l].W[o][j] += d * x
+				}
+			}
+			if l == 0 {
+				break
+			}
+			prev := make([]float64, len(in))
+			for j := range prev {
+				sum := 0.0
+				for o, d := range delta {
+					sum += m.Layers[l].W[o][j] * d
+				}
+				prev[j] = sum * activateDerivative(m.Activation, in[j])
+			}
+			delta = prev
+		}
+	}
+
+	for l, layer := range m.Layers {
+		for o := range layer.W {
+			for j, w := range layer.W[o] {
+				grads[l].W[o][j] += m.Alpha * w / n
+			}
+		}
+	}
+	return grads
+}
+
+// evaluate returns the mean loss and the accuracy over rows.
+func (m *MLP) evaluate(inputs, targets [][]float64, rows []int) (float64, float64) {
+	loss, correct := 0.0, 0
+	for _, r := range rows {
+		acts := m.forward(inputs[r])
+		out := acts[len(acts)-1]
+		if m.Classify {
+			k := argmax(targets[r])
+			loss -= math.Log(math.Max(out[k], 1e-15))
+			if argmax(out) == k {
+				correct++
+			}
+		} else {
+			d := out[0] - targets[r][0]
+			loss += d * d / 2
+		}
+	}
+	return loss / float64(len(rows)), float64(correct) / float64(len(rows))
+}
+
+func (m *MLP) scale(row []float64) []float64 {
+	out := make([]float64, len(row))
+	for j, v := range row {
+		out[j] = (v - m.InputMean[j]) / m.InputScale[j]
+	}
+	return out
+}
+
+// optimizer applies gradient steps and keeps whatever per-weight state the
+// chosen method needs.
+type optimizer struct {
+	m        *MLP
+	velocity []DenseLayer // momentum, or Adam's first moment
+	second   []DenseLayer // Adam's second moment
+	t        int
+}
+
+func newOptimizer(m *MLP) *optimizer {
+	zeros := func() []DenseLayer {
+		out := make([]DenseLayer, len(m.Layers))
+		for l, layer := range m.Layers {
+			out[l] = DenseLayer{W: make([][]float64, len(layer.W)), B: make([]float64, len(layer.B))}
+			for o := range layer.W {
+				out[l].W[o] = make([]float64, len(layer.W[o]))
+			}
+		}
+		return out
+	}
+	return &optimizer{m: m, velocity: zeros(), second: zeros()}
+}
+
+func (opt *optimizer) step(layers, grads []DenseLayer) {
+	opt.t++
+	for l := range layers {
+		for o := range layers[l].W {
+			for j := range layers[l].W[o] {
+				layers[l].W[o][j] += opt.delta(&opt.velocity[l].W[o][j], &opt.second[l].W[o][j], grads[l].W[o][j])
+			}
+			layers[l].B[o] += opt.delta(&opt.velocity[l].B[o], &opt.second[l].B[o], grads[l].B[o])
+		}
+	}
+}
+
+// delta returns the change for one parameter given its gradient g.
+func (opt *optimizer) delta(v, s *float64, g float64) float64 {
+	lr := opt.m.LearningRate
+	switch opt.m.Optimizer {
+	case "momentum":
+		*v = opt.m.Momentum**v - lr*g
+		return *v
+	case "adam":
+		const beta1, beta2, eps = 0.9, 0.999, 1e-8
+		*v = beta1**v + (1-beta1)*g
+		*s = beta2**s + (1-beta2)*g*g
+		vHat := *v / (1 - math.Pow(beta1, float64(opt.t)))
+		sHat := *s / (1 - math.Pow(beta2, float64(opt.t)))
+		return -lr * vHat / (math.Sqrt(sHat) + eps)
+	default:
+		return -lr * g
+	}
+}
+
+func activate(name string, z float64) float64 {
+	switch name {
+	case "relu":
+		return math.Max(z, 0)
+	case "tanh":
+		return math.Tanh(z)
+	default:
+		return sigmoid(z)
+	}
+}
+
+// activateDerivative is the derivative expressed in terms of the
+// activation's output a, which is what forward keeps.
+func activateDerivative(name string, a float64) float64 {
+	switch name {
+	case "relu":
+		if a > 0 {
+			return 1
+		}
+		return 0
+	case "tanh":
+		return 1 - a*a
+	default:
+		return a * (1 - a)
+	}
+}
+
+func softmax(z []float64) {
+	max := z[argmax(z)]
+	sum := 0.0
+	for i := range z {
+		z[i] = math.Exp(z[i] - max)
+		sum += z[i]
+	}
+	for i := range z {
+		z[i] /= sum
+	}
+}
+
+func argmax(v []float64) int {
+	best := 0
+	for i := range v {
+		if v[i] > v[best] {
+			best = i
+		}
+	}
+	return best
+}
+
+// standardization returns the per-column mean and standard deviation of X,
+// using 1 for constant columns so they scale to zero instead of NaN.
+func standardization(X [][]float64) ([]float64, []float64) {
+	mean := make([]float64, len(X[0]))
+	scale := make([]float64, len(X[0]))
+	column := make([]float64, len(X))
+	for j := range mean {
+		for i, row := range X {
+			column[i] = row[j]
+		}
+		mean[j], scale[j] = meanStd(column)
+	}
+	return mean, scale
+}
+
+func meanStd(values []float64) (float64, float64) {
+	mean := 0.0
+	for _, v := range values {
+		mean += v / float64(len(values))
+	}
+	variance := 0.0
+	for _, v := range values {
+		variance += (v - mean) * (v - mean) / float64(len(values))
+	}
+	if variance < 1e-24 {
+		return mean, 1
+	}
+	return mean, math.Sqrt(variance)
+}
+
+// distinct returns the sorted distinct values of y.
+func distinct(y []float64) []float64 {
+	seen := map[float64]bool{}
+	var out []float64
+	for _, v := range y {
+		if !seen[v] {
+			seen[v] = true
+			out = append(out, v)
+		}
+	}
+	sort.Float64s(out)
+	return out
+}
@@ -0,0 +1,108 @@
+package model
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+// Checks that every optimizer fits a smooth non-linear function and that the
+// target is predicted back in its original (unstandardised) units.
+func TestMLPRegressorOptimizers(t *testing.T) {
+	rng := rand.New(rand.NewSource(4))
+	X := make([][]float64, 200)
+	y := make([]float64, len(X))
+	for i := range X {
+		x := rng.Float64()*4 - 2
+		X[i] = []float64{x}
+		y[i] = 1000 + 500*math.Sin(x) // large offset exercises target scaling
+	}
+
+	for _, opt := range []string{"sgd", "momentum", "adam"} {
+		params := Params{
+			"hidden": []interface{}{16.0, 16.0}, "activation": "tanh", "optimizer": opt,
+			"epochs": 150.0, "batch_size": 16.0, "seed": 1.0,
+		}
+		if opt == "adam" {
+			params["learning_rate"] = 0.01
+		}
+		m, err := Spec{Type: "mlp", Params: params}.New()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := m.Fit(X, y); err != nil {
+			t.Fatalf("%s: %v", opt, err)
+		}
+		pred, _ := m.Predict([][]float64{{1}, {-1}})
+		want := []float64{1000 + 500*math.Sin(1), 1000 + 500*math.Sin(-1)}
+		for i := range pred {
+			if math.Abs(pred[i]-want[i]) > 60 {
+				t.Errorf("%s: predict %v = %v, want about %v", opt, X[i], pred[i], want[i])
+			}
+		}
+	}
+}
+
+// Checks that the classifier separates three classes, reports per-epoch
+// accuracy and validation metrics, and produces normalised probabilities.
+func TestMLPClassifier(t *testing.T) {
+	rng := rand.New(rand.NewSource(5))
+	var X [][]float64
+	var y []float64
+	centres := [][]float64{{0, 0}, {4, 4}, {0, 4}}
+	for i := 0; i < 150; i++ {
+		c := i % 3
+		X = append(X, []float64{centres[c][0] + rng.NormFloat64()*0.5, centres[c][1] + rng.NormFloat64()*0.5})
+		y = append(y, float64(10*c))
+	}
+
+	m, _ := Spec{Type: "mlp_classifier", Params: Params{
+		"hidden": 8.0, "epochs": 60.0, "learning_rate": 0.01, "validation_fraction": 0.2, "seed": 2.0,
+	}}.New()
+	var last Progress
+	epochs := 0
+	m.(Reporter).OnProgress(func(p Progress) { last, epochs = p, epochs+1 })
+	if err := m.Fit(X, y); err != nil {
+		t.Fatal(err)
+	}
+
+	if epochs != 60 {
+		t.Errorf("got %d progress events, want 60", epochs)
+	}
+	for _, name := range []string{"loss", "accuracy", "val_loss", "val_accuracy"} {
+		if _, ok := last.Metrics[name]; !ok {
+			t.Errorf("final progress is missing %s: %v", name, last.Metrics)
+		}
+	}
+	if last.Metrics["accuracy"] < 0.95 {
+		t.Errorf("training accuracy %v, want >= 0.95", last.Metrics["accuracy"])
+	}
+
+	pred, _ := m.Predict([][]float64{{4, 4}, {0, 4}})
+	if pred[0] != 10 || pred[1] != 20 {
+		t.Errorf("predictions %v, want [10 20]", pred)
+	}
+	proba, _ := m.(Classifier).PredictProba([][]float64{{0, 0}})
+	if len(proba[0]) != 3 || math.Abs(proba[0][0]+proba[0][1]+proba[0][2]-1) > 1e-9 {
+		t.Errorf("probabilities %v, want 3 values summing to 1", proba[0])
+	}
+}
+
+// Checks that the same seed reproduces the same weights.
+func TestMLPSeeded(t *testing.T) {
+	X := [][]float64{{1}, {2}, {3}, {4}}
+	y := []float64{2, 4, 6, 8}
+	fit := func() []float64 {
+		m, _ := Spec{Type: "mlp", Params: Params{"hidden": []interface{}{4.0}, "epochs": 5.0, "seed": 9.0}}.New()
+		if err := m.Fit(X, y); err != nil {
+			t.Fatal(err)
+		}
+		return m.(*MLP).Layers[0].W[0]
+	}
+	a, b := fit(), fit()
+	for i := range a {
+		if a[i] != b[i] {
+			t.Fatalf("weights differ between identical seeded runs: %v vs %v", a, b)
+		}
+	}
+}
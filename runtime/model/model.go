@@ -0,0 +1,349 @@
+// Package model holds MLite's native learners and the registry that maps
+// the names used in scripts (`gbm_regressor(...)`) to them.
+package model
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"mlite/dataset"
+)
+
+// Model is a learner that fits a numeric target from a row-major feature matrix.
+type Model interface {
+	Fit(X [][]float64, y []float64) error
+	Predict(X [][]float64) ([]float64, error)
+}
+
+// Classifier is a Model whose predictions are class labels.
+type Classifier interface {
+	Model
+	// Classes returns the labels seen during Fit, in ascending order.
+	Classes() []float64
+	// PredictProba returns one probability per class for every row.
+	PredictProba(X [][]float64) ([][]float64, error)
+}
+
+// IsClassifier reports whether a fitted model predicts class labels. Model
+// types that can be either, such as gradient boosting, only report classes
+// when fitted with a classification loss.
+func IsClassifier(m Model) bool {
+	c, ok := m.(Classifier)
+	return ok && len(c.Classes()) > 0
+}
+
+// Incremental is a Model that can also learn from data one batch at a time,
+// so a dataset streamed from disk can be trained on without holding it in
+// memory.
+type Incremental interface {
+	Model
+	// Reset forgets what earlier batches taught the model.
+	Reset()
+	// PartialFit continues training on one batch of rows.
+	PartialFit(X [][]float64, y []float64) error
+	// Finish reports whether the batches seen were enough to train on,
+	// after the last of them.
+	Finish() error
+	// Epochs is how many passes over the data training makes.
+	Epochs() int
+}
+
+// Progress is reported by iterative models after each boosting round or epoch.
+type Progress struct {
+	Iteration int                // 1-based
+	Metrics   map[string]float64 // e.g. "loss", "val_loss"
+}
+
+// Reporter is implemented by models that can report training progress.
+type Reporter interface {
+	OnProgress(fn func(Progress))
+}
+
+// Factory builds an unfitted model from its hyperparameters.
+type Factory func(params Params) (Model, error)
+
+type entry struct {
+	factory    Factory
+	positional []string
+}
+
+var registry = map[string]entry{}
+
+// Register makes a model type available to scripts under name. Positional
+// names the parameters that may be passed without a keyword, in order.
+func Register(name string, factory Factory, positional ...string) {
+	if _, dup := registry[name]; dup {
+		panic(fmt.Sprintf("model: %s registered twice", name))
+	}
+	registry[name] = entry{factory: factory, positional: positional}
+}
+
+// IsRegistered reports whether name is a known model type.
+func IsRegistered(name string) bool {
+	_, ok := registry[name]
+	return ok
+}
+
+// Types returns the registered model type names, sorted.
+func Types() []string {
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Positional returns the names of the parameters that can be passed
+// positionally to the model type.
+func Positional(name string) []string {
+	return registry[name].positional
+}
+
+// Spec identifies an unfitted model: its registered type and hyperparameters.
+// A pipeline also has preprocessing steps, fitted on the training data
+// before the model.
+type Spec struct {
+	Type   string
+	Params Params
+	Steps  []dataset.Step
+}
+
+// Name describes the spec: its type, or for a pipeline its steps and type,
+// e.g. "pipeline(standardize(sqft), linreg)".
+func (s Spec) Name() string {
+	if len(s.Steps) == 0 {
+		return s.Type
+	}
+	parts := make([]string, len(s.Steps)+1)
+	for j, step := range s.Steps {
+		parts[j] = step.String()
+	}
+	parts[len(s.Steps)] = s.Type
+	return "pipeline(" + strings.Join(parts, ", ") + ")"
+}
+
+// New builds a fresh, unfitted model from the spec.
+func (s Spec) New() (Model, error) {
+	e, ok := registry[s.Type]
+	if !ok {
+		return nil, fmt.Errorf("unknown model type %q (have %s)", s.Type, strings.Join(Types(), ", "))
+	}
+	params := s.Params
+	if params == nil {
+		params = Params{}
+	}
+	return e.factory(params)
+}
+
+// Estimator is a model together with the spec it was built from and the
+// dataset columns it was fitted on. It is the value scripts hold in a variable.
+type Estimator struct {
+	Spec     Spec
+	Model    Model
+	Features []string
+	Target   string
+
+	// Transforms are the preprocessing steps of the training data, replayed
+	// on data the model predicts from.
+	Transforms []dataset.Transform
+
+	// Training metadata, kept in saved model files.
+	Rows      int
+	TrainedAt time.Time
+}
+
+// NewEstimator builds an unfitted estimator for spec.
+func NewEstimator(spec Spec) (*Estimator, error) {
+	m, err := spec.New()
+	if err != nil {
+		return nil, err
+	}
+	return &Estimator{Spec: spec, Model: m}, nil
+}
+
+// Trained reports whether Fit has completed.
+func (e *Estimator) Trained() bool {
+	return e.Features != nil
+}
+
+// Fit trains the model on the feature and target columns of d. A pipeline
+// first fits its steps on d in order; its features may name columns that a
+// one-hot step encodes, standing for the encoded columns.
+func (e *Estimator) Fit(d *dataset.Dataset, features []string, target string) error {
+	for _, step := range e.Spec.Steps {
+		t, err := step.Fit(d)
+		if err != nil {
+			return fmt.Errorf("%s: %w", step, err)
+		}
+		if d, err = d.Apply(t); err != nil {
+			return err
+		}
+	}
+	features = d.ExpandColumns(features)
+	X, err := d.Matrix(features)
+	if err != nil {
+		return err
+	}
+	y, err := d.Numbers(target)
+	if err != nil {
+		return err
+	}
+	if err := e.Model.Fit(X, y); err != nil {
+		return fmt.Errorf("%s: %w", e.Spec.Type, err)
+	}
+	e.Features = features
+	e.Target = target
+	e.Transforms = d.Transforms
+	e.Rows = len(y)
+	e.TrainedAt = time.Now()
+	return nil
+}
+
+// FitStream trains the model on a dataset streamed from disk, passing each
+// batch to PartialFit, over as many passes as the model needs. Only
+// Incremental models can learn this way, and pipelines cannot, since their
+// steps are fitted on the whole of the data.
+func (e *Estimator) FitStream(s *dataset.Stream, features []string, target string) error {
+	m, ok := e.Model.(Incremental)
+	if !ok {
+		return fmt.Errorf("%s cannot be trained on a streamed dataset (use %s)", e.Spec.Type, strings.Join(IncrementalTypes(), ", "))
+	}
+	if len(e.Spec.Steps) > 0 {
+		return fmt.Errorf("a pipeline cannot be trained on a streamed dataset")
+	}
+	if _, err := s.Schema().Matrix(append(append([]string(nil), features...), target)); err != nil {
+		return err
+	}
+
+	m.Reset()
+	rows := 0
+	for epoch := 0; epoch < m.Epochs(); epoch++ {
+		rows = 0
+		err := s.Each(func(d *dataset.Dataset) error {
+			X, err := d.Matrix(features)
+			if err != nil {
+				return err
+			}
+			y, err := d.Numbers(target)
+			if err != nil {
+				return err
+			}
+			rows += len(y)
+			return m.PartialFit(X, y)
+		})
+		if err != nil {
+			return fmt.Errorf("%s: %w", e.Spec.Type, err)
+		}
+	}
+	if rows == 0 {
+		return fmt.Errorf("%s: the stream has no rows", e.Spec.Type)
+	}
+	if err := m.Finish(); err != nil {
+		return fmt.Errorf("%s: %w", e.Spec.Type, err)
+	}
+	e.Features = features
+	e.Target = target
+	e.Transforms = nil
+	e.Rows = rows
+	e.TrainedAt = time.Now()
+	return nil
+}
+
+// IncrementalTypes returns the registered model types that can be trained
+// on a streamed dataset, sorted.
+func IncrementalTypes() []string {
+	var names []string
+	for _, name := range Types() {
+		if m, err := registry[name].factory(Params{}); err == nil {
+			if _, ok := m.(Incremental); ok {
+				names = append(names, name)
+			}
+		}
+	}
+	return names
+}
+
+// CheckColumns reports whether d has every feature column the model was
+// fitted on, as a numeric column.
+func (e *Estimator) CheckColumns(d *dataset.Dataset) error {
+	var missing, text []string
+	for _, name := range e.Features {
+		c, err := d.Column(name)
+		switch {
+		case err != nil:
+			missing = append(missing, name)
+		case c.Type != dataset.Numeric:
+			text = append(text, name)
+		}
+	}
+	if missing != nil {
+		return fmt.Errorf("data is missing feature column(s) %s; the model was trained on %s",
+			strings.Join(missing, ", "), strings.Join(e.Features, ", "))
+	}
+	if text != nil {
+		return fmt.Errorf("feature column(s) %s are not numeric", strings.Join(text, ", "))
+	}
+	return nil
+}
+
+// Prepare replays on d the preprocessing steps of the training data that d
+// has not been through, so raw data can be scored directly.
+func (e *Estimator) Prepare(d *dataset.Dataset) (*dataset.Dataset, error) {
+	return d.Replay(e.Transforms)
+}
+
+// Predict predicts every row of d from the columns the model was fitted on,
+// after preprocessing d like the training data.
+func (e *Estimator) Predict(d *dataset.Dataset) ([]float64, error) {
+	if !e.Trained() {
+		return nil, fmt.Errorf("model has not been trained")
+	}
+	d, err := e.Prepare(d)
+	if err != nil {
+		return nil, err
+	}
+	if err := e.CheckColumns(d); err != nil {
+		return nil, err
+	}
+	X, err := d.Matrix(e.Features)
+	if err != nil {
+		return nil, err
+	}
+	return e.Model.Predict(X)
+}
+
+// PredictRow predicts a single row whose values follow the order of
+// Features. Preprocessing steps that rewrite those columns, such as scaling,
+// are replayed on it; values of encoded columns are taken as encoded.
+func (e *Estimator) PredictRow(row []float64) (float64, error) {
+	if !e.Trained() {
+		return 0, fmt.Errorf("model has not been trained")
+	}
+	if len(row) != len(e.Features) {
+		return 0, fmt.Errorf("expected %d inputs (%s), got %d", len(e.Features), strings.Join(e.Features, ", "), len(row))
+	}
+	columns := make([]*dataset.Column, len(row))
+	for j, name := range e.Features {
+		columns[j] = dataset.NewNumeric(name, []float64{row[j]})
+	}
+	d, err := dataset.New(columns...)
+	if err != nil {
+		return 0, err
+	}
+	out, err := e.Predict(d)
+	if err != nil {
+		return 0, err
+	}
+	return out[0], nil
+}
+
+// String renders a short description such as "gbm_regressor(price ~ sqft, age)".
+func (e *Estimator) String() string {
+	if !e.Trained() {
+		return e.Spec.Name() + "(untrained)"
+	}
+	return fmt.Sprintf("%s(%s ~ %s)", e.Spec.Name(), e.Target, strings.Join(e.Features, ", "))
+}
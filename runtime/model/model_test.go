@@ -0,0 +1,276 @@
+package model
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+// Checks that OLS recovers the exact coefficients of a noiseless linear target.
+func TestLinearRegressionExactFit(t *testing.T) {
+	X := [][]float64{{1, 2}, {2, 1}, {3, 5}, {4, 3}, {5, 8}}
+	y := make([]float64, len(X))
+	for i, row := range X {
+		y[i] = 3*row[0] - 2*row[1] + 7
+	}
+
+	m, err := Spec{Type: "linear_regression"}.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Fit(X, y); err != nil {
+		t.Fatal(err)
+	}
+	lr := m.(*LinearRegression)
+	if !near(lr.Coef[0], 3) || !near(lr.Coef[1], -2) || !near(lr.Intercept, 7) {
+		t.Errorf("got coef %v intercept %v, want [3 -2] and 7", lr.Coef, lr.Intercept)
+	}
+}
+
+// Checks that collinear features, such as the one-hot columns of a category,
+// get the smallest least-squares coefficients instead of failing, and that
+// a single row still leaves the model untrained.
+func TestLinearRegressionCollinear(t *testing.T) {
+	var X [][]float64
+	var y []float64
+	for i := 0; i < 12; i++ {
+		austin := float64(i % 2)
+		X = append(X, []float64{float64(i), austin, 1 - austin})
+		y = append(y, 2*float64(i)+5*austin+1)
+	}
+	m, _ := Spec{Type: "linear_regression"}.New()
+	if err := m.Fit(X, y); err != nil {
+		t.Fatal(err)
+	}
+	lr := m.(*LinearRegression)
+	if !near(lr.Coef[0], 2) || !near(lr.Coef[1], 2.5) || !near(lr.Coef[2], -2.5) {
+		t.Errorf("got coef %v, want [2 2.5 -2.5]", lr.Coef)
+	}
+	pred, _ := m.Predict(X)
+	for i := range y {
+		if !near(pred[i], y[i]) {
+			t.Errorf("row %d: predicted %v, want %v", i, pred[i], y[i])
+		}
+	}
+
+	if err := m.Fit(X[:1], y[:1]); err == nil {
+		t.Error("expected an error fitting a single row")
+	}
+}
+
+// Checks that unknown or mistyped hyperparameters are rejected at construction.
+func TestSpecRejectsBadParams(t *testing.T) {
+	cases := []Spec{
+		{Type: "gbm_regressor", Params: Params{"max_detph": 3.0}},
+		{Type: "gbm_regressor", Params: Params{"n_estimators": 2.5}},
+		{Type: "gbm_regressor", Params: Params{"loss": "hinge"}},
+		{Type: "gbm_classifier", Params: Params{"loss": "squared"}},
+		{Type: "gbm_regressor", Params: Params{"loss": "log"}},
+		{Type: "gbm_classifier", Params: Params{"subsample": 0.0}},
+		{Type: "random_forest"},
+	}
+	for _, spec := range cases {
+		if _, err := spec.New(); err == nil {
+			t.Errorf("%s %v: expected an error", spec.Type, spec.Params)
+		}
+	}
+}
+
+// Checks that boosting fits a non-linear target far better than its initial
+// constant prediction and reports a decreasing loss every round.
+func TestGBMRegressorFitsNonLinearTarget(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	X := make([][]float64, 200)
+	y := make([]float64, len(X))
+	for i := range X {
+		x := rng.Float64()*6 - 3
+		X[i] = []float64{x}
+		y[i] = x * x
+	}
+
+	m, _ := Spec{Type: "gbm_regressor", Params: Params{"n_estimators": 50.0, "subsample": 0.8, "seed": 3.0}}.New()
+	var losses []float64
+	m.(Reporter).OnProgress(func(p Progress) { losses = append(losses, p.Metrics["loss"]) })
+	if err := m.Fit(X, y); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(losses) != 50 {
+		t.Fatalf("got %d progress events, want 50", len(losses))
+	}
+	if losses[49] > losses[0]/10 {
+		t.Errorf("loss barely improved: first %v, last %v", losses[0], losses[49])
+	}
+	pred, _ := m.Predict([][]float64{{2}, {0}})
+	if math.Abs(pred[0]-4) > 0.5 || math.Abs(pred[1]) > 0.5 {
+		t.Errorf("predictions %v, want close to [4 0]", pred)
+	}
+}
+
+// Checks that early stopping halts before n_estimators once the validation
+// loss stops improving.
+func TestGBMEarlyStopping(t *testing.T) {
+	rng := rand.New(rand.NewSource(2))
+	X := make([][]float64, 100)
+	y := make([]float64, len(X))
+	for i := range X {
+		X[i] = []float64{rng.Float64()}
+		y[i] = rng.NormFloat64() // pure noise: validation loss cannot keep improving
+	}
+
+	m, _ := Spec{Type: "gbm_regressor", Params: Params{"n_estimators": 500.0, "n_iter_no_change": 5.0}}.New()
+	rounds := 0
+	m.(Reporter).OnProgress(func(p Progress) {
+		rounds = p.Iteration
+		if _, ok := p.Metrics["val_loss"]; !ok {
+			t.Fatal("progress is missing val_loss")
+		}
+	})
+	if err := m.Fit(X, y); err != nil {
+		t.Fatal(err)
+	}
+	if rounds >= 500 {
+		t.Errorf("ran all %d rounds, expected early stopping", rounds)
+	}
+	if len(m.(*GradientBoosting).Trees) != rounds {
+		t.Errorf("kept %d trees after %d rounds", len(m.(*GradientBoosting).Trees), rounds)
+	}
+}
+
+// Checks that the log-loss classifier separates two classes, maps predictions
+// back to the original labels and returns probabilities that sum to one.
+func TestGBMClassifier(t *testing.T) {
+	var X [][]float64
+	var y []float64
+	for i := 0; i < 40; i++ {
+		x := float64(i)
+		X = append(X, []float64{x})
+		if x < 20 {
+			y = append(y, 3)
+		} else {
+			y = append(y, 7)
+		}
+	}
+
+	m, _ := Spec{Type: "gbm_classifier", Params: Params{"n_estimators": 20.0}}.New()
+	if err := m.Fit(X, y); err != nil {
+		t.Fatal(err)
+	}
+	c := m.(Classifier)
+	if got := c.Classes(); got[0] != 3 || got[1] != 7 {
+		t.Errorf("classes %v, want [3 7]", got)
+	}
+	pred, _ := c.Predict([][]float64{{5}, {35}})
+	if pred[0] != 3 || pred[1] != 7 {
+		t.Errorf("predictions %v, want [3 7]", pred)
+	}
+	proba, _ := c.PredictProba([][]float64{{5}})
+	if !near(proba[0][0]+proba[0][1], 1) || proba[0][0] < 0.9 {
+		t.Errorf("probabilities %v, want P(3) > 0.9", proba[0])
+	}
+
+	if err := m.Fit(X, make([]float64, len(X))); err == nil {
+		t.Error("expected an error for a single-class target")
+	}
+}
+
+// Checks that logistic regression separates three classes with softmax
+// outputs and that its coefficients apply to unscaled inputs.
+func TestLogisticRegressionMulticlass(t *testing.T) {
+	var X [][]float64
+	var y []float64
+	for i := 0; i < 60; i++ {
+		x := float64(i * 100) // large raw scale, standardised internally
+		X = append(X, []float64{x})
+		y = append(y, float64(i/20))
+	}
+
+	m, _ := Spec{Type: "logistic_regression", Params: Params{"C": 100.0}}.New()
+	if err := m.Fit(X, y); err != nil {
+		t.Fatal(err)
+	}
+	lr := m.(*LogisticRegression)
+	if len(lr.Coef) != 3 || len(lr.Intercept) != 3 {
+		t.Fatalf("got %d coefficient rows, want 3", len(lr.Coef))
+	}
+	pred, _ := lr.Predict([][]float64{{500}, {3000}, {5500}})
+	if pred[0] != 0 || pred[1] != 1 || pred[2] != 2 {
+		t.Errorf("predictions %v, want [0 1 2]", pred)
+	}
+	proba, _ := lr.PredictProba([][]float64{{3000}})
+	if sum := proba[0][0] + proba[0][1] + proba[0][2]; !near(sum, 1) {
+		t.Errorf("probabilities %v sum to %v", proba[0], sum)
+	}
+
+	if _, err := (Spec{Type: "logistic_regression", Params: Params{"C": 0.0}}).New(); err == nil {
+		t.Error("expected an error for C = 0")
+	}
+}
+
+// Checks that fitting linear regression batch by batch gives the fit of
+// all the rows at once.
+func TestLinearRegressionPartialFit(t *testing.T) {
+	rng := rand.New(rand.NewSource(2))
+	X := make([][]float64, 90)
+	y := make([]float64, len(X))
+	for i := range X {
+		X[i] = []float64{rng.Float64() * 1000, rng.Float64()}
+		y[i] = 0.5*X[i][0] + 40*X[i][1] + rng.NormFloat64()
+	}
+
+	whole, _ := Spec{Type: "linear_regression", Params: Params{"alpha": 0.5}}.New()
+	if err := whole.Fit(X, y); err != nil {
+		t.Fatal(err)
+	}
+	batched, _ := Spec{Type: "linear_regression", Params: Params{"alpha": 0.5}}.New()
+	inc := batched.(Incremental)
+	for _, r := range [][2]int{{0, 7}, {7, 50}, {50, 90}} {
+		if err := inc.PartialFit(X[r[0]:r[1]], y[r[0]:r[1]]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	a, b := whole.(*LinearRegression), batched.(*LinearRegression)
+	if !near(a.Coef[0], b.Coef[0]) || !near(a.Coef[1], b.Coef[1]) || !near(a.Intercept, b.Intercept) {
+		t.Errorf("batched fit %v + %v, whole fit %v + %v", b.Coef, b.Intercept, a.Coef, a.Intercept)
+	}
+}
+
+// Checks that the SGD regressor approaches the least-squares line on raw,
+// unscaled columns and that the classifier separates two classes.
+func TestSGD(t *testing.T) {
+	rng := rand.New(rand.NewSource(3))
+	X := make([][]float64, 500)
+	y := make([]float64, len(X))
+	labels := make([]float64, len(X))
+	for i := range X {
+		X[i] = []float64{1000 + rng.Float64()*2000}
+		y[i] = 150*X[i][0] + 20000 + rng.NormFloat64()*1000
+		if X[i][0] > 2000 {
+			labels[i] = 1
+		}
+	}
+
+	m, _ := Spec{Type: "sgd_regressor", Params: Params{"epochs": 20.0}}.New()
+	if err := m.Fit(X, y); err != nil {
+		t.Fatal(err)
+	}
+	if coef := m.(*SGD).Coef[0][0]; math.Abs(coef-150) > 5 {
+		t.Errorf("slope %v, want about 150", coef)
+	}
+
+	c, _ := Spec{Type: "sgd_classifier"}.New()
+	if err := c.Fit(X, labels); err != nil {
+		t.Fatal(err)
+	}
+	pred, _ := c.Predict([][]float64{{1200}, {2800}})
+	if pred[0] != 0 || pred[1] != 1 || !IsClassifier(c) {
+		t.Errorf("predictions %v, want [0 1]", pred)
+	}
+	if _, err := (Spec{Type: "sgd_regressor", Params: Params{"epochs": 0.0}}).New(); err == nil {
+		t.Error("expected an error for 0 epochs")
+	}
+}
+
+func near(a, b float64) bool {
+	return math.Abs(a-b) < 1e-6
+}
@@ -0,0 +1,138 @@
+package model
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+)
+
+// Params are the hyperparameters given to a model constructor. Values come
+// straight from the interpreter: float64 for numbers, string for strings and
+// []interface{} for arrays.
+type Params map[string]interface{}
+
+// Float returns the numeric parameter name, or def when it is not set.
+func (p Params) Float(name string, def float64) (float64, error) {
+	v, ok := p[name]
+	if !ok {
+		return def, nil
+	}
+	f, ok := v.(float64)
+	if !ok {
+		return 0, fmt.Errorf("%s must be a number, got %v", name, v)
+	}
+	return f, nil
+}
+
+// Int returns the whole-number parameter name, or def when it is not set.
+func (p Params) Int(name string, def int) (int, error) {
+	f, err := p.Float(name, float64(def))
+	if err != nil {
+		return 0, err
+	}
+	if f != math.Trunc(f) {
+		return 0, fmt.Errorf("%s must be a whole number, got %v", name, f)
+	}
+	return int(f), nil
+}
+
+// String returns the string parameter name, or def when it is not set.
+func (p Params) String(name string, def string) (string, error) {
+	v, ok := p[name]
+	if !ok {
+		return def, nil
+	}
+	s, ok := v.(string)
+	if !ok {
+		return "", fmt.Errorf("%s must be a string, got %v", name, v)
+	}
+	return s, nil
+}
+
+// Ints returns the array parameter name as whole numbers, or def when it is
+// not set. A single number is accepted as a one-element array.
+func (p Params) Ints(name string, def []int) ([]int, error) {
+	v, ok := p[name]
+	if !ok {
+		return def, nil
+	}
+	items, ok := v.([]interface{})
+	if !ok {
+		items = []interface{}{v}
+	}
+	out := make([]int, len(items))
+	for i, item := range items {
+		f, ok := item.(float64)
+		if !ok || f != math.Trunc(f) {
+			return nil, fmt.Errorf("%s must contain whole numbers, got %v", name, item)
+		}
+		out[i] = int(f)
+	}
+	return out, nil
+}
+
+// Check rejects any parameter not listed in allowed, so a typo such as
+// `max_detph` fails loudly instead of being ignored.
+func (p Params) Check(allowed ...string) error {
+	known := make(map[string]bool, len(allowed))
+	for _, name := range allowed {
+		known[name] = true
+	}
+	var unknown []string
+	for name := range p {
+		if !known[name] {
+			unknown = append(unknown, name)
+		}
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return fmt.Errorf("unknown parameter(s) %s (accepted: %s)", strings.Join(unknown, ", "), strings.Join(allowed, ", "))
+	}
+	return nil
+}
+
+// paramReader reads several parameters and keeps the first error, so a
+// constructor can check once at the end instead of after every value.
+type paramReader struct {
+	p   Params
+	err error
+}
+
+func (p Params) reader() *paramReader {
+	return &paramReader{p: p}
+}
+
+func (r *paramReader) keep(err error) {
+	if r.err == nil {
+		r.err = err
+	}
+}
+
+func (r *paramReader) Float(name string, def float64) float64 {
+	v, err := r.p.Float(name, def)
+	r.keep(err)
+	return v
+}
+
+func (r *paramReader) Int(name string, def int) int {
+	v, err := r.p.Int(name, def)
+	r.keep(err)
+	return v
+}
+
+func (r *paramReader) String(name string, def string) string {
+	v, err := r.p.String(name, def)
+	r.keep(err)
+	return v
+}
+
+func (r *paramReader) Ints(name string, def []int) []int {
+	v, err := r.p.Ints(name, def)
+	r.keep(err)
+	return v
+}
+
+func (r *paramReader) Err() error {
+	return r.err
+}
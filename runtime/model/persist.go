@@ -0,0 +1,420 @@
+package model
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"time"
+
+	"mlite/dataset"
+)
+
+// The .mlm model file format, version 2. All integers are little-endian.
+//
+//	offset  size  field
+//	0       8     magic "MLITEMDL"
+//	8       2     format version (uint16), 1 or 2
+//	10      4     header length H (uint32)
+//	14      H     header: UTF-8 JSON, see FileHeader
+//	14+H    P     payload: the fitted weights, P = FileHeader.PayloadBytes
+//
+// The payload is a flat sequence of values written by the model type's
+// Weights implementation: float64 values as IEEE 754 bits (8 bytes), ints
+// as int64 (8 bytes), and slices as an int64 length followed by their
+// elements. FileHeader.SHA256 is the hex SHA-256 of the payload.
+//
+// A reader must reject files with a newer format version. Later versions may
+// add header fields; readers ignore unknown ones.
+//
+// Version 2 adds the preprocessing header field, the training data's fitted
+// preprocessing steps. A version 1 reader would ignore the steps and score
+// unprocessed data, so only files with steps are written as version 2. A
+// pipeline's file also lists its unfitted steps in the pipeline field, so
+// the loaded model can be retrained; its fitted steps are among the
+// preprocessing ones.
+const (
+	fileMagic   = "MLITEMDL"
+	FileVersion = 2
+
+	// maxHeaderBytes bounds the JSON header; real headers are a few KB.
+	maxHeaderBytes = 1 << 24
+)
+
+// FileHeader is the JSON header of a model file.
+type FileHeader struct {
+	FormatVersion int       `json:"format_version"`
+	ModelType     string    `json:"model_type"`
+	Params        Params    `json:"params"`
+	Features      []string  `json:"features"`
+	Target        string    `json:"target"`
+	TrainingRows  int       `json:"training_rows"`
+	TrainedAt     time.Time `json:"trained_at"`
+	PayloadBytes  int       `json:"payload_bytes"`
+	SHA256        string    `json:"sha256"`
+
+	Preprocessing json.RawMessage `json:"preprocessing,omitempty"` // version 2
+	Pipeline      []dataset.Step  `json:"pipeline,omitempty"`      // version 2, unfitted pipeline steps
+}
+
+// Weights is implemented by models that can be saved: they write their
+// fitted state to a payload and read it back into a model freshly built
+// from the same Spec.
+type Weights interface {
+	WriteWeights(w *WeightWriter)
+	ReadWeights(r *WeightReader) error
+}
+
+// Save writes a trained estimator to path in the .mlm format.
+func (e *Estimator) Save(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := e.Encode(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Encode writes a trained estimator in the .mlm format.
+func (e *Estimator) Encode(out io.Writer) error {
+	if !e.Trained() {
+		return errors.New("model has not been trained")
+	}
+	m, ok := e.Model.(Weights)
+	if !ok {
+		return fmt.Errorf("%s models cannot be saved", e.Spec.Type)
+	}
+	var w WeightWriter
+	m.WriteWeights(&w)
+	payload := w.buf.Bytes()
+	sum := sha256.Sum256(payload)
+
+	params := e.Spec.Params
+	if params == nil {
+		params = Params{}
+	}
+	version := 1
+	var steps []byte
+	if len(e.Transforms) > 0 {
+		version = 2
+		var err error
+		if steps, err = dataset.MarshalTransforms(e.Transforms); err != nil {
+			return err
+		}
+	}
+	header, err := json.Marshal(FileHeader{
+		FormatVersion: version,
+		ModelType:     e.Spec.Type,
+		Params:        params,
+		Features:      e.Features,
+		Target:        e.Target,
+		TrainingRows:  e.Rows,
+		TrainedAt:     e.TrainedAt.UTC(),
+		PayloadBytes:  len(payload),
+		SHA256:        hex.EncodeToString(sum[:]),
+		Preprocessing: steps,
+		Pipeline:      e.Spec.Steps,
+	})
+	if err != nil {
+		return err
+	}
+
+	var prefix bytes.Buffer
+	prefix.WriteString(fileMagic)
+	binary.Write(&prefix, binary.LittleEndian, uint16(version))
+	binary.Write(&prefix, binary.LittleEndian, uint32(len(header)))
+	for _, part := range [][]byte{prefix.Bytes(), header, payload} {
+		if _, err := out.Write(part); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Load reads an estimator saved with Save.
+func Load(path string) (*Estimator, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return Decode(f)
+}
+
+// Decode reads an estimator in the .mlm format, verifying its checksum.
+func Decode(in io.Reader) (*Estimator, error) {
+	magic := make([]byte, len(fileMagic))
+	if _, err := io.ReadFull(in, magic); err != nil || string(magic) != fileMagic {
+		return nil, errors.New("not an MLite model file")
+	}
+	var version uint16
+	var headerLen uint32
+	if err := binary.Read(in, binary.LittleEndian, &version); err != nil {
+		return nil, fmt.Errorf("truncated model file: %w", err)
+	}
+	if version > FileVersion {
+		return nil, fmt.Errorf("model file format version %d is newer than this MLite supports (%d)", version, FileVersion)
+	}
+	if version < 1 {
+		return nil, fmt.Errorf("invalid model file format version %d", version)
+	}
+	if err := binary.Read(in, binary.LittleEndian, &headerLen); err != nil {
+		return nil, fmt.Errorf("truncated model file: %w", err)
+	}
+
+	// The lengths are checked against what is left of the file before
+	// anything is allocated for them.
+	rest, err := io.ReadAll(in)
+	if err != nil {
+		return nil, fmt.Errorf("reading model file: %w", err)
+	}
+	if headerLen > maxHeaderBytes || int(headerLen) > len(rest) {
+		return nil, fmt.Errorf("invalid model header length %d (%d bytes remain)", headerLen, len(rest))
+	}
+	var header FileHeader
+	if err := json.Unmarshal(rest[:headerLen], &header); err != nil {
+		return nil, fmt.Errorf("invalid model header: %w", err)
+	}
+	if header.FormatVersion != int(version) {
+		return nil, fmt.Errorf("invalid model header: format version %d does not match the file's version %d", header.FormatVersion, version)
+	}
+	rest = rest[headerLen:]
+	if header.PayloadBytes < 0 || header.PayloadBytes > len(rest) {
+		return nil, fmt.Errorf("invalid model weights length %d (%d bytes remain)", header.PayloadBytes, len(rest))
+	}
+
+	payload := rest[:header.PayloadBytes]
+	sum := sha256.Sum256(payload)
+	if hex.EncodeToString(sum[:]) != header.SHA256 {
+		return nil, errors.New("model weights do not match their checksum; the file is corrupt")
+	}
+
+	est, err := NewEstimator(Spec{Type: header.ModelType, Params: header.Params, Steps: header.Pipeline})
+	if err != nil {
+		return nil, err
+	}
+	m, ok := est.Model.(Weights)
+	if !ok {
+		return nil, fmt.Errorf("%s models cannot be loaded", header.ModelType)
+	}
+	r := &WeightReader{buf: bytes.NewReader(payload)}
+	if err := m.ReadWeights(r); err != nil {
+		return nil, fmt.Errorf("reading %s weights: %w", header.ModelType, err)
+	}
+	if r.buf.Len() != 0 {
+		return nil, fmt.Errorf("reading %s weights: %d unexpected trailing bytes", header.ModelType, r.buf.Len())
+	}
+	if header.Preprocessing != nil {
+		if est.Transforms, err = dataset.UnmarshalTransforms(header.Preprocessing); err != nil {
+			return nil, fmt.Errorf("invalid preprocessing steps: %w", err)
+		}
+	}
+	est.Features = header.Features
+	est.Target = header.Target
+	est.Rows = header.TrainingRows
+	est.TrainedAt = header.TrainedAt
+	return est, nil
+}
+
+// WeightWriter encodes a model's fitted state.
+type WeightWriter struct {
+	buf bytes.Buffer
+}
+
+// Float writes one float64.
+func (w *WeightWriter) Float(v float64) {
+	binary.Write(&w.buf, binary.LittleEndian, math.Float64bits(v))
+}
+
+// Int writes an int as int64.
+func (w *WeightWriter) Int(v int) {
+	binary.Write(&w.buf, binary.LittleEndian, int64(v))
+}
+
+// Floats writes a length-prefixed slice.
+func (w *WeightWriter) Floats(vs []float64) {
+	w.Int(len(vs))
+	for _, v := range vs {
+		w.Float(v)
+	}
+}
+
+// Matrix writes a length-prefixed slice of rows.
+func (w *WeightWriter) Matrix(rows [][]float64) {
+	w.Int(len(rows))
+	for _, row := range rows {
+		w.Floats(row)
+	}
+}
+
+// WeightReader decodes what a WeightWriter wrote. Like paramReader it keeps
+// the first error, so a model reads every field and checks Err once.
+type WeightReader struct {
+	buf *bytes.Reader
+	err error
+}
+
+// Float reads one float64.
+func (r *WeightReader) Float() float64 {
+	var bits uint64
+	if r.err == nil {
+		r.err = binary.Read(r.buf, binary.LittleEndian, &bits)
+	}
+	return math.Float64frombits(bits)
+}
+
+// Int reads an int64.
+func (r *WeightReader) Int() int {
+	var v int64
+	if r.err == nil {
+		r.err = binary.Read(r.buf, binary.LittleEndian, &v)
+	}
+	return int(v)
+}
+
+// length reads a slice length, rejecting values the remaining bytes cannot hold.
+func (r *WeightReader) length() int {
+	n := r.Int()
+	if r.err == nil && (n < 0 || n > r.buf.Len()) {
+		r.err = fmt.Errorf("invalid length %d", n)
+	}
+	if r.err != nil {
+		return 0
+	}
+	return n
+}
+
+// Floats reads a slice written by WeightWriter.Floats.
+func (r *WeightReader) Floats() []float64 {
+	n := r.length()
+	if n == 0 {
+		return nil
+	}
+	vs := make([]float64, n)
+	for i := range vs {
+		vs[i] = r.Float()
+	}
+	return vs
+}
+
+// Matrix reads rows written by WeightWriter.Matrix.
+func (r *WeightReader) Matrix() [][]float64 {
+	n := r.length()
+	if n == 0 {
+		return nil
+	}
+	rows := make([][]float64, n)
+	for i := range rows {
+		rows[i] = r.Floats()
+	}
+	return rows
+}
+
+// Err returns the first decoding error.
+func (r *WeightReader) Err() error {
+	return r.err
+}
+
+func (m *LinearRegression) WriteWeights(w *WeightWriter) {
+	w.Floats(m.Coef)
+	w.Float(m.Intercept)
+}
+
+func (m *LinearRegression) ReadWeights(r *WeightReader) error {
+	m.Coef = r.Floats()
+	m.Intercept = r.Float()
+	return r.Err()
+}
+
+func (m *GradientBoosting) WriteWeights(w *WeightWriter) {
+	w.Float(m.Init)
+	w.Floats(m.Labels)
+	w.Int(len(m.Trees))
+	for _, t := range m.Trees {
+		w.Int(len(t.Nodes))
+		for _, n := range t.Nodes {
+			w.Int(n.Feature)
+			w.Float(n.Threshold)
+			w.Int(n.Left)
+			w.Int(n.Right)
+			w.Float(n.Value)
+		}
+	}
+}
+
+func (m *GradientBoosting) ReadWeights(r *WeightReader) error {
+	m.Init = r.Float()
+	m.Labels = r.Floats()
+	m.Trees = make([]*Tree, r.length())
+	for j := range m.Trees {
+		t := &Tree{Nodes: make([]TreeNode, r.length())}
+		for k := range t.Nodes {
+			t.Nodes[k] = TreeNode{Feature: r.Int(), Threshold: r.Float(), Left: r.Int(), Right: r.Int(), Value: r.Float()}
+		}
+		m.Trees[j] = t
+	}
+	return r.Err()
+}
+
+func (m *MLP) WriteWeights(w *WeightWriter) {
+	w.Int(len(m.Layers))
+	for _, l := range m.Layers {
+		w.Matrix(l.W)
+		w.Floats(l.B)
+	}
+	w.Floats(m.Labels)
+	w.Floats(m.InputMean)
+	w.Floats(m.InputScale)
+	w.Float(m.TargetMean)
+	w.Float(m.TargetScale)
+}
+
+func (m *MLP) ReadWeights(r *WeightReader) error {
+	m.Layers = make([]DenseLayer, r.length())
+	for j := range m.Layers {
+		m.Layers[j] = DenseLayer{W: r.Matrix(), B: r.Floats()}
+	}
+	m.Labels = r.Floats()
+	m.InputMean = r.Floats()
+	m.InputScale = r.Floats()
+	m.TargetMean = r.Float()
+	m.TargetScale = r.Float()
+	return r.Err()
+}
+
+func (m *LogisticRegression) WriteWeights(w *WeightWriter) {
+	w.Matrix(m.Coef)
+	w.Floats(m.Intercept)
+	w.Floats(m.Labels)
+}
+
+func (m *LogisticRegression) ReadWeights(r *WeightReader) error {
+	m.Coef = r.Matrix()
+	m.Intercept = r.Floats()
+	m.Labels = r.Floats()
+	return r.Err()
+}
+
+// An SGD model is saved without its running moments, so training a loaded
+// one starts over.
+func (m *SGD) WriteWeights(w *WeightWriter) {
+	w.Matrix(m.Coef)
+	w.Floats(m.Intercept)
+	w.Floats(m.Labels)
+}
+
+func (m *SGD) ReadWeights(r *WeightReader) error {
+	m.Coef = r.Matrix()
+	m.Intercept = r.Floats()
+	m.Labels = r.Floats()
+	return r.Err()
+}
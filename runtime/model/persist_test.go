@@ -0,0 +1,212 @@
+package model
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"mlite/dataset"
+)
+
+var update = flag.Bool("update", false, "rewrite the model file fixtures in testdata")
+
+// persistData is a small deterministic dataset with a numeric and a binary target.
+func persistData() *dataset.Dataset {
+	x1 := []float64{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}
+	x2 := []float64{5, 3, 4, 1, 2, 8, 6, 9, 7, 10}
+	y := make([]float64, len(x1))
+	label := make([]float64, len(x1))
+	for i := range x1 {
+		y[i] = 3*x1[i] - x2[i] + 2
+		if x1[i]+x2[i] > 10 {
+			label[i] = 1
+		}
+	}
+	d, _ := dataset.New(dataset.NewNumeric("x1", x1), dataset.NewNumeric("x2", x2),
+		dataset.NewNumeric("y", y), dataset.NewNumeric("label", label))
+	return d
+}
+
+// persistCases trains one estimator of every saveable model type.
+var persistCases = []struct {
+	file   string
+	spec   Spec
+	target string
+}{
+	{"linear.mlm", Spec{Type: "linear_regression", Params: Params{"alpha": 0.5}}, "y"},
+	{"gbm_classifier.mlm", Spec{Type: "gbm_classifier", Params: Params{"n_estimators": 5.0, "max_depth": 2.0}}, "label"},
+	{"mlp.mlm", Spec{Type: "mlp", Params: Params{"hidden": []interface{}{4.0}, "epochs": 5.0, "seed": 1.0}}, "y"},
+	{"logistic.mlm", Spec{Type: "logistic_regression", Params: Params{"C": 10.0}}, "label"},
+}
+
+// Checks that every model type predicts identically after a save/load round
+// trip and keeps its spec, columns and training metadata.
+func TestSaveLoadRoundTrip(t *testing.T) {
+	d := persistData()
+	for _, c := range persistCases {
+		est, _ := NewEstimator(c.spec)
+		if err := est.Fit(d, []string{"x1", "x2"}, c.target); err != nil {
+			t.Fatal(err)
+		}
+		path := filepath.Join(t.TempDir(), c.file)
+		if err := est.Save(path); err != nil {
+			t.Fatalf("%s: %v", c.spec.Type, err)
+		}
+		loaded, err := Load(path)
+		if err != nil {
+			t.Fatalf("%s: %v", c.spec.Type, err)
+		}
+
+		if loaded.Spec.Type != c.spec.Type || loaded.Target != c.target || len(loaded.Features) != 2 || loaded.Rows != 10 {
+			t.Errorf("%s: loaded %+v", c.spec.Type, loaded)
+		}
+		want, _ := est.Predict(d)
+		got, err := loaded.Predict(d)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := range want {
+			if got[i] != want[i] {
+				t.Errorf("%s row %d: got %v, want %v", c.spec.Type, i, got[i], want[i])
+			}
+		}
+	}
+}
+
+// Checks that a flipped payload byte, a newer format version, a corrupt
+// header, out-of-range lengths and an untrained model are all rejected with
+// a clear error rather than a panic.
+func TestSaveLoadErrors(t *testing.T) {
+	est, _ := NewEstimator(Spec{Type: "linear_regression"})
+	var buf bytes.Buffer
+	if err := est.Encode(&buf); err == nil {
+		t.Error("expected an error saving an untrained model")
+	}
+
+	est.Fit(persistData(), []string{"x1"}, "y")
+	buf.Reset()
+	est.Encode(&buf)
+	good := buf.Bytes()
+
+	corrupt := append([]byte(nil), good...)
+	corrupt[len(corrupt)-1] ^= 0xff
+	if _, err := Decode(bytes.NewReader(corrupt)); err == nil || !strings.Contains(err.Error(), "checksum") {
+		t.Errorf("corrupt payload: got %v, want a checksum error", err)
+	}
+
+	newer := append([]byte(nil), good...)
+	newer[8] = FileVersion + 1
+	if _, err := Decode(bytes.NewReader(newer)); err == nil || !strings.Contains(err.Error(), "newer") {
+		t.Errorf("newer version: got %v, want a version error", err)
+	}
+
+	if _, err := Decode(strings.NewReader("x1,y\n1,2\n")); err == nil {
+		t.Error("expected an error for a file that is not a model")
+	}
+
+	headerLen := binary.LittleEndian.Uint32(good[10:14])
+	var header FileHeader
+	if err := json.Unmarshal(good[14:14+headerLen], &header); err != nil {
+		t.Fatal(err)
+	}
+	payload := good[14+headerLen:]
+	for _, c := range []struct {
+		name string
+		file []byte
+		want string
+	}{
+		{"corrupt header", rewriteHeader(good, []byte(`{"model_type": "linear_reg`), payload), "invalid model header"},
+		{"header length past the end", withHeaderLen(good, uint32(len(good))), "invalid model header length"},
+		{"huge header length", withHeaderLen(good, 0xffffffff), "invalid model header length"},
+		{"negative payload length", editHeader(t, good, header, payload, func(h *FileHeader) { h.PayloadBytes = -1 }), "invalid model weights length"},
+		{"payload length past the end", editHeader(t, good, header, payload, func(h *FileHeader) { h.PayloadBytes = len(payload) + 1 }), "invalid model weights length"},
+		{"mismatched header version", editHeader(t, good, header, payload, func(h *FileHeader) { h.FormatVersion = FileVersion }), "does not match"},
+		{"version zero", append(append([]byte(fileMagic), 0, 0), good[10:]...), "invalid model file format version"},
+	} {
+		if _, err := Decode(bytes.NewReader(c.file)); err == nil || !strings.Contains(err.Error(), c.want) {
+			t.Errorf("%s: got %v, want an error containing %q", c.name, err, c.want)
+		}
+	}
+}
+
+// rewriteHeader builds a model file from a raw header and payload, keeping
+// the magic and version of good.
+func rewriteHeader(good, header, payload []byte) []byte {
+	out := append([]byte(nil), good[:10]...)
+	out = binary.LittleEndian.AppendUint32(out, uint32(len(header)))
+	out = append(out, header...)
+	return append(out, payload...)
+}
+
+// editHeader re-encodes header after edit and builds a model file from it,
+// keeping the magic and version of good.
+func editHeader(t *testing.T, good []byte, header FileHeader, payload []byte, edit func(*FileHeader)) []byte {
+	edit(&header)
+	raw, err := json.Marshal(header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return rewriteHeader(good, raw, payload)
+}
+
+// withHeaderLen returns a copy of good with its header length field replaced.
+func withHeaderLen(good []byte, n uint32) []byte {
+	out := append([]byte(nil), good...)
+	binary.LittleEndian.PutUint32(out[10:14], n)
+	return out
+}
+
+// Checks that model files written by format version 1 still load and predict
+// what they predicted when they were written. Run with -update to rewrite the
+// fixtures, which should only be needed when adding a new model type.
+func TestLoadVersion1Fixtures(t *testing.T) {
+	d := persistData()
+	expectedPath := filepath.Join("testdata", "v1", "expected.json")
+
+	if *update {
+		expected := map[string][]float64{}
+		for _, c := range persistCases {
+			est, _ := NewEstimator(c.spec)
+			if err := est.Fit(d, []string{"x1", "x2"}, c.target); err != nil {
+				t.Fatal(err)
+			}
+			if err := est.Save(filepath.Join("testdata", "v1", c.file)); err != nil {
+				t.Fatal(err)
+			}
+			expected[c.file], _ = est.Predict(d)
+		}
+		out, _ := json.MarshalIndent(expected, "", "  ")
+		if err := os.WriteFile(expectedPath, out, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	raw, err := os.ReadFile(expectedPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var expected map[string][]float64
+	if err := json.Unmarshal(raw, &expected); err != nil {
+		t.Fatal(err)
+	}
+	for file, want := range expected {
+		est, err := Load(filepath.Join("testdata", "v1", file))
+		if err != nil {
+			t.Fatalf("%s: %v", file, err)
+		}
+		got, err := est.Predict(d)
+		if err != nil {
+			t.Fatalf("%s: %v", file, err)
+		}
+		for i := range want {
+			if got[i] != want[i] {
+				t.Errorf("%s row %d: got %v, want %v", file, i, got[i], want[i])
+			}
+		}
+	}
+}
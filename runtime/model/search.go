@@ -0,0 +1,223 @@
+package model
+
+import (
+	"fmt"
+	"math/rand"
+	"runtime"
+	"sort"
+	"sync"
+
+	"mlite/dataset"
+)
+
+// lowerIsBetter lists the metrics where a smaller score wins; every other
+// metric is maximised.
+var lowerIsBetter = map[string]bool{"mae": true, "mse": true, "rmse": true, "mape": true, "log_loss": true}
+
+// SearchConfig describes a hyperparameter search.
+type SearchConfig struct {
+	Base     Spec                     // model type and the parameters every candidate shares
+	Grid     map[string][]interface{} // values to try per parameter
+	Features []string
+	Target   string
+	Folds    []dataset.Fold
+	// Metric ranks the candidates; "" means r2 for regressors and accuracy
+	// for classifiers, like sklearn's default scoring.
+	Metric string
+	// NIter > 0 samples that many grid points at random (without
+	// replacement, using Seed) instead of trying them all.
+	NIter int
+	Seed  int64
+	// Workers bounds how many candidates are cross-validated at once;
+	// 0 means one per CPU.
+	Workers int
+}
+
+// Candidate is one grid point and its mean cross-validated score.
+type Candidate struct {
+	Params Params // only the searched parameters
+	Score  float64
+	Rank   int // 1 is best
+}
+
+// SearchResult holds every candidate, best first, and the winner refitted
+// on all the rows.
+type SearchResult struct {
+	Metric     string
+	Candidates []Candidate
+	Best       *Estimator
+}
+
+// Search cross-validates every candidate of cfg.Grid on d, fanning the fits
+// out across a bounded pool of goroutines, then refits the best one on all
+// of d. Results do not depend on scheduling: ties keep grid order.
+func Search(d *dataset.Dataset, cfg SearchConfig) (*SearchResult, error) {
+	points, err := gridPoints(cfg.Grid)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.NIter > 0 && cfg.NIter < len(points) {
+		rng := rand.New(rand.NewSource(cfg.Seed))
+		rng.Shuffle(len(points), func(a, b int) { points[a], points[b] = points[b], points[a] })
+		points = points[:cfg.NIter]
+	}
+
+	metric := cfg.Metric
+	if metric == "" {
+		// Fit the first candidate once to learn whether it classifies.
+		probe, err := NewEstimator(cfg.spec(points[0]))
+		if err != nil {
+			return nil, err
+		}
+		if err := probe.Fit(d.Take(cfg.Folds[0].Train), cfg.Features, cfg.Target); err != nil {
+			return nil, err
+		}
+		metric = "r2"
+		if IsClassifier(probe.Model) {
+			metric = "accuracy"
+		}
+	}
+
+	workers := cfg.Workers
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+	if workers > len(points) {
+		workers = len(points)
+	}
+
+	candidates := make([]Candidate, len(points))
+	errs := make([]error, len(points))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range jobs {
+				candidates[j].Params = points[j]
+				candidates[j].Score, errs[j] = cfg.crossValidate(d, points[j], metric)
+			}
+		}()
+	}
+	for j := range points {
+		jobs <- j
+	}
+	close(jobs)
+	wg.Wait()
+
+	for j, err := range errs {
+		if err != nil {
+			return nil, fmt.Errorf("candidate %s: %w", formatParams(points[j]), err)
+		}
+	}
+
+	sort.SliceStable(candidates, func(a, b int) bool {
+		if lowerIsBetter[metric] {
+			return candidates[a].Score < candidates[b].Score
+		}
+		return candidates[a].Score > candidates[b].Score
+	})
+	for j := range candidates {
+		candidates[j].Rank = j + 1
+	}
+
+	best, err := NewEstimator(cfg.spec(candidates[0].Params))
+	if err != nil {
+		return nil, err
+	}
+	if err := best.Fit(d, cfg.Features, cfg.Target); err != nil {
+		return nil, err
+	}
+	return &SearchResult{Metric: metric, Candidates: candidates, Best: best}, nil
+}
+
+// spec merges a grid point over the base parameters.
+func (cfg SearchConfig) spec(point Params) Spec {
+	params := Params{}
+	for k, v := range cfg.Base.Params {
+		params[k] = v
+	}
+	for k, v := range point {
+		params[k] = v
+	}
+	return Spec{Type: cfg.Base.Type, Params: params, Steps: cfg.Base.Steps}
+}
+
+// crossValidate returns the mean of metric over the folds for one grid point.
+func (cfg SearchConfig) crossValidate(d *dataset.Dataset, point Params, metric string) (float64, error) {
+	total := 0.0
+	for j, fold := range cfg.Folds {
+		est, err := NewEstimator(cfg.spec(point))
+		if err != nil {
+			return 0, err
+		}
+		if err := est.Fit(d.Take(fold.Train), cfg.Features, cfg.Target); err != nil {
+			return 0, fmt.Errorf("fold %d: %w", j+1, err)
+		}
+		report, err := Evaluate(est, d.Take(fold.Test))
+		if err != nil {
+			return 0, fmt.Errorf("fold %d: %w", j+1, err)
+		}
+		score, ok := report.Metrics[metric]
+		if !ok {
+			return 0, fmt.Errorf("fold %d: metric %q is not available for %s", j+1, metric, cfg.Base.Type)
+		}
+		total += score
+	}
+	return total / float64(len(cfg.Folds)), nil
+}
+
+// gridPoints expands a grid into every combination, with parameter names in
+// sorted order and the last name varying fastest, as sklearn's ParameterGrid.
+func gridPoints(grid map[string][]interface{}) ([]Params, error) {
+	if len(grid) == 0 {
+		return nil, fmt.Errorf("the grid is empty")
+	}
+	names := make([]string, 0, len(grid))
+	for name, values := range grid {
+		if len(values) == 0 {
+			return nil, fmt.Errorf("the grid has no values for %s", name)
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	points := []Params{{}}
+	for _, name := range names {
+		var next []Params
+		for _, p := range points {
+			for _, v := range grid[name] {
+				q := Params{name: v}
+				for k, old := range p {
+					q[k] = old
+				}
+				next = append(next, q)
+			}
+		}
+		points = next
+	}
+	return points, nil
+}
+
+// formatParams renders parameters as "max_depth=3 subsample=0.8", sorted by name.
+func formatParams(p Params) string {
+	names := make([]string, 0, len(p))
+	for name := range p {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	out := ""
+	for j, name := range names {
+		if j > 0 {
+			out += " "
+		}
+		out += fmt.Sprintf("%s=%v", name, p[name])
+	}
+	return out
+}
+
+// String renders the candidate's parameters as "max_depth=3 subsample=0.8".
+func (c Candidate) String() string {
+	return formatParams(c.Params)
+}
@@ -0,0 +1,70 @@
+package model
+
+import (
+	"testing"
+
+	"mlite/dataset"
+)
+
+// Checks that a grid search tries every combination, ranks by the chosen
+// metric and refits the winner: a ridge penalty only hurts a noiseless line.
+func TestSearchGrid(t *testing.T) {
+	x := make([]float64, 30)
+	y := make([]float64, 30)
+	for i := range x {
+		x[i] = float64(i)
+		y[i] = 2*x[i] + 1
+	}
+	d, _ := dataset.New(dataset.NewNumeric("x", x), dataset.NewNumeric("y", y))
+	folds, _ := dataset.KFoldRows(d.NumRows(), 3, 0, nil)
+
+	result, err := Search(d, SearchConfig{
+		Base:     Spec{Type: "linear_regression"},
+		Grid:     map[string][]interface{}{"alpha": {100.0, 0.0, 10.0}},
+		Features: []string{"x"},
+		Target:   "y",
+		Folds:    folds,
+		Metric:   "rmse",
+		Workers:  2,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Candidates) != 3 {
+		t.Fatalf("got %d candidates, want 3", len(result.Candidates))
+	}
+	order := []float64{0, 10, 100}
+	for j, c := range result.Candidates {
+		if c.Params["alpha"] != order[j] || c.Rank != j+1 {
+			t.Errorf("rank %d: got %v, want alpha=%v", j+1, c, order[j])
+		}
+	}
+	if !result.Best.Trained() || result.Best.Spec.Params["alpha"] != 0.0 {
+		t.Errorf("best model %v was not refitted with alpha=0", result.Best.Spec)
+	}
+}
+
+// Checks that gridPoints expands combinations in sklearn's order and that a
+// random search samples the requested number of distinct points.
+func TestGridPointsAndRandomSearch(t *testing.T) {
+	points, _ := gridPoints(map[string][]interface{}{"b": {1.0, 2.0}, "a": {"x", "y", "z"}})
+	if len(points) != 6 || points[0]["a"] != "x" || points[1]["b"] != 2.0 {
+		t.Errorf("unexpected grid order: %v", points)
+	}
+
+	x := []float64{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}
+	d, _ := dataset.New(dataset.NewNumeric("x", x), dataset.NewNumeric("y", x))
+	folds, _ := dataset.KFoldRows(d.NumRows(), 2, 0, nil)
+	result, err := Search(d, SearchConfig{
+		Base:     Spec{Type: "linear_regression"},
+		Grid:     map[string][]interface{}{"alpha": {0.0, 0.1, 1.0, 10.0, 100.0}},
+		Features: []string{"x"}, Target: "y", Folds: folds,
+		NIter: 2, Seed: 3,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Candidates) != 2 || result.Metric != "r2" {
+		t.Errorf("got %d candidates ranked by %s, want 2 by r2", len(result.Candidates), result.Metric)
+	}
+}
@@ -0,0 +1,250 @@
+package model
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+func init() {
+	Register("sgd_regressor", func(p Params) (Model, error) { return newSGD(p, false) })
+	Register("sgd_classifier", func(p Params) (Model, error) { return newSGD(p, true) })
+}
+
+// SGD is a linear model trained by stochastic gradient descent, one row at
+// a time: squared error for the regressor, log loss for the classifier,
+// with one output per class (one-vs-rest). The step size decays as
+// LearningRate/t^0.25 over the t rows seen, as sklearn's "invscaling"
+// schedule does.
+//
+// Features, and the regression target, are standardised with means and
+// variances updated as rows arrive, so no pass over the data is needed
+// before training. Coef and Intercept apply to raw inputs.
+type SGD struct {
+	Alpha        float64 // L2 penalty
+	LearningRate float64
+	EpochCount   int
+	Classify     bool
+
+	Coef      [][]float64 // one row per output
+	Intercept []float64
+	Labels    []float64 // class labels, classifier only
+
+	// Training state: running moments and the weights on standardised data.
+	seen       float64
+	mean, m2   []float64
+	yMean, yM2 float64
+	w          [][]float64
+	b          []float64
+	steps      float64
+}
+
+func newSGD(p Params, classify bool) (Model, error) {
+	if err := p.Check("alpha", "learning_rate", "epochs"); err != nil {
+		return nil, err
+	}
+	r := p.reader()
+	m := &SGD{
+		Alpha:        r.Float("alpha", 0.0001),
+		LearningRate: r.Float("learning_rate", 0.01),
+		EpochCount:   r.Int("epochs", 5),
+		Classify:     classify,
+	}
+	if err := r.Err(); err != nil {
+		return nil, err
+	}
+	switch {
+	case m.Alpha < 0:
+		return nil, fmt.Errorf("alpha must be >= 0, got %v", m.Alpha)
+	case m.LearningRate <= 0:
+		return nil, fmt.Errorf("learning_rate must be > 0, got %v", m.LearningRate)
+	case m.EpochCount < 1:
+		return nil, fmt.Errorf("epochs must be >= 1, got %d", m.EpochCount)
+	}
+	return m, nil
+}
+
+// Epochs is how many passes over the data training makes.
+func (m *SGD) Epochs() int {
+	return m.EpochCount
+}
+
+// Reset forgets the fitted weights and running moments.
+func (m *SGD) Reset() {
+	*m = SGD{Alpha: m.Alpha, LearningRate: m.LearningRate, EpochCount: m.EpochCount, Classify: m.Classify}
+}
+
+// Fit trains from scratch, passing over the rows Epochs times.
+func (m *SGD) Fit(X [][]float64, y []float64) error {
+	if err := checkTrainingData(X, y); err != nil {
+		return err
+	}
+	m.Reset()
+	for epoch := 0; epoch < m.EpochCount; epoch++ {
+		if err := m.PartialFit(X, y); err != nil {
+			return err
+		}
+	}
+	return m.Finish()
+}
+
+// Finish fails for a classifier that has seen fewer than two classes.
+func (m *SGD) Finish() error {
+	if m.Classify && len(m.Labels) < 2 {
+		return fmt.Errorf("the target needs at least 2 classes, found %d", len(m.Labels))
+	}
+	return nil
+}
+
+// PartialFit takes one gradient step per row of the batch.
+func (m *SGD) PartialFit(X [][]float64, y []float64) error {
+	if err := checkTrainingData(X, y); err != nil {
+		return err
+	}
+	p := len(X[0])
+	if m.mean == nil {
+		m.mean, m.m2 = make([]float64, p), make([]float64, p)
+		if !m.Classify {
+			m.w, m.b = [][]float64{make([]float64, p)}, []float64{0}
+		}
+	} else if len(m.mean) != p {
+		return fmt.Errorf("expected %d features, got %d", len(m.mean), p)
+	}
+	if m.Classify {
+		m.addLabels(y)
+	}
+
+	z := make([]float64, p)
+	for i, row := range X {
+		m.seen++
+		for j, v := range row {
+			d := v - m.mean[j]
+			m.mean[j] += d / m.seen
+			m.m2[j] += d * (v - m.mean[j])
+			z[j] = (v - m.mean[j]) / runningScale(m.m2[j], m.seen)
+		}
+		m.steps++
+		eta := m.LearningRate / math.Pow(m.steps, 0.25)
+		if !m.Classify {
+			d := y[i] - m.yMean
+			m.yMean += d / m.seen
+			m.yM2 += d * (y[i] - m.yMean)
+			target := (y[i] - m.yMean) / runningScale(m.yM2, m.seen)
+			m.step(0, z, dot(m.w[0], z)+m.b[0]-target, eta)
+			continue
+		}
+		for k, label := range m.Labels {
+			target := 0.0
+			if y[i] == label {
+				target = 1
+			}
+			m.step(k, z, sigmoid(dot(m.w[k], z)+m.b[k])-target, eta)
+		}
+	}
+	m.fold()
+	return nil
+}
+
+// step moves output k's weights against the gradient of its loss, whose
+// derivative at the prediction is g.
+func (m *SGD) step(k int, z []float64, g, eta float64) {
+	for j, v := range z {
+		m.w[k][j] -= eta * (g*v + m.Alpha*m.w[k][j])
+	}
+	m.b[k] -= eta * g
+}
+
+// addLabels adds an output, starting from zero weights, for each class
+// the batch shows for the first time, keeping Labels sorted.
+func (m *SGD) addLabels(y []float64) {
+	for _, label := range distinct(y) {
+		k := sort.SearchFloat64s(m.Labels, label)
+		if k < len(m.Labels) && m.Labels[k] == label {
+			continue
+		}
+		m.Labels = append(m.Labels[:k], append([]float64{label}, m.Labels[k:]...)...)
+		m.w = append(m.w[:k], append([][]float64{make([]float64, len(m.mean))}, m.w[k:]...)...)
+		m.b = append(m.b[:k], append([]float64{0}, m.b[k:]...)...)
+	}
+}
+
+// fold maps the weights on standardised data back to raw inputs.
+func (m *SGD) fold() {
+	yMean, yScale := 0.0, 1.0
+	if !m.Classify {
+		yMean, yScale = m.yMean, runningScale(m.yM2, m.seen)
+	}
+	m.Coef = make([][]float64, len(m.w))
+	m.Intercept = make([]float64, len(m.w))
+	for k := range m.w {
+		m.Coef[k] = make([]float64, len(m.mean))
+		m.Intercept[k] = yMean + yScale*m.b[k]
+		for j := range m.mean {
+			m.Coef[k][j] = yScale * m.w[k][j] / runningScale(m.m2[j], m.seen)
+			m.Intercept[k] -= m.Coef[k][j] * m.mean[j]
+		}
+	}
+}
+
+// runningScale is the standard deviation of a running variance, or 1 while
+// it is still zero.
+func runningScale(m2, n float64) float64 {
+	if s := math.Sqrt(m2 / n); s > 0 {
+		return s
+	}
+	return 1
+}
+
+// Predict returns the regression estimate, or the most probable class.
+func (m *SGD) Predict(X [][]float64) ([]float64, error) {
+	if m.Coef == nil {
+		return nil, fmt.Errorf("model has not been trained")
+	}
+	out := make([]float64, len(X))
+	if m.Classify {
+		proba, err := m.PredictProba(X)
+		if err != nil {
+			return nil, err
+		}
+		for i, p := range proba {
+			out[i] = m.Labels[argmax(p)]
+		}
+		return out, nil
+	}
+	for i, row := range X {
+		if len(row) != len(m.Coef[0]) {
+			return nil, fmt.Errorf("expected %d features, got %d", len(m.Coef[0]), len(row))
+		}
+		out[i] = m.Intercept[0] + dot(m.Coef[0], row)
+	}
+	return out, nil
+}
+
+// Classes returns the labels seen in training, in ascending order.
+func (m *SGD) Classes() []float64 {
+	return m.Labels
+}
+
+// PredictProba normalises the one-vs-rest probabilities of every row to
+// sum to one, as sklearn does.
+func (m *SGD) PredictProba(X [][]float64) ([][]float64, error) {
+	if m.Coef == nil || !m.Classify {
+		return nil, fmt.Errorf("model has not been trained as a classifier")
+	}
+	out := make([][]float64, len(X))
+	for i, row := range X {
+		if len(row) != len(m.Coef[0]) {
+			return nil, fmt.Errorf("row %d has %d features, expected %d", i, len(row), len(m.Coef[0]))
+		}
+		out[i] = make([]float64, len(m.Coef))
+		total := 0.0
+		for k := range m.Coef {
+			out[i][k] = sigmoid(dot(m.Coef[k], row) + m.Intercept[k])
+			total += out[i][k]
+		}
+		for k := range out[i] {
+			out[i][k] /= total
+		}
+	}
+	return out, nil
+}
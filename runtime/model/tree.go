@@ -0,0 +1,125 @@
+package model
+
+import "sort"
+
+// TreeNode is one node of a binary regression tree. Leaves have Feature -1.
+// Rows with X[Feature] <= Threshold go Left, the rest go Right.
+type TreeNode struct {
+	Feature   int
+	Threshold float64
+	Left      int
+	Right     int
+	Value     float64
+}
+
+// Tree is a regression tree stored as a flat node slice; node 0 is the root.
+type Tree struct {
+	Nodes []TreeNode
+}
+
+// Predict walks the tree for one row.
+func (t *Tree) Predict(row []float64) float64 {
+	n := t.Nodes[0]
+	for n.Feature >= 0 {
+		if row[n.Feature] <= n.Threshold {
+			n = t.Nodes[n.Left]
+		} else {
+			n = t.Nodes[n.Right]
+		}
+	}
+	return n.Value
+}
+
+// treeConfig controls how deep a tree grows.
+type treeConfig struct {
+	maxDepth       int
+	minSamplesLeaf int
+}
+
+// fitTree grows a least-squares regression tree on target for the given
+// rows. When hess is nil leaves hold the mean target; otherwise they hold
+// the Newton step sum(target)/sum(hess) used by log-loss boosting.
+func fitTree(X [][]float64, target, hess []float64, rows []int, cfg treeConfig) *Tree {
+	t := &Tree{}
+	t.grow(X, target, hess, rows, 0, cfg)
+	return t
+}
+
+func (t *Tree) grow(X [][]float64, target, hess []float64, rows []int, depth int, cfg treeConfig) int {
+	idx := len(t.Nodes)
+	t.Nodes = append(t.Nodes, TreeNode{Feature: -1, Value: leafValue(target, hess, rows)})
+
+	if depth >= cfg.maxDepth || len(rows) < 2*cfg.minSamplesLeaf {
+		return idx
+	}
+	feature, threshold, ok := bestSplit(X, target, rows, cfg.minSamplesLeaf)
+	if !ok {
+		return idx
+	}
+
+	var left, right []int
+	for _, r := range rows {
+		if X[r][feature] <= threshold {
+			left = append(left, r)
+		} else {
+			right = append(right, r)
+		}
+	}
+	l := t.grow(X, target, hess, left, depth+1, cfg)
+	r := t.grow(X, target, hess, right, depth+1, cfg)
+	t.Nodes[idx] = TreeNode{Feature: feature, Threshold: threshold, Left: l, Right: r}
+	return idx
+}
+
+func leafValue(target, hess []float64, rows []int) float64 {
+	num, den := 0.0, 0.0
+	for _, r := range rows {
+		num += target[r]
+		if hess != nil {
+			den += hess[r]
+		} else {
+			den++
+		}
+	}
+	if den < 1e-12 {
+		return 0
+	}
+	return num / den
+}
+
+// bestSplit finds the split that most reduces the squared error of target,
+// scanning every feature in sorted order with running sums.
+func bestSplit(X [][]float64, target []float64, rows []int, minLeaf int) (int, float64, bool) {
+	n := len(rows)
+	total := 0.0
+	for _, r := range rows {
+		total += target[r]
+	}
+	parentScore := total * total / float64(n)
+
+	bestGain, bestFeature, bestThreshold := 1e-12, -1, 0.0
+	sorted := make([]int, n)
+	for f := range X[rows[0]] {
+		copy(sorted, rows)
+		sort.Slice(sorted, func(a, b int) bool { return X[sorted[a]][f] < X[sorted[b]][f] })
+
+		leftSum := 0.0
+		for i := 0; i < n-1; i++ {
+			leftSum += target[sorted[i]]
+			nl, nr := i+1, n-i-1
+			if nl < minLeaf || nr < minLeaf {
+				continue
+			}
+			lo, hi := X[sorted[i]][f], X[sorted[i+1]][f]
+			if lo == hi {
+				continue
+			}
+			rightSum := total - leftSum
+			gain := leftSum*leftSum/float64(nl) + rightSum*rightSum/float64(nr) - parentScore
+			if gain > bestGain {
+				bestGain, bestFeature, bestThreshold = gain, f, (lo+hi)/2
+			}
+		}
+	}
+	return bestFeature, bestThreshold, bestFeature >= 0
+}
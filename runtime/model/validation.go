@@ -0,0 +1,149 @@
+package model
+
+import (
+	"fmt"
+
+	"mlite/dataset"
+	"mlite/metrics"
+)
+
+// Score computes the default metrics of a trained estimator on d: accuracy
+// for classifiers; r2, rmse and mae for regressors.
+func Score(e *Estimator, d *dataset.Dataset) (map[string]float64, error) {
+	d, err := e.Prepare(d)
+	if err != nil {
+		return nil, err
+	}
+	yTrue, err := d.Numbers(e.Target)
+	if err != nil {
+		return nil, err
+	}
+	yPred, err := e.Predict(d)
+	if err != nil {
+		return nil, err
+	}
+
+	scorers := map[string]func(a, b []float64) (float64, error){
+		"r2":   metrics.R2,
+		"rmse": metrics.RMSE,
+		"mae":  metrics.MAE,
+	}
+	if IsClassifier(e.Model) {
+		scorers = map[string]func(a, b []float64) (float64, error){"accuracy": metrics.Accuracy}
+	}
+	scores := make(map[string]float64, len(scorers))
+	for name, fn := range scorers {
+		if scores[name], err = fn(yTrue, yPred); err != nil {
+			return nil, err
+		}
+	}
+	return scores, nil
+}
+
+// CVResult holds the metrics of every fold and their mean.
+type CVResult struct {
+	Folds []map[string]float64
+	Mean  map[string]float64
+}
+
+// CrossValidate fits a fresh model from spec on the training rows of every
+// fold and scores it on that fold's test rows.
+func CrossValidate(spec Spec, d *dataset.Dataset, features []string, target string, folds []dataset.Fold) (*CVResult, error) {
+	result := &CVResult{Mean: map[string]float64{}}
+	for j, fold := range folds {
+		est, err := NewEstimator(spec)
+		if err != nil {
+			return nil, err
+		}
+		if err := est.Fit(d.Take(fold.Train), features, target); err != nil {
+			return nil, fmt.Errorf("fold %d: %w", j+1, err)
+		}
+		scores, err := Score(est, d.Take(fold.Test))
+		if err != nil {
+			return nil, fmt.Errorf("fold %d: %w", j+1, err)
+		}
+		result.Folds = append(result.Folds, scores)
+		for name, v := range scores {
+			result.Mean[name] += v / float64(len(folds))
+		}
+	}
+	return result, nil
+}
+
+// Report is the full evaluation of a trained estimator on a dataset.
+type Report struct {
+	Metrics map[string]float64
+	// Labels and Confusion are set for classifiers: Confusion[i][j] counts
+	// rows of class Labels[i] predicted as Labels[j].
+	Labels    []float64
+	Confusion [][]int
+}
+
+// Evaluate scores a trained estimator on d with every applicable metric:
+// mae, mse, rmse, r2 and mape for regressors (mape is left out when a target
+// is zero); accuracy, precision, recall, f1 and the confusion matrix for
+// classifiers, plus log_loss and, for two classes, roc_auc.
+func Evaluate(e *Estimator, d *dataset.Dataset) (*Report, error) {
+	d, err := e.Prepare(d)
+	if err != nil {
+		return nil, err
+	}
+	yTrue, err := d.Numbers(e.Target)
+	if err != nil {
+		return nil, err
+	}
+	yPred, err := e.Predict(d)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &Report{Metrics: map[string]float64{}}
+	if !IsClassifier(e.Model) {
+		for name, fn := range map[string]func(a, b []float64) (float64, error){
+			"mae": metrics.MAE, "mse": metrics.MSE, "rmse": metrics.RMSE, "r2": metrics.R2,
+		} {
+			if report.Metrics[name], err = fn(yTrue, yPred); err != nil {
+				return nil, err
+			}
+		}
+		if mape, err := metrics.MAPE(yTrue, yPred); err == nil {
+			report.Metrics["mape"] = mape
+		}
+		return report, nil
+	}
+
+	for name, fn := range map[string]func(a, b []float64) (float64, error){
+		"accuracy": metrics.Accuracy, "precision": metrics.Precision, "recall": metrics.Recall, "f1": metrics.F1,
+	} {
+		if report.Metrics[name], err = fn(yTrue, yPred); err != nil {
+			return nil, err
+		}
+	}
+	if report.Labels, report.Confusion, err = metrics.ConfusionMatrix(yTrue, yPred); err != nil {
+		return nil, err
+	}
+
+	c := e.Model.(Classifier)
+	X, err := d.Matrix(e.Features)
+	if err != nil {
+		return nil, err
+	}
+	proba, err := c.PredictProba(X)
+	if err != nil {
+		return nil, err
+	}
+	if report.Metrics["log_loss"], err = metrics.LogLoss(yTrue, proba, c.Classes()); err != nil {
+		return nil, err
+	}
+	if len(c.Classes()) == 2 {
+		positive := make([]float64, len(proba))
+		for i, p := range proba {
+			positive[i] = p[1]
+		}
+		// A test set holding only one class has no ROC curve; leave it out.
+		if auc, err := metrics.ROCAUC(yTrue, positive); err == nil {
+			report.Metrics["roc_auc"] = auc
+		}
+	}
+	return report, nil
+}
@@ -0,0 +1,79 @@
+package model
+
+import (
+	"math"
+	"testing"
+
+	"mlite/dataset"
+)
+
+// Checks that cross-validating a linear model on a noiseless linear target
+// scores every fold perfectly and averages the folds.
+func TestCrossValidateLinear(t *testing.T) {
+	x := make([]float64, 20)
+	y := make([]float64, 20)
+	for i := range x {
+		x[i] = float64(i)
+		y[i] = 2*x[i] + 1
+	}
+	d, _ := dataset.New(dataset.NewNumeric("x", x), dataset.NewNumeric("y", y))
+	folds, _ := dataset.KFoldRows(d.NumRows(), 4, 0, nil)
+
+	result, err := CrossValidate(Spec{Type: "linear_regression"}, d, []string{"x"}, "y", folds)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Folds) != 4 {
+		t.Fatalf("got %d folds, want 4", len(result.Folds))
+	}
+	if math.Abs(result.Mean["r2"]-1) > 1e-9 || result.Mean["rmse"] > 1e-9 {
+		t.Errorf("mean scores %v, want r2=1 rmse=0", result.Mean)
+	}
+}
+
+// Checks that classifiers are scored on accuracy rather than regression metrics.
+func TestScoreClassifier(t *testing.T) {
+	x := []float64{1, 2, 3, 4, 5, 6, 7, 8}
+	y := []float64{0, 0, 0, 0, 1, 1, 1, 1}
+	d, _ := dataset.New(dataset.NewNumeric("x", x), dataset.NewNumeric("y", y))
+
+	est, _ := NewEstimator(Spec{Type: "gbm_classifier", Params: Params{"n_estimators": 10.0}})
+	if err := est.Fit(d, []string{"x"}, "y"); err != nil {
+		t.Fatal(err)
+	}
+	scores, err := Score(est, d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := scores["r2"]; ok || scores["accuracy"] != 1 {
+		t.Errorf("got %v, want only accuracy=1", scores)
+	}
+}
+
+// Checks that Evaluate reports the classification metrics, including the
+// probability-based ones, and a confusion matrix for a separable problem.
+func TestEvaluateClassifier(t *testing.T) {
+	x := []float64{1, 2, 3, 4, 5, 6, 7, 8}
+	y := []float64{0, 0, 0, 0, 1, 1, 1, 1}
+	d, _ := dataset.New(dataset.NewNumeric("x", x), dataset.NewNumeric("y", y))
+
+	est, _ := NewEstimator(Spec{Type: "gbm_classifier", Params: Params{"n_estimators": 20.0}})
+	if err := est.Fit(d, []string{"x"}, "y"); err != nil {
+		t.Fatal(err)
+	}
+	report, err := Evaluate(est, d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"accuracy", "precision", "recall", "f1", "roc_auc"} {
+		if report.Metrics[name] != 1 {
+			t.Errorf("%s = %v, want 1", name, report.Metrics[name])
+		}
+	}
+	if ll := report.Metrics["log_loss"]; ll <= 0 || ll > 0.5 {
+		t.Errorf("log_loss = %v, want a small positive value", ll)
+	}
+	if report.Confusion[0][0] != 4 || report.Confusion[1][1] != 4 {
+		t.Errorf("confusion matrix %v, want a diagonal of 4s", report.Confusion)
+	}
+}
@@ -0,0 +1,252 @@
+// Package onnx exports trained MLite models as ONNX graphs built from the
+// ai.onnx.ml operators, so they can be served by any ONNX runtime.
+//
+// Every exported graph takes one float tensor "input" of shape [N, features],
+// with columns in the order of Estimator.Features. Regressors output a float
+// tensor "prediction" of shape [N, 1]; classifiers output "label" [N] and
+// "probabilities" [N, classes].
+package onnx
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+
+	"mlite/model"
+)
+
+const (
+	irVersion = 8  // ONNX 1.10
+	opset     = 17 // default domain
+	mlOpset   = 3  // ai.onnx.ml
+	mlDomain  = "ai.onnx.ml"
+)
+
+// Export builds the ONNX model for a trained estimator. Linear regression,
+// logistic regression and gradient boosting are supported; the MLP and
+// models trained on preprocessed data are not.
+func Export(e *model.Estimator) (*Model, error) {
+	if !e.Trained() {
+		return nil, fmt.Errorf("model has not been trained")
+	}
+	if len(e.Transforms) > 0 {
+		return nil, fmt.Errorf("%s has preprocessing steps, which cannot be exported", e.Spec.Name())
+	}
+	var (
+		node    *Node
+		outputs []*ValueInfo
+	)
+	switch m := e.Model.(type) {
+	case *model.LinearRegression:
+		node, outputs = linearRegressor(m)
+	case *model.LogisticRegression:
+		node, outputs = linearClassifier(m)
+	case *model.GradientBoosting:
+		if m.Loss == "log" {
+			node, outputs = treeClassifier(m)
+		} else {
+			node, outputs = treeRegressor(m)
+		}
+	default:
+		return nil, fmt.Errorf("%s cannot be exported to ONNX (supported: linear_regression, logistic_regression, gbm_regressor, gbm_classifier)", e.Spec.Type)
+	}
+	node.Name = e.Spec.Type
+	node.Inputs = []string{"input"}
+	node.Domain = mlDomain
+	for _, o := range outputs {
+		node.Outputs = append(node.Outputs, o.Name)
+	}
+
+	return &Model{
+		IRVersion:    irVersion,
+		Opsets:       []Opset{{Domain: "", Version: opset}, {Domain: mlDomain, Version: mlOpset}},
+		ProducerName: "mlite",
+		DocString:    fmt.Sprintf("%s; features: %s", e, strings.Join(e.Features, ", ")),
+		Graph: &Graph{
+			Name:    e.Spec.Type,
+			Nodes:   []*Node{node},
+			Inputs:  []*ValueInfo{{Name: "input", ElemType: Float, Shape: []Dim{{Param: "N"}, {Value: int64(len(e.Features))}}}},
+			Outputs: outputs,
+		},
+	}, nil
+}
+
+// WriteFile exports e and writes the encoded model to path.
+func WriteFile(e *model.Estimator, path string) error {
+	m, err := Export(e)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, m.Marshal(), 0o644)
+}
+
+func linearRegressor(m *model.LinearRegression) (*Node, []*ValueInfo) {
+	return &Node{
+		OpType: "LinearRegressor",
+		Attributes: []*Attribute{
+			floats("coefficients", m.Coef...),
+			floats("intercepts", m.Intercept),
+			integer("targets", 1),
+		},
+	}, []*ValueInfo{prediction()}
+}
+
+// linearClassifier writes one coefficient row per class. The native binary
+// model has a single logit row w; the graph gets rows -w and w, whose
+// sigmoids are the two class probabilities.
+func linearClassifier(m *model.LogisticRegression) (*Node, []*ValueInfo) {
+	coef, intercept := m.Coef, m.Intercept
+	transform := "SOFTMAX"
+	if len(coef) == 1 {
+		neg := make([]float64, len(coef[0]))
+		for j, w := range coef[0] {
+			neg[j] = -w
+		}
+		coef = [][]float64{neg, coef[0]}
+		intercept = []float64{-intercept[0], intercept[0]}
+		transform = "LOGISTIC"
+	}
+	var flat []float64
+	for _, row := range coef {
+		flat = append(flat, row...)
+	}
+	labels, label := classLabels("classlabels_ints", m.Labels)
+	return &Node{
+		OpType: "LinearClassifier",
+		Attributes: []*Attribute{
+			floats("coefficients", flat...),
+			floats("intercepts", intercept...),
+			labels,
+			text("post_transform", transform),
+			integer("multi_class", 0),
+		},
+	}, []*ValueInfo{label, probabilities(len(m.Labels))}
+}
+
+func treeRegressor(m *model.GradientBoosting) (*Node, []*ValueInfo) {
+	attrs := treeAttributes(m, "target")
+	attrs = append(attrs,
+		integer("n_targets", 1),
+		text("aggregate_function", "SUM"),
+		floats("base_values", m.Init),
+		text("post_transform", "NONE"),
+	)
+	return &Node{OpType: "TreeEnsembleRegressor", Attributes: attrs}, []*ValueInfo{prediction()}
+}
+
+// treeClassifier follows the ONNX convention for binary ensembles: every
+// leaf adds to class 0's score, which is the log-odds of the second label,
+// and the LOGISTIC transform turns it into the pair [1-p, p].
+func treeClassifier(m *model.GradientBoosting) (*Node, []*ValueInfo) {
+	attrs := treeAttributes(m, "class")
+	labels, label := classLabels("classlabels_int64s", m.Labels)
+	attrs = append(attrs,
+		labels,
+		floats("base_values", m.Init),
+		text("post_transform", "LOGISTIC"),
+	)
+	return &Node{OpType: "TreeEnsembleClassifier", Attributes: attrs}, []*ValueInfo{label, probabilities(2)}
+}
+
+// treeAttributes flattens the ensemble into the nodes_* arrays and the
+// per-leaf weights, named target_* for regressors and class_* for
+// classifiers. Leaf weights are scaled by the learning rate, so the sum
+// over trees plus base_values is the native raw score.
+func treeAttributes(m *model.GradientBoosting, prefix string) []*Attribute {
+	var (
+		treeIDs, nodeIDs, featureIDs, trueIDs, falseIDs []int64
+		values                                          []float64
+		modes                                           []string
+		leafTrees, leafNodes, leafIDs                   []int64
+		weights                                         []float64
+	)
+	for t, tree := range m.Trees {
+		for id, n := range tree.Nodes {
+			treeIDs = append(treeIDs, int64(t))
+			nodeIDs = append(nodeIDs, int64(id))
+			if n.Feature < 0 {
+				featureIDs = append(featureIDs, 0)
+				values = append(values, 0)
+				modes = append(modes, "LEAF")
+				trueIDs = append(trueIDs, 0)
+				falseIDs = append(falseIDs, 0)
+
+				leafTrees = append(leafTrees, int64(t))
+				leafNodes = append(leafNodes, int64(id))
+				leafIDs = append(leafIDs, 0)
+				weights = append(weights, m.LearningRate*n.Value)
+				continue
+			}
+			featureIDs = append(featureIDs, int64(n.Feature))
+			values = append(values, n.Threshold)
+			modes = append(modes, "BRANCH_LEQ")
+			trueIDs = append(trueIDs, int64(n.Left))
+			falseIDs = append(falseIDs, int64(n.Right))
+		}
+	}
+	return []*Attribute{
+		ints("nodes_treeids", treeIDs...),
+		ints("nodes_nodeids", nodeIDs...),
+		ints("nodes_featureids", featureIDs...),
+		floats("nodes_values", values...),
+		strs("nodes_modes", modes...),
+		ints("nodes_truenodeids", trueIDs...),
+		ints("nodes_falsenodeids", falseIDs...),
+		ints(prefix+"_treeids", leafTrees...),
+		ints(prefix+"_nodeids", leafNodes...),
+		ints(prefix+"_ids", leafIDs...),
+		floats(prefix+"_weights", weights...),
+	}
+}
+
+// classLabels writes the labels as integers when they are all whole
+// numbers, and as strings otherwise; the label output takes the same type.
+// intsName is the attribute's integer form, which differs between operators.
+func classLabels(intsName string, labels []float64) (*Attribute, *ValueInfo) {
+	whole := make([]int64, len(labels))
+	for i, l := range labels {
+		if l != math.Trunc(l) || math.Abs(l) > 1<<53 {
+			names := make([]string, len(labels))
+			for j, l := range labels {
+				names[j] = strconv.FormatFloat(l, 'g', -1, 64)
+			}
+			return strs("classlabels_strings", names...), &ValueInfo{Name: "label", ElemType: String, Shape: []Dim{{Param: "N"}}}
+		}
+		whole[i] = int64(l)
+	}
+	return ints(intsName, whole...), &ValueInfo{Name: "label", ElemType: Int64, Shape: []Dim{{Param: "N"}}}
+}
+
+func prediction() *ValueInfo {
+	return &ValueInfo{Name: "prediction", ElemType: Float, Shape: []Dim{{Param: "N"}, {Value: 1}}}
+}
+
+func probabilities(classes int) *ValueInfo {
+	return &ValueInfo{Name: "probabilities", ElemType: Float, Shape: []Dim{{Param: "N"}, {Value: int64(classes)}}}
+}
+
+func floats(name string, vs ...float64) *Attribute {
+	a := &Attribute{Name: name, Type: AttrFloats, Floats: make([]float32, len(vs))}
+	for i, v := range vs {
+		a.Floats[i] = float32(v)
+	}
+	return a
+}
+
+func ints(name string, vs ...int64) *Attribute {
+	return &Attribute{Name: name, Type: AttrInts, Ints: vs}
+}
+
+func strs(name string, vs ...string) *Attribute {
+	return &Attribute{Name: name, Type: AttrStrings, Strings: vs}
+}
+
+func integer(name string, v int64) *Attribute {
+	return &Attribute{Name: name, Type: AttrInt, I: v}
+}
+
+func text(name, v string) *Attribute {
+	return &Attribute{Name: name, Type: AttrString, S: v}
+}
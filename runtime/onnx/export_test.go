@@ -0,0 +1,178 @@
+package onnx
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"mlite/internal/modeltest"
+	"mlite/model"
+)
+
+// exportONNX trains spec on the shared data, writes it as ONNX and decodes
+// the file.
+func exportONNX(t *testing.T, spec model.Spec, target string) (*model.Estimator, *Model) {
+	t.Helper()
+	est, _ := modeltest.Train(t, spec, target)
+	path := filepath.Join(t.TempDir(), "m.onnx")
+	if err := WriteFile(est, path); err != nil {
+		t.Fatal(err)
+	}
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := Unmarshal(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return est, m
+}
+
+// Checks the model envelope every export shares: IR version, both opsets
+// and a dynamic batch dimension on the input.
+func TestExportEnvelope(t *testing.T) {
+	_, m := exportONNX(t, model.Spec{Type: "linear_regression"}, "y")
+	if m.IRVersion != irVersion || m.ProducerName != "mlite" || len(m.Opsets) != 2 || m.Opsets[1].Domain != mlDomain {
+		t.Errorf("unexpected envelope %+v", m)
+	}
+	in := m.Graph.Inputs[0]
+	if in.Name != "input" || in.ElemType != Float || in.Shape[0].Param != "N" || in.Shape[1].Value != 2 {
+		t.Errorf("unexpected input %+v", in)
+	}
+	node := m.Graph.Nodes[0]
+	if node.OpType != "LinearRegressor" || node.Domain != mlDomain || node.Outputs[0] != "prediction" {
+		t.Errorf("unexpected node %+v", node)
+	}
+}
+
+// Checks that every supported model type decodes to a graph whose operator,
+// evaluated here from its attributes, reproduces the native predictions.
+func TestExportMatchesNativePredictions(t *testing.T) {
+	cases := []struct {
+		spec   model.Spec
+		target string
+		op     string
+	}{
+		{model.Spec{Type: "linear_regression", Params: model.Params{"alpha": 0.5}}, "y", "LinearRegressor"},
+		{model.Spec{Type: "logistic_regression"}, "label", "LinearClassifier"},
+		{model.Spec{Type: "gbm_regressor", Params: model.Params{"n_estimators": 10.0}}, "y", "TreeEnsembleRegressor"},
+		{model.Spec{Type: "gbm_classifier", Params: model.Params{"n_estimators": 10.0}}, "label", "TreeEnsembleClassifier"},
+	}
+	d := modeltest.Data()
+	X, _ := d.Matrix(modeltest.Features)
+	for _, c := range cases {
+		est, m := exportONNX(t, c.spec, c.target)
+		node := m.Graph.Nodes[0]
+		if node.OpType != c.op {
+			t.Errorf("%s: got op %s, want %s", c.spec.Type, node.OpType, c.op)
+			continue
+		}
+		want, _ := est.Model.Predict(X)
+		for i, row := range X {
+			got := evaluate(t, node, row)
+			if math.Abs(got-want[i]) > 1e-4*math.Max(1, math.Abs(want[i])) {
+				t.Errorf("%s row %d: ONNX graph gives %v, native %v", c.spec.Type, i, got, want[i])
+			}
+		}
+	}
+}
+
+// Checks that the MLP and untrained models are rejected.
+func TestExportErrors(t *testing.T) {
+	mlp, _ := model.NewEstimator(model.Spec{Type: "mlp", Params: model.Params{"epochs": 1.0}})
+	if _, err := Export(mlp); err == nil {
+		t.Error("expected an error for an untrained model")
+	}
+	mlp.Fit(modeltest.Data(), []string{"x1"}, "y")
+	if _, err := Export(mlp); err == nil {
+		t.Error("expected an error for an mlp")
+	}
+}
+
+// evaluate runs one row through node following the ai.onnx.ml operator
+// semantics, returning the prediction or the predicted label.
+func evaluate(t *testing.T, node *Node, row []float64) float64 {
+	attr := map[string]*Attribute{}
+	for _, a := range node.Attributes {
+		attr[a.Name] = a
+	}
+	f := func(name string) []float64 {
+		a, ok := attr[name]
+		if !ok {
+			t.Fatalf("%s: missing attribute %s", node.OpType, name)
+		}
+		out := make([]float64, len(a.Floats))
+		for i, v := range a.Floats {
+			out[i] = float64(v)
+		}
+		return out
+	}
+
+	switch node.OpType {
+	case "LinearRegressor":
+		coef := f("coefficients")
+		y := f("intercepts")[0]
+		for j, x := range row {
+			y += coef[j] * x
+		}
+		return y
+
+	case "LinearClassifier":
+		coef, intercepts := f("coefficients"), f("intercepts")
+		best, bestScore := 0, math.Inf(-1)
+		for k := range intercepts {
+			score := intercepts[k]
+			for j, x := range row {
+				score += coef[k*len(row)+j] * x
+			}
+			if score > bestScore {
+				best, bestScore = k, score
+			}
+		}
+		return float64(attr["classlabels_ints"].Ints[best])
+
+	case "TreeEnsembleRegressor", "TreeEnsembleClassifier":
+		prefix := "target"
+		if node.OpType == "TreeEnsembleClassifier" {
+			prefix = "class"
+		}
+		values := f("nodes_values")
+		weights := f(prefix + "_weights")
+		index := map[[2]int64]int{}
+		for i := range attr["nodes_nodeids"].Ints {
+			index[[2]int64{attr["nodes_treeids"].Ints[i], attr["nodes_nodeids"].Ints[i]}] = i
+		}
+		leaf := map[[2]int64]float64{}
+		for i, w := range weights {
+			leaf[[2]int64{attr[prefix+"_treeids"].Ints[i], attr[prefix+"_nodeids"].Ints[i]}] = w
+		}
+		score := f("base_values")[0]
+		for _, root := range index {
+			if attr["nodes_nodeids"].Ints[root] != 0 {
+				continue
+			}
+			tree := attr["nodes_treeids"].Ints[root]
+			i := root
+			for attr["nodes_modes"].Strings[i] == "BRANCH_LEQ" {
+				next := attr["nodes_falsenodeids"].Ints[i]
+				if float32(row[attr["nodes_featureids"].Ints[i]]) <= float32(values[i]) {
+					next = attr["nodes_truenodeids"].Ints[i]
+				}
+				i = index[[2]int64{tree, next}]
+			}
+			score += leaf[[2]int64{tree, attr["nodes_nodeids"].Ints[i]}]
+		}
+		if prefix == "target" {
+			return score
+		}
+		labels := attr["classlabels_int64s"].Ints
+		if score > 0 {
+			return float64(labels[1])
+		}
+		return float64(labels[0])
+	}
+	t.Fatalf("unexpected op %s", node.OpType)
+	return 0
+}
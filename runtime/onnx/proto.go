@@ -0,0 +1,489 @@
+package onnx
+
+import (
+	"fmt"
+	"math"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// The messages below are the subset of onnx.proto that MLite writes. Field
+// numbers follow the ONNX schema; repeated scalars are written unpacked, as
+// proto2 requires, and read in either form.
+
+// Model is an ONNX ModelProto.
+type Model struct {
+	IRVersion       int64
+	Opsets          []Opset
+	ProducerName    string
+	ProducerVersion string
+	DocString       string
+	Graph           *Graph
+}
+
+// Opset is an OperatorSetIdProto: the version of an operator domain the
+// graph was written against. The default domain is "".
+type Opset struct {
+	Domain  string
+	Version int64
+}
+
+// Graph is a GraphProto.
+type Graph struct {
+	Name    string
+	Nodes   []*Node
+	Inputs  []*ValueInfo
+	Outputs []*ValueInfo
+}
+
+// Node is a NodeProto: one operator call.
+type Node struct {
+	Inputs     []string
+	Outputs    []string
+	Name       string
+	OpType     string
+	Domain     string
+	Attributes []*Attribute
+}
+
+// AttributeType says which field of an Attribute holds its value.
+type AttributeType int64
+
+const (
+	AttrFloat   AttributeType = 1
+	AttrInt     AttributeType = 2
+	AttrString  AttributeType = 3
+	AttrFloats  AttributeType = 6
+	AttrInts    AttributeType = 7
+	AttrStrings AttributeType = 8
+)
+
+// Attribute is an AttributeProto.
+type Attribute struct {
+	Name    string
+	Type    AttributeType
+	F       float32
+	I       int64
+	S       string
+	Floats  []float32
+	Ints    []int64
+	Strings []string
+}
+
+// ElemType is a TensorProto.DataType.
+type ElemType int32
+
+const (
+	Float  ElemType = 1
+	Int64  ElemType = 7
+	String ElemType = 8
+)
+
+// ValueInfo is a ValueInfoProto for a tensor: a graph input or output.
+type ValueInfo struct {
+	Name     string
+	ElemType ElemType
+	Shape    []Dim
+}
+
+// Dim is one tensor dimension: a fixed size, or a named symbolic size
+// such as the batch dimension.
+type Dim struct {
+	Value int64
+	Param string
+}
+
+// Field numbers from onnx.proto.
+const (
+	modelIRVersion       = 1
+	modelProducerName    = 2
+	modelProducerVersion = 3
+	modelDocString       = 6
+	modelGraph           = 7
+	modelOpsetImport     = 8
+
+	opsetDomain  = 1
+	opsetVersion = 2
+
+	graphNode   = 1
+	graphName   = 2
+	graphInput  = 11
+	graphOutput = 12
+
+	nodeInput     = 1
+	nodeOutput    = 2
+	nodeName      = 3
+	nodeOpType    = 4
+	nodeAttribute = 5
+	nodeDomain    = 7
+
+	attrName    = 1
+	attrF       = 2
+	attrI       = 3
+	attrS       = 4
+	attrFloats  = 7
+	attrInts    = 8
+	attrStrings = 9
+	attrType    = 20
+
+	valueName = 1
+	valueType = 2
+
+	typeTensor  = 1
+	tensorElem  = 1
+	tensorShape = 2
+	shapeDim    = 1
+	dimValue    = 1
+	dimParam    = 2
+)
+
+// Marshal encodes the model in the protobuf wire format.
+func (m *Model) Marshal() []byte {
+	var b []byte
+	b = appendVarint(b, modelIRVersion, uint64(m.IRVersion))
+	b = appendString(b, modelProducerName, m.ProducerName)
+	b = appendString(b, modelProducerVersion, m.ProducerVersion)
+	b = appendString(b, modelDocString, m.DocString)
+	if m.Graph != nil {
+		b = appendMessage(b, modelGraph, m.Graph.marshal())
+	}
+	for _, o := range m.Opsets {
+		var ob []byte
+		ob = appendString(ob, opsetDomain, o.Domain)
+		ob = appendVarint(ob, opsetVersion, uint64(o.Version))
+		b = appendMessage(b, modelOpsetImport, ob)
+	}
+	return b
+}
+
+func (g *Graph) marshal() []byte {
+	var b []byte
+	for _, n := range g.Nodes {
+		b = appendMessage(b, graphNode, n.marshal())
+	}
+	b = appendString(b, graphName, g.Name)
+	for _, v := range g.Inputs {
+		b = appendMessage(b, graphInput, v.marshal())
+	}
+	for _, v := range g.Outputs {
+		b = appendMessage(b, graphOutput, v.marshal())
+	}
+	return b
+}
+
+func (n *Node) marshal() []byte {
+	var b []byte
+	for _, s := range n.Inputs {
+		b = appendString(b, nodeInput, s)
+	}
+	for _, s := range n.Outputs {
+		b = appendString(b, nodeOutput, s)
+	}
+	b = appendString(b, nodeName, n.Name)
+	b = appendString(b, nodeOpType, n.OpType)
+	for _, a := range n.Attributes {
+		b = appendMessage(b, nodeAttribute, a.marshal())
+	}
+	b = appendString(b, nodeDomain, n.Domain)
+	return b
+}
+
+func (a *Attribute) marshal() []byte {
+	var b []byte
+	b = appendString(b, attrName, a.Name)
+	switch a.Type {
+	case AttrFloat:
+		b = protowire.AppendTag(b, attrF, protowire.Fixed32Type)
+		b = protowire.AppendFixed32(b, math.Float32bits(a.F))
+	case AttrInt:
+		b = protowire.AppendTag(b, attrI, protowire.VarintType)
+		b = protowire.AppendVarint(b, uint64(a.I))
+	case AttrString:
+		b = protowire.AppendTag(b, attrS, protowire.BytesType)
+		b = protowire.AppendString(b, a.S)
+	case AttrFloats:
+		for _, f := range a.Floats {
+			b = protowire.AppendTag(b, attrFloats, protowire.Fixed32Type)
+			b = protowire.AppendFixed32(b, math.Float32bits(f))
+		}
+	case AttrInts:
+		for _, i := range a.Ints {
+			b = protowire.AppendTag(b, attrInts, protowire.VarintType)
+			b = protowire.AppendVarint(b, uint64(i))
+		}
+	case AttrStrings:
+		for _, s := range a.Strings {
+			b = protowire.AppendTag(b, attrStrings, protowire.BytesType)
+			b = protowire.AppendString(b, s)
+		}
+	}
+	return appendVarint(b, attrType, uint64(a.Type))
+}
+
+func (v *ValueInfo) marshal() []byte {
+	var shape []byte
+	for _, d := range v.Shape {
+		var db []byte
+		if d.Param != "" {
+			db = appendString(db, dimParam, d.Param)
+		} else {
+			db = protowire.AppendTag(db, dimValue, protowire.VarintType)
+			db = protowire.AppendVarint(db, uint64(d.Value))
+		}
+		shape = appendMessage(shape, shapeDim, db)
+	}
+	var tensor []byte
+	tensor = appendVarint(tensor, tensorElem, uint64(v.ElemType))
+	tensor = appendMessage(tensor, tensorShape, shape)
+
+	var b []byte
+	b = appendString(b, valueName, v.Name)
+	return appendMessage(b, valueType, appendMessage(nil, typeTensor, tensor))
+}
+
+// appendVarint writes a varint field, omitting zero as proto3 does for
+// defaults; the readers treat a missing field as zero either way.
+func appendVarint(b []byte, num protowire.Number, v uint64) []byte {
+	if v == 0 {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.VarintType)
+	return protowire.AppendVarint(b, v)
+}
+
+// appendString writes a string field, omitting the empty string.
+func appendString(b []byte, num protowire.Number, s string) []byte {
+	if s == "" {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendString(b, s)
+}
+
+func appendMessage(b []byte, num protowire.Number, msg []byte) []byte {
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendBytes(b, msg)
+}
+
+// Unmarshal decodes a model written by Marshal or by another ONNX writer.
+// Fields outside the subset above are skipped.
+func Unmarshal(b []byte) (*Model, error) {
+	m := &Model{}
+	err := fields(b, func(num protowire.Number, typ protowire.Type, v []byte) error {
+		var err error
+		switch num {
+		case modelIRVersion:
+			m.IRVersion, err = varint(typ, v)
+		case modelProducerName:
+			m.ProducerName = string(v)
+		case modelProducerVersion:
+			m.ProducerVersion = string(v)
+		case modelDocString:
+			m.DocString = string(v)
+		case modelGraph:
+			m.Graph, err = unmarshalGraph(v)
+		case modelOpsetImport:
+			var o Opset
+			err = fields(v, func(num protowire.Number, typ protowire.Type, v []byte) error {
+				var err error
+				switch num {
+				case opsetDomain:
+					o.Domain = string(v)
+				case opsetVersion:
+					o.Version, err = varint(typ, v)
+				}
+				return err
+			})
+			m.Opsets = append(m.Opsets, o)
+		}
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("onnx: %w", err)
+	}
+	return m, nil
+}
+
+func unmarshalGraph(b []byte) (*Graph, error) {
+	g := &Graph{}
+	return g, fields(b, func(num protowire.Number, typ protowire.Type, v []byte) error {
+		switch num {
+		case graphNode:
+			n, err := unmarshalNode(v)
+			g.Nodes = append(g.Nodes, n)
+			return err
+		case graphName:
+			g.Name = string(v)
+		case graphInput, graphOutput:
+			vi, err := unmarshalValueInfo(v)
+			if num == graphInput {
+				g.Inputs = append(g.Inputs, vi)
+			} else {
+				g.Outputs = append(g.Outputs, vi)
+			}
+			return err
+		}
+		return nil
+	})
+}
+
+func unmarshalNode(b []byte) (*Node, error) {
+	n := &Node{}
+	return n, fields(b, func(num protowire.Number, typ protowire.Type, v []byte) error {
+		switch num {
+		case nodeInput:
+			n.Inputs = append(n.Inputs, string(v))
+		case nodeOutput:
+			n.Outputs = append(n.Outputs, string(v))
+		case nodeName:
+			n.Name = string(v)
+		case nodeOpType:
+			n.OpType = string(v)
+		case nodeDomain:
+			n.Domain = string(v)
+		case nodeAttribute:
+			a, err := unmarshalAttribute(v)
+			n.Attributes = append(n.Attributes, a)
+			return err
+		}
+		return nil
+	})
+}
+
+func unmarshalAttribute(b []byte) (*Attribute, error) {
+	a := &Attribute{}
+	return a, fields(b, func(num protowire.Number, typ protowire.Type, v []byte) error {
+		var err error
+		switch num {
+		case attrName:
+			a.Name = string(v)
+		case attrType:
+			var t int64
+			t, err = varint(typ, v)
+			a.Type = AttributeType(t)
+		case attrF:
+			a.F = float(v)
+		case attrI:
+			a.I, err = varint(typ, v)
+		case attrS:
+			a.S = string(v)
+		case attrFloats:
+			err = repeated(typ, v, protowire.Fixed32Type, func(v []byte) error {
+				a.Floats = append(a.Floats, float(v))
+				return nil
+			})
+		case attrInts:
+			err = repeated(typ, v, protowire.VarintType, func(v []byte) error {
+				i, err := varint(protowire.VarintType, v)
+				a.Ints = append(a.Ints, i)
+				return err
+			})
+		case attrStrings:
+			a.Strings = append(a.Strings, string(v))
+		}
+		return err
+	})
+}
+
+func unmarshalValueInfo(b []byte) (*ValueInfo, error) {
+	vi := &ValueInfo{}
+	return vi, fields(b, func(num protowire.Number, typ protowire.Type, v []byte) error {
+		switch num {
+		case valueName:
+			vi.Name = string(v)
+		case valueType:
+			return fields(v, func(num protowire.Number, typ protowire.Type, v []byte) error {
+				if num != typeTensor {
+					return nil
+				}
+				return fields(v, func(num protowire.Number, typ protowire.Type, v []byte) error {
+					switch num {
+					case tensorElem:
+						t, err := varint(typ, v)
+						vi.ElemType = ElemType(t)
+						return err
+					case tensorShape:
+						return fields(v, func(num protowire.Number, typ protowire.Type, v []byte) error {
+							if num != shapeDim {
+								return nil
+							}
+							var d Dim
+							err := fields(v, func(num protowire.Number, typ protowire.Type, v []byte) error {
+								var err error
+								switch num {
+								case dimValue:
+									d.Value, err = varint(typ, v)
+								case dimParam:
+									d.Param = string(v)
+								}
+								return err
+							})
+							vi.Shape = append(vi.Shape, d)
+							return err
+						})
+					}
+					return nil
+				})
+			})
+		}
+		return nil
+	})
+}
+
+// fields calls fn with every field of the message in b. For length-delimited
+// fields v is the contents; otherwise it is the encoded value.
+func fields(b []byte, fn func(num protowire.Number, typ protowire.Type, v []byte) error) error {
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+		m := protowire.ConsumeFieldValue(num, typ, b)
+		if m < 0 {
+			return fmt.Errorf("field %d: %w", num, protowire.ParseError(m))
+		}
+		v := b[:m]
+		if typ == protowire.BytesType {
+			v, _ = protowire.ConsumeBytes(b)
+		}
+		if err := fn(num, typ, v); err != nil {
+			return err
+		}
+		b = b[m:]
+	}
+	return nil
+}
+
+// repeated calls fn for each element of a repeated scalar field, which is
+// either a single value of type elem or a packed run of them.
+func repeated(typ protowire.Type, v []byte, elem protowire.Type, fn func(v []byte) error) error {
+	if typ != protowire.BytesType {
+		return fn(v)
+	}
+	for len(v) > 0 {
+		n := protowire.ConsumeFieldValue(0, elem, v)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		if err := fn(v[:n]); err != nil {
+			return err
+		}
+		v = v[n:]
+	}
+	return nil
+}
+
+func varint(typ protowire.Type, v []byte) (int64, error) {
+	if typ != protowire.VarintType {
+		return 0, fmt.Errorf("expected a varint, got wire type %d", typ)
+	}
+	x, _ := protowire.ConsumeVarint(v)
+	return int64(x), nil
+}
+
+// float decodes a float field value: the IEEE 754 bits as a fixed32.
+func float(v []byte) float32 {
+	x, _ := protowire.ConsumeFixed32(v)
+	return math.Float32frombits(x)
+}
@@ -1,40 +1,100 @@
 package parser
 
+import "mlite/token"
+
 
 type Node interface{}
 
+// Span is the stretch of source a statement was parsed from: from the start
+// of its first token to the end of its last. Every statement node embeds
+// one; it is zero for nodes built without the parser.
+type Span struct {
+	Start token.Position `json:"start"`
+	End   token.Position `json:"end"`
+}
+
+// SourceSpan returns the span itself, for statement nodes embedding it.
+func (s Span) SourceSpan() Span {
+	return s
+}
+
+func (s *Span) setSpan(span Span) {
+	*s = span
+}
+
+// SpanOf returns the span of a statement node, or the zero Span.
+func SpanOf(node Node) Span {
+	if n, ok := node.(interface{ SourceSpan() Span }); ok {
+		return n.SourceSpan()
+	}
+	return Span{}
+}
+
+// LoadNode reads a file into df, or the rows of a query when SQLite names
+// a database file.
 type LoadNode struct {
-	File string
+	Span
+	File   string
+	Format string // csv, tsv, json, jsonl or parquet; empty means detect from File
+	SQLite string
+	Query  string // :name, @name and $name parameters bind MLite variables
 }
 
+// SaveNode writes a dataset to a file, or to a table of a SQLite database.
 type SaveNode struct {
-	File string
+	Span
+	Data   string // Dataset variable to save; empty means the loaded df
+	File   string
+	Format string
+	SQLite string
+	Table  string // replaced if it exists
 }
 
 type TrainNode struct {
+    Span
     Model    string
     Features []string
     Target   string
+    Data     string // Dataset variable to fit on; empty means the loaded df
 }
 
 type PredictNode struct {
+    Span
     Model string
-    Input []float64
+    Input []float64 // A single literal row; nil when predicting a dataset
+    Data  string    // Dataset variable to predict every row of
+    Into  string    // Column to append the predictions to, if any
+}
+
+// CallNode is a builtin call used as a statement, e.g. save_model(m, "m.mlm")
+type CallNode struct {
+    Span
+    Call *ExpressionNode
+}
+
+type EvaluateNode struct {
+    Span
+    Model string
+    Data  string // Dataset variable to score on; empty means the loaded df
 }
 
 
 
 type LetNode struct {
+	Span
 	Variable string
 	Value    *ExpressionNode
+	Names    []string // Every name bound by a destructuring let such as `let tr, te :: split(df)`
 }
 
 type SetNode struct {
+	Span
 	Variable string
 	Value    *ExpressionNode
 }
 
 type IfNode struct {
+	Span
 	Left     *ExpressionNode
 	Operator string
 	Right    *ExpressionNode
@@ -42,10 +102,18 @@ type IfNode struct {
 }
 
 type LoopNode struct {
+	Span
 	Count    *ExpressionNode
 	Commands []Node
 }
 
+// CommentNode holds the # comment lines written above the statement that
+// follows it, one per line. It does nothing when run.
+type CommentNode struct {
+	Span
+	Text string
+}
+
 
 
 
@@ -59,8 +127,16 @@ func (l *LetNode) TokenLiteral() string {
 // ExpressionNode represents an expression in the AST
 
 type ExpressionNode struct {
-    Type  string      // Type of the expression (e.g., "LITERAL", "IDENTIFIER")
-    Value interface{} // Value or variable name
+    Type     string            // Type of the expression (e.g., "LITERAL", "IDENTIFIER", "CALL")
+    Value    interface{}       // Value, variable name, called function name or MEMBER field name
+    Args     []*ExpressionNode // Positional arguments of a CALL, the elements of an ARRAY, or the object of a MEMBER
+    Keywords []*KeywordArg     // Named arguments of a CALL or entries of a MAP, in source order
+}
+
+// KeywordArg is a named call argument such as `learning_rate: 0.1`.
+type KeywordArg struct {
+    Name  string
+    Value *ExpressionNode
 }
 
 
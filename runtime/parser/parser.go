@@ -4,13 +4,45 @@ import (
 	"fmt"
 	"mlite/token"
 	"strconv"
+	"strings"
 )
 
+// Operator precedences, lowest first.
 const (
-	LOWEST = 0
+	LOWEST      = iota
+	LOGICAL_OR  // ||
+	LOGICAL_AND // &&
+	EQUALS      // == !=
+	COMPARISON  // < <= > >=
+	SUM         // + -
+	PRODUCT     // * /
+)
+
+var precedences = map[token.TokenType]int{
+	token.OR:       LOGICAL_OR,
+	token.AND:      LOGICAL_AND,
+	token.EQ:       EQUALS,
+	token.NOT_EQ:   EQUALS,
+	token.LT:       COMPARISON,
+	token.LTE:      COMPARISON,
+	token.GT:       COMPARISON,
+	token.GTE:      COMPARISON,
+	token.PLUS:     SUM,
+	token.MINUS:    SUM,
+	token.ASTERISK: PRODUCT,
+	token.SLASH:    PRODUCT,
+}
 
+const (
 	LITERAL    = "LITERAL"
 	IDENTIFIER = "IDENTIFIER"
+	STRING     = "STRING"
+	CALL       = "CALL"
+	ARRAY      = "ARRAY"
+	MEMBER     = "MEMBER"
+	MAP        = "MAP"
+	BINARY     = "BINARY" // Value is the operator, Args the two operands
+	UNARY      = "UNARY"  // Value is "-" or "!", Args the operand
 )
 
 type Parser struct {
@@ -23,17 +55,149 @@ func NewParser(tokens []token.Token) *Parser {
 	return &Parser{tokens: tokens}
 }
 
+// parseExpression parses operators binding tighter than precedence, so
+// price / sqft > 100 && age < 20 groups as ((price / sqft) > 100) && (age < 20).
+// Operators of equal precedence group to the left.
 func (p *Parser) parseExpression(precedence int) *ExpressionNode {
+	expr := p.parseOperand()
+	for {
+		tok := p.currentToken()
+		next, ok := precedences[tok.Type]
+		if !ok || next <= precedence {
+			return expr
+		}
+		p.pos++
+		right := p.parseExpression(next)
+		expr = &ExpressionNode{Type: BINARY, Value: tok.Literal, Args: []*ExpressionNode{expr, right}}
+	}
+}
+
+// parseOperand parses a primary expression with its prefix operators and
+// member accesses.
+func (p *Parser) parseOperand() *ExpressionNode {
+	switch p.currentToken().Type {
+	case token.MINUS, token.BANG:
+		op := p.expect(token.MINUS, token.BANG).Literal
+		operand := p.parseOperand()
+		if op == "-" && operand.Type == LITERAL {
+			// Fold negative numbers into the literal: -1 stays a number.
+			literal := operand.Value.(string)
+			if strings.HasPrefix(literal, "-") {
+				return &ExpressionNode{Type: LITERAL, Value: literal[1:]}
+			}
+			return &ExpressionNode{Type: LITERAL, Value: "-" + literal}
+		}
+		return &ExpressionNode{Type: UNARY, Value: op, Args: []*ExpressionNode{operand}}
+	}
+
+	return p.parseMembers(p.parsePrimary())
+}
+
+// parseMembers parses member accesses such as df.price or scores.r2, and
+// method calls: x.f(a, b) is the call f(x, a, b), so
+// group_by(df, [bedrooms]).agg(count()) calls agg on the groups.
+func (p *Parser) parseMembers(expr *ExpressionNode) *ExpressionNode {
+	for p.currentToken().Type == token.DOT {
+		p.expect(token.DOT)
+		field := p.expect(token.IDENTIFIER).Literal
+		if p.currentToken().Type == token.LPAREN {
+			call := p.parseCall(field)
+			call.Args = append([]*ExpressionNode{expr}, call.Args...)
+			expr = call
+			continue
+		}
+		expr = &ExpressionNode{Type: MEMBER, Value: field, Args: []*ExpressionNode{expr}}
+	}
+	return expr
+}
+
+func (p *Parser) parsePrimary() *ExpressionNode {
 	switch p.currentToken().Type {
 	case token.NUMBER:
 		return &ExpressionNode{Type: LITERAL, Value: p.expect(token.NUMBER).Literal}
+	case token.STRING:
+		return &ExpressionNode{Type: STRING, Value: p.expect(token.STRING).Literal}
 	case token.IDENTIFIER:
-		return &ExpressionNode{Type: IDENTIFIER, Value: p.expect(token.IDENTIFIER).Literal}
+		name := p.expect(token.IDENTIFIER).Literal
+		if p.currentToken().Type == token.LPAREN {
+			return p.parseCall(name)
+		}
+		return &ExpressionNode{Type: IDENTIFIER, Value: name}
+	case token.LPAREN:
+		p.expect(token.LPAREN)
+		expr := p.parseExpression(LOWEST)
+		p.expect(token.RPAREN)
+		return expr
+	case token.LBRACKET:
+		return p.parseArrayLiteral()
+	case token.LBRACE:
+		return p.parseMapLiteral()
+	// predict(m, te) and evaluate(m, te) used as values return the
+	// prediction column and the metrics record
+	case token.PREDICT, token.EVALUATE:
+		return p.parseCall(p.expect(token.PREDICT, token.EVALUATE).Literal)
 	default:
 		panic(fmt.Sprintf("Unexpected token: %s", p.currentToken().Literal))
 	}
 }
 
+// Parse an array literal such as [64, 32] or ["relu", "tanh"]
+func (p *Parser) parseArrayLiteral() *ExpressionNode {
+	array := &ExpressionNode{Type: ARRAY}
+	p.expect(token.LBRACKET)
+	for p.currentToken().Type != token.RBRACKET {
+		array.Args = append(array.Args, p.parseExpression(LOWEST))
+		if p.currentToken().Type != token.RBRACKET {
+			p.expect(token.COMMA)
+		}
+	}
+	p.expect(token.RBRACKET)
+	return array
+}
+
+// Parse a map literal such as {max_depth: [3, 5], "learning_rate": [0.1]}.
+// Entries are kept in source order as Keywords.
+func (p *Parser) parseMapLiteral() *ExpressionNode {
+	m := &ExpressionNode{Type: MAP}
+	p.expect(token.LBRACE)
+	for p.currentToken().Type != token.RBRACE {
+		key := p.expect(token.IDENTIFIER, token.STRING).Literal
+		p.expect(token.COLON)
+		m.Keywords = append(m.Keywords, &KeywordArg{Name: key, Value: p.parseExpression(LOWEST)})
+		if p.currentToken().Type != token.RBRACE {
+			p.expect(token.COMMA)
+		}
+	}
+	p.expect(token.RBRACE)
+	return m
+}
+
+// Parse a call such as gbm_regressor(n_estimators: 200, max_depth: 3).
+// Positional arguments must come before named ones.
+func (p *Parser) parseCall(name string) *ExpressionNode {
+	call := &ExpressionNode{Type: CALL, Value: name}
+	p.expect(token.LPAREN)
+
+	for p.currentToken().Type != token.RPAREN {
+		if p.currentToken().Type == token.IDENTIFIER && p.peekToken().Type == token.COLON {
+			key := p.expect(token.IDENTIFIER).Literal
+			p.expect(token.COLON)
+			call.Keywords = append(call.Keywords, &KeywordArg{Name: key, Value: p.parseExpression(LOWEST)})
+		} else {
+			if len(call.Keywords) > 0 {
+				panic(fmt.Sprintf("Positional argument after named arguments in call to %s", name))
+			}
+			call.Args = append(call.Args, p.parseExpression(LOWEST))
+		}
+		if p.currentToken().Type != token.RPAREN {
+			p.expect(token.COMMA)
+		}
+	}
+
+	p.expect(token.RPAREN)
+	return call
+}
+
 // Other methods...
 
 // Parse parses the tokens into a list of nodes
@@ -46,6 +210,10 @@ func (p *Parser) Parse() []Node {
 		if tok.Type == token.EOF {
 			break
 		}
+		if tok.Comment != "" {
+			nodes = append(nodes, &CommentNode{Text: tok.Comment})
+		}
+		start := p.pos
 
 		switch tok.Type {
 		case token.LOAD:
@@ -64,19 +232,42 @@ func (p *Parser) Parse() []Node {
 			nodes = append(nodes, p.parseLetStatement())
 		case token.PREDICT:
 			nodes = append(nodes, p.parsePredict())
+		case token.EVALUATE:
+			nodes = append(nodes, p.parseEvaluate())
+		case token.IDENTIFIER:
+			nodes = append(nodes, p.parseCallStatement())
 		default:
 			panic(fmt.Sprintf("Unexpected token: %s", tok.Type))
 		}
+		p.setSpan(nodes[len(nodes)-1], start)
 	}
 
 	return nodes
 }
 
+// setSpan records on a statement node the source from the token at start
+// to the last token parsed.
+func (p *Parser) setSpan(node Node, start int) {
+	if n, ok := node.(interface{ setSpan(Span) }); ok && p.pos > start {
+		n.setSpan(Span{Start: p.tokens[start].Start, End: p.tokens[p.pos-1].End})
+	}
+}
+
 // Parse "let" statements
 func (p *Parser) parseLetStatement() *LetNode {
 	p.expect(token.LET)
 	variable := p.expect(token.IDENTIFIER).Literal
 
+	// let a, b :: f(...) unpacks a function returning several values
+	var names []string
+	for p.currentToken().Type == token.COMMA {
+		if names == nil {
+			names = []string{variable}
+		}
+		p.expect(token.COMMA)
+		names = append(names, p.expect(token.IDENTIFIER).Literal)
+	}
+
 	p.expect(token.ASSIGN)
 	value := p.parseExpression(LOWEST)
 
@@ -85,6 +276,7 @@ func (p *Parser) parseLetStatement() *LetNode {
 	return &LetNode{
 		Variable: variable,
 		Value:    value,
+		Names:    names,
 	}
 }
 
@@ -94,7 +286,13 @@ func (p *Parser) parseBlock() []Node {
 	var commands []Node
 
 	for p.currentToken().Type != token.RBRACE {
-		commands = append(commands, p.ParseSingleCommand())
+		if comment := p.currentToken().Comment; comment != "" {
+			commands = append(commands, &CommentNode{Text: comment})
+		}
+		start := p.pos
+		command := p.ParseSingleCommand()
+		p.setSpan(command, start)
+		commands = append(commands, command)
 	}
 
 	p.expect(token.RBRACE)
@@ -119,29 +317,90 @@ func (p *Parser) ParseSingleCommand() Node {
 		return p.parseLoop()
 	case token.PREDICT:
 		return p.parsePredict()
+	case token.EVALUATE:
+		return p.parseEvaluate()
+	case token.IDENTIFIER:
+		return p.parseCallStatement()
 	default:
 		panic(fmt.Sprintf("Unexpected command in block: %s", tok.Type))
 	}
 }
 
-// Parse "load" commands
+// Parse "load" commands: load("data.csv"), load("data.txt", format: "tsv")
+// or load(sqlite: "features.db", query: "SELECT ...")
 func (p *Parser) parseLoad() *LoadNode {
 	p.expect(token.LOAD)
 	p.expect(token.LPAREN)
-	file := p.expect(token.STRING).Literal
+	file := ""
+	if p.currentToken().Type == token.STRING {
+		file = p.expect(token.STRING).Literal
+	}
+	options := p.parseOptions("load", file != "", "format", "sqlite", "query")
 	p.expect(token.RPAREN)
 
-	return &LoadNode{File: file}
+	n := &LoadNode{File: file, Format: options["format"], SQLite: options["sqlite"], Query: options["query"]}
+	switch {
+	case (n.File == "") == (n.SQLite == ""):
+		panic("load takes a file name or sqlite:, not both")
+	case n.SQLite != "" && (n.Query == "" || n.Format != ""):
+		panic("load(sqlite: ...) takes a query: and no format:")
+	case n.File != "" && n.Query != "":
+		panic("load: query: needs sqlite:")
+	}
+	return n
 }
 
-// Parse "save" commands
+// Parse "save" commands: save("out.csv"), save("out", format: "parquet"),
+// save(preds, "preds.csv") or save(preds, sqlite: "out.db", table: "preds")
 func (p *Parser) parseSave() *SaveNode {
 	p.expect(token.SAVE)
 	p.expect(token.LPAREN)
-	file := p.expect(token.STRING).Literal
+	data, file := "", ""
+	if p.currentToken().Type == token.IDENTIFIER && p.peekToken().Type == token.COMMA {
+		data = p.expect(token.IDENTIFIER).Literal
+		p.expect(token.COMMA)
+	}
+	if p.currentToken().Type == token.STRING {
+		file = p.expect(token.STRING).Literal
+	}
+	options := p.parseOptions("save", file != "", "format", "sqlite", "table")
 	p.expect(token.RPAREN)
 
-	return &SaveNode{File: file}
+	n := &SaveNode{Data: data, File: file, Format: options["format"], SQLite: options["sqlite"], Table: options["table"]}
+	switch {
+	case (n.File == "") == (n.SQLite == ""):
+		panic("save takes a file name or sqlite:, not both")
+	case n.SQLite != "" && (n.Table == "" || n.Format != ""):
+		panic("save(..., sqlite: ...) takes a table: and no format:")
+	case n.File != "" && n.Table != "":
+		panic("save: table: needs sqlite:")
+	}
+	return n
+}
+
+// Parse the key: "value" arguments of load and save. After a positional
+// argument each one follows a comma.
+func (p *Parser) parseOptions(command string, afterPositional bool, keys ...string) map[string]string {
+	options := map[string]string{}
+	for p.currentToken().Type != token.RPAREN {
+		if afterPositional || len(options) > 0 {
+			p.expect(token.COMMA)
+		}
+		key := p.expect(token.IDENTIFIER).Literal
+		known := false
+		for _, k := range keys {
+			known = known || k == key
+		}
+		if !known {
+			panic(fmt.Sprintf("Unknown %s argument: %s", command, key))
+		}
+		if _, dup := options[key]; dup {
+			panic(fmt.Sprintf("%s: argument %s given twice", command, key))
+		}
+		p.expect(token.COLON)
+		options[key] = p.expect(token.STRING).Literal
+	}
+	return options
 }
 
 // Parse "train" commands
@@ -149,22 +408,56 @@ func (p *Parser) parseTrain() *TrainNode {
 	p.expect(token.TRAIN)
 	p.expect(token.LPAREN)
 
-	model := p.expect(token.IDENTIFIER).Literal
+	// The model is either a variable holding a declared model or the
+	// name of a registered model type, e.g. "gbm_regressor".
+	model := p.expect(token.IDENTIFIER, token.STRING).Literal
 	p.expect(token.COMMA)
 
-	features := p.expect(token.IDENTIFIER).Literal
+	features := p.parseColumnList()
 	p.expect(token.COMMA)
 
-	target := p.expect(token.IDENTIFIER).Literal
+	target := p.expect(token.IDENTIFIER, token.STRING).Literal
+
+	// Optional trailing data: argument selects the dataset to fit on
+	data := ""
+	if p.currentToken().Type == token.COMMA {
+		p.expect(token.COMMA)
+		if key := p.expect(token.IDENTIFIER).Literal; key != "data" {
+			panic(fmt.Sprintf("Unknown train argument: %s", key))
+		}
+		p.expect(token.COLON)
+		data = p.expect(token.IDENTIFIER).Literal
+	}
 	p.expect(token.RPAREN)
 
 	return &TrainNode{
 		Model:    model,
-		Features: []string{features},
+		Features: features,
 		Target:   target,
+		Data:     data,
+	}
+}
+
+// Parse a single column name or a bracketed list of them: sqft or [sqft, age]
+func (p *Parser) parseColumnList() []string {
+	if p.currentToken().Type != token.LBRACKET {
+		return []string{p.expect(token.IDENTIFIER, token.STRING).Literal}
 	}
+
+	p.expect(token.LBRACKET)
+	var columns []string
+	for p.currentToken().Type != token.RBRACKET {
+		columns = append(columns, p.expect(token.IDENTIFIER, token.STRING).Literal)
+		if p.currentToken().Type != token.RBRACKET {
+			p.expect(token.COMMA)
+		}
+	}
+	p.expect(token.RBRACKET)
+	return columns
 }
 
+// Parse "predict" commands: a literal row, predict(m, [1.5, 2.0]), or a
+// dataset, predict(m, te) or predict(m, te, into: "price_hat")
 func (p *Parser) parsePredict() *PredictNode {
 	p.expect(token.PREDICT)
 	p.expect(token.LPAREN)
@@ -172,42 +465,102 @@ func (p *Parser) parsePredict() *PredictNode {
 	model := p.expect(token.IDENTIFIER).Literal
 	p.expect(token.COMMA)
 
-	input := p.parseArray() // Parse the input array
+	node := &PredictNode{Model: model}
+	if p.currentToken().Type == token.LBRACKET {
+		node.Input = p.parseArray() // Parse the input array
+	} else {
+		node.Data = p.expect(token.IDENTIFIER).Literal
+		if p.currentToken().Type == token.COMMA {
+			p.expect(token.COMMA)
+			if key := p.expect(token.IDENTIFIER).Literal; key != "into" {
+				panic(fmt.Sprintf("Unknown predict argument: %s", key))
+			}
+			p.expect(token.COLON)
+			node.Into = p.expect(token.STRING).Literal
+		}
+	}
 	p.expect(token.RPAREN)
 
-	return &PredictNode{
+	return node
+}
+
+// Parse "evaluate" commands: evaluate(model) or evaluate(model, data)
+func (p *Parser) parseEvaluate() *EvaluateNode {
+	p.expect(token.EVALUATE)
+	p.expect(token.LPAREN)
+
+	model := p.expect(token.IDENTIFIER).Literal
+	data := ""
+	if p.currentToken().Type == token.COMMA {
+		p.expect(token.COMMA)
+		data = p.expect(token.IDENTIFIER).Literal
+	}
+	p.expect(token.RPAREN)
+
+	return &EvaluateNode{
 		Model: model,
-		Input: input,
+		Data:  data,
 	}
 }
 
-// Parse "if" statements
+// Parse a builtin called for its effect, such as save_model(m, "m.mlm");
+// the semicolon is optional, as after other commands
+func (p *Parser) parseCallStatement() *CallNode {
+	name := p.expect(token.IDENTIFIER).Literal
+	if p.currentToken().Type != token.LPAREN {
+		panic(fmt.Sprintf("Unexpected identifier: %s", name))
+	}
+	call := p.parseMembers(p.parseCall(name))
+	if call.Type != CALL {
+		panic(fmt.Sprintf("Unexpected member access in statement: %s", call.Value))
+	}
+	if p.currentToken().Type == token.SEMICOLON {
+		p.expect(token.SEMICOLON)
+	}
+	return &CallNode{Call: call}
+}
+
+// Parse "if" statements. The condition is a comparison; its operands may
+// be any expressions, as in if(x + 1 > 5).
 func (p *Parser) parseIf() *IfNode {
 	p.expect(token.IF)
 	p.expect(token.LPAREN)
 
-	left := p.parseExpression(LOWEST)
-	operator := p.expect(token.EQ, token.GT, token.LT, token.GTE, token.LTE).Literal
-	right := p.parseExpression(LOWEST)
+	condition := p.parseExpression(LOWEST)
+	if condition.Type != BINARY || !isComparison(condition.Value.(string)) {
+		panic("Syntax error: if needs a comparison such as x > 5")
+	}
 
 	p.expect(token.RPAREN)
 
 	commands := p.parseBlock()
 
 	return &IfNode{
-		Left:     left,
-		Operator: operator,
-		Right:    right,
+		Left:     condition.Args[0],
+		Operator: condition.Value.(string),
+		Right:    condition.Args[1],
 		Commands: commands,
 	}
 }
 
+func isComparison(op string) bool {
+	switch op {
+	case "==", "!=", "<", "<=", ">", ">=":
+		return true
+	}
+	return false
+}
+
 func (p *Parser) parseArray() []float64 {
 	p.expect(token.LBRACKET)
 	var elements []float64
 
 	for p.currentToken().Type != token.RBRACKET {
-		num := p.expect(token.NUMBER).Literal
+		sign := ""
+		if p.currentToken().Type == token.MINUS {
+			sign = p.expect(token.MINUS).Literal
+		}
+		num := sign + p.expect(token.NUMBER).Literal
 		val, err := strconv.ParseFloat(num, 64)
 		if err != nil {
 			panic(fmt.Sprintf("Invalid number in array: %s", num))
@@ -262,6 +615,14 @@ func (p *Parser) currentToken() token.Token {
 	return p.tokens[p.pos]
 }
 
+// Peek at the token after the current one
+func (p *Parser) peekToken() token.Token {
+	if p.pos+1 >= len(p.tokens) {
+		return token.Token{Type: token.EOF}
+	}
+	return p.tokens[p.pos+1]
+}
+
 // Expect token helper
 func (p *Parser) expect(expectedTypes ...token.TokenType) token.Token {
 	tok := p.currentToken()
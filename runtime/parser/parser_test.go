@@ -1,7 +1,9 @@
 package parser
 
 import (
+	"fmt"
 	"mlite/token"
+	"strings"
 	"testing"
 )
 
@@ -96,6 +98,28 @@ func TestParsePredict(t *testing.T) {
 	}
 }
 
+func TestParsePredictNegativeInput(t *testing.T) {
+	tokens := []token.Token{
+		{Type: token.PREDICT, Literal: "predict"},
+		{Type: token.LPAREN, Literal: "("},
+		{Type: token.IDENTIFIER, Literal: "m"},
+		{Type: token.COMMA, Literal: ","},
+		{Type: token.LBRACKET, Literal: "["},
+		{Type: token.MINUS, Literal: "-"},
+		{Type: token.NUMBER, Literal: "1"},
+		{Type: token.COMMA, Literal: ","},
+		{Type: token.NUMBER, Literal: "2"},
+		{Type: token.RBRACKET, Literal: "]"},
+		{Type: token.RPAREN, Literal: ")"},
+		{Type: token.EOF, Literal: ""},
+	}
+
+	predict := NewParser(tokens).Parse()[0].(*PredictNode)
+	if len(predict.Input) != 2 || predict.Input[0] != -1 || predict.Input[1] != 2 {
+		t.Errorf("unexpected input: %v", predict.Input)
+	}
+}
+
 func TestFullCommand(t *testing.T) {
     input := []token.Token{
         {Type: token.LOAD, Literal: "load"},
@@ -124,3 +148,469 @@ func TestFullCommand(t *testing.T) {
         t.Fatalf("expected 3 nodes, got %d", len(nodes))
     }
 }
+
+// Checks that a let can declare a model with a call carrying named arguments.
+func TestParseCallExpression(t *testing.T) {
+	tokens := []token.Token{
+		{Type: token.LET, Literal: "let"},
+		{Type: token.IDENTIFIER, Literal: "m"},
+		{Type: token.ASSIGN, Literal: "::"},
+		{Type: token.IDENTIFIER, Literal: "gbm_regressor"},
+		{Type: token.LPAREN, Literal: "("},
+		{Type: token.IDENTIFIER, Literal: "n_estimators"},
+		{Type: token.COLON, Literal: ":"},
+		{Type: token.NUMBER, Literal: "200"},
+		{Type: token.COMMA, Literal: ","},
+		{Type: token.IDENTIFIER, Literal: "loss"},
+		{Type: token.COLON, Literal: ":"},
+		{Type: token.STRING, Literal: "squared"},
+		{Type: token.RPAREN, Literal: ")"},
+		{Type: token.SEMICOLON, Literal: ";"},
+		{Type: token.EOF, Literal: ""},
+	}
+
+	nodes := NewParser(tokens).Parse()
+	let, ok := nodes[0].(*LetNode)
+	if !ok || let.Value.Type != CALL || let.Value.Value != "gbm_regressor" {
+		t.Fatalf("expected a let with a gbm_regressor call, got %+v", nodes[0])
+	}
+	if len(let.Value.Keywords) != 2 {
+		t.Fatalf("expected 2 named arguments, got %d", len(let.Value.Keywords))
+	}
+	first, second := let.Value.Keywords[0], let.Value.Keywords[1]
+	if first.Name != "n_estimators" || first.Value.Value != "200" || second.Name != "loss" || second.Value.Type != STRING {
+		t.Errorf("unexpected arguments: %+v, %+v", first, second)
+	}
+}
+
+// Checks that train accepts a bracketed feature list.
+func TestParseTrainFeatureList(t *testing.T) {
+	tokens := []token.Token{
+		{Type: token.TRAIN, Literal: "train"},
+		{Type: token.LPAREN, Literal: "("},
+		{Type: token.IDENTIFIER, Literal: "m"},
+		{Type: token.COMMA, Literal: ","},
+		{Type: token.LBRACKET, Literal: "["},
+		{Type: token.IDENTIFIER, Literal: "sqft"},
+		{Type: token.COMMA, Literal: ","},
+		{Type: token.IDENTIFIER, Literal: "age"},
+		{Type: token.RBRACKET, Literal: "]"},
+		{Type: token.COMMA, Literal: ","},
+		{Type: token.IDENTIFIER, Literal: "price"},
+		{Type: token.RPAREN, Literal: ")"},
+		{Type: token.EOF, Literal: ""},
+	}
+
+	train := NewParser(tokens).Parse()[0].(*TrainNode)
+	if len(train.Features) != 2 || train.Features[0] != "sqft" || train.Features[1] != "age" {
+		t.Errorf("unexpected features: %v", train.Features)
+	}
+}
+
+// Checks that array literals parse as ARRAY expressions, e.g. mlp layer sizes.
+func TestParseArrayLiteral(t *testing.T) {
+	tokens := []token.Token{
+		{Type: token.LET, Literal: "let"},
+		{Type: token.IDENTIFIER, Literal: "layers"},
+		{Type: token.ASSIGN, Literal: "::"},
+		{Type: token.LBRACKET, Literal: "["},
+		{Type: token.NUMBER, Literal: "64"},
+		{Type: token.COMMA, Literal: ","},
+		{Type: token.NUMBER, Literal: "32"},
+		{Type: token.RBRACKET, Literal: "]"},
+		{Type: token.SEMICOLON, Literal: ";"},
+		{Type: token.EOF, Literal: ""},
+	}
+
+	let := NewParser(tokens).Parse()[0].(*LetNode)
+	if let.Value.Type != ARRAY || len(let.Value.Args) != 2 || let.Value.Args[1].Value != "32" {
+		t.Errorf("unexpected array: %+v", let.Value)
+	}
+}
+
+// Checks that a let can unpack several names and that train accepts data:.
+func TestParseDestructuringLetAndTrainData(t *testing.T) {
+	tokens := []token.Token{
+		{Type: token.LET, Literal: "let"},
+		{Type: token.IDENTIFIER, Literal: "tr"},
+		{Type: token.COMMA, Literal: ","},
+		{Type: token.IDENTIFIER, Literal: "te"},
+		{Type: token.ASSIGN, Literal: "::"},
+		{Type: token.IDENTIFIER, Literal: "split"},
+		{Type: token.LPAREN, Literal: "("},
+		{Type: token.IDENTIFIER, Literal: "df"},
+		{Type: token.RPAREN, Literal: ")"},
+		{Type: token.SEMICOLON, Literal: ";"},
+		{Type: token.TRAIN, Literal: "train"},
+		{Type: token.LPAREN, Literal: "("},
+		{Type: token.IDENTIFIER, Literal: "m"},
+		{Type: token.COMMA, Literal: ","},
+		{Type: token.IDENTIFIER, Literal: "x"},
+		{Type: token.COMMA, Literal: ","},
+		{Type: token.IDENTIFIER, Literal: "y"},
+		{Type: token.COMMA, Literal: ","},
+		{Type: token.IDENTIFIER, Literal: "data"},
+		{Type: token.COLON, Literal: ":"},
+		{Type: token.IDENTIFIER, Literal: "tr"},
+		{Type: token.RPAREN, Literal: ")"},
+		{Type: token.EOF, Literal: ""},
+	}
+
+	nodes := NewParser(tokens).Parse()
+	let := nodes[0].(*LetNode)
+	if len(let.Names) != 2 || let.Names[0] != "tr" || let.Names[1] != "te" {
+		t.Errorf("unexpected names: %v", let.Names)
+	}
+	if train := nodes[1].(*TrainNode); train.Data != "tr" {
+		t.Errorf("expected data tr, got %q", train.Data)
+	}
+}
+
+func TestParseEvaluateAndMember(t *testing.T) {
+	tokens := []token.Token{
+		{Type: token.EVALUATE, Literal: "evaluate"},
+		{Type: token.LPAREN, Literal: "("},
+		{Type: token.IDENTIFIER, Literal: "m"},
+		{Type: token.COMMA, Literal: ","},
+		{Type: token.IDENTIFIER, Literal: "te"},
+		{Type: token.RPAREN, Literal: ")"},
+		{Type: token.LET, Literal: "let"},
+		{Type: token.IDENTIFIER, Literal: "r2"},
+		{Type: token.ASSIGN, Literal: "::"},
+		{Type: token.EVALUATE, Literal: "evaluate"},
+		{Type: token.LPAREN, Literal: "("},
+		{Type: token.IDENTIFIER, Literal: "m"},
+		{Type: token.RPAREN, Literal: ")"},
+		{Type: token.DOT, Literal: "."},
+		{Type: token.IDENTIFIER, Literal: "r2"},
+		{Type: token.SEMICOLON, Literal: ";"},
+		{Type: token.EOF, Literal: ""},
+	}
+
+	nodes := NewParser(tokens).Parse()
+	if eval, ok := nodes[0].(*EvaluateNode); !ok || eval.Model != "m" || eval.Data != "te" {
+		t.Fatalf("expected EvaluateNode on m and te, got %+v", nodes[0])
+	}
+	member := nodes[1].(*LetNode).Value
+	if member.Type != MEMBER || member.Value != "r2" || member.Args[0].Type != CALL || member.Args[0].Value != "evaluate" {
+		t.Errorf("expected evaluate(m).r2, got %+v", member)
+	}
+}
+
+func TestParseMapLiteral(t *testing.T) {
+	tokens := []token.Token{
+		{Type: token.LET, Literal: "let"},
+		{Type: token.IDENTIFIER, Literal: "grid"},
+		{Type: token.ASSIGN, Literal: "::"},
+		{Type: token.LBRACE, Literal: "{"},
+		{Type: token.IDENTIFIER, Literal: "max_depth"},
+		{Type: token.COLON, Literal: ":"},
+		{Type: token.LBRACKET, Literal: "["},
+		{Type: token.NUMBER, Literal: "3"},
+		{Type: token.COMMA, Literal: ","},
+		{Type: token.NUMBER, Literal: "5"},
+		{Type: token.RBRACKET, Literal: "]"},
+		{Type: token.COMMA, Literal: ","},
+		{Type: token.STRING, Literal: "loss"},
+		{Type: token.COLON, Literal: ":"},
+		{Type: token.STRING, Literal: "squared"},
+		{Type: token.RBRACE, Literal: "}"},
+		{Type: token.SEMICOLON, Literal: ";"},
+		{Type: token.EOF, Literal: ""},
+	}
+
+	m := NewParser(tokens).Parse()[0].(*LetNode).Value
+	if m.Type != MAP || len(m.Keywords) != 2 {
+		t.Fatalf("expected a MAP with 2 entries, got %+v", m)
+	}
+	if m.Keywords[0].Name != "max_depth" || len(m.Keywords[0].Value.Args) != 2 || m.Keywords[1].Name != "loss" {
+		t.Errorf("unexpected entries: %+v %+v", m.Keywords[0], m.Keywords[1])
+	}
+}
+
+func TestParsePredictDataset(t *testing.T) {
+	tokens := []token.Token{
+		{Type: token.PREDICT, Literal: "predict"},
+		{Type: token.LPAREN, Literal: "("},
+		{Type: token.IDENTIFIER, Literal: "m"},
+		{Type: token.COMMA, Literal: ","},
+		{Type: token.IDENTIFIER, Literal: "te"},
+		{Type: token.COMMA, Literal: ","},
+		{Type: token.IDENTIFIER, Literal: "into"},
+		{Type: token.COLON, Literal: ":"},
+		{Type: token.STRING, Literal: "price_hat"},
+		{Type: token.RPAREN, Literal: ")"},
+		{Type: token.LET, Literal: "let"},
+		{Type: token.IDENTIFIER, Literal: "p"},
+		{Type: token.ASSIGN, Literal: "::"},
+		{Type: token.PREDICT, Literal: "predict"},
+		{Type: token.LPAREN, Literal: "("},
+		{Type: token.IDENTIFIER, Literal: "m"},
+		{Type: token.COMMA, Literal: ","},
+		{Type: token.IDENTIFIER, Literal: "te"},
+		{Type: token.RPAREN, Literal: ")"},
+		{Type: token.SEMICOLON, Literal: ";"},
+		{Type: token.EOF, Literal: ""},
+	}
+
+	nodes := NewParser(tokens).Parse()
+	predict := nodes[0].(*PredictNode)
+	if predict.Input != nil || predict.Data != "te" || predict.Into != "price_hat" {
+		t.Errorf("unexpected predict node: %+v", predict)
+	}
+	if call := nodes[1].(*LetNode).Value; call.Type != CALL || call.Value != "predict" || len(call.Args) != 2 {
+		t.Errorf("expected a predict call, got %+v", call)
+	}
+}
+
+func TestParseCallStatement(t *testing.T) {
+	tokens := []token.Token{
+		{Type: token.IDENTIFIER, Literal: "save_model"},
+		{Type: token.LPAREN, Literal: "("},
+		{Type: token.IDENTIFIER, Literal: "m"},
+		{Type: token.COMMA, Literal: ","},
+		{Type: token.STRING, Literal: "m.mlm"},
+		{Type: token.RPAREN, Literal: ")"},
+		{Type: token.SEMICOLON, Literal: ";"},
+		{Type: token.EOF, Literal: ""},
+	}
+
+	nodes := NewParser(tokens).Parse()
+	if len(nodes) != 1 {
+		t.Fatalf("expected 1 node, got %d", len(nodes))
+	}
+	call, ok := nodes[0].(*CallNode)
+	if !ok || call.Call.Value != "save_model" || len(call.Call.Args) != 2 {
+		t.Errorf("expected a save_model CallNode, got %+v", nodes[0])
+	}
+}
+
+// Checks that binary operators group by precedence and to the left, that
+// parentheses and prefix operators bind tightest, and that a negative
+// number stays a literal.
+func TestParseOperators(t *testing.T) {
+	// let x :: a - b - c * -2 > 1 && !(d == "x") || e;
+	tokens := []token.Token{
+		{Type: token.LET, Literal: "let"},
+		{Type: token.IDENTIFIER, Literal: "x"},
+		{Type: token.ASSIGN, Literal: "::"},
+		{Type: token.IDENTIFIER, Literal: "a"},
+		{Type: token.MINUS, Literal: "-"},
+		{Type: token.IDENTIFIER, Literal: "b"},
+		{Type: token.MINUS, Literal: "-"},
+		{Type: token.IDENTIFIER, Literal: "c"},
+		{Type: token.ASTERISK, Literal: "*"},
+		{Type: token.MINUS, Literal: "-"},
+		{Type: token.NUMBER, Literal: "2"},
+		{Type: token.GT, Literal: ">"},
+		{Type: token.NUMBER, Literal: "1"},
+		{Type: token.AND, Literal: "&&"},
+		{Type: token.BANG, Literal: "!"},
+		{Type: token.LPAREN, Literal: "("},
+		{Type: token.IDENTIFIER, Literal: "d"},
+		{Type: token.EQ, Literal: "=="},
+		{Type: token.STRING, Literal: "x"},
+		{Type: token.RPAREN, Literal: ")"},
+		{Type: token.OR, Literal: "||"},
+		{Type: token.IDENTIFIER, Literal: "e"},
+		{Type: token.SEMICOLON, Literal: ";"},
+		{Type: token.EOF, Literal: ""},
+	}
+
+	var render func(e *ExpressionNode) string
+	render = func(e *ExpressionNode) string {
+		switch e.Type {
+		case BINARY:
+			return "(" + render(e.Args[0]) + " " + e.Value.(string) + " " + render(e.Args[1]) + ")"
+		case UNARY:
+			return e.Value.(string) + render(e.Args[0])
+		case STRING:
+			return `"` + e.Value.(string) + `"`
+		}
+		return e.Value.(string)
+	}
+
+	let := NewParser(tokens).Parse()[0].(*LetNode)
+	want := `(((((a - b) - (c * -2)) > 1) && !(d == "x")) || e)`
+	if got := render(let.Value); got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+}
+
+// Checks that x.f(a) parses as the call f(x, a), after member accesses,
+// both in expressions and as a statement.
+func TestParseMethodCall(t *testing.T) {
+	// g(df).agg(mean(s.price)); head(df).tail(2)
+	tokens := []token.Token{
+		{Type: token.IDENTIFIER, Literal: "g"},
+		{Type: token.LPAREN, Literal: "("},
+		{Type: token.IDENTIFIER, Literal: "df"},
+		{Type: token.RPAREN, Literal: ")"},
+		{Type: token.DOT, Literal: "."},
+		{Type: token.IDENTIFIER, Literal: "agg"},
+		{Type: token.LPAREN, Literal: "("},
+		{Type: token.IDENTIFIER, Literal: "mean"},
+		{Type: token.LPAREN, Literal: "("},
+		{Type: token.IDENTIFIER, Literal: "s"},
+		{Type: token.DOT, Literal: "."},
+		{Type: token.IDENTIFIER, Literal: "price"},
+		{Type: token.RPAREN, Literal: ")"},
+		{Type: token.RPAREN, Literal: ")"},
+		{Type: token.SEMICOLON, Literal: ";"},
+		{Type: token.IDENTIFIER, Literal: "head"},
+		{Type: token.LPAREN, Literal: "("},
+		{Type: token.IDENTIFIER, Literal: "df"},
+		{Type: token.RPAREN, Literal: ")"},
+		{Type: token.DOT, Literal: "."},
+		{Type: token.IDENTIFIER, Literal: "tail"},
+		{Type: token.LPAREN, Literal: "("},
+		{Type: token.NUMBER, Literal: "2"},
+		{Type: token.RPAREN, Literal: ")"},
+		{Type: token.EOF, Literal: ""},
+	}
+
+	nodes := NewParser(tokens).Parse()
+	if len(nodes) != 2 {
+		t.Fatalf("expected 2 nodes, got %d", len(nodes))
+	}
+	agg := nodes[0].(*CallNode).Call
+	if agg.Value != "agg" || len(agg.Args) != 2 || agg.Args[0].Value != "g" {
+		t.Fatalf("expected agg(g(df), ...), got %+v", agg)
+	}
+	if mean := agg.Args[1]; mean.Value != "mean" || mean.Args[0].Type != MEMBER {
+		t.Errorf("expected mean(s.price), got %+v", mean)
+	}
+	tail := nodes[1].(*CallNode).Call
+	if tail.Value != "tail" || len(tail.Args) != 2 || tail.Args[0].Value != "head" || tail.Args[1].Value != "2" {
+		t.Errorf("expected tail(head(df), 2), got %+v", tail)
+	}
+}
+
+// Checks that load and save accept a trailing format: argument.
+func TestParseLoadFormat(t *testing.T) {
+	// load("prices.txt", format: "tsv") save("out")
+	tokens := []token.Token{
+		{Type: token.LOAD, Literal: "load"},
+		{Type: token.LPAREN, Literal: "("},
+		{Type: token.STRING, Literal: "prices.txt"},
+		{Type: token.COMMA, Literal: ","},
+		{Type: token.IDENTIFIER, Literal: "format"},
+		{Type: token.COLON, Literal: ":"},
+		{Type: token.STRING, Literal: "tsv"},
+		{Type: token.RPAREN, Literal: ")"},
+		{Type: token.SAVE, Literal: "save"},
+		{Type: token.LPAREN, Literal: "("},
+		{Type: token.STRING, Literal: "out"},
+		{Type: token.RPAREN, Literal: ")"},
+		{Type: token.EOF, Literal: ""},
+	}
+
+	nodes := NewParser(tokens).Parse()
+	if load := nodes[0].(*LoadNode); load.File != "prices.txt" || load.Format != "tsv" {
+		t.Errorf("expected a tsv LoadNode, got %+v", load)
+	}
+	if save := nodes[1].(*SaveNode); save.File != "out" || save.Format != "" {
+		t.Errorf("expected a SaveNode without a format, got %+v", save)
+	}
+}
+
+// Checks that load and save accept sqlite: with query: and table:, and
+// that save can name the dataset to write.
+func TestParseSQLite(t *testing.T) {
+	// load(sqlite: "f.db", query: "SELECT 1") save(preds, sqlite: "out.db", table: "p")
+	tokens := []token.Token{
+		{Type: token.LOAD, Literal: "load"},
+		{Type: token.LPAREN, Literal: "("},
+		{Type: token.IDENTIFIER, Literal: "sqlite"},
+		{Type: token.COLON, Literal: ":"},
+		{Type: token.STRING, Literal: "f.db"},
+		{Type: token.COMMA, Literal: ","},
+		{Type: token.IDENTIFIER, Literal: "query"},
+		{Type: token.COLON, Literal: ":"},
+		{Type: token.STRING, Literal: "SELECT 1"},
+		{Type: token.RPAREN, Literal: ")"},
+		{Type: token.SAVE, Literal: "save"},
+		{Type: token.LPAREN, Literal: "("},
+		{Type: token.IDENTIFIER, Literal: "preds"},
+		{Type: token.COMMA, Literal: ","},
+		{Type: token.IDENTIFIER, Literal: "sqlite"},
+		{Type: token.COLON, Literal: ":"},
+		{Type: token.STRING, Literal: "out.db"},
+		{Type: token.COMMA, Literal: ","},
+		{Type: token.IDENTIFIER, Literal: "table"},
+		{Type: token.COLON, Literal: ":"},
+		{Type: token.STRING, Literal: "p"},
+		{Type: token.RPAREN, Literal: ")"},
+		{Type: token.EOF, Literal: ""},
+	}
+
+	nodes := NewParser(tokens).Parse()
+	if load := nodes[0].(*LoadNode); load.SQLite != "f.db" || load.Query != "SELECT 1" || load.File != "" {
+		t.Errorf("expected a sqlite LoadNode, got %+v", load)
+	}
+	if save := nodes[1].(*SaveNode); save.Data != "preds" || save.SQLite != "out.db" || save.Table != "p" {
+		t.Errorf("expected a sqlite SaveNode of preds, got %+v", save)
+	}
+
+	defer func() {
+		if r := recover(); r == nil || !strings.Contains(fmt.Sprint(r), "takes a table:") {
+			t.Errorf("expected a missing table: panic, got %v", r)
+		}
+	}()
+	NewParser(append(tokens[10:17:17], tokens[21:]...)).Parse() // save(preds, sqlite: "out.db")
+}
+
+// Checks that a comment above a statement becomes a CommentNode before it,
+// at the top level and inside a block.
+func TestParseComments(t *testing.T) {
+	tokens := []token.Token{
+		{Type: token.LOOP, Literal: "loop", Comment: "Twice"},
+		{Type: token.LPAREN, Literal: "("},
+		{Type: token.NUMBER, Literal: "2"},
+		{Type: token.RPAREN, Literal: ")"},
+		{Type: token.LBRACE, Literal: "{"},
+		{Type: token.SAVE, Literal: "save", Comment: "Keep a copy"},
+		{Type: token.LPAREN, Literal: "("},
+		{Type: token.STRING, Literal: "out.csv"},
+		{Type: token.RPAREN, Literal: ")"},
+		{Type: token.RBRACE, Literal: "}"},
+		{Type: token.EOF, Literal: ""},
+	}
+	nodes := NewParser(tokens).Parse()
+	if len(nodes) != 2 || nodes[0].(*CommentNode).Text != "Twice" {
+		t.Fatalf("expected a comment then the loop, got %#v", nodes)
+	}
+	loop := nodes[1].(*LoopNode)
+	if len(loop.Commands) != 2 || loop.Commands[0].(*CommentNode).Text != "Keep a copy" {
+		t.Fatalf("expected a comment then save in the loop, got %#v", loop.Commands)
+	}
+}
+
+// Checks that statements record the span from their first token to their
+// last, inside blocks too.
+func TestParseSpans(t *testing.T) {
+	at := func(line, column int) token.Position { return token.Position{Line: line, Column: column} }
+	// loop(2) {
+	//   save("out.csv")
+	// }
+	tokens := []token.Token{
+		{Type: token.LOOP, Literal: "loop", Start: at(1, 1), End: at(1, 5)},
+		{Type: token.LPAREN, Literal: "(", Start: at(1, 5), End: at(1, 6)},
+		{Type: token.NUMBER, Literal: "2", Start: at(1, 6), End: at(1, 7)},
+		{Type: token.RPAREN, Literal: ")", Start: at(1, 7), End: at(1, 8)},
+		{Type: token.LBRACE, Literal: "{", Start: at(1, 9), End: at(1, 10)},
+		{Type: token.SAVE, Literal: "save", Start: at(2, 3), End: at(2, 7)},
+		{Type: token.LPAREN, Literal: "(", Start: at(2, 7), End: at(2, 8)},
+		{Type: token.STRING, Literal: "out.csv", Start: at(2, 8), End: at(2, 17)},
+		{Type: token.RPAREN, Literal: ")", Start: at(2, 17), End: at(2, 18)},
+		{Type: token.RBRACE, Literal: "}", Start: at(3, 1), End: at(3, 2)},
+		{Type: token.EOF, Start: at(3, 2), End: at(3, 2)},
+	}
+	loop := NewParser(tokens).Parse()[0].(*LoopNode)
+	if want := (Span{Start: at(1, 1), End: at(3, 2)}); SpanOf(loop) != want {
+		t.Errorf("loop: got %+v, want %+v", SpanOf(loop), want)
+	}
+	if want := (Span{Start: at(2, 3), End: at(2, 18)}); SpanOf(loop.Commands[0]) != want {
+		t.Errorf("save: got %+v, want %+v", SpanOf(loop.Commands[0]), want)
+	}
+}
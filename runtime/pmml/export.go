@@ -0,0 +1,273 @@
+package pmml
+
+import (
+	"encoding/xml"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+
+	"mlite/dataset"
+	"mlite/model"
+)
+
+// Export builds the PMML document for a trained estimator. The data
+// dictionary declares every column of d with its type, so d should be the
+// dataset the model was trained on or one shaped like it. Linear and
+// logistic regression and gradient boosting are supported; the MLP and
+// models trained on preprocessed data are not.
+func Export(e *model.Estimator, d *dataset.Dataset) (*PMML, error) {
+	if !e.Trained() {
+		return nil, fmt.Errorf("model has not been trained")
+	}
+	if len(e.Transforms) > 0 {
+		return nil, fmt.Errorf("%s has preprocessing steps, which cannot be exported", e.Spec.Name())
+	}
+	if err := e.CheckColumns(d); err != nil {
+		return nil, err
+	}
+	doc := &PMML{
+		Version: "4.4",
+		Header: Header{
+			Description: e.String(),
+			Application: Application{Name: "MLite"},
+			Timestamp:   e.TrainedAt.UTC().Format(time.RFC3339),
+		},
+		DataDictionary: dataDictionary(e, d),
+	}
+
+	schema := miningSchema(e)
+	switch m := e.Model.(type) {
+	case *model.LinearRegression:
+		doc.RegressionModel = linearRegression(m, e.Features, schema)
+	case *model.LogisticRegression:
+		doc.RegressionModel = logisticRegression(m, e.Features, schema)
+	case *model.GradientBoosting:
+		doc.MiningModel = gradientBoosting(m, e.Features, schema)
+	default:
+		return nil, fmt.Errorf("%s cannot be exported to PMML (supported: linear_regression, logistic_regression, gbm_regressor, gbm_classifier)", e.Spec.Type)
+	}
+	return doc, nil
+}
+
+// WriteFile exports e and writes the indented XML document to path.
+func WriteFile(e *model.Estimator, d *dataset.Dataset, path string) error {
+	doc, err := Export(e, d)
+	if err != nil {
+		return err
+	}
+	out, err := xml.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append([]byte(xml.Header), append(out, '\n')...), 0o644)
+}
+
+// dataDictionary declares the columns of d: numeric columns as continuous
+// doubles and text columns as categorical strings with their distinct
+// values. A classifier's target is categorical over its class labels, and
+// is declared from the model when d does not have it.
+func dataDictionary(e *model.Estimator, d *dataset.Dataset) DataDictionary {
+	var dict DataDictionary
+	hasTarget := false
+	for _, c := range d.Columns {
+		if c.Name == e.Target {
+			hasTarget = true
+			dict.Fields = append(dict.Fields, targetField(e))
+			continue
+		}
+		if c.Type == dataset.Numeric {
+			dict.Fields = append(dict.Fields, DataField{Name: c.Name, Optype: "continuous", DataType: "double"})
+			continue
+		}
+		field := DataField{Name: c.Name, Optype: "categorical", DataType: "string"}
+		for _, v := range distinctStrings(c.Strings) {
+			field.Values = append(field.Values, Value{v})
+		}
+		dict.Fields = append(dict.Fields, field)
+	}
+	if !hasTarget {
+		dict.Fields = append(dict.Fields, targetField(e))
+	}
+	dict.NumberOfFields = len(dict.Fields)
+	return dict
+}
+
+func targetField(e *model.Estimator) DataField {
+	c, ok := e.Model.(model.Classifier)
+	if !ok || !model.IsClassifier(e.Model) {
+		return DataField{Name: e.Target, Optype: "continuous", DataType: "double"}
+	}
+	field := DataField{Name: e.Target, Optype: "categorical", DataType: "integer"}
+	for _, l := range c.Classes() {
+		if l != math.Trunc(l) {
+			field.DataType = "double"
+		}
+		field.Values = append(field.Values, Value{label(l)})
+	}
+	return field
+}
+
+func miningSchema(e *model.Estimator) MiningSchema {
+	var s MiningSchema
+	for _, f := range e.Features {
+		s.Fields = append(s.Fields, MiningField{Name: f})
+	}
+	s.Fields = append(s.Fields, MiningField{Name: e.Target, UsageType: "target"})
+	return s
+}
+
+// activeSchema lists only the features, for segments that do not predict
+// the target themselves.
+func activeSchema(features []string) MiningSchema {
+	var s MiningSchema
+	for _, f := range features {
+		s.Fields = append(s.Fields, MiningField{Name: f})
+	}
+	return s
+}
+
+func linearRegression(m *model.LinearRegression, features []string, schema MiningSchema) *RegressionModel {
+	return &RegressionModel{
+		FunctionName: "regression",
+		MiningSchema: schema,
+		Tables:       []RegressionTable{table(m.Intercept, "", features, m.Coef)},
+	}
+}
+
+// logisticRegression writes one table per class. With two classes the
+// native model's single logit row scores the second label and the first
+// label's table is empty: PMML's logit normalization gives the last table
+// the remaining probability.
+func logisticRegression(m *model.LogisticRegression, features []string, schema MiningSchema) *RegressionModel {
+	r := &RegressionModel{
+		FunctionName:        "classification",
+		NormalizationMethod: "softmax",
+		MiningSchema:        schema,
+		Output:              probabilities(m.Labels),
+	}
+	if len(m.Coef) == 1 {
+		r.NormalizationMethod = "logit"
+		r.Tables = []RegressionTable{
+			table(m.Intercept[0], label(m.Labels[1]), features, m.Coef[0]),
+			{TargetCategory: label(m.Labels[0])},
+		}
+		return r
+	}
+	for k, l := range m.Labels {
+		r.Tables = append(r.Tables, table(m.Intercept[k], label(l), features, m.Coef[k]))
+	}
+	return r
+}
+
+// gradientBoosting sums the trees in a MiningModel whose Targets element
+// applies the learning rate and initial score. A classifier chains that
+// sum, exposed as the decisionFunction output, into a logit regression
+// over the two labels.
+func gradientBoosting(m *model.GradientBoosting, features []string, schema MiningSchema) *MiningModel {
+	target := schema.Fields[len(schema.Fields)-1]
+	sum := &MiningModel{
+		FunctionName: "regression",
+		MiningSchema: schema,
+		Targets:      &Targets{Targets: []Target{{RescaleFactor: m.LearningRate, RescaleConstant: m.Init}}},
+		Segmentation: &Segmentation{MultipleModelMethod: "sum"},
+	}
+	for i, t := range m.Trees {
+		sum.Segmentation.Segments = append(sum.Segmentation.Segments, Segment{
+			ID:   strconv.Itoa(i + 1),
+			True: &True{},
+			TreeModel: &TreeModel{
+				FunctionName:        "regression",
+				SplitCharacteristic: "binarySplit",
+				MiningSchema:        activeSchema(features),
+				Node:                treeNode(t, 0, features, Node{True: &True{}}),
+			},
+		})
+	}
+	if m.Loss != "log" {
+		sum.Targets.Targets[0].Field = target.Name
+		return sum
+	}
+
+	sum.MiningSchema = activeSchema(features)
+	sum.Output = &Output{Fields: []OutputField{{
+		Name: "decisionFunction", Optype: "continuous", DataType: "double",
+		Feature: "predictedValue", IsFinalResult: "false",
+	}}}
+	return &MiningModel{
+		FunctionName: "classification",
+		MiningSchema: schema,
+		Output:       probabilities(m.Labels),
+		Segmentation: &Segmentation{
+			MultipleModelMethod: "modelChain",
+			Segments: []Segment{
+				{ID: "1", True: &True{}, MiningModel: sum},
+				{ID: "2", True: &True{}, RegressionModel: &RegressionModel{
+					FunctionName:        "classification",
+					NormalizationMethod: "logit",
+					MiningSchema:        MiningSchema{Fields: []MiningField{{Name: "decisionFunction"}, target}},
+					Tables: []RegressionTable{
+						table(0, label(m.Labels[1]), []string{"decisionFunction"}, []float64{1}),
+						{TargetCategory: label(m.Labels[0])},
+					},
+				}},
+			},
+		},
+	}
+}
+
+// treeNode converts node id of t and its subtree into n, which already
+// holds the predicate that leads to it.
+func treeNode(t *model.Tree, id int, features []string, n Node) Node {
+	tn := t.Nodes[id]
+	if tn.Feature < 0 {
+		score := tn.Value
+		n.Score = &score
+		return n
+	}
+	field := features[tn.Feature]
+	n.Nodes = []Node{
+		treeNode(t, tn.Left, features, Node{SimplePredicate: &SimplePredicate{Field: field, Operator: "lessOrEqual", Value: tn.Threshold}}),
+		treeNode(t, tn.Right, features, Node{SimplePredicate: &SimplePredicate{Field: field, Operator: "greaterThan", Value: tn.Threshold}}),
+	}
+	return n
+}
+
+func table(intercept float64, category string, features []string, coef []float64) RegressionTable {
+	t := RegressionTable{Intercept: intercept, TargetCategory: category}
+	for j, f := range features {
+		t.Predictors = append(t.Predictors, NumericPredictor{Name: f, Coefficient: coef[j]})
+	}
+	return t
+}
+
+// probabilities declares one probability output per class label.
+func probabilities(labels []float64) *Output {
+	out := &Output{}
+	for _, l := range labels {
+		out.Fields = append(out.Fields, OutputField{
+			Name: "probability(" + label(l) + ")", Optype: "continuous", DataType: "double",
+			Feature: "probability", Value: label(l),
+		})
+	}
+	return out
+}
+
+func label(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+func distinctStrings(values []string) []string {
+	seen := map[string]bool{}
+	var out []string
+	for _, v := range values {
+		if v != "" && !seen[v] {
+			seen[v] = true
+			out = append(out, v)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
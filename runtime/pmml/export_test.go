@@ -0,0 +1,448 @@
+package pmml
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"mlite/dataset"
+	"mlite/internal/modeltest"
+	"mlite/model"
+)
+
+// exportPMML trains spec on the shared data, writes it as PMML with that
+// data's dictionary and parses the file, returning the raw XML as well.
+func exportPMML(t *testing.T, spec model.Spec, target string) (*model.Estimator, *PMML, []byte) {
+	t.Helper()
+	est, d := modeltest.Train(t, spec, target)
+	path := filepath.Join(t.TempDir(), "m.pmml")
+	if err := WriteFile(est, d, path); err != nil {
+		t.Fatal(err)
+	}
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var doc PMML
+	if err := xml.Unmarshal(raw, &doc); err != nil {
+		t.Fatal(err)
+	}
+	return est, &doc, raw
+}
+
+// Checks that the data dictionary declares every dataset column from its
+// type, with a classifier's target as categorical over its labels.
+func TestExportDataDictionary(t *testing.T) {
+	_, doc, _ := exportPMML(t, model.Spec{Type: "gbm_classifier", Params: model.Params{"n_estimators": 3.0}}, "label")
+	dict := doc.DataDictionary
+	if dict.NumberOfFields != 5 || len(dict.Fields) != 5 {
+		t.Fatalf("got %d fields (numberOfFields=%d), want 5", len(dict.Fields), dict.NumberOfFields)
+	}
+	want := map[string]string{
+		"x1":    "continuous double []",
+		"city":  "categorical string [austin dallas waco]",
+		"label": "categorical integer [0 1]",
+	}
+	for _, f := range dict.Fields {
+		var values []string
+		for _, v := range f.Values {
+			values = append(values, v.Value)
+		}
+		got := f.Optype + " " + f.DataType + " " + "[" + strings.Join(values, " ") + "]"
+		if w, ok := want[f.Name]; ok && got != w {
+			t.Errorf("%s: got %s, want %s", f.Name, got, w)
+		}
+	}
+}
+
+// exportCases are the supported model types, each with the column it
+// predicts.
+var exportCases = []struct {
+	spec   model.Spec
+	target string
+}{
+	{model.Spec{Type: "linear_regression", Params: model.Params{"alpha": 0.5}}, "y"},
+	{model.Spec{Type: "logistic_regression"}, "label"},
+	{model.Spec{Type: "gbm_regressor", Params: model.Params{"n_estimators": 10.0}}, "y"},
+	{model.Spec{Type: "gbm_classifier", Params: model.Params{"n_estimators": 10.0}}, "label"},
+}
+
+// Checks that every supported model type produces a document that satisfies
+// the PMML 4.4 schema rules for the elements MLite writes, and that scoring
+// the decoded document reproduces the native predictions.
+func TestExportValidatesAndScores(t *testing.T) {
+	d := modeltest.Data()
+	X, _ := d.Matrix(modeltest.Features)
+	for _, c := range exportCases {
+		est, doc, raw := exportPMML(t, c.spec, c.target)
+		validate(t, c.spec.Type, doc, raw)
+
+		want, _ := est.Model.Predict(X)
+		for i, row := range X {
+			record := map[string]float64{"x1": row[0], "x2": row[1]}
+			var got result
+			var err error
+			if doc.RegressionModel != nil {
+				got = scoreRegression(doc.RegressionModel, record)
+			} else {
+				got, err = scoreMining(doc.MiningModel, record)
+			}
+			if err != nil {
+				t.Errorf("%s row %d: %v", c.spec.Type, i, err)
+			} else if math.Abs(got.prediction()-want[i]) > 1e-9*math.Max(1, math.Abs(want[i])) {
+				t.Errorf("%s row %d: PMML scores %v, native %v", c.spec.Type, i, got.prediction(), want[i])
+			}
+		}
+	}
+}
+
+// Checks that every exported document is valid against the PMML 4.4
+// schema for the elements MLite writes, vendored in testdata, as xmllint
+// sees it. The test is skipped where xmllint is not installed.
+func TestExportMatchesSchema(t *testing.T) {
+	xmllint, err := exec.LookPath("xmllint")
+	if err != nil {
+		t.Skip("xmllint not installed")
+	}
+	for _, c := range exportCases {
+		_, _, raw := exportPMML(t, c.spec, c.target)
+		path := filepath.Join(t.TempDir(), c.spec.Type+".pmml")
+		if err := os.WriteFile(path, raw, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		out, err := exec.Command(xmllint, "--noout", "--schema", filepath.Join("testdata", "pmml-4-4-subset.xsd"), path).CombinedOutput()
+		if err != nil {
+			t.Errorf("%s: %v\n%s", c.spec.Type, err, out)
+		}
+	}
+}
+
+// Checks that scoring a tree stops with an error when no child's predicate
+// holds, as for a missing value.
+func TestScoreTreeWithoutMatchingChild(t *testing.T) {
+	leaf := 1.0
+	tree := Node{True: &True{}, Nodes: []Node{
+		{Score: &leaf, SimplePredicate: &SimplePredicate{Field: "x1", Operator: "lessOrEqual", Value: 5}},
+		{Score: &leaf, SimplePredicate: &SimplePredicate{Field: "x1", Operator: "greaterThan", Value: 5}},
+	}}
+	if _, err := scoreTree(tree, map[string]float64{"x1": math.NaN()}); err == nil {
+		t.Error("expected an error for a record no child matches")
+	}
+}
+
+// Checks that the MLP, untrained models and data without the features are
+// rejected.
+func TestExportErrors(t *testing.T) {
+	d := modeltest.Data()
+	mlp, _ := model.NewEstimator(model.Spec{Type: "mlp", Params: model.Params{"epochs": 1.0}})
+	if _, err := Export(mlp, d); err == nil {
+		t.Error("expected an error for an untrained model")
+	}
+	mlp.Fit(d, []string{"x1"}, "y")
+	if _, err := Export(mlp, d); err == nil {
+		t.Error("expected an error for an mlp")
+	}
+
+	lin, _ := model.NewEstimator(model.Spec{Type: "linear_regression"})
+	lin.Fit(d, []string{"x1"}, "y")
+	other, _ := dataset.New(dataset.NewNumeric("z", []float64{1}))
+	if _, err := Export(lin, other); err == nil {
+		t.Error("expected an error for data missing the feature column")
+	}
+}
+
+// childOrder lists, for each element MLite writes, the children it may have
+// in the order the PMML 4.4 schema's xs:sequence requires.
+var childOrder = map[string][]string{
+	"PMML":            {"Header", "DataDictionary", "RegressionModel", "MiningModel"},
+	"Header":          {"Application", "Timestamp"},
+	"DataDictionary":  {"DataField"},
+	"DataField":       {"Value"},
+	"RegressionModel": {"MiningSchema", "Output", "Targets", "RegressionTable"},
+	"RegressionTable": {"NumericPredictor"},
+	"MiningModel":     {"MiningSchema", "Output", "Targets", "Segmentation"},
+	"Segmentation":    {"Segment"},
+	"Segment":         {"True", "RegressionModel", "TreeModel", "MiningModel"},
+	"TreeModel":       {"MiningSchema", "Node"},
+	"Node":            {"True", "SimplePredicate", "Node"},
+	"MiningSchema":    {"MiningField"},
+	"Output":          {"OutputField"},
+	"Targets":         {"Target"},
+}
+
+// Enumerations from the schema for the attributes MLite writes.
+var enums = map[string][]string{
+	"optype":              {"categorical", "ordinal", "continuous"},
+	"dataType":            {"string", "integer", "float", "double", "boolean"},
+	"usageType":           {"active", "predicted", "target", "supplementary", "group", "order", "frequencyWeight", "analysisWeight"},
+	"functionName":        {"associationRules", "sequences", "classification", "regression", "clustering", "timeSeries", "mixed"},
+	"normalizationMethod": {"none", "simplemax", "softmax", "logit", "probit", "cloglog", "exp", "loglog", "cauchit"},
+	"multipleModelMethod": {"majorityVote", "weightedMajorityVote", "average", "weightedAverage", "median", "weightedMedian", "max", "sum", "weightedSum", "selectFirst", "selectAll", "modelChain"},
+	"splitCharacteristic": {"binarySplit", "multiSplit"},
+	"operator":            {"equal", "notEqual", "lessThan", "lessOrEqual", "greaterThan", "greaterOrEqual", "isMissing", "isNotMissing"},
+	"feature":             {"predictedValue", "predictedDisplayValue", "transformedValue", "decision", "probability", "affinity", "residual", "standardError", "standardDeviation", "clusterId", "clusterAffinity", "entityId", "entityAffinity", "warning", "ruleValue", "reasonCode", "antecedent", "consequent", "rule", "ruleId", "confidence", "support", "lift", "leverage"},
+}
+
+// validate checks doc against the PMML 4.4 schema rules that apply to the
+// elements MLite writes: namespace and version, child element order,
+// attribute enumerations, and that every field reference resolves.
+func validate(t *testing.T, name string, doc *PMML, raw []byte) {
+	t.Helper()
+	if doc.XMLName.Space != Namespace || doc.Version != "4.4" {
+		t.Errorf("%s: root is %v version %q", name, doc.XMLName, doc.Version)
+	}
+	if (doc.RegressionModel == nil) == (doc.MiningModel == nil) {
+		t.Errorf("%s: want exactly one model element", name)
+	}
+
+	// Element order and enumerations, from the raw token stream.
+	dec := xml.NewDecoder(bytes.NewReader(raw))
+	type open struct {
+		name string
+		last int
+	}
+	var stack []open
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			break
+		}
+		switch tok := tok.(type) {
+		case xml.StartElement:
+			if n := len(stack); n > 0 {
+				parent := &stack[n-1]
+				pos := indexOf(childOrder[parent.name], tok.Name.Local)
+				if pos < 0 || pos < parent.last {
+					t.Errorf("%s: <%s> may not appear there in <%s>", name, tok.Name.Local, parent.name)
+				}
+				parent.last = pos
+			}
+			for _, a := range tok.Attr {
+				if allowed, ok := enums[a.Name.Local]; ok && indexOf(allowed, a.Value) < 0 {
+					t.Errorf("%s: <%s %s=%q> is not in the schema's enumeration", name, tok.Name.Local, a.Name.Local, a.Value)
+				}
+			}
+			stack = append(stack, open{name: tok.Name.Local})
+		case xml.EndElement:
+			stack = stack[:len(stack)-1]
+		}
+	}
+
+	// Field references.
+	fields := map[string]bool{}
+	for _, f := range doc.DataDictionary.Fields {
+		if fields[f.Name] {
+			t.Errorf("%s: field %s declared twice", name, f.Name)
+		}
+		fields[f.Name] = true
+	}
+	if doc.DataDictionary.NumberOfFields != len(doc.DataDictionary.Fields) {
+		t.Errorf("%s: numberOfFields=%d for %d fields", name, doc.DataDictionary.NumberOfFields, len(doc.DataDictionary.Fields))
+	}
+	if doc.RegressionModel != nil {
+		checkRegression(t, name, doc.RegressionModel, fields)
+	} else {
+		checkMining(t, name, doc.MiningModel, fields)
+	}
+}
+
+// checkSchema checks that a mining schema only names known fields and
+// returns the fields visible inside the model.
+func checkSchema(t *testing.T, name string, s MiningSchema, known map[string]bool) map[string]bool {
+	visible := map[string]bool{}
+	for _, f := range s.Fields {
+		if !known[f.Name] {
+			t.Errorf("%s: MiningField %s is not a declared field", name, f.Name)
+		}
+		visible[f.Name] = true
+	}
+	return visible
+}
+
+func checkRegression(t *testing.T, name string, r *RegressionModel, known map[string]bool) {
+	visible := checkSchema(t, name, r.MiningSchema, known)
+	if len(r.Tables) == 0 {
+		t.Errorf("%s: RegressionModel needs at least one RegressionTable", name)
+	}
+	for _, table := range r.Tables {
+		for _, p := range table.Predictors {
+			if !visible[p.Name] {
+				t.Errorf("%s: NumericPredictor %s is not in the mining schema", name, p.Name)
+			}
+		}
+	}
+}
+
+func checkMining(t *testing.T, name string, m *MiningModel, known map[string]bool) {
+	visible := checkSchema(t, name, m.MiningSchema, known)
+	// In a model chain, a segment's outputs are fields for the segments after it.
+	chained := map[string]bool{}
+	for f := range known {
+		chained[f] = true
+	}
+	for _, s := range m.Segmentation.Segments {
+		if s.True == nil {
+			t.Errorf("%s: segment %s has no predicate", name, s.ID)
+		}
+		switch {
+		case s.RegressionModel != nil:
+			checkRegression(t, name, s.RegressionModel, chained)
+		case s.MiningModel != nil:
+			checkMining(t, name, s.MiningModel, chained)
+			if s.MiningModel.Output != nil {
+				for _, o := range s.MiningModel.Output.Fields {
+					chained[o.Name] = true
+				}
+			}
+		case s.TreeModel != nil:
+			checkTree(t, name, s.TreeModel.Node, checkSchema(t, name, s.TreeModel.MiningSchema, visible), true)
+		default:
+			t.Errorf("%s: segment %s has no model", name, s.ID)
+		}
+	}
+}
+
+func checkTree(t *testing.T, name string, n Node, visible map[string]bool, root bool) {
+	if (n.True == nil) == (n.SimplePredicate == nil) {
+		t.Errorf("%s: tree node needs exactly one predicate", name)
+	}
+	if root && n.True == nil {
+		t.Errorf("%s: tree root should be selected by True", name)
+	}
+	if n.SimplePredicate != nil && !visible[n.SimplePredicate.Field] {
+		t.Errorf("%s: split on %s, which is not in the mining schema", name, n.SimplePredicate.Field)
+	}
+	if len(n.Nodes) == 0 && n.Score == nil {
+		t.Errorf("%s: leaf without a score", name)
+	}
+	for _, c := range n.Nodes {
+		checkTree(t, name, c, visible, false)
+	}
+}
+
+// result is a scored record: a value, or probabilities by category.
+type result struct {
+	value float64
+	proba map[string]float64
+}
+
+// prediction returns the value, or the most probable category as a number.
+func (r result) prediction() float64 {
+	if r.proba == nil {
+		return r.value
+	}
+	best, bestP := "", -1.0
+	for c, p := range r.proba {
+		if p > bestP || (p == bestP && c < best) {
+			best, bestP = c, p
+		}
+	}
+	v, _ := strconv.ParseFloat(best, 64)
+	return v
+}
+
+// scoreRegression evaluates a RegressionModel as a PMML consumer would.
+func scoreRegression(r *RegressionModel, record map[string]float64) result {
+	ys := make([]float64, len(r.Tables))
+	for k, table := range r.Tables {
+		ys[k] = table.Intercept
+		for _, p := range table.Predictors {
+			ys[k] += p.Coefficient * record[p.Name]
+		}
+	}
+	if r.FunctionName == "regression" {
+		return result{value: ys[0]}
+	}
+	proba := map[string]float64{}
+	switch r.NormalizationMethod {
+	case "logit":
+		// Every table but the last is a sigmoid; the last takes the rest.
+		rest := 1.0
+		for k, table := range r.Tables[:len(r.Tables)-1] {
+			p := 1 / (1 + math.Exp(-ys[k]))
+			proba[table.TargetCategory] = p
+			rest -= p
+		}
+		proba[r.Tables[len(r.Tables)-1].TargetCategory] = rest
+	case "softmax":
+		sum := 0.0
+		for _, y := range ys {
+			sum += math.Exp(y)
+		}
+		for k, table := range r.Tables {
+			proba[table.TargetCategory] = math.Exp(ys[k]) / sum
+		}
+	}
+	return result{proba: proba}
+}
+
+// scoreMining evaluates a MiningModel with sum or modelChain segmentation.
+func scoreMining(m *MiningModel, record map[string]float64) (result, error) {
+	var out result
+	for _, s := range m.Segmentation.Segments {
+		var r result
+		var err error
+		switch {
+		case s.TreeModel != nil:
+			r.value, err = scoreTree(s.TreeModel.Node, record)
+		case s.RegressionModel != nil:
+			r = scoreRegression(s.RegressionModel, record)
+		case s.MiningModel != nil:
+			r, err = scoreMining(s.MiningModel, record)
+			if s.MiningModel.Output != nil {
+				for _, o := range s.MiningModel.Output.Fields {
+					record[o.Name] = r.value
+				}
+			}
+		}
+		if err != nil {
+			return result{}, fmt.Errorf("segment %s: %w", s.ID, err)
+		}
+		if m.Segmentation.MultipleModelMethod == "sum" {
+			out.value += r.value
+		} else {
+			out = r
+		}
+	}
+	if m.Targets != nil {
+		target := m.Targets.Targets[0]
+		out.value = out.value*target.RescaleFactor + target.RescaleConstant
+	}
+	return out, nil
+}
+
+// scoreTree follows the first child whose predicate holds down to a leaf.
+// A record no child matches, such as one with a NaN, has no score.
+func scoreTree(n Node, record map[string]float64) (float64, error) {
+	for len(n.Nodes) > 0 {
+		matched := false
+		for _, c := range n.Nodes {
+			p := c.SimplePredicate
+			x := record[p.Field]
+			if (p.Operator == "lessOrEqual" && x <= p.Value) || (p.Operator == "greaterThan" && x > p.Value) {
+				n, matched = c, true
+				break
+			}
+		}
+		if !matched {
+			return 0, fmt.Errorf("no child of the node matches %v", record)
+		}
+	}
+	return *n.Score, nil
+}
+
+func indexOf(list []string, s string) int {
+	for i, v := range list {
+		if v == s {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,158 @@
+// Package pmml exports trained MLite models as PMML 4.4 documents for
+// scoring engines that read the Predictive Model Markup Language.
+//
+// The types below mirror the subset of the PMML 4.4 schema that MLite
+// writes. Fields are declared in the element order the schema requires, so
+// encoding/xml produces valid documents, and the same types decode them.
+package pmml
+
+import "encoding/xml"
+
+// Namespace is the PMML 4.4 XML namespace.
+const Namespace = "http://www.dmg.org/PMML-4_4"
+
+// PMML is the document root. Exactly one model element is set.
+type PMML struct {
+	XMLName         xml.Name `xml:"http://www.dmg.org/PMML-4_4 PMML"`
+	Version         string   `xml:"version,attr"`
+	Header          Header
+	DataDictionary  DataDictionary
+	RegressionModel *RegressionModel
+	MiningModel     *MiningModel
+}
+
+type Header struct {
+	Description string `xml:"description,attr,omitempty"`
+	Application Application
+	Timestamp   string `xml:",omitempty"`
+}
+
+type Application struct {
+	Name    string `xml:"name,attr"`
+	Version string `xml:"version,attr,omitempty"`
+}
+
+// DataDictionary declares every field a model may read.
+type DataDictionary struct {
+	NumberOfFields int         `xml:"numberOfFields,attr"`
+	Fields         []DataField `xml:"DataField"`
+}
+
+// DataField is one input or target column. Categorical fields list their
+// valid values.
+type DataField struct {
+	Name     string  `xml:"name,attr"`
+	Optype   string  `xml:"optype,attr"`   // "continuous" or "categorical"
+	DataType string  `xml:"dataType,attr"` // "double", "integer" or "string"
+	Values   []Value `xml:"Value"`
+}
+
+type Value struct {
+	Value string `xml:"value,attr"`
+}
+
+// MiningSchema lists the fields a model uses and their role.
+type MiningSchema struct {
+	Fields []MiningField `xml:"MiningField"`
+}
+
+type MiningField struct {
+	Name      string `xml:"name,attr"`
+	UsageType string `xml:"usageType,attr,omitempty"` // "active" when empty, or "target"
+}
+
+// Output names values a model exposes besides its prediction.
+type Output struct {
+	Fields []OutputField `xml:"OutputField"`
+}
+
+type OutputField struct {
+	Name          string `xml:"name,attr"`
+	Optype        string `xml:"optype,attr"`
+	DataType      string `xml:"dataType,attr"`
+	Feature       string `xml:"feature,attr"` // e.g. "probability", "predictedValue"
+	Value         string `xml:"value,attr,omitempty"`
+	IsFinalResult string `xml:"isFinalResult,attr,omitempty"`
+}
+
+// Targets rescales a model's raw prediction: value·RescaleFactor + RescaleConstant.
+type Targets struct {
+	Targets []Target `xml:"Target"`
+}
+
+type Target struct {
+	Field           string  `xml:"field,attr,omitempty"`
+	RescaleFactor   float64 `xml:"rescaleFactor,attr"`
+	RescaleConstant float64 `xml:"rescaleConstant,attr"`
+}
+
+// RegressionModel is a linear model. Classification models have one table
+// per class and a normalizationMethod ("logit" or "softmax") that turns the
+// table values into probabilities.
+type RegressionModel struct {
+	FunctionName        string `xml:"functionName,attr"`
+	NormalizationMethod string `xml:"normalizationMethod,attr,omitempty"`
+	MiningSchema        MiningSchema
+	Output              *Output
+	Tables              []RegressionTable `xml:"RegressionTable"`
+}
+
+type RegressionTable struct {
+	Intercept      float64            `xml:"intercept,attr"`
+	TargetCategory string             `xml:"targetCategory,attr,omitempty"`
+	Predictors     []NumericPredictor `xml:"NumericPredictor"`
+}
+
+type NumericPredictor struct {
+	Name        string  `xml:"name,attr"`
+	Coefficient float64 `xml:"coefficient,attr"`
+}
+
+// MiningModel combines the models of its segments, e.g. by summing trees.
+type MiningModel struct {
+	FunctionName string `xml:"functionName,attr"`
+	MiningSchema MiningSchema
+	Output       *Output
+	Targets      *Targets
+	Segmentation *Segmentation
+}
+
+type Segmentation struct {
+	MultipleModelMethod string    `xml:"multipleModelMethod,attr"` // "sum" or "modelChain"
+	Segments            []Segment `xml:"Segment"`
+}
+
+// Segment holds one sub-model; MLite always selects it with True.
+type Segment struct {
+	ID              string `xml:"id,attr"`
+	True            *True
+	RegressionModel *RegressionModel
+	TreeModel       *TreeModel
+	MiningModel     *MiningModel
+}
+
+// TreeModel is a decision tree whose leaves hold scores.
+type TreeModel struct {
+	FunctionName        string `xml:"functionName,attr"`
+	SplitCharacteristic string `xml:"splitCharacteristic,attr"`
+	MiningSchema        MiningSchema
+	Node                Node
+}
+
+// Node is a tree node. It is reached when its predicate holds; leaves have
+// a Score.
+type Node struct {
+	Score           *float64 `xml:"score,attr"`
+	True            *True
+	SimplePredicate *SimplePredicate
+	Nodes           []Node `xml:"Node"`
+}
+
+// True is the predicate that always holds.
+type True struct{}
+
+type SimplePredicate struct {
+	Field    string  `xml:"field,attr"`
+	Operator string  `xml:"operator,attr"` // "lessOrEqual" or "greaterThan"
+	Value    float64 `xml:"value,attr"`
+}
@@ -0,0 +1,49 @@
+//go:build !server
+
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"mlite/dataset"
+	"os"
+)
+
+// runProfile implements "mlite profile [-json] data.csv": it prints the
+// describe() profile of a data file as a text table, or as the JSON the
+// workbench reads. The file may be in any format load() reads. It returns
+// the process exit code.
+func runProfile(args []string) int {
+	flags := flag.NewFlagSet("profile", flag.ContinueOnError)
+	asJSON := flags.Bool("json", false, "print the profile as JSON")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: mlite profile [-json] data.csv")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return 2
+	}
+
+	d, err := dataset.Load(flags.Arg(0), "")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "profile:", err)
+		return 1
+	}
+	profile := d.Describe()
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(profile); err != nil {
+			fmt.Fprintln(os.Stderr, "profile:", err)
+			return 1
+		}
+		return 0
+	}
+	fmt.Print(profile)
+	return 0
+}
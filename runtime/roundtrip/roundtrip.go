@@ -0,0 +1,130 @@
+// Package roundtrip runs MLite scripts through both backends, the
+// interpreter and the Python the transpiler writes, and compares what they
+// compute. The golden tests in this package keep, for each script in
+// testdata:
+//
+//	name.mlite   the script
+//	name.out     what the interpreter prints for it
+//	name.py      the Python the transpiler writes for it
+//	name.py.out  what that Python printed when it was last run
+//
+// The interpreter and the transpiler are checked against name.out and
+// name.py on every run. Running the Python needs pandas and scikit-learn,
+// so its output is recorded with -record-python and committed; the numbers
+// in it are then compared with the interpreter's on every run.
+package roundtrip
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"mlite/interpreter"
+	"mlite/lexer"
+	"mlite/parser"
+	"mlite/token"
+	"mlite/transpiler"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// parse lexes and parses MLite source. It panics on a syntax error, as
+// the parser does.
+func parse(source string) []parser.Node {
+	lex := lexer.NewLexer(source)
+	var tokens []token.Token
+	for {
+		tok := lex.NextToken()
+		tokens = append(tokens, tok)
+		if tok.Type == token.EOF {
+			break
+		}
+	}
+	return parser.NewParser(tokens).Parse()
+}
+
+// Interpret runs source through the interpreter and returns what it
+// printed and its results: the numbers its call statements computed, in
+// order. These are what the comparison looks at — metrics, mainly, which
+// both backends print as a bare number. Datasets and records are printed
+// differently by the two and are left to the golden files. If the script
+// fails, what it did up to the failure is returned with the error.
+func Interpret(source string) (output string, results []float64, err error) {
+	var printed strings.Builder
+	sink := &resultSink{text: interpreter.NewTextSink(&printed)}
+	defer func() {
+		output, results = printed.String(), sink.results
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%v", r)
+		}
+	}()
+	interpreter.NewInterpreter(sink).Run(parse(source))
+	return "", nil, nil
+}
+
+// resultSink prints a run's events and keeps the metrics computed by call
+// statements. An evaluate statement's report, with many metrics, is left
+// out.
+type resultSink struct {
+	text    *interpreter.TextSink
+	results []float64
+}
+
+func (s *resultSink) Emit(e interpreter.Event) {
+	s.text.Emit(e)
+	if score, ok := e.Metrics[e.Name]; ok && e.Type == interpreter.MetricComputed && len(e.Metrics) == 1 {
+		s.results = append(s.results, score)
+	}
+}
+
+// Transpile returns source as a Python module.
+func Transpile(source string) (code string, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%v", r)
+		}
+	}()
+	return transpiler.NewTranspiler().Transpile(parse(source)), nil
+}
+
+// RunPython runs a Python file with python, such as "python3", from the
+// current directory and returns what it printed. A failed run returns its
+// standard error in the error.
+func RunPython(python, path string) (string, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command(python, path)
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	if err := cmd.Run(); err != nil {
+		return stdout.String(), fmt.Errorf("%s %s: %v\n%s", python, path, err, stderr.String())
+	}
+	return stdout.String(), nil
+}
+
+// PythonResults returns the lines of the Python's output that are a single
+// number, in order. The transpiler prints a call statement's result with
+// print(), so these line up with the results Interpret returns.
+func PythonResults(output string) []float64 {
+	var results []float64
+	for _, line := range strings.Split(output, "\n") {
+		if f, err := strconv.ParseFloat(strings.TrimSpace(line), 64); err == nil {
+			results = append(results, f)
+		}
+	}
+	return results
+}
+
+// Compare reports the first result where the two backends differ by more
+// than tolerance, relative to the larger of the two (or absolutely, for
+// results below 1).
+func Compare(interpreted, python []float64, tolerance float64) error {
+	for i := range min(len(interpreted), len(python)) {
+		a, b := interpreted[i], python[i]
+		if math.Abs(a-b) > tolerance*max(1, math.Abs(a), math.Abs(b)) {
+			return fmt.Errorf("result %d: the interpreter computed %v, Python %v", i+1, a, b)
+		}
+	}
+	if len(interpreted) != len(python) {
+		return fmt.Errorf("the interpreter printed %d results, Python %d", len(interpreted), len(python))
+	}
+	return nil
+}
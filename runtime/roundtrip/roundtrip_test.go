@@ -0,0 +1,127 @@
+package roundtrip
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var (
+	update       = flag.Bool("update", false, "rewrite the .out and .py golden files")
+	recordPython = flag.Bool("record-python", false, "run each golden .py with -python and record its output in .py.out")
+	python       = flag.String("python", "python3", "the Python that -record-python runs")
+)
+
+// tolerance allows for the interpreter printing six significant digits.
+const tolerance = 1e-5
+
+// scripts returns the golden scripts in testdata, without their extension.
+func scripts(t *testing.T) []string {
+	t.Helper()
+	paths, err := filepath.Glob(filepath.Join("testdata", "*.mlite"))
+	if err != nil || len(paths) == 0 {
+		t.Fatalf("no golden scripts in testdata (%v)", err)
+	}
+	for i, path := range paths {
+		paths[i] = strings.TrimSuffix(path, ".mlite")
+	}
+	return paths
+}
+
+// golden compares got with the file at path, or rewrites the file with
+// -update.
+func golden(t *testing.T, path, got string) {
+	t.Helper()
+	if *update {
+		if err := os.WriteFile(path, []byte(got), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("%v (run go test ./roundtrip -update to create it)", err)
+	}
+	if got != string(want) {
+		t.Errorf("%s is out of date (run go test ./roundtrip -update if the change is intended)\ngot:\n%s\nwant:\n%s", path, got, want)
+	}
+}
+
+// Checks each golden script against what the interpreter printed and the
+// Python the transpiler wrote for it, and — where a run of that Python has
+// been recorded — that both backends computed the same results.
+func TestGolden(t *testing.T) {
+	for _, base := range scripts(t) {
+		t.Run(filepath.Base(base), func(t *testing.T) {
+			source, err := os.ReadFile(base + ".mlite")
+			if err != nil {
+				t.Fatal(err)
+			}
+			output, results, err := Interpret(string(source))
+			if err != nil {
+				t.Fatalf("interpreter: %v\noutput:\n%s", err, output)
+			}
+			golden(t, base+".out", output)
+
+			code, err := Transpile(string(source))
+			if err != nil {
+				t.Fatalf("transpiler: %v", err)
+			}
+			golden(t, base+".py", code)
+
+			if *recordPython {
+				recorded, err := RunPython(*python, base+".py")
+				if err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(base+".py.out", []byte(recorded), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			recorded, err := os.ReadFile(base + ".py.out")
+			if errors.Is(err, os.ErrNotExist) {
+				t.Skipf("no recorded Python output (run go test ./roundtrip -record-python with pandas and scikit-learn installed)")
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := Compare(results, PythonResults(string(recorded)), tolerance); err != nil {
+				t.Errorf("the backends disagree: %v\ninterpreter:\n%s\nPython:\n%s", err, output, recorded)
+			}
+		})
+	}
+}
+
+// Checks that the interpreter's results are the metrics its call
+// statements computed, that Python's are its bare numbers, and that a drift
+// beyond the tolerance or a missing result is reported.
+func TestCompareResults(t *testing.T) {
+	_, interpreted, err := Interpret(`
+		load("testdata/housing.csv")
+		let m :: linear_regression();
+		train(m, [sqft], price)
+		evaluate(m)
+		r2(m, df)
+		accuracy([1, 0, 1, 1], [1, 0, 0, 1])
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(interpreted) != 2 || interpreted[1] != 0.75 {
+		t.Fatalf("interpreter results %v, want r2 and 0.75", interpreted)
+	}
+	python := PythonResults(fmt.Sprintf("   sqft  price\n0  1200  18000\n%.12f\n0.75\n", interpreted[0]))
+	if err := Compare(interpreted, python, tolerance); err != nil {
+		t.Errorf("equal results reported as different: %v", err)
+	}
+	if err := Compare(interpreted, []float64{interpreted[0], 0.7}, tolerance); err == nil || !strings.Contains(err.Error(), "result 2") {
+		t.Errorf("drift in result 2 reported as %v", err)
+	}
+	if err := Compare(interpreted, interpreted[:1], tolerance); err == nil {
+		t.Error("a missing Python result was not reported")
+	}
+}
@@ -0,0 +1,16 @@
+import pandas as pd
+from sklearn.linear_model import LinearRegression
+from sklearn.metrics import mean_absolute_error
+from sklearn.metrics import r2_score
+
+df = pd.read_csv("testdata/housing.csv")
+rounds = 3
+total = 0
+for i in range(rounds):
+    total = total + 2 * rounds
+m = LinearRegression()
+m.fit(df[["sqft"]], df["price"])
+if total > 10:
+    print(r2_score(df["price"], m.predict(df[["sqft"]])))
+if total < 10:
+    print(mean_absolute_error(df["price"], m.predict(df[["sqft"]])))
@@ -0,0 +1,27 @@
+import pandas as pd
+from sklearn.linear_model import LinearRegression
+from sklearn.metrics import mean_squared_error
+from sklearn.metrics import r2_score
+from sklearn.preprocessing import OneHotEncoder
+
+
+def one_hot(data, column):
+    encoder = OneHotEncoder(handle_unknown="ignore", sparse_output=False).fit(data[[column]].dropna())
+
+    def step(data):
+        encoded = pd.DataFrame(encoder.transform(data[[column]]), columns=encoder.get_feature_names_out(), index=data.index)
+        at = data.columns.get_loc(column)
+        return pd.concat([data.iloc[:, :at], encoded, data.iloc[:, at + 1:]], axis=1)
+    step.columns = list(encoder.get_feature_names_out())
+    return step
+
+
+# City is one-hot encoded in place and named as one feature, which both
+# backends expand to the columns the encoding wrote
+df = pd.read_csv("testdata/homes.csv")
+step_1 = one_hot(df, "city")
+df = step_1(df)
+m = LinearRegression()
+m.fit(df[["sqft", *step_1.columns]], df["price"])
+print(mean_squared_error(df["price"], m.predict(df[["sqft", *step_1.columns]])) ** 0.5)
+print(r2_score(df["price"], m.predict(df[["sqft", *step_1.columns]])))
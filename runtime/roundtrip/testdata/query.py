@@ -0,0 +1,8 @@
+import pandas as pd
+
+df = pd.read_csv("testdata/housing.csv")
+big = df[(df["sqft"] > 2000) & (df["age"] < 8)]
+priced = big.assign(ppsf=big["price"] / big["sqft"])
+print(priced.sort_values(["ppsf"], ascending=False, kind="stable"))
+groups = df.groupby(["bedrooms"], dropna=False)
+print(groups.agg(mean_price=("price", "mean"), count=("bedrooms", "size")).reset_index())
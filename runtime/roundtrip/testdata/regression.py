@@ -0,0 +1,13 @@
+import pandas as pd
+from sklearn.linear_model import LinearRegression
+from sklearn.metrics import mean_absolute_error
+from sklearn.metrics import mean_squared_error
+from sklearn.metrics import r2_score
+
+# A linear fit on every row, so both backends train on the same data
+df = pd.read_csv("testdata/housing.csv")
+m = LinearRegression()
+m.fit(df[["sqft", "bedrooms", "age"]], df["price"])
+print(mean_squared_error(df["price"], m.predict(df[["sqft", "bedrooms", "age"]])) ** 0.5)
+print(mean_absolute_error(df["price"], m.predict(df[["sqft", "bedrooms", "age"]])))
+print(r2_score(df["price"], m.predict(df[["sqft", "bedrooms", "age"]])))
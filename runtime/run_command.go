@@ -0,0 +1,115 @@
+//go:build !server
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"math"
+	"mlite/interpreter"
+	"mlite/lexer"
+	"mlite/parser"
+	"mlite/token"
+	"mlite/trace"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// runScript implements "mlite run [-trace trace.json] [-memory 512MiB]
+// script.mlite": it runs a script with the interpreter and, with -trace,
+// records the run for the workbench debugger. A run that fails still
+// writes its trace, up to the failing statement. With -memory, CSV and
+// TSV files larger than the budget are streamed rather than loaded. It
+// returns the process exit code.
+func runScript(args []string) int {
+	flags := flag.NewFlagSet("run", flag.ContinueOnError)
+	tracePath := flags.String("trace", "", "write a trace of the run to this file, e.g. trace.json")
+	var memory byteSize
+	flags.Var(&memory, "memory", "memory budget for loaded data, a `size` such as 512MiB; larger CSV and TSV files are streamed (default: load every file whole)")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: mlite run [-trace trace.json] [-memory 512MiB] script.mlite")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return 2
+	}
+
+	source, err := os.ReadFile(flags.Arg(0))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "run:", err)
+		return 1
+	}
+	var events interpreter.EventSink = interpreter.NewTextSink(os.Stdout)
+	var recorder *interpreter.TraceRecorder
+	if *tracePath != "" {
+		recorder = interpreter.NewTraceRecorder(filepath.Base(flags.Arg(0)))
+		events = interpreter.MultiSink(events, recorder)
+	}
+
+	code := 0
+	if err := run(string(source), events, int64(memory)); err != nil {
+		fmt.Fprintln(os.Stderr, "run:", err)
+		code = 1
+	}
+	if recorder != nil {
+		if err := trace.Write(*tracePath, recorder.Trace()); err != nil {
+			fmt.Fprintln(os.Stderr, "run:", err)
+			return 1
+		}
+	}
+	return code
+}
+
+// run lexes, parses and interprets source within a memory budget in bytes
+// (0 for none), turning the panics the three stages signal errors with
+// into an error.
+func run(source string, events interpreter.EventSink, memory int64) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%v", r)
+		}
+	}()
+	lex := lexer.NewLexer(source)
+	var tokens []token.Token
+	for {
+		tok := lex.NextToken()
+		tokens = append(tokens, tok)
+		if tok.Type == token.EOF {
+			break
+		}
+	}
+	interp := interpreter.NewInterpreter(events)
+	interp.SetMemoryBudget(memory)
+	interp.Run(parser.NewParser(tokens).Parse())
+	return nil
+}
+
+// byteSize is a flag value for a size in bytes, given as a number with an
+// optional binary unit: 1048576, 512KiB, 64MiB or 2GiB.
+type byteSize int64
+
+func (b *byteSize) String() string {
+	return strconv.FormatInt(int64(*b), 10)
+}
+
+func (b *byteSize) Set(s string) error {
+	number, multiplier := s, int64(1)
+	for j, unit := range []string{"KiB", "MiB", "GiB", "TiB"} {
+		if strings.HasSuffix(s, unit) {
+			number, multiplier = strings.TrimSuffix(s, unit), int64(1)<<(10*(j+1))
+			break
+		}
+	}
+	n, err := strconv.ParseInt(strings.TrimSpace(number), 10, 64)
+	if err != nil || n < 0 || n > math.MaxInt64/multiplier {
+		return fmt.Errorf("invalid size %q: want a number of bytes, optionally with KiB, MiB, GiB or TiB", s)
+	}
+	*b = byteSize(n * multiplier)
+	return nil
+}
@@ -6,25 +6,39 @@ package main
 import (
 	"encoding/json"
 	"fmt"
+	"mlite/dataset"
 	"mlite/lexer"
 	"mlite/parser"
 	"mlite/token"
 	"mlite/transpiler"
 	"net/http"
+	"strings"
 )
 
 // Request is the JSON body the workbench sends us.
 // The Code field contains raw MLite source code.
+// Module asks for a runnable script with argparse flags and a
+// requirements.txt instead of flat statements.
+// Target picks the language: "python" (the default), "r" or "ipynb".
 type Request struct {
-	Code string `json:"code"`
+	Code   string `json:"code"`
+	Module bool   `json:"module,omitempty"`
+	Target string `json:"target,omitempty"`
 }
 
 // Response is what we send back.
-// On success: Python is populated.
-// On failure: Error is populated and Python is empty.
+// On success: the field of the requested target is populated.
+// On failure: Error is populated and the others are empty.
 type Response struct {
-	Python string `json:"python,omitempty"`
-	Error  string `json:"error,omitempty"`
+	Python       string `json:"python,omitempty"`
+	R            string `json:"r,omitempty"`
+	Notebook     string `json:"notebook,omitempty"`     // nbformat 4 JSON
+	Requirements string `json:"requirements,omitempty"` // only for a module
+	Error        string `json:"error,omitempty"`
+
+	// SourceMap maps each line of Python back to the MLite statement it
+	// came from; see transpiler.SourceMap.
+	SourceMap *transpiler.SourceMap `json:"sourceMap,omitempty"`
 }
 
 // handleTranspile is the core endpoint.
@@ -46,6 +60,18 @@ func handleTranspile(w http.ResponseWriter, r *http.Request) {
 		writeError(w, "code field is empty", http.StatusBadRequest)
 		return
 	}
+	if req.Target == "" {
+		req.Target = "python"
+	}
+	backend, err := transpiler.NewBackend(req.Target)
+	if err != nil {
+		writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.Module && req.Target != "python" {
+		writeError(w, "module is only available for the python target", http.StatusBadRequest)
+		return
+	}
 
 	// Step 2: Lex — turn the MLite source string into a token slice.
 	// The lexer produces one token at a time, so we loop until EOF.
@@ -79,8 +105,8 @@ func handleTranspile(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Step 4: Transpile — walk the AST and emit Python source code.
-	var pythonCode string
+	// Step 4: Transpile — walk the AST and emit code in the target language.
+	var response Response
 	var transpileErr string
 	func() {
 		defer func() {
@@ -88,8 +114,21 @@ func handleTranspile(w http.ResponseWriter, r *http.Request) {
 				transpileErr = fmt.Sprintf("transpile error: %v", r)
 			}
 		}()
-		t := transpiler.NewTranspiler()
-		pythonCode = t.Transpile(nodes)
+		switch b := backend.(type) {
+		case *transpiler.Transpiler:
+			if req.Module {
+				module := b.TranspileModule(nodes)
+				response = Response{Python: module.Script, Requirements: module.Requirements}
+			} else {
+				response = Response{Python: b.Transpile(nodes)}
+			}
+			sourceMap := b.SourceMap()
+			response.SourceMap = &sourceMap
+		case *transpiler.RTranspiler:
+			response = Response{R: b.Transpile(nodes)}
+		default:
+			response = Response{Notebook: backend.Transpile(nodes)}
+		}
 	}()
 
 	if transpileErr != "" {
@@ -97,9 +136,9 @@ func handleTranspile(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Step 5: return the Python source as JSON
+	// Step 5: return the generated source as JSON
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(Response{Python: pythonCode})
+	json.NewEncoder(w).Encode(response)
 }
 
 // writeError sends a JSON error response with the given HTTP status code.
@@ -125,6 +164,32 @@ func enableCors(next http.Handler) http.Handler {
 	})
 }
 
+// ProfileRequest is the body of POST /profile: the contents of a CSV file.
+type ProfileRequest struct {
+	CSV string `json:"csv"`
+}
+
+// handleProfile returns the describe() profile of a CSV file as JSON, the
+// same document "mlite profile -json" prints.
+func handleProfile(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var req ProfileRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, "invalid request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	d, err := dataset.ReadCSV(strings.NewReader(req.CSV))
+	if err != nil {
+		writeError(w, "invalid csv: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(d.Describe())
+}
+
 // handleHealth responds to GET /health so the UI can poll server status.
 func handleHealth(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
@@ -135,6 +200,7 @@ func handleHealth(w http.ResponseWriter, r *http.Request) {
 func main() {
 	mux := http.NewServeMux()
 	mux.HandleFunc("/transpile", handleTranspile)
+	mux.HandleFunc("/profile", handleProfile)
 	mux.HandleFunc("/health", handleHealth)
 	// Catch-all: any unknown route still gets CORS headers so the browser
 	// doesn't report a misleading "CORS header missing" error on 404s.
@@ -143,7 +209,8 @@ func main() {
 	})
 
 	fmt.Println("MLite server running on http://localhost:8081")
-	fmt.Println("POST /transpile  — send MLite code, receive Python")
+	fmt.Println("POST /transpile  — send MLite code, receive Python, R or a notebook")
+	fmt.Println("POST /profile    — send CSV contents, receive a column profile")
 	fmt.Println("GET  /health     — server status check")
 	http.ListenAndServe(":8081", enableCors(mux))
 }
\ No newline at end of file
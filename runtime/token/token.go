@@ -1,10 +1,26 @@
 package token
 
+import "fmt"
+
 type TokenType string
 
 type Token struct {
 	Type    TokenType
 	Literal string
+	Comment string   // # comment lines directly above the token, without the #
+	Start   Position // where the token begins
+	End     Position // just past its last character
+}
+
+// Position is a place in MLite source: a 1-based line, and a 1-based
+// column counting bytes.
+type Position struct {
+	Line   int `json:"line"`
+	Column int `json:"column"`
+}
+
+func (p Position) String() string {
+	return fmt.Sprintf("%d:%d", p.Line, p.Column)
 }
 
 const (
@@ -13,6 +29,8 @@ const (
 
 	// Symbols
 	COMMA     TokenType = "COMMA"
+	DOT       TokenType = "DOT"   // Member access such as df.price
+	COLON     TokenType = "COLON" // Single colon for named arguments (name: value)
 	LPAREN    TokenType = "LPAREN"
 	RPAREN    TokenType = "RPAREN"
 	LBRACE    TokenType = "LBRACE"   // {
@@ -24,6 +42,14 @@ const (
 	LT        TokenType = "LT"        // Less than
 	GTE       TokenType = "GTE"       // Greater than or equal to
 	LTE       TokenType = "LTE"       // Less than or equal to
+	NOT_EQ    TokenType = "NOT_EQ"    // !=
+	PLUS      TokenType = "PLUS"      // +
+	MINUS     TokenType = "MINUS"     // -
+	ASTERISK  TokenType = "ASTERISK"  // *
+	SLASH     TokenType = "SLASH"     // /
+	AND       TokenType = "AND"       // &&
+	OR        TokenType = "OR"        // ||
+	BANG      TokenType = "BANG"      // ! (logical not)
 	ASSIGN    TokenType = "ASSIGN"    // Double colon for assignment (::)
 	SEMICOLON TokenType = "SEMICOLON" // Semicolon for statement termination (;)
 
@@ -32,12 +58,13 @@ const (
 	STRING     TokenType = "STRING"
 	NUMBER     TokenType = "NUMBER"
 	// Keywords
-	LOAD    TokenType = "LOAD"
-	SAVE    TokenType = "SAVE"
-	TRAIN   TokenType = "TRAIN"
-	SET     TokenType = "SET"
-	LOOP    TokenType = "LOOP"
-	IF      TokenType = "IF"
-	LET     TokenType = "LET"
-	PREDICT TokenType = "PREDICT"
+	LOAD     TokenType = "LOAD"
+	SAVE     TokenType = "SAVE"
+	TRAIN    TokenType = "TRAIN"
+	SET      TokenType = "SET"
+	LOOP     TokenType = "LOOP"
+	IF       TokenType = "IF"
+	LET      TokenType = "LET"
+	PREDICT  TokenType = "PREDICT"
+	EVALUATE TokenType = "EVALUATE"
 )
@@ -0,0 +1,170 @@
+// Package trace defines trace.json, the record of one run of an MLite
+// program that the workbench debugger steps through. The interpreter
+// writes it (see interpreter.TraceRecorder); Read checks a file against
+// the schema before anything steps through it.
+//
+// A trace lists the statements in the order they started. A statement in
+// a loop or if block comes after the statement that holds it and names it
+// as its parent, and appears once per time it ran:
+//
+//	{"version": 1, "source": "housing.mlite", "started": "2026-10-19T09:30:00Z",
+//	 "steps": [
+//	  {"index": 0, "statement": "let", "span": {...}, "start_ms": 0.01, "duration_ms": 0.02,
+//	   "changes": {"n": "2"}, "variables": {"n": "2"}},
+//	  {"index": 1, "statement": "loop", "iterations": 2, ...},
+//	  {"index": 2, "statement": "set", "parent": 1, "depth": 1, "iteration": 1, ...}]}
+package trace
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mlite/parser"
+	"os"
+	"time"
+)
+
+// Version is the version of the schema this package reads and writes.
+// Readers reject other versions rather than guess at them.
+const Version = 1
+
+// Trace is a trace.json file.
+type Trace struct {
+	Version int       `json:"version"`
+	Source  string    `json:"source,omitempty"` // the program's file
+	Started time.Time `json:"started"`
+	Steps   []Step    `json:"steps"`
+	Error   string    `json:"error,omitempty"` // why the run stopped early
+}
+
+// Step is one execution of one statement.
+type Step struct {
+	Index     int          `json:"index"` // the step's position in Steps
+	Statement string       `json:"statement"`
+	Span      *parser.Span `json:"span,omitempty"`
+	Parent    *int         `json:"parent,omitempty"`    // the loop or if holding the statement
+	Depth     int          `json:"depth,omitempty"`     // how many blocks deep it is
+	Iteration int          `json:"iteration,omitempty"` // which pass of the parent loop, from 1
+
+	StartMS    float64 `json:"start_ms"` // since the run started
+	DurationMS float64 `json:"duration_ms"`
+
+	Iterations *int    `json:"iterations,omitempty"` // a loop's count
+	Branch     *Branch `json:"branch,omitempty"`     // an if's decision
+
+	// Changes holds the variables the statement set, not counting those
+	// its block set, and Variables every variable once it finished. Values
+	// are written as the interpreter prints them.
+	Changes   map[string]string `json:"changes,omitempty"`
+	Variables map[string]string `json:"variables"`
+
+	Metrics  map[string]float64 `json:"metrics,omitempty"`
+	Progress []Progress         `json:"progress,omitempty"` // a train's rounds or epochs
+	Output   []string           `json:"output,omitempty"`   // what the statement printed
+	Error    string             `json:"error,omitempty"`
+}
+
+// Branch is the decision an if made.
+type Branch struct {
+	Condition string `json:"condition"` // with its operands' values, e.g. "4 > 3"
+	Taken     bool   `json:"taken"`
+}
+
+// Progress is one boosting round or epoch of training.
+type Progress struct {
+	Iteration int                `json:"iteration"`
+	Metrics   map[string]float64 `json:"metrics"`
+}
+
+// Read reads and validates a trace file.
+func Read(path string) (*Trace, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var t Trace
+	if err := json.Unmarshal(data, &t); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if err := t.Validate(); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return &t, nil
+}
+
+// Write validates t and writes it to path as indented JSON.
+func Write(path string, t *Trace) error {
+	if err := t.Validate(); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(t, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0o644)
+}
+
+// Validate checks what the schema requires beyond the shape JSON gives
+// it: a known version, steps in order with parents before them, and
+// spans, times and decisions that make sense.
+func (t *Trace) Validate() error {
+	if t.Version != Version {
+		return fmt.Errorf("trace version %d, want %d", t.Version, Version)
+	}
+	if t.Steps == nil {
+		return errors.New("trace has no steps list")
+	}
+	for i, s := range t.Steps {
+		if err := t.validateStep(i, s); err != nil {
+			return fmt.Errorf("step %d: %w", i, err)
+		}
+	}
+	return nil
+}
+
+func (t *Trace) validateStep(i int, s Step) error {
+	switch {
+	case s.Index != i:
+		return fmt.Errorf("index %d out of order", s.Index)
+	case s.Statement == "":
+		return errors.New("no statement")
+	case s.StartMS < 0 || s.DurationMS < 0:
+		return fmt.Errorf("negative time (start %vms, duration %vms)", s.StartMS, s.DurationMS)
+	case s.Variables == nil:
+		return errors.New("no variables snapshot")
+	case s.Iterations != nil && (s.Statement != "loop" || *s.Iterations < 0):
+		return fmt.Errorf("iterations %d on a %s", *s.Iterations, s.Statement)
+	case s.Branch != nil && s.Statement != "if":
+		return fmt.Errorf("a branch decision on a %s", s.Statement)
+	}
+	if s.Span != nil {
+		start, end := s.Span.Start, s.Span.End
+		if start.Line < 1 || start.Column < 1 || end.Line < start.Line || end.Line == start.Line && end.Column < start.Column {
+			return fmt.Errorf("span %s-%s is not a range of the source", start, end)
+		}
+	}
+	if s.Parent == nil {
+		if s.Depth != 0 || s.Iteration != 0 {
+			return fmt.Errorf("depth %d and iteration %d with no parent", s.Depth, s.Iteration)
+		}
+		return nil
+	}
+	p := *s.Parent
+	if p < 0 || p >= i {
+		return fmt.Errorf("parent %d does not come before it", p)
+	}
+	parent := t.Steps[p]
+	switch {
+	case parent.Statement != "loop" && parent.Statement != "if":
+		return fmt.Errorf("parent %d is a %s, not a loop or if", p, parent.Statement)
+	case s.Depth != parent.Depth+1:
+		return fmt.Errorf("depth %d under a parent at depth %d", s.Depth, parent.Depth)
+	case parent.Statement == "loop" && (s.Iteration < 1 || parent.Iterations != nil && s.Iteration > *parent.Iterations):
+		return fmt.Errorf("iteration %d of loop %d", s.Iteration, p)
+	case parent.Statement == "if" && (parent.Branch == nil || !parent.Branch.Taken):
+		return fmt.Errorf("ran under if %d, whose branch was not taken", p)
+	case parent.Statement == "if" && s.Iteration != 0:
+		return fmt.Errorf("iteration %d under if %d", s.Iteration, p)
+	}
+	return nil
+}
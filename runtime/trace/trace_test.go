@@ -0,0 +1,82 @@
+package trace
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// validTrace is a let, then a loop of one pass holding a set.
+func validTrace() *Trace {
+	loop, passes := 1, 1
+	return &Trace{
+		Version: Version,
+		Steps: []Step{
+			{Index: 0, Statement: "let", Changes: map[string]string{"n": "1"}, Variables: map[string]string{"n": "1"}},
+			{Index: 1, Statement: "loop", Iterations: &passes, Variables: map[string]string{"n": "2"}},
+			{Index: 2, Statement: "set", Parent: &loop, Depth: 1, Iteration: 1, Variables: map[string]string{"n": "2"}},
+		},
+	}
+}
+
+// Checks that a written trace reads back the same, and that reading
+// rejects files the schema does not allow.
+func TestWriteAndRead(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "trace.json")
+	if err := Write(path, validTrace()); err != nil {
+		t.Fatal(err)
+	}
+	got, err := Read(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got.Steps) != 3 || *got.Steps[2].Parent != 1 || got.Steps[0].Changes["n"] != "1" {
+		t.Errorf("read back %+v", got.Steps)
+	}
+
+	for _, c := range []struct{ json, want string }{
+		{`{"version": 2, "steps": []}`, "version 2"},
+		{`{"version": 1}`, "no steps"},
+		{`{"version": 1, "steps": [{"index": 0, "statement": "let"}]}`, "no variables"},
+		{`{"version": 1, "steps": [{"index": 1, "statement": "let", "variables": {}}]}`, "out of order"},
+		{`{"version": 1, "steps": [{"index": 0, "statement": "let", "variables": {}, "span": {"start": {"line": 2, "column": 1}, "end": {"line": 1, "column": 1}}}]}`, "not a range"},
+		{`{"version": 1, "steps": [{"index": 0, "statement": "let", "variables": {}, "branch": {"condition": "1 > 0", "taken": true}}]}`, "branch decision on a let"},
+		{`{"version": 1, "steps": [{"index": 0, "statement": "let", "parent": 0, "depth": 1, "variables": {}}]}`, "does not come before"},
+		{`not json`, "invalid character"},
+	} {
+		if err := os.WriteFile(path, []byte(c.json), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := Read(path); err == nil || !strings.Contains(err.Error(), c.want) {
+			t.Errorf("reading %s: got %v, want an error about %q", c.json, err, c.want)
+		}
+	}
+}
+
+// Checks that a step must sit one level under its parent, in a pass the
+// loop made, and only under an if whose branch was taken.
+func TestValidateParents(t *testing.T) {
+	for _, c := range []struct {
+		name   string
+		change func(*Trace)
+		want   string
+	}{
+		{"depth", func(tr *Trace) { tr.Steps[2].Depth = 2 }, "depth 2"},
+		{"iteration", func(tr *Trace) { tr.Steps[2].Iteration = 2 }, "iteration 2 of loop 1"},
+		{"parent type", func(tr *Trace) { zero := 0; tr.Steps[2].Parent = &zero }, "not a loop or if"},
+		{"if not taken", func(tr *Trace) {
+			tr.Steps[1] = Step{Index: 1, Statement: "if", Branch: &Branch{Condition: "1 > 2"}, Variables: map[string]string{}}
+			tr.Steps[2].Iteration = 0
+		}, "not taken"},
+	} {
+		tr := validTrace()
+		c.change(tr)
+		if err := tr.Validate(); err == nil || !strings.Contains(err.Error(), c.want) {
+			t.Errorf("%s: got %v, want an error about %q", c.name, err, c.want)
+		}
+	}
+	if err := validTrace().Validate(); err != nil {
+		t.Errorf("valid trace rejected: %v", err)
+	}
+}
@@ -0,0 +1,158 @@
+//go:build !server
+
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"mlite/lexer"
+	"mlite/parser"
+	"mlite/token"
+	"mlite/transpiler"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// runTranspile implements "mlite transpile [-target python|r|ipynb] [-module]
+// [-o out] script.mlite": it writes the script in the target language next
+// to it, e.g. script.py, or to the -o file ("-" for standard output).
+// Python gets a source map beside it, e.g. script.py.map, unless written to
+// standard output. With -module the Python script takes its paths and
+// constants as command-line flags, and a requirements.txt listing its pip
+// packages is written in the same directory. It returns the process exit
+// code.
+func runTranspile(args []string) int {
+	flags := flag.NewFlagSet("transpile", flag.ContinueOnError)
+	target := flags.String("target", "python", "language to generate: python, r or ipynb")
+	out := flags.String("o", "", "output file; - for standard output")
+	module := flags.Bool("module", false, "generate a runnable Python module with command-line flags and a requirements.txt beside it")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: mlite transpile [-target python|r|ipynb] [-module] [-o out] script.mlite")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return 2
+	}
+	backend, err := transpiler.NewBackend(*target)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "transpile:", err)
+		return 2
+	}
+	if _, python := backend.(*transpiler.Transpiler); *module && !python {
+		fmt.Fprintln(os.Stderr, "transpile: -module needs -target python")
+		return 2
+	}
+	if *module && *out == "-" {
+		fmt.Fprintln(os.Stderr, "transpile: -module writes requirements.txt beside the script and cannot write to standard output")
+		return 2
+	}
+
+	source, err := os.ReadFile(flags.Arg(0))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "transpile:", err)
+		return 1
+	}
+	code, requirements, sourceMap, err := transpile(backend, string(source), *module)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "transpile:", err)
+		return 1
+	}
+	if *out == "-" {
+		fmt.Print(code)
+		return 0
+	}
+	if *out == "" {
+		*out = strings.TrimSuffix(flags.Arg(0), ".mlite") + backend.Extension()
+	}
+	if err := os.WriteFile(*out, []byte(code), 0o644); err != nil {
+		fmt.Fprintln(os.Stderr, "transpile:", err)
+		return 1
+	}
+	if *module {
+		if err := os.WriteFile(filepath.Join(filepath.Dir(*out), "requirements.txt"), []byte(requirements), 0o644); err != nil {
+			fmt.Fprintln(os.Stderr, "transpile:", err)
+			return 1
+		}
+	}
+	if sourceMap == nil {
+		return 0
+	}
+	sourceMap.File, sourceMap.Source = filepath.Base(*out), filepath.Base(flags.Arg(0))
+	data, err := json.MarshalIndent(sourceMap, "", "  ")
+	if err == nil {
+		err = os.WriteFile(*out+".map", append(data, '\n'), 0o644)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "transpile:", err)
+		return 1
+	}
+	return 0
+}
+
+// runTraceback implements "mlite traceback script.py.map": it copies a
+// Python traceback from standard input to standard output with the frames
+// in the generated script pointing at the MLite source.
+func runTraceback(args []string) int {
+	if len(args) != 1 {
+		fmt.Fprintln(os.Stderr, "usage: mlite traceback script.py.map < traceback.txt")
+		return 2
+	}
+	data, err := os.ReadFile(args[0])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "traceback:", err)
+		return 1
+	}
+	var sourceMap transpiler.SourceMap
+	if err := json.Unmarshal(data, &sourceMap); err != nil {
+		fmt.Fprintln(os.Stderr, "traceback:", err)
+		return 1
+	}
+	traceback, err := io.ReadAll(os.Stdin)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "traceback:", err)
+		return 1
+	}
+	fmt.Print(sourceMap.RewriteTraceback(string(traceback)))
+	return 0
+}
+
+// transpile lexes, parses and transpiles source, as a module with its
+// requirements when module is set, turning the panics the three stages
+// signal errors with into an error. The source map is nil for targets
+// other than Python; module needs the Python backend.
+func transpile(backend transpiler.Backend, source string, module bool) (code, requirements string, sourceMap *transpiler.SourceMap, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%v", r)
+		}
+	}()
+	lex := lexer.NewLexer(source)
+	var tokens []token.Token
+	for {
+		tok := lex.NextToken()
+		tokens = append(tokens, tok)
+		if tok.Type == token.EOF {
+			break
+		}
+	}
+	nodes := parser.NewParser(tokens).Parse()
+	python, ok := backend.(*transpiler.Transpiler)
+	if module {
+		m := python.TranspileModule(nodes)
+		code, requirements = m.Script, m.Requirements
+	} else {
+		code = backend.Transpile(nodes)
+	}
+	if ok {
+		m := python.SourceMap()
+		sourceMap = &m
+	}
+	return code, requirements, sourceMap, nil
+}
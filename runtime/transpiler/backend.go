@@ -0,0 +1,81 @@
+package transpiler
+
+import (
+	"fmt"
+	"mlite/parser"
+	"sort"
+	"strings"
+)
+
+// Backend generates a program in one target language from the AST.
+type Backend interface {
+	// Transpile returns the generated program.
+	Transpile(nodes []parser.Node) string
+	// Extension is the file extension of the generated program, e.g. ".py".
+	Extension() string
+}
+
+// Backends maps each target a program can be transpiled to to the
+// constructor of its backend.
+var Backends = map[string]func() Backend{
+	"python": func() Backend { return NewTranspiler() },
+	"r":      func() Backend { return NewRTranspiler() },
+	"ipynb":  func() Backend { return NewNotebook() },
+}
+
+// NewBackend returns a fresh backend for target.
+func NewBackend(target string) (Backend, error) {
+	newBackend, ok := Backends[target]
+	if !ok {
+		var targets []string
+		for name := range Backends {
+			targets = append(targets, name)
+		}
+		sort.Strings(targets)
+		return nil, fmt.Errorf("unknown target %q (have %s)", target, strings.Join(targets, ", "))
+	}
+	return newBackend(), nil
+}
+
+// writer accumulates generated lines at the current indentation, which
+// every backend tracks the same way: indent++ before a block, indent--
+// after it.
+type writer struct {
+	output strings.Builder
+	indent int    // how many levels deep are we right now?
+	tab    string // one level of indentation, e.g. four spaces
+
+	span  parser.Span   // the statement being written
+	spans []parser.Span // the statement each line of output came from
+}
+
+// writeLine writes one line at the correct indentation level.
+// strings.Repeat(w.tab, w.indent) produces the right number of spaces.
+// With a four-space tab, indent=0: no spaces. indent=1: 4 spaces.
+func (w *writer) writeLine(line string) {
+	w.output.WriteString(strings.Repeat(w.tab, w.indent) + line + "\n")
+	for i := strings.Count(line, "\n"); i >= 0; i-- {
+		w.spans = append(w.spans, w.span)
+	}
+}
+
+// at makes span the source of the lines written until the returned func
+// is called, which restores the enclosing statement's:
+//
+//	defer w.at(parser.SpanOf(node))()
+func (w *writer) at(span parser.Span) func() {
+	enclosing := w.span
+	w.span = span
+	return func() { w.span = enclosing }
+}
+
+// writeComment writes each line of text as a # comment, which Python and
+// R share.
+func (w *writer) writeComment(text string) {
+	for _, line := range strings.Split(text, "\n") {
+		w.writeLine(strings.TrimRight("# "+line, " "))
+	}
+}
+
+// Extension is the file extension of a Python script.
+func (t *Transpiler) Extension() string { return ".py" }
@@ -0,0 +1,360 @@
+package transpiler
+
+import (
+	"fmt"
+	"mlite/parser"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// pythonBuiltin emits the Python for an MLite builtin call. Params names the
+// arguments in positional order, matching the interpreter's builtins.
+// Action builtins such as save_model return nothing, so a call statement
+// emits them as they are rather than printing their result.
+type pythonBuiltin struct {
+	params []string
+	emit   func(t *Transpiler, args map[string]*parser.ExpressionNode) string
+	action bool
+}
+
+var pythonBuiltins map[string]pythonBuiltin
+
+func init() {
+	pythonBuiltins = map[string]pythonBuiltin{
+		"split":          {params: []string{"data", "test", "seed", "stratify"}, emit: emitSplit},
+		"kfold":          {params: []string{"data", "k", "seed", "stratify"}, emit: emitKFold},
+		"cross_validate": {params: []string{"model", "data", "k", "seed", "stratify", "features", "target"}, emit: emitCrossValidate},
+		"evaluate":       {params: []string{"model", "data"}, emit: emitEvaluate},
+		"predict":        {params: []string{"model", "data", "into"}, emit: emitPredict},
+		"save_model":     {params: []string{"model", "path"}, emit: emitSaveModel, action: true},
+		"load_model":     {params: []string{"path"}, emit: emitLoadModel},
+		"export_onnx":    {params: []string{"model", "path"}, emit: emitExportONNX, action: true},
+		"export_pmml":    {params: []string{"model", "path", "data"}, emit: emitExportPMML, action: true},
+		"drop_na":        {params: []string{"columns", "data"}, emit: emitDropNA},
+		"pipeline":       {params: []string{"steps"}, emit: emitPipeline},
+		"select":         {params: []string{"data", "columns"}, emit: emitSelect},
+		"filter":         {params: []string{"data", "condition"}, emit: emitFilter},
+		"sort":           {params: []string{"data", "by", "desc"}, emit: emitSort},
+		"with_column":    {params: []string{"data", "name", "value"}, emit: emitWithColumn},
+		"head":           {params: []string{"data", "n"}, emit: emitHead},
+		"tail":           {params: []string{"data", "n"}, emit: emitTail},
+		"sample":         {params: []string{"data", "n", "seed"}, emit: emitSample},
+		"describe":       {params: []string{"data"}, emit: emitDescribe},
+		"group_by":       {params: []string{"data", "by"}, emit: emitGroupBy},
+		"agg":            {params: []string{"groups", "...aggregations"}, emit: emitAgg},
+		"join":           {params: []string{"left", "right", "on", "how"}, emit: emitJoin},
+		"search":         {params: []string{"model", "data", "grid", "cv", "metric", "n_iter", "seed", "workers", "stratify", "features", "target"}, emit: emitSearch},
+	}
+	for name := range sklearnMetrics {
+		pythonBuiltins[name] = pythonBuiltin{params: []string{"y_true", "y_pred"}, emit: metricEmitter(name)}
+	}
+}
+
+// bindArgs maps a call's positional and named arguments to parameter names.
+// A last param written "...name" collects the remaining positional
+// arguments as an array.
+func bindArgs(call *parser.ExpressionNode, params []string) map[string]*parser.ExpressionNode {
+	accepted := make([]string, len(params))
+	for j, param := range params {
+		accepted[j] = strings.TrimPrefix(param, "...")
+	}
+	if last := len(params) - 1; last >= 0 && strings.HasPrefix(params[last], "...") {
+		call, params = collectRest(call, params)
+	}
+	if len(call.Args) > len(params) {
+		panic(fmt.Sprintf("transpiler: %s takes at most %d positional argument(s)", call.Value, len(params)))
+	}
+	args := map[string]*parser.ExpressionNode{}
+	for j, arg := range call.Args {
+		args[params[j]] = arg
+	}
+	for _, kw := range call.Keywords {
+		if !slices.Contains(accepted, kw.Name) {
+			panic(fmt.Sprintf("transpiler: %s: unknown argument %s (accepted: %s)", call.Value, kw.Name, strings.Join(accepted, ", ")))
+		}
+		args[kw.Name] = kw.Value
+	}
+	return args
+}
+
+// argOr renders an argument, or def when it was not given.
+func (t *Transpiler) argOr(args map[string]*parser.ExpressionNode, name, def string) string {
+	if e, ok := args[name]; ok {
+		return t.expression(e)
+	}
+	return def
+}
+
+// columnName returns a column-name argument written as a bare name or string.
+func columnName(args map[string]*parser.ExpressionNode, name string) string {
+	e, ok := args[name]
+	if !ok {
+		return ""
+	}
+	return fmt.Sprintf("%v", e.Value)
+}
+
+// columnNames returns a column-list argument: one name or an array of names.
+func columnNames(args map[string]*parser.ExpressionNode, name string) []string {
+	e, ok := args[name]
+	if !ok {
+		return nil
+	}
+	if e.Type != parser.ARRAY {
+		return []string{fmt.Sprintf("%v", e.Value)}
+	}
+	names := make([]string, len(e.Args))
+	for j, el := range e.Args {
+		names[j] = fmt.Sprintf("%v", el.Value)
+	}
+	return names
+}
+
+// MLite:  split(df, test: 0.2, seed: 42, stratify: label)
+// Python: train_test_split(df, test_size=0.2, random_state=42, stratify=df["label"])
+func emitSplit(t *Transpiler, args map[string]*parser.ExpressionNode) string {
+	t.require("from sklearn.model_selection import train_test_split")
+	data := t.argOr(args, "data", "df")
+	parts := []string{
+		data,
+		"test_size=" + t.argOr(args, "test", "0.25"),
+		"random_state=" + t.argOr(args, "seed", "0"),
+	}
+	if col := columnName(args, "stratify"); col != "" {
+		parts = append(parts, "stratify="+columnOf(data, col))
+	}
+	return fmt.Sprintf("train_test_split(%s)", strings.Join(parts, ", "))
+}
+
+// kfoldSplitter renders the sklearn splitter matching MLite's k-fold options.
+func (t *Transpiler) kfoldSplitter(args map[string]*parser.ExpressionNode) (splitter, splitArgs string) {
+	data := t.argOr(args, "data", "df")
+	options := fmt.Sprintf("n_splits=%s, shuffle=True, random_state=%s", t.argOr(args, "k", "5"), t.argOr(args, "seed", "0"))
+	if col := columnName(args, "stratify"); col != "" {
+		t.require("from sklearn.model_selection import StratifiedKFold")
+		return fmt.Sprintf("StratifiedKFold(%s)", options), data + ", " + columnOf(data, col)
+	}
+	t.require("from sklearn.model_selection import KFold")
+	return fmt.Sprintf("KFold(%s)", options), data
+}
+
+// MLite:  kfold(df, k: 5)
+// Python: [(df.iloc[tr], df.iloc[te]) for tr, te in KFold(n_splits=5, shuffle=True, random_state=0).split(df)]
+func emitKFold(t *Transpiler, args map[string]*parser.ExpressionNode) string {
+	data := t.argOr(args, "data", "df")
+	splitter, splitArgs := t.kfoldSplitter(args)
+	return fmt.Sprintf("[(%s.iloc[tr], %s.iloc[te]) for tr, te in %s.split(%s)]", data, data, splitter, splitArgs)
+}
+
+// MLite:  cross_validate(m, df, k: 5)
+// Python: cross_validate(m, df[["sqft"]], df["price"], cv=KFold(...), scoring=[...])
+//
+// Features and target default to the ones m was last trained on, as in the
+// interpreter.
+func emitCrossValidate(t *Transpiler, args map[string]*parser.ExpressionNode) string {
+	t.require("from sklearn.model_selection import cross_validate")
+	modelVar := t.argOr(args, "model", "")
+	data := t.argOr(args, "data", "df")
+
+	features, target := columnNames(args, "features"), columnName(args, "target")
+	if fit, ok := t.fitted[modelVar]; ok {
+		if features == nil {
+			features = fit.Features
+		}
+		if target == "" {
+			target = fit.Target
+		}
+	}
+	if features == nil || target == "" {
+		panic(fmt.Sprintf("transpiler: cross_validate(%s) needs features: and target: before %s is trained", modelVar, modelVar))
+	}
+
+	scoring := `["r2", "neg_root_mean_squared_error", "neg_mean_absolute_error"]`
+	if t.isClassifier(modelVar) {
+		scoring = `["accuracy"]`
+	}
+	splitter, _ := t.kfoldSplitter(args)
+	return fmt.Sprintf("cross_validate(%s, %s, %s, cv=%s, scoring=%s)",
+		modelVar, t.featuresOf(data, features, t.steps[data]), columnOf(data, target), splitter, scoring)
+}
+
+// predictCall renders the predictions of a trained model for every row of
+// data, selecting the columns it was trained on.
+func (t *Transpiler) predictCall(modelVar, data string) string {
+	X, _ := t.modelData(modelVar, data, "predict")
+	return fmt.Sprintf("%s.predict(%s)", modelVar, X)
+}
+
+// MLite:  predict(m, te)
+// Python: m.predict(te[["sqft"]])
+//
+// MLite:  predict(m, te, into: "price_hat")
+// Python: te.assign(price_hat=m.predict(te[["sqft"]]))
+//
+// As in the interpreter, into: in an expression returns a copy; only the
+// predict statement adds the column in place.
+func emitPredict(t *Transpiler, args map[string]*parser.ExpressionNode) string {
+	modelVar := t.argOr(args, "model", "")
+	if row := args["data"]; row != nil && row.Type == parser.ARRAY {
+		return fmt.Sprintf("%s.predict([%s])[0]", modelVar, t.expression(row))
+	}
+	predictions := t.predictCall(modelVar, t.argOr(args, "data", "df"))
+	into, ok := args["into"]
+	if !ok {
+		return predictions
+	}
+	name := fmt.Sprintf("%v", into.Value)
+	if isIdentifier(name) {
+		return fmt.Sprintf("%s.assign(%s=%s)", t.argOr(args, "data", "df"), name, predictions)
+	}
+	return fmt.Sprintf("%s.assign(**{%s: %s})", t.argOr(args, "data", "df"), strconv.Quote(name), predictions)
+}
+
+// isIdentifier reports whether name can be written as a Python keyword argument.
+func isIdentifier(name string) bool {
+	for j, r := range name {
+		if !(r == '_' || unicode.IsLetter(r) || (j > 0 && unicode.IsDigit(r))) {
+			return false
+		}
+	}
+	return name != "" && !pythonKeywords[name]
+}
+
+// saveModelHelper keeps the target name with the model, as MLite model
+// files do, so evaluate works on the model after load_model.
+const saveModelHelper = `def save_model(model, path, target):
+    model.target_name_ = target
+    joblib.dump(model, path)
+`
+
+// MLite:  save_model(m, "m.mlm")
+// Python: save_model(m, "m.mlm", "price")
+//
+// The Python program writes a joblib pickle, not MLite's .mlm format; each
+// runtime reads back only the files it wrote.
+//
+// An .mlm file keeps the preprocessing steps of the training data, and the
+// interpreter replays them on whatever a loaded model predicts for. The
+// Python steps are closures, which joblib cannot pickle, so a model trained
+// after preprocessing statements is rejected rather than saved without
+// them; a pipeline keeps its steps and saves whole.
+func emitSaveModel(t *Transpiler, args map[string]*parser.ExpressionNode) string {
+	t.require("import joblib")
+	t.define(saveModelHelper)
+	modelVar := t.argOr(args, "model", "")
+	fit, ok := t.fitted[modelVar]
+	if !ok {
+		panic(fmt.Sprintf("transpiler: save_model(%s) needs %s to be trained first", modelVar, modelVar))
+	}
+	if len(t.modelSteps[modelVar]) > 0 {
+		panic(fmt.Sprintf("transpiler: save_model(%s): the preprocessing steps of its training data cannot be saved with it; train a pipeline instead", modelVar))
+	}
+	target := strconv.Quote(fit.Target)
+	if t.isLoaded(modelVar) {
+		target = modelVar + ".target_name_"
+	}
+	return fmt.Sprintf("save_model(%s, %s, %s)", modelVar, t.argOr(args, "path", ""), target)
+}
+
+// MLite:  load_model("m.mlm")
+// Python: joblib.load("m.mlm")
+func emitLoadModel(t *Transpiler, args map[string]*parser.ExpressionNode) string {
+	t.require("import joblib")
+	return fmt.Sprintf("joblib.load(%s)", t.argOr(args, "path", ""))
+}
+
+// exportONNXHelper converts with skl2onnx. Its graphs follow skl2onnx's
+// naming, and classifiers report probabilities as a ZipMap, so they are not
+// byte-for-byte what the interpreter writes.
+const exportONNXHelper = `def export_onnx(model, path):
+    inputs = [("input", FloatTensorType([None, len(model.feature_names_in_)]))]
+    with open(path, "wb") as f:
+        f.write(convert_sklearn(model, initial_types=inputs).SerializeToString())
+`
+
+// MLite:  export_onnx(m, "m.onnx")
+// Python: export_onnx(m, "m.onnx")
+func emitExportONNX(t *Transpiler, args map[string]*parser.ExpressionNode) string {
+	modelVar := t.argOr(args, "model", "")
+	if _, ok := t.fitted[modelVar]; !ok {
+		panic(fmt.Sprintf("transpiler: export_onnx(%s) needs %s to be trained first", modelVar, modelVar))
+	}
+	if strings.HasPrefix(t.models[modelVar], "mlp") {
+		panic(fmt.Sprintf("transpiler: export_onnx does not support %s models", t.models[modelVar]))
+	}
+	if t.pipelines[modelVar] || len(t.modelSteps[modelVar]) > 0 {
+		panic(fmt.Sprintf("transpiler: export_onnx(%s): models with preprocessing steps cannot be exported", modelVar))
+	}
+	t.require("from skl2onnx import convert_sklearn")
+	t.require("from skl2onnx.common.data_types import FloatTensorType")
+	t.define(exportONNXHelper)
+	return fmt.Sprintf("export_onnx(%s, %s)", modelVar, t.argOr(args, "path", ""))
+}
+
+// exportPMMLHelper converts with sklearn2pmml, which needs a Java runtime.
+// It derives the data dictionary from the fitted model, so the data
+// argument has no Python counterpart.
+const exportPMMLHelper = `def export_pmml(model, path, target):
+    pipeline = make_pmml_pipeline(model, active_fields=list(model.feature_names_in_), target_fields=[target])
+    sklearn2pmml(pipeline, path)
+`
+
+// MLite:  export_pmml(m, "m.pmml")
+// Python: export_pmml(m, "m.pmml", "price")
+func emitExportPMML(t *Transpiler, args map[string]*parser.ExpressionNode) string {
+	modelVar := t.argOr(args, "model", "")
+	fit, ok := t.fitted[modelVar]
+	if !ok {
+		panic(fmt.Sprintf("transpiler: export_pmml(%s) needs %s to be trained first", modelVar, modelVar))
+	}
+	if strings.HasPrefix(t.models[modelVar], "mlp") {
+		panic(fmt.Sprintf("transpiler: export_pmml does not support %s models", t.models[modelVar]))
+	}
+	if t.pipelines[modelVar] || len(t.modelSteps[modelVar]) > 0 {
+		panic(fmt.Sprintf("transpiler: export_pmml(%s): models with preprocessing steps cannot be exported", modelVar))
+	}
+	t.require("from sklearn2pmml import make_pmml_pipeline, sklearn2pmml")
+	t.define(exportPMMLHelper)
+	target := strconv.Quote(fit.Target)
+	if t.isLoaded(modelVar) {
+		target = modelVar + ".target_name_"
+	}
+	return fmt.Sprintf("export_pmml(%s, %s, %s)", modelVar, t.argOr(args, "path", ""), target)
+}
+
+// recordLoad remembers that variable holds a model read with load_model.
+// Its type and columns are unknown until run time, marked by a fit with no
+// features.
+func (t *Transpiler) recordLoad(variable string, e *parser.ExpressionNode) {
+	if e.Type == parser.CALL && e.Value == "load_model" {
+		t.fitted[variable] = &parser.TrainNode{Model: variable}
+	}
+}
+
+// collectRest rewrites a call to a builtin whose last param is "...name",
+// passing the positional arguments from that one on as name: [...].
+func collectRest(call *parser.ExpressionNode, params []string) (*parser.ExpressionNode, []string) {
+	last := len(params) - 1
+	name := strings.TrimPrefix(params[last], "...")
+	rest := &parser.ExpressionNode{Type: parser.ARRAY}
+	positional := call.Args
+	if len(positional) > last {
+		positional, rest.Args = positional[:last], positional[last:]
+	}
+	keywords := call.Keywords
+	if len(rest.Args) > 0 || !hasKeyword(call, name) {
+		keywords = append(keywords[:len(keywords):len(keywords)], &parser.KeywordArg{Name: name, Value: rest})
+	}
+	return &parser.ExpressionNode{Type: call.Type, Value: call.Value, Args: positional, Keywords: keywords}, params[:last]
+}
+
+func hasKeyword(call *parser.ExpressionNode, name string) bool {
+	for _, kw := range call.Keywords {
+		if kw.Name == name {
+			return true
+		}
+	}
+	return false
+}
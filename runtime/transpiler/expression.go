@@ -0,0 +1,159 @@
+package transpiler
+
+import (
+	"fmt"
+	"mlite/parser"
+	"strings"
+)
+
+// MLite names that mean something else in Python are renamed with a
+// trailing underscore, as PEP 8 suggests: let class :: 3 becomes
+// class_ = 3. Only variables are renamed; a column named class is still
+// df["class"].
+//
+// reservedNames holds Python's keywords, the builtins generated code calls
+// or a reader would expect intact, and the names generated code defines or
+// imports itself.
+var reservedNames = map[string]bool{}
+
+// pythonKeywords cannot be used as Python identifiers at all.
+var pythonKeywords = map[string]bool{}
+
+func init() {
+	for _, name := range strings.Fields(`False None True and as assert async await break class
+		continue def del elif else except finally for from global if import in is lambda
+		nonlocal not or pass raise return try while with yield`) {
+		pythonKeywords[name] = true
+		reservedNames[name] = true
+	}
+	for _, name := range strings.Fields(`abs all any bool dict dir enumerate filter float format
+		getattr hasattr hash id input int isinstance iter len list map max min next object
+		open print range repr reversed round set slice sorted str sum super tuple type vars zip`) {
+		reservedNames[name] = true
+	}
+	for _, name := range strings.Fields(`pd np args main parser con argparse sqlite3 joblib
+		averaged best_of clip confusion describe evaluate_classifier evaluate_regressor
+		export_onnx export_pmml impute label_encode minmax_scale on_columns one_hot
+		save_model standardize`) {
+		reservedNames[name] = true
+	}
+	for _, m := range sklearnModels {
+		reservedNames[m.Class] = true
+		if m.Ridge != "" {
+			reservedNames[m.Ridge] = true
+		}
+	}
+}
+
+// pyName renders an MLite variable name as a Python one.
+func pyName(name string) string {
+	if reservedNames[name] {
+		return name + "_"
+	}
+	return name
+}
+
+// fresh returns name, or name with underscores appended, such that no
+// variable declared so far has it: the loop counter and lambda parameters
+// of generated code must not hide the program's own variables.
+func (t *Transpiler) fresh(name string) string {
+	for t.variables[name] {
+		name += "_"
+	}
+	return name
+}
+
+// Precedences of the operators MLite expressions become, keyed by MLite
+// operator, lowest first. In Python, not binds looser than the comparisons
+// it usually negates, and unary minus tightest; R orders its operators the
+// same way.
+var precedence = map[string]int{
+	"||": 1,
+	"&&": 2,
+	"!":  3,
+	"==": 4, "!=": 4, "<": 4, "<=": 4, ">": 4, ">=": 4,
+	"+": 7, "-": 7,
+	"*": 8, "/": 8,
+	"unary": 9,
+}
+
+// pandasPrecedence is precedence with && and || spelled & and |, which
+// bind tighter than comparisons, and ! spelled ~, which binds tightest.
+var pandasPrecedence = map[string]int{}
+
+func init() {
+	for op, p := range precedence {
+		pandasPrecedence[op] = p
+	}
+	pandasPrecedence["||"] = 5
+	pandasPrecedence["&&"] = 6
+	pandasPrecedence["!"] = precedence["unary"]
+}
+
+// atom is the precedence of anything that is not an operation: names,
+// literals, calls and subscripts never need parentheses.
+const atom = 10
+
+// spelling maps MLite operators to those of a target language.
+type spelling struct {
+	binary     map[string]string
+	not        string // the prefix for !, e.g. "not " or "~"
+	precedence map[string]int
+	notWraps   bool // parenthesize any operation !'s operand is, for readers
+}
+
+var (
+	plainSpelling  = spelling{binary: pythonOperators, not: "not ", precedence: precedence}
+	pandasSpelling = spelling{binary: pandasOperators, not: "~", precedence: pandasPrecedence}
+)
+
+// operator returns the spelling of e's operator and its precedence, or
+// atom when e is not an operation.
+func (s spelling) operator(e *parser.ExpressionNode) (string, int) {
+	op, _ := e.Value.(string)
+	switch e.Type {
+	case parser.UNARY:
+		if op == "!" {
+			return s.not, s.precedence["!"]
+		}
+		return op, s.precedence["unary"]
+	case parser.BINARY:
+		if spelled, ok := s.binary[op]; ok {
+			return spelled, s.precedence[op]
+		}
+		return op, s.precedence[op]
+	}
+	return "", atom
+}
+
+// operation renders a BINARY or UNARY expression, with render producing
+// its operands. Operands are parenthesized only where Python would group
+// them differently: a looser operand, the right operand of an operator of
+// the same precedence (Python groups from the left), and a comparison
+// inside a comparison, which Python would chain.
+func (s spelling) operation(e *parser.ExpressionNode, render func(*parser.ExpressionNode) string) string {
+	op, p := s.operator(e)
+	wrap := func(operand *parser.ExpressionNode, needs func(int) bool) string {
+		code := render(operand)
+		if _, q := s.operator(operand); needs(q) {
+			return "(" + code + ")"
+		}
+		return code
+	}
+	if e.Type == parser.UNARY {
+		return op + wrap(e.Args[0], func(q int) bool { return q < p || s.notWraps && op == s.not && q < atom })
+	}
+	comparison := p == s.precedence["=="]
+	left := wrap(e.Args[0], func(q int) bool { return q < p || comparison && q == p })
+	right := wrap(e.Args[1], func(q int) bool { return q <= p })
+	return fmt.Sprintf("%s %s %s", left, op, right)
+}
+
+// primary renders e so that a subscript or attribute can follow it,
+// parenthesizing an operation: (a + b)["x"] rather than a + b["x"].
+func (t *Transpiler) primary(e *parser.ExpressionNode) string {
+	if _, p := plainSpelling.operator(e); p < atom {
+		return "(" + t.expression(e) + ")"
+	}
+	return t.expression(e)
+}
@@ -0,0 +1,71 @@
+package transpiler
+
+import (
+	"fmt"
+	"mlite/dataset"
+	"mlite/parser"
+	"strconv"
+	"strings"
+)
+
+// pandasReaders and pandasWriters give the pandas call for each file
+// format, as a format string taking the quoted file name. pandas
+// decompresses .gz and .zst files by their extension.
+var pandasReaders = map[dataset.Format]string{
+	dataset.CSV:       "pd.read_csv(%s)",
+	dataset.TSV:       `pd.read_csv(%s, sep="\t")`,
+	dataset.JSON:      "pd.read_json(%s)",
+	dataset.JSONLines: "pd.read_json(%s, lines=True)",
+	dataset.Parquet:   "pd.read_parquet(%s)",
+}
+
+var pandasWriters = map[dataset.Format]string{
+	dataset.CSV:       "to_csv(%s, index=False)",
+	dataset.TSV:       `to_csv(%s, sep="\t", index=False)`,
+	dataset.JSON:      `to_json(%s, orient="records")`,
+	dataset.JSONLines: `to_json(%s, orient="records", lines=True)`,
+	dataset.Parquet:   "to_parquet(%s, index=False)",
+}
+
+// fileFormat resolves the format of a load or save, detecting it from the
+// file name as the interpreter does when none is given. Parquet needs
+// pyarrow installed, though nothing imports it.
+func (t *Transpiler) fileFormat(file, name string) dataset.Format {
+	format, err := dataset.ParseFormat(name)
+	if err != nil {
+		panic(fmt.Sprintf("transpiler: %s", err))
+	}
+	if format == "" {
+		format = dataset.DetectFormat(file)
+	}
+	if format == dataset.Parquet {
+		t.needs("pyarrow")
+	}
+	return format
+}
+
+// readSQLite runs a load's query with pandas, binding its named parameters
+// to the Python variables of the same names as the interpreter does.
+func (t *Transpiler) readSQLite(n *parser.LoadNode) {
+	t.require("import pandas as pd")
+	t.require("import sqlite3")
+	var params []string
+	for _, name := range dataset.QueryParameters(n.Query) {
+		params = append(params, fmt.Sprintf("%s: %s", strconv.Quote(name), pyName(name)))
+	}
+	call := fmt.Sprintf("pd.read_sql(%s, con", strconv.Quote(n.Query))
+	if len(params) > 0 {
+		call += ", params={" + strings.Join(params, ", ") + "}"
+	}
+	t.writeLine(fmt.Sprintf("con = sqlite3.connect(%s)", t.path(n.SQLite, "database read by load")))
+	t.writeLine("df = " + call + ")")
+	t.writeLine("con.close()")
+}
+
+// writeSQLite replaces a table with a DataFrame, as the interpreter does.
+func (t *Transpiler) writeSQLite(data string, n *parser.SaveNode) {
+	t.require("import sqlite3")
+	t.writeLine(fmt.Sprintf("con = sqlite3.connect(%s)", t.path(n.SQLite, "database written by save")))
+	t.writeLine(fmt.Sprintf(`%s.to_sql(%s, con, if_exists="replace", index=False)`, data, strconv.Quote(n.Table)))
+	t.writeLine("con.close()")
+}
@@ -0,0 +1,107 @@
+package transpiler
+
+import (
+	"fmt"
+	"mlite/dataset"
+	"mlite/parser"
+	"strconv"
+	"strings"
+)
+
+// pandasAggregations maps MLite aggregations to pandas' names for them.
+// count() with no column counts rows, which is pandas' size.
+var pandasAggregations = map[string]string{
+	"count": "count", "sum": "sum", "mean": "mean", "median": "median",
+	"min": "min", "max": "max", "std": "std", "n_unique": "nunique",
+}
+
+// MLite:  group_by(df, [bedrooms])
+// Python: df.groupby(["bedrooms"], dropna=False)
+//
+// Missing keys form a group, sorted last, as in the interpreter.
+func emitGroupBy(t *Transpiler, args map[string]*parser.ExpressionNode) string {
+	return fmt.Sprintf("%s.groupby(%s, dropna=False)", t.argOr(args, "data", "df"), quoteAll(requiredColumns("group_by", args, "by")))
+}
+
+// MLite:  group_by(df, [bedrooms]).agg(mean(price), count())
+// Python: df.groupby(["bedrooms"], dropna=False).agg(mean_price=("price", "mean"), count=("bedrooms", "size")).reset_index()
+//
+// Output columns are named as in the interpreter. A row count needs the
+// grouping keys, so the groups must come from group_by directly or through
+// a variable set to it.
+func emitAgg(t *Transpiler, args map[string]*parser.ExpressionNode) string {
+	groups, ok := args["groups"]
+	if !ok {
+		panic("transpiler: agg: missing argument groups")
+	}
+	var named, quoted []string
+	for _, e := range args["aggregations"].Args {
+		a := t.aggregation(e)
+		column, fn := a.Column, pandasAggregations[a.Func]
+		if fn == "" {
+			panic(fmt.Sprintf("transpiler: agg: unknown aggregation %q (have %s)", a.Func, strings.Join(dataset.AggregateFuncs, ", ")))
+		}
+		if column == "" {
+			keys := t.groupKeys(groups)
+			if a.Func != "count" || keys == nil {
+				panic(fmt.Sprintf("transpiler: agg: cannot tell the grouping columns for %s()", a.Func))
+			}
+			column, fn = keys[0], "size"
+		}
+		spec := fmt.Sprintf("(%s, %s)", strconv.Quote(column), strconv.Quote(fn))
+		if isIdentifier(a.Name()) {
+			named = append(named, a.Name()+"="+spec)
+		} else {
+			quoted = append(quoted, strconv.Quote(a.Name())+": "+spec)
+		}
+	}
+	if len(named)+len(quoted) == 0 {
+		panic("transpiler: agg: needs an aggregation such as mean(price) or count()")
+	}
+	if quoted != nil {
+		named = append(named, "**{"+strings.Join(quoted, ", ")+"}")
+	}
+	return fmt.Sprintf("%s.agg(%s).reset_index()", t.expression(groups), strings.Join(named, ", "))
+}
+
+// aggregation reads an aggregation written as fn(column) or fn().
+func (t *Transpiler) aggregation(e *parser.ExpressionNode) dataset.Aggregation {
+	if e.Type != parser.CALL || len(e.Args) > 1 || len(e.Keywords) > 0 {
+		panic("transpiler: agg: aggregations are written as mean(price) or count()")
+	}
+	a := dataset.Aggregation{Func: e.Value.(string)}
+	if len(e.Args) == 1 {
+		a.Column = fmt.Sprintf("%v", e.Args[0].Value)
+	}
+	return a
+}
+
+// groupKeys returns the grouping columns of a group_by call or of a
+// variable set to one, or nil.
+func (t *Transpiler) groupKeys(e *parser.ExpressionNode) []string {
+	switch {
+	case e.Type == parser.IDENTIFIER:
+		return t.groups[pyName(e.Value.(string))]
+	case e.Type == parser.CALL && e.Value == "group_by":
+		return columnNames(bindArgs(e, pythonBuiltins["group_by"].params), "by")
+	}
+	return nil
+}
+
+// MLite:  join(a, b, on: id, how: "left")
+// Python: a.merge(b, on=["id"], how="left")
+//
+// pandas matches missing keys with each other, where the interpreter
+// matches them with nothing, and sorts the rows of an outer join by key.
+func emitJoin(t *Transpiler, args map[string]*parser.ExpressionNode) string {
+	left, ok := args["left"]
+	if !ok {
+		panic("transpiler: join: missing argument left")
+	}
+	right, ok := args["right"]
+	if !ok {
+		panic("transpiler: join: missing argument right")
+	}
+	return fmt.Sprintf("%s.merge(%s, on=%s, how=%s)", t.expression(left), t.expression(right),
+		quoteAll(requiredColumns("join", args, "on")), t.argOr(args, "how", `"inner"`))
+}
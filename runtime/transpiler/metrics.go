@@ -0,0 +1,196 @@
+package transpiler
+
+import (
+	"fmt"
+	"mlite/parser"
+)
+
+// sklearnMetrics maps MLite metric builtins to their sklearn.metrics function.
+var sklearnMetrics = map[string]string{
+	"mae":              "mean_absolute_error",
+	"mse":              "mean_squared_error",
+	"rmse":             "mean_squared_error",
+	"r2":               "r2_score",
+	"mape":             "mean_absolute_percentage_error",
+	"accuracy":         "accuracy_score",
+	"precision":        "precision_score",
+	"recall":           "recall_score",
+	"f1":               "f1_score",
+	"roc_auc":          "roc_auc_score",
+	"log_loss":         "log_loss",
+	"confusion_matrix": "confusion_matrix",
+}
+
+// averageHelper mirrors MLite's averaging of precision, recall and F1:
+// binary with the larger label positive for two classes, macro otherwise.
+const averageHelper = `def averaged(score, y_true, y_pred):
+    labels = sorted(set(y_true) | set(y_pred))
+    if len(labels) <= 2:
+        return score(y_true, y_pred, average="binary", pos_label=labels[-1], zero_division=0)
+    return score(y_true, y_pred, average="macro", zero_division=0)
+`
+
+// confusionHelper returns the same {labels, matrix} record as MLite.
+const confusionHelper = `def confusion(y_true, y_pred):
+    labels = sorted(set(y_true) | set(y_pred))
+    return {"labels": labels, "matrix": confusion_matrix(y_true, y_pred, labels=labels).tolist()}
+`
+
+const evaluateRegressorHelper = `def evaluate_regressor(model, X, y):
+    pred = model.predict(X)
+    scores = {
+        "mae": mean_absolute_error(y, pred),
+        "mse": mean_squared_error(y, pred),
+        "rmse": mean_squared_error(y, pred) ** 0.5,
+        "r2": r2_score(y, pred),
+    }
+    if (y != 0).all():
+        scores["mape"] = mean_absolute_percentage_error(y, pred)
+    return scores
+`
+
+const evaluateClassifierHelper = `def evaluate_classifier(model, X, y):
+    pred = model.predict(X)
+    proba = model.predict_proba(X)
+    scores = {
+        "accuracy": accuracy_score(y, pred),
+        "precision": averaged(precision_score, y, pred),
+        "recall": averaged(recall_score, y, pred),
+        "f1": averaged(f1_score, y, pred),
+        "log_loss": log_loss(y, proba, labels=model.classes_),
+        "confusion_matrix": confusion(y, pred),
+    }
+    if len(model.classes_) == 2 and y.nunique() == 2:
+        scores["roc_auc"] = roc_auc_score(y, proba[:, 1])
+    return scores
+`
+
+// importMetrics requires `from sklearn.metrics import ...` for each function.
+func (t *Transpiler) importMetrics(functions ...string) {
+	for _, fn := range functions {
+		t.require("from sklearn.metrics import " + fn)
+	}
+}
+
+// MLite:  evaluate(m, te)
+// Python: evaluate_regressor(m, te[["sqft"]], te["price"])
+//
+// The helper is defined once at the top of the file and returns the same
+// metrics record as the interpreter.
+//
+// A model read with load_model has no known type until run time, so both
+// helpers are defined and sklearn's is_classifier picks one.
+func (t *Transpiler) evaluateCall(modelVar, data string) string {
+	X, y := t.modelData(modelVar, data, "evaluate")
+	classify := t.isClassifier(modelVar)
+	if classify || t.isLoaded(modelVar) {
+		t.importMetrics("accuracy_score", "precision_score", "recall_score", "f1_score", "log_loss", "roc_auc_score", "confusion_matrix")
+		t.define(averageHelper)
+		t.define(confusionHelper)
+		t.define(evaluateClassifierHelper)
+	}
+	if !classify {
+		t.importMetrics("mean_absolute_error", "mean_squared_error", "r2_score", "mean_absolute_percentage_error")
+		t.define(evaluateRegressorHelper)
+	}
+
+	helper := "evaluate_regressor"
+	switch {
+	case classify:
+		helper = "evaluate_classifier"
+	case t.isLoaded(modelVar):
+		t.require("from sklearn.base import is_classifier")
+		helper = fmt.Sprintf("(evaluate_classifier if is_classifier(%s) else evaluate_regressor)", modelVar)
+	}
+	return fmt.Sprintf("%s(%s, %s, %s)", helper, modelVar, X, y)
+}
+
+func emitEvaluate(t *Transpiler, args map[string]*parser.ExpressionNode) string {
+	return t.evaluateCall(t.argOr(args, "model", ""), t.argOr(args, "data", "df"))
+}
+
+// metricEmitter renders a metric builtin. As in the interpreter, the
+// arguments are either (y_true, y_pred) or (model, data):
+//
+// MLite:  rmse(te.price, p)
+// Python: mean_squared_error(te["price"], p) ** 0.5
+//
+// MLite:  roc_auc(m, te)
+// Python: roc_auc_score(te["label"], m.predict_proba(te[["x"]])[:, 1])
+func metricEmitter(name string) func(t *Transpiler, args map[string]*parser.ExpressionNode) string {
+	return func(t *Transpiler, args map[string]*parser.ExpressionNode) string {
+		fn := sklearnMetrics[name]
+		t.importMetrics(fn)
+
+		var yTrue, yPred string
+		extra := ""
+		if modelVar, data, ok := t.modelAndData(args); ok {
+			var X string
+			X, yTrue = t.modelData(modelVar, data, name)
+			switch name {
+			case "roc_auc":
+				yPred = fmt.Sprintf("%s.predict_proba(%s)[:, 1]", modelVar, X)
+			case "log_loss":
+				yPred = fmt.Sprintf("%s.predict_proba(%s)", modelVar, X)
+				extra = ", labels=" + modelVar + ".classes_"
+			default:
+				yPred = fmt.Sprintf("%s.predict(%s)", modelVar, X)
+			}
+		} else {
+			yTrue, yPred = t.argOr(args, "y_true", ""), t.argOr(args, "y_pred", "")
+		}
+
+		switch name {
+		case "rmse":
+			return fmt.Sprintf("%s(%s, %s) ** 0.5", fn, yTrue, yPred)
+		case "precision", "recall", "f1":
+			t.define(averageHelper)
+			return fmt.Sprintf("averaged(%s, %s, %s)", fn, yTrue, yPred)
+		case "confusion_matrix":
+			t.define(confusionHelper)
+			return fmt.Sprintf("confusion(%s, %s)", yTrue, yPred)
+		default:
+			return fmt.Sprintf("%s(%s, %s%s)", fn, yTrue, yPred, extra)
+		}
+	}
+}
+
+// modelAndData reports whether a metric was called as (model, data), i.e.
+// its first argument names a trained model.
+func (t *Transpiler) modelAndData(args map[string]*parser.ExpressionNode) (modelVar, data string, ok bool) {
+	first, found := args["y_true"]
+	if !found || first.Type != parser.IDENTIFIER {
+		return "", "", false
+	}
+	modelVar = pyName(first.Value.(string))
+	if _, trained := t.fitted[modelVar]; !trained {
+		return "", "", false
+	}
+	return modelVar, t.argOr(args, "y_pred", "df"), true
+}
+
+// modelData renders the feature matrix and target column modelVar was
+// trained on, taken from data. The columns of a model read with load_model
+// are only known at run time, from the attributes the saved model carries.
+func (t *Transpiler) modelData(modelVar, data, caller string) (X, y string) {
+	fit, ok := t.fitted[modelVar]
+	if !ok {
+		panic(fmt.Sprintf("transpiler: %s(%s) needs %s to be trained first", caller, modelVar, modelVar))
+	}
+	data = t.replay(modelVar, data)
+	if t.isLoaded(modelVar) {
+		return fmt.Sprintf("%s[%s.feature_names_in_]", data, modelVar), fmt.Sprintf("%s[%s.target_name_]", data, modelVar)
+	}
+	return t.featuresOf(data, fit.Features, t.modelSteps[modelVar]), columnOf(data, fit.Target)
+}
+
+// isLoaded reports whether modelVar was read with load_model.
+func (t *Transpiler) isLoaded(modelVar string) bool {
+	fit, ok := t.fitted[modelVar]
+	return ok && fit.Features == nil
+}
+
+// isClassifier reports whether modelVar holds a classifier model type.
+func (t *Transpiler) isClassifier(modelVar string) bool {
+	return sklearnModels[t.models[modelVar]].Classifier
+}
@@ -0,0 +1,140 @@
+package transpiler
+
+// sklearnModel describes how a registered MLite model type is written in
+// scikit-learn: the class to import and how MLite parameter names and
+// values translate to its keyword arguments.
+type sklearnModel struct {
+	Module     string
+	Class      string
+	Ridge      string                       // class used instead when alpha is given
+	Positional []string                     // MLite names of the positional parameters
+	Params     map[string]string            // MLite name → sklearn name; missing entries keep their name
+	Values     map[string]map[string]string // MLite name → MLite value → sklearn keyword arguments
+	Implies    map[string][]string          // MLite name → keyword arguments that make it take effect
+	Fixed      []string                     // keyword arguments always passed, e.g. `loss="log_loss"`
+	Wrap       string                       // format wrapping the constructor, e.g. in a scaling pipeline
+	Imports    []string                     // extra imports the wrapper needs
+	GridPrefix string                       // prefix of searched parameter names when wrapped, e.g. "mlpclassifier__"
+	Classifier bool                         // predicts class labels
+}
+
+// The native MLP standardises inputs (and regression targets) itself; the
+// scikit-learn estimators are wrapped in StandardScaler steps to match.
+var mlpParams = map[string]string{
+	"hidden":        "hidden_layer_sizes",
+	"learning_rate": "learning_rate_init",
+	"epochs":        "max_iter",
+	"seed":          "random_state",
+}
+
+// Plain sgd has no momentum natively; momentum=0 is only written when the
+// program gives no momentum: of its own.
+var mlpValues = map[string]map[string]string{
+	"activation": {"sigmoid": `activation="logistic"`},
+	"optimizer": {
+		"sgd":      `solver="sgd", momentum=0`,
+		"momentum": `solver="sgd", nesterovs_momentum=False`,
+		"adam":     `solver="adam"`,
+	},
+}
+
+// scikit-learn only holds out validation_fraction with early_stopping. It
+// then also stops once the validation score stalls and keeps the best
+// weights, where the native model trains every epoch and reports val_loss.
+var mlpImplies = map[string][]string{
+	"validation_fraction": {"early_stopping=True"},
+}
+
+var sklearnModels = map[string]sklearnModel{
+	"linear_regression": {Module: "sklearn.linear_model", Class: "LinearRegression", Ridge: "Ridge"},
+	"linreg":            {Module: "sklearn.linear_model", Class: "LinearRegression", Ridge: "Ridge"},
+	"gbm_regressor": {
+		Module: "sklearn.ensemble",
+		Class:  "GradientBoostingRegressor",
+		Params: map[string]string{"seed": "random_state"},
+		Values: map[string]map[string]string{"loss": {"squared": `loss="squared_error"`}},
+	},
+	"gbm_classifier": {
+		Module:     "sklearn.ensemble",
+		Class:      "GradientBoostingClassifier",
+		Params:     map[string]string{"seed": "random_state"},
+		Values:     map[string]map[string]string{"loss": {"log": `loss="log_loss"`}},
+		Classifier: true,
+	},
+	"mlp": {
+		Module:     "sklearn.neural_network",
+		Class:      "MLPRegressor",
+		Positional: []string{"hidden"},
+		Params:     mlpParams,
+		Values:     mlpValues,
+		Implies:    mlpImplies,
+		Wrap:       "TransformedTargetRegressor(regressor=make_pipeline(StandardScaler(), %s), transformer=StandardScaler())",
+		GridPrefix: "regressor__mlpregressor__",
+		Imports: []string{
+			"from sklearn.compose import TransformedTargetRegressor",
+			"from sklearn.pipeline import make_pipeline",
+			"from sklearn.preprocessing import StandardScaler",
+		},
+	},
+	"mlp_classifier": {
+		Module:     "sklearn.neural_network",
+		Class:      "MLPClassifier",
+		Positional: []string{"hidden"},
+		Params:     mlpParams,
+		Values:     mlpValues,
+		Implies:    mlpImplies,
+		Wrap:       "make_pipeline(StandardScaler(), %s)",
+		GridPrefix: "mlpclassifier__",
+		Classifier: true,
+		Imports: []string{
+			"from sklearn.pipeline import make_pipeline",
+			"from sklearn.preprocessing import StandardScaler",
+		},
+	},
+	// The native model standardises its inputs before gradient descent, so
+	// the penalty C means the same thing behind a StandardScaler.
+	"logistic_regression": {
+		Module:     "sklearn.linear_model",
+		Class:      "LogisticRegression",
+		Wrap:       "make_pipeline(StandardScaler(), %s)",
+		GridPrefix: "logisticregression__",
+		Classifier: true,
+		Imports: []string{
+			"from sklearn.pipeline import make_pipeline",
+			"from sklearn.preprocessing import StandardScaler",
+		},
+	},
+	// The native SGD models standardise inputs, and the regression target,
+	// with running moments; learning_rate is sklearn's eta0 on the same
+	// invscaling schedule.
+	"sgd_regressor": {
+		Module:     "sklearn.linear_model",
+		Class:      "SGDRegressor",
+		Params:     sgdParams,
+		Wrap:       "TransformedTargetRegressor(regressor=make_pipeline(StandardScaler(), %s), transformer=StandardScaler())",
+		GridPrefix: "regressor__sgdregressor__",
+		Imports: []string{
+			"from sklearn.compose import TransformedTargetRegressor",
+			"from sklearn.pipeline import make_pipeline",
+			"from sklearn.preprocessing import StandardScaler",
+		},
+	},
+	"sgd_classifier": {
+		Module:     "sklearn.linear_model",
+		Class:      "SGDClassifier",
+		Params:     sgdParams,
+		Fixed:      []string{`loss="log_loss"`, `learning_rate="invscaling"`, "eta0=0.01"},
+		Wrap:       "make_pipeline(StandardScaler(), %s)",
+		GridPrefix: "sgdclassifier__",
+		Classifier: true,
+		Imports: []string{
+			"from sklearn.pipeline import make_pipeline",
+			"from sklearn.preprocessing import StandardScaler",
+		},
+	},
+}
+
+var sgdParams = map[string]string{
+	"learning_rate": "eta0",
+	"epochs":        "max_iter",
+}
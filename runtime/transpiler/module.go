@@ -0,0 +1,191 @@
+package transpiler
+
+import (
+	"fmt"
+	"mlite/parser"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Module is a transpiled program packaged as a runnable Python script,
+// with the pip requirements its imports need.
+type Module struct {
+	Script       string
+	Requirements string // the contents of a requirements.txt
+}
+
+// flag is a command-line option of a generated module: a file a load or
+// save reads or writes, or a top-level constant.
+type flag struct {
+	name    string // the option without dashes, e.g. housing_csv for --housing-csv
+	dest    string // argparse destination: name, renamed as variables are
+	kind    string // argparse type= for constants; empty for paths
+	value   string // the default, as Python source
+	help    string
+	literal string // a path's original value, so repeated paths share a flag
+}
+
+// TranspileModule generates a script with a main(args) entry point and an
+// argparse flag for every load and save path and every top-level let of a
+// number or string, so the generated code can run on other files and
+// settings without being edited.
+//
+// load("housing.csv") followed by let floor :: 100000; becomes
+//
+//	def main(args):
+//	    df = pd.read_csv(args.housing_csv)
+//	    floor = args.floor
+//
+//	if __name__ == "__main__":
+//	    parser = argparse.ArgumentParser(description="Generated from MLite.")
+//	    parser.add_argument("--housing-csv", dest="housing_csv", default="housing.csv", help="file read by load")
+//	    parser.add_argument("--floor", dest="floor", type=int, default=100000, help="let floor")
+//	    main(parser.parse_args())
+//
+// A flag's destination is renamed as variables are, so let class :: 5;
+// reads args.class_ from --class.
+func (t *Transpiler) TranspileModule(nodes []parser.Node) Module {
+	t.flags = []*flag{}
+	t.indent = 1
+	for _, node := range nodes {
+		t.transpileNode(node)
+	}
+	t.indent = 0
+	if t.output.Len() == 0 {
+		t.writeLine("    pass")
+	}
+	t.require("import argparse")
+
+	var script strings.Builder
+	script.WriteString(t.header())
+	script.WriteString("\ndef main(args):\n")
+	t.mapOffset = strings.Count(script.String(), "\n")
+	script.WriteString(t.output.String())
+	script.WriteString("\n\nif __name__ == \"__main__\":\n")
+	script.WriteString("    parser = argparse.ArgumentParser(description=\"Generated from MLite.\")\n")
+	for _, f := range t.flags {
+		option := fmt.Sprintf("%q, dest=%q", "--"+strings.ReplaceAll(f.name, "_", "-"), f.dest)
+		if f.kind != "" {
+			option += ", type=" + f.kind
+		}
+		script.WriteString(fmt.Sprintf("    parser.add_argument(%s, default=%s, help=%s)\n", option, f.value, strconv.Quote(f.help)))
+	}
+	script.WriteString("    main(parser.parse_args())\n")
+	return Module{Script: script.String(), Requirements: t.requirements()}
+}
+
+// path renders a file name a load or save uses: quoted in a plain script,
+// and read from its flag in a module.
+func (t *Transpiler) path(file, help string) string {
+	if t.flags == nil {
+		return strconv.Quote(file)
+	}
+	for _, f := range t.flags {
+		if f.kind == "" && f.literal == file {
+			return "args." + f.dest
+		}
+	}
+	f := t.newFlag(filepath.Base(file))
+	f.value, f.help, f.literal = strconv.Quote(file), help, file
+	t.flags = append(t.flags, f)
+	return "args." + f.dest
+}
+
+// constant returns the flag a top-level let of a literal becomes in a
+// module, reading its value from args; ok is false when it stays as is.
+func (t *Transpiler) constant(name string, value *parser.ExpressionNode) (string, bool) {
+	if t.flags == nil || t.indent != 1 {
+		return "", false
+	}
+	f := t.newFlag(name)
+	f.help = "let " + name
+	switch value.Type {
+	case parser.STRING:
+		f.kind, f.value = "str", strconv.Quote(value.Value.(string))
+	case parser.LITERAL:
+		number := fmt.Sprintf("%v", value.Value)
+		if _, err := strconv.ParseFloat(number, 64); err != nil {
+			return "", false
+		}
+		f.kind, f.value = "float", number
+		if _, err := strconv.Atoi(number); err == nil {
+			f.kind = "int"
+		}
+	default:
+		return "", false
+	}
+	t.flags = append(t.flags, f)
+	return "args." + f.dest, true
+}
+
+// newFlag names a flag after a variable or file name, unique among the
+// flags so far: "housing.csv" becomes --housing-csv.
+func (t *Transpiler) newFlag(name string) *flag {
+	var b strings.Builder
+	for _, r := range strings.ToLower(name) {
+		if r >= 'a' && r <= 'z' || r >= '0' && r <= '9' {
+			b.WriteRune(r)
+		} else {
+			b.WriteByte('_')
+		}
+	}
+	base := strings.Trim(b.String(), "_")
+	if base == "" || base[0] >= '0' && base[0] <= '9' {
+		base = "file_" + base
+	}
+	unique := base
+	for n := 2; ; n++ {
+		taken := false
+		for _, f := range t.flags {
+			taken = taken || f.name == unique
+		}
+		if !taken {
+			return &flag{name: unique, dest: pyName(unique)}
+		}
+		unique = fmt.Sprintf("%s_%d", base, n)
+	}
+}
+
+// needs records a pip package the generated code uses without importing.
+func (t *Transpiler) needs(pkg string) {
+	for _, existing := range t.packages {
+		if existing == pkg {
+			return
+		}
+	}
+	t.packages = append(t.packages, pkg)
+}
+
+// packages maps the top-level Python modules generated code imports to
+// the pip packages providing them. Standard library modules are absent.
+var packages = map[string]string{
+	"pandas":       "pandas",
+	"numpy":        "numpy",
+	"sklearn":      "scikit-learn",
+	"joblib":       "joblib",
+	"skl2onnx":     "skl2onnx",
+	"sklearn2pmml": "sklearn2pmml",
+}
+
+// requirements lists the pip packages of the imports used, and of the
+// engines pandas loads by itself, one per line.
+func (t *Transpiler) requirements() string {
+	seen := map[string]bool{}
+	for _, line := range t.imports {
+		fields := strings.Fields(line)
+		if pkg, ok := packages[strings.Split(fields[1], ".")[0]]; ok {
+			seen[pkg] = true
+		}
+	}
+	for _, pkg := range t.packages {
+		seen[pkg] = true
+	}
+	var names []string
+	for pkg := range seen {
+		names = append(names, pkg)
+	}
+	sort.Strings(names)
+	return strings.Join(names, "\n") + "\n"
+}
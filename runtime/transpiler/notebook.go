@@ -0,0 +1,80 @@
+package transpiler
+
+import (
+	"encoding/json"
+	"fmt"
+	"mlite/parser"
+	"strings"
+)
+
+// Notebook generates a Jupyter notebook (nbformat 4) running the same
+// Python as Transpiler. The imports and helper functions come first, in a
+// cell of their own, and then each top-level statement is a code cell. A
+// # comment above a statement becomes a markdown cell before it.
+//
+// MLite:  # Fit on the training rows only
+//
+//	train(m, [sqft], price, data: tr);
+//
+// Notebook: a markdown cell "Fit on the training rows only", then a code
+// cell m.fit(tr[["sqft"]], tr["price"]).
+type Notebook struct {
+	python *Transpiler
+}
+
+func NewNotebook() *Notebook {
+	return &Notebook{python: NewTranspiler()}
+}
+
+// Transpile returns the notebook as JSON. Cells are maps so that a code
+// cell's execution_count is written as null, as nbformat requires before
+// the cell has run; encoding/json sorts their keys as Jupyter does.
+func (n *Notebook) Transpile(nodes []parser.Node) string {
+	var cells []map[string]any
+	for _, node := range nodes {
+		if c, ok := node.(*parser.CommentNode); ok {
+			cells = append(cells, map[string]any{"cell_type": "markdown", "source": cellLines(c.Text)})
+			continue
+		}
+		n.python.output.Reset()
+		n.python.transpileNode(node)
+		cells = append(cells, codeCell(n.python.output.String()))
+	}
+	if header := strings.TrimSpace(n.python.header()); header != "" {
+		cells = append([]map[string]any{codeCell(header)}, cells...)
+	}
+	for i, cell := range cells {
+		cell["id"] = fmt.Sprintf("cell-%d", i+1)
+		cell["metadata"] = map[string]any{}
+	}
+	if cells == nil {
+		cells = []map[string]any{}
+	}
+
+	out, err := json.MarshalIndent(map[string]any{
+		"cells": cells,
+		"metadata": map[string]any{
+			"kernelspec":    map[string]string{"display_name": "Python 3", "language": "python", "name": "python3"},
+			"language_info": map[string]string{"name": "python"},
+		},
+		"nbformat":       4,
+		"nbformat_minor": 5,
+	}, "", " ")
+	if err != nil {
+		panic(fmt.Sprintf("transpiler: notebook: %s", err))
+	}
+	return string(out) + "\n"
+}
+
+func codeCell(source string) map[string]any {
+	return map[string]any{"cell_type": "code", "execution_count": nil, "outputs": []any{}, "source": cellLines(source)}
+}
+
+// Extension is the file extension of a Jupyter notebook.
+func (n *Notebook) Extension() string { return ".ipynb" }
+
+// cellLines splits source into nbformat's list of lines, each but the
+// last ending in "\n".
+func cellLines(source string) []string {
+	return strings.SplitAfter(strings.TrimRight(source, "\n"), "\n")
+}
@@ -0,0 +1,446 @@
+package transpiler
+
+import (
+	"fmt"
+	"mlite/parser"
+	"strconv"
+	"strings"
+)
+
+// Preprocessing builtins become fitted step functions, as in the
+// interpreter: each helper below fits on the data it is given and returns
+// a step that transforms any DataFrame the same way. The transpiler tracks
+// which steps every DataFrame variable has been through, and a model
+// trained on preprocessed data runs the missing steps on whatever it
+// predicts for.
+//
+// MLite:  standardize([sqft, age])
+// Python: step_1 = standardize(df, ["sqft", "age"])
+//         df = step_1(df)
+
+const standardizeHelper = `def standardize(data, columns):
+    scaler = StandardScaler().fit(data[columns])
+
+    def step(data):
+        data = data.copy()
+        data[columns] = scaler.transform(data[columns])
+        return data
+    return step
+`
+
+const minmaxScaleHelper = `def minmax_scale(data, columns, low=0, high=1):
+    scaler = MinMaxScaler(feature_range=(low, high)).fit(data[columns])
+
+    def step(data):
+        data = data.copy()
+        data[columns] = scaler.transform(data[columns])
+        return data
+    return step
+`
+
+// oneHotHelper puts the new columns where the encoded one was, named
+// column_category like the interpreter's. Missing and unseen values encode
+// as all zeros. The step's columns attribute lists the columns it writes.
+const oneHotHelper = `def one_hot(data, column):
+    encoder = OneHotEncoder(handle_unknown="ignore", sparse_output=False).fit(data[[column]].dropna())
+
+    def step(data):
+        encoded = pd.DataFrame(encoder.transform(data[[column]]), columns=encoder.get_feature_names_out(), index=data.index)
+        at = data.columns.get_loc(column)
+        return pd.concat([data.iloc[:, :at], encoded, data.iloc[:, at + 1:]], axis=1)
+    step.columns = list(encoder.get_feature_names_out())
+    return step
+`
+
+// labelEncodeHelper maps through the fitted classes rather than calling
+// LabelEncoder.transform, which rejects missing values.
+const labelEncodeHelper = `def label_encode(data, column):
+    classes = LabelEncoder().fit(data[column].dropna()).classes_
+    codes = {c: j for j, c in enumerate(classes)}
+
+    def step(data):
+        data = data.copy()
+        data[column] = data[column].map(codes)
+        return data
+    return step
+`
+
+const imputeHelper = `def impute(data, column, strategy=None, value=None):
+    if strategy is None:
+        strategy = "constant" if value is not None else "mean" if is_numeric_dtype(data[column]) else "most_frequent"
+    imputer = SimpleImputer(strategy=strategy, fill_value=value).fit(data[[column]])
+
+    def step(data):
+        data = data.copy()
+        data[[column]] = imputer.transform(data[[column]])
+        return data
+    return step
+`
+
+const clipHelper = `def clip(data, columns, lower=None, upper=None):
+    def step(data):
+        data = data.copy()
+        data[columns] = data[columns].clip(lower, upper)
+        return data
+    return step
+`
+
+// preprocessor describes how one preprocessing builtin is emitted: its
+// parameters as in the interpreter, its helper and imports, and the
+// arguments after the data that the helper takes.
+type preprocessor struct {
+	params  []string
+	helper  string
+	imports []string
+	args    func(t *Transpiler, args map[string]*parser.ExpressionNode) []string
+}
+
+var preprocessors map[string]preprocessor
+
+func init() {
+	preprocessors = map[string]preprocessor{
+		"standardize": {
+			params:  []string{"columns", "data"},
+			helper:  standardizeHelper,
+			imports: []string{"from sklearn.preprocessing import StandardScaler"},
+			args: func(t *Transpiler, args map[string]*parser.ExpressionNode) []string {
+				return []string{quoteAll(requiredColumns("standardize", args, "columns"))}
+			},
+		},
+		"minmax_scale": {
+			params:  []string{"columns", "data", "min", "max"},
+			helper:  minmaxScaleHelper,
+			imports: []string{"from sklearn.preprocessing import MinMaxScaler"},
+			args: func(t *Transpiler, args map[string]*parser.ExpressionNode) []string {
+				return []string{
+					quoteAll(requiredColumns("minmax_scale", args, "columns")),
+					t.argOr(args, "min", "0"),
+					t.argOr(args, "max", "1"),
+				}
+			},
+		},
+		"one_hot": {
+			params:  []string{"column", "data"},
+			helper:  oneHotHelper,
+			imports: []string{"from sklearn.preprocessing import OneHotEncoder", "import pandas as pd"},
+			args: func(t *Transpiler, args map[string]*parser.ExpressionNode) []string {
+				return []string{strconv.Quote(requiredColumn("one_hot", args, "column"))}
+			},
+		},
+		"label_encode": {
+			params:  []string{"column", "data"},
+			helper:  labelEncodeHelper,
+			imports: []string{"from sklearn.preprocessing import LabelEncoder"},
+			args: func(t *Transpiler, args map[string]*parser.ExpressionNode) []string {
+				return []string{strconv.Quote(requiredColumn("label_encode", args, "column"))}
+			},
+		},
+		"impute": {
+			params:  []string{"column", "strategy", "value", "data"},
+			helper:  imputeHelper,
+			imports: []string{"from sklearn.impute import SimpleImputer", "from pandas.api.types import is_numeric_dtype"},
+			args: func(t *Transpiler, args map[string]*parser.ExpressionNode) []string {
+				return []string{
+					strconv.Quote(requiredColumn("impute", args, "column")),
+					t.argOr(args, "strategy", "None"),
+					t.argOr(args, "value", "None"),
+				}
+			},
+		},
+		"clip": {
+			params: []string{"columns", "lower", "upper", "data"},
+			helper: clipHelper,
+			args: func(t *Transpiler, args map[string]*parser.ExpressionNode) []string {
+				if args["lower"] == nil && args["upper"] == nil {
+					panic("transpiler: clip needs lower:, upper: or both")
+				}
+				return []string{
+					quoteAll(requiredColumns("clip", args, "columns")),
+					t.argOr(args, "lower", "None"),
+					t.argOr(args, "upper", "None"),
+				}
+			},
+		},
+	}
+}
+
+// preprocess writes the line fitting the step of a preprocessing call
+// before the statement that uses it, and renders the call as the step
+// applied to the data.
+func (t *Transpiler) preprocess(call *parser.ExpressionNode) string {
+	name := call.Value.(string)
+	p := preprocessors[name]
+	args := bindArgs(call, p.params)
+	for _, line := range p.imports {
+		t.require(line)
+	}
+	t.define(p.helper)
+	data := t.argOr(args, "data", "df")
+	step := fmt.Sprintf("step_%d", len(t.stepOf)+1)
+	t.stepOf[call] = step
+	if name == "one_hot" {
+		t.encoded[step] = requiredColumn(name, args, "column")
+	}
+	t.writeLine(fmt.Sprintf("%s = %s(%s)", step, name, strings.Join(append([]string{data}, p.args(t, args)...), ", ")))
+	return fmt.Sprintf("%s(%s)", step, data)
+}
+
+// MLite:  drop_na(columns: [age])
+// Python: df.dropna(subset=["age"])
+//
+// Dropping rows is not replayed at prediction time.
+func emitDropNA(t *Transpiler, args map[string]*parser.ExpressionNode) string {
+	data := t.argOr(args, "data", "df")
+	if columns := columnNames(args, "columns"); columns != nil {
+		return fmt.Sprintf("%s.dropna(subset=%s)", data, quoteAll(columns))
+	}
+	return data + ".dropna()"
+}
+
+// recordSteps tracks the steps variable has been through after it is set
+// to e: those of the data a preprocessing call or split read, plus the
+// step the call fitted.
+func (t *Transpiler) recordSteps(variables []string, e *parser.ExpressionNode) {
+	steps := t.stepsOf(e)
+	for _, v := range variables {
+		t.steps[v] = steps
+	}
+}
+
+// stepsOf returns the steps of the DataFrame e evaluates to, as far as the
+// transpiler can tell.
+func (t *Transpiler) stepsOf(e *parser.ExpressionNode) []string {
+	if e.Type == parser.IDENTIFIER {
+		return t.steps[pyName(e.Value.(string))]
+	}
+	if e.Type != parser.CALL {
+		return nil
+	}
+	name := e.Value.(string)
+	params := preprocessors[name].params
+	if fn, ok := pythonBuiltins[name]; ok {
+		params = fn.params
+	}
+	if params == nil {
+		return nil
+	}
+	args := bindArgs(e, params)
+	var inherited []string
+	if data, ok := args["data"]; ok {
+		inherited = t.stepsOf(data)
+	} else {
+		inherited = t.steps["df"]
+	}
+	switch {
+	case t.stepOf[e] != "":
+		return append(append([]string(nil), inherited...), t.stepOf[e])
+	case name == "drop_na", name == "split", name == "predict", queryBuiltins[name]:
+		return inherited
+	}
+	return nil
+}
+
+// inPlaceTarget returns the variable a preprocessing statement updates: the
+// data argument when it names a variable, else df.
+func inPlaceTarget(call *parser.ExpressionNode) (string, bool) {
+	name := call.Value.(string)
+	params := preprocessors[name].params
+	if name == "drop_na" {
+		params = pythonBuiltins[name].params
+	}
+	if params == nil {
+		return "", false
+	}
+	args := bindArgs(call, params)
+	e, ok := args["data"]
+	switch {
+	case !ok:
+		return "df", true
+	case e.Type == parser.IDENTIFIER:
+		return pyName(e.Value.(string)), true
+	}
+	return "", false
+}
+
+// replay renders data passed through the steps modelVar was trained after
+// that data has not been through, mirroring Dataset.Replay.
+func (t *Transpiler) replay(modelVar, data string) string {
+	chain, have := t.modelSteps[modelVar], t.steps[data]
+	done := 0
+	for done < len(chain) && done < len(have) && chain[done] == have[done] {
+		done++
+	}
+	for _, step := range chain[done:] {
+		data = fmt.Sprintf("%s(%s)", step, data)
+	}
+	return data
+}
+
+// featuresOf renders the feature columns of data, which has been through
+// steps. A column a one-hot step among them encoded stands for the columns
+// the step wrote, as in Dataset.ExpandColumns.
+func (t *Transpiler) featuresOf(data string, columns, steps []string) string {
+	items := make([]string, len(columns))
+	for j, c := range columns {
+		items[j] = strconv.Quote(c)
+		for _, step := range steps {
+			if t.encoded[step] == c {
+				items[j] = "*" + step + ".columns"
+			}
+		}
+	}
+	return fmt.Sprintf("%s[[%s]]", data, strings.Join(items, ", "))
+}
+
+func requiredColumns(fn string, args map[string]*parser.ExpressionNode, name string) []string {
+	columns := columnNames(args, name)
+	if columns == nil {
+		panic(fmt.Sprintf("transpiler: %s: missing argument %s", fn, name))
+	}
+	return columns
+}
+
+func requiredColumn(fn string, args map[string]*parser.ExpressionNode, name string) string {
+	column := columnName(args, name)
+	if column == "" {
+		panic(fmt.Sprintf("transpiler: %s: missing argument %s", fn, name))
+	}
+	return column
+}
+
+// quoteAll renders names as a Python list of strings.
+func quoteAll(names []string) string {
+	quoted := make([]string, len(names))
+	for j, n := range names {
+		quoted[j] = strconv.Quote(n)
+	}
+	return "[" + strings.Join(quoted, ", ") + "]"
+}
+
+// onColumnsHelper applies a transformer to some columns and passes the
+// others through, keeping column names so later steps can select them.
+const onColumnsHelper = `def on_columns(name, transformer, columns):
+    return (name, ColumnTransformer([(name, transformer, columns)], remainder="passthrough", verbose_feature_names_out=False))
+`
+
+// MLite:  pipeline([standardize(sqft), one_hot(city), linreg()])
+// Python: Pipeline([on_columns("standardize", StandardScaler(), ["sqft"]), on_columns("one_hot", ...),
+// ("model", LinearRegression())]).set_output(transform="pandas")
+//
+// Without a data type to go by, impute defaults to the mean; give text
+// columns strategy: "most_frequent".
+func emitPipeline(t *Transpiler, args map[string]*parser.ExpressionNode) string {
+	list, ok := args["steps"]
+	if !ok || list.Type != parser.ARRAY || len(list.Args) == 0 {
+		panic("transpiler: pipeline needs a list of preprocessing steps ending with a model")
+	}
+	t.require("from sklearn.pipeline import Pipeline")
+	t.require("from sklearn.compose import ColumnTransformer")
+	t.define(onColumnsHelper)
+
+	var steps []string
+	seen := map[string]int{}
+	for _, e := range list.Args[:len(list.Args)-1] {
+		name, _ := e.Value.(string)
+		p, ok := preprocessors[name]
+		if e.Type != parser.CALL || !ok {
+			panic(fmt.Sprintf("transpiler: pipeline: %v is not a preprocessing step", e.Value))
+		}
+		stepArgs := bindArgs(e, p.params)
+		if _, ok := stepArgs["data"]; ok {
+			panic(fmt.Sprintf("transpiler: pipeline: %s takes no data: inside a pipeline", name))
+		}
+		seen[name]++
+		label := name
+		if seen[name] > 1 {
+			label = fmt.Sprintf("%s_%d", name, seen[name])
+		}
+		columns := columnNames(stepArgs, "columns")
+		if columns == nil {
+			columns = []string{requiredColumn(name, stepArgs, "column")}
+		}
+		steps = append(steps, fmt.Sprintf("on_columns(%s, %s, %s)", strconv.Quote(label), t.transformer(name, stepArgs), quoteAll(columns)))
+	}
+
+	last := list.Args[len(list.Args)-1]
+	var model string
+	switch {
+	case last.Type == parser.IDENTIFIER && t.models[pyName(last.Value.(string))] != "":
+		t.require("from sklearn.base import clone")
+		model = fmt.Sprintf("clone(%s)", pyName(last.Value.(string)))
+	case last.Type == parser.IDENTIFIER || last.Type == parser.CALL:
+		m, ok := sklearnModels[fmt.Sprintf("%v", last.Value)]
+		if !ok {
+			panic("transpiler: pipeline: the last step must be a model")
+		}
+		call := last
+		if last.Type == parser.IDENTIFIER {
+			call = &parser.ExpressionNode{Type: parser.CALL, Value: last.Value}
+		}
+		model = t.modelConstructor(m, call)
+	default:
+		panic("transpiler: pipeline: the last step must be a model")
+	}
+	steps = append(steps, fmt.Sprintf(`("model", %s)`, model))
+	return fmt.Sprintf(`Pipeline([%s]).set_output(transform="pandas")`, strings.Join(steps, ", "))
+}
+
+// transformer renders the scikit-learn transformer of a pipeline step.
+func (t *Transpiler) transformer(name string, args map[string]*parser.ExpressionNode) string {
+	switch name {
+	case "standardize":
+		t.require("from sklearn.preprocessing import StandardScaler")
+		return "StandardScaler()"
+	case "minmax_scale":
+		t.require("from sklearn.preprocessing import MinMaxScaler")
+		if args["min"] == nil && args["max"] == nil {
+			return "MinMaxScaler()"
+		}
+		return fmt.Sprintf("MinMaxScaler(feature_range=(%s, %s))", t.argOr(args, "min", "0"), t.argOr(args, "max", "1"))
+	case "one_hot":
+		t.require("from sklearn.preprocessing import OneHotEncoder")
+		return `OneHotEncoder(handle_unknown="ignore", sparse_output=False)`
+	case "label_encode":
+		t.require("from sklearn.preprocessing import OrdinalEncoder")
+		return "OrdinalEncoder()"
+	case "impute":
+		t.require("from sklearn.impute import SimpleImputer")
+		var options []string
+		if s, ok := args["strategy"]; ok {
+			options = append(options, "strategy="+t.expression(s))
+		} else if _, ok := args["value"]; ok {
+			options = append(options, `strategy="constant"`)
+		}
+		if v, ok := args["value"]; ok {
+			options = append(options, "fill_value="+t.expression(v))
+		}
+		return fmt.Sprintf("SimpleImputer(%s)", strings.Join(options, ", "))
+	case "clip":
+		t.require("import pandas as pd")
+		t.require("from sklearn.preprocessing import FunctionTransformer")
+		if args["lower"] == nil && args["upper"] == nil {
+			panic("transpiler: clip needs lower:, upper: or both")
+		}
+		return fmt.Sprintf(`FunctionTransformer(pd.DataFrame.clip, kw_args={"lower": %s, "upper": %s}, feature_names_out="one-to-one")`,
+			t.argOr(args, "lower", "None"), t.argOr(args, "upper", "None"))
+	}
+	panic(fmt.Sprintf("transpiler: pipeline: %s is not a preprocessing step", name))
+}
+
+// recordPipeline remembers that variable holds a pipeline, and the type of
+// its final model.
+func (t *Transpiler) recordPipeline(variable string, e *parser.ExpressionNode) {
+	if e.Type != parser.CALL || e.Value != "pipeline" {
+		return
+	}
+	t.pipelines[variable] = true
+	args := bindArgs(e, pythonBuiltins["pipeline"].params)
+	if list := args["steps"]; list != nil && len(list.Args) > 0 {
+		last := list.Args[len(list.Args)-1]
+		name := fmt.Sprintf("%v", last.Value)
+		if declared := t.models[name]; declared != "" && last.Type == parser.IDENTIFIER {
+			name = declared
+		}
+		t.models[variable] = name
+	}
+}
@@ -0,0 +1,191 @@
+package transpiler
+
+import (
+	"fmt"
+	"mlite/parser"
+	"strconv"
+	"strings"
+)
+
+// Query builtins become pandas DataFrame methods. Expressions in filter and
+// with_column name columns directly; the transpiler reads a bare name there
+// as a column unless a let or set declared a variable of that name. (The
+// interpreter, which knows the data, prefers the column.)
+//
+// MLite:  filter(df, price > 100000 && age < 20)
+// Python: df[(df["price"] > 100000) & (df["age"] < 20)]
+
+// queryBuiltins lists the builtins whose result has been through the same
+// preprocessing steps as their data.
+var queryBuiltins = map[string]bool{
+	"select": true, "filter": true, "sort": true, "with_column": true,
+	"head": true, "tail": true, "sample": true,
+}
+
+// pandasOperators maps MLite operators whose pandas spelling differs: on
+// columns, && and || are the element-wise & and |.
+var pandasOperators = map[string]string{"&&": "&", "||": "|"}
+
+// pythonOperators maps MLite operators to their Python spelling on plain
+// values.
+var pythonOperators = map[string]string{"&&": "and", "||": "or"}
+
+// MLite:  select(df, [sqft, price])
+// Python: df[["sqft", "price"]]
+func emitSelect(t *Transpiler, args map[string]*parser.ExpressionNode) string {
+	return columnsOf(t.argOr(args, "data", "df"), requiredColumns("select", args, "columns"))
+}
+
+// MLite:  filter(df, price > 100000)
+// Python: df[df["price"] > 100000]
+//
+// Data that is not a variable is filtered through .loc with a lambda, so
+// it is only computed once.
+func emitFilter(t *Transpiler, args map[string]*parser.ExpressionNode) string {
+	condition, ok := args["condition"]
+	if !ok {
+		panic("transpiler: filter: missing argument condition")
+	}
+	data, column := t.queryData(args)
+	if column == data {
+		return fmt.Sprintf("%s[%s]", data, t.columnExpression(column, condition))
+	}
+	return fmt.Sprintf("%s.loc[lambda %s: %s]", data, column, t.columnExpression(column, condition))
+}
+
+// MLite:  sort(df, by: price, desc: true)
+// Python: df.sort_values(["price"], ascending=False, kind="stable")
+func emitSort(t *Transpiler, args map[string]*parser.ExpressionNode) string {
+	parts := []string{quoteAll(requiredColumns("sort", args, "by"))}
+	if desc, ok := args["desc"]; ok {
+		switch {
+		case desc.Type == parser.IDENTIFIER && desc.Value == "true" && !t.variables[pyName("true")]:
+			parts = append(parts, "ascending=False")
+		case desc.Type == parser.IDENTIFIER && desc.Value == "false" && !t.variables[pyName("false")]:
+		default:
+			parts = append(parts, "ascending=not "+t.expression(desc))
+		}
+	}
+	parts = append(parts, `kind="stable"`)
+	return fmt.Sprintf("%s.sort_values(%s)", t.argOr(args, "data", "df"), strings.Join(parts, ", "))
+}
+
+// MLite:  with_column(df, "ppsf", price / sqft)
+// Python: df.assign(ppsf=df["price"] / df["sqft"])
+//
+// A condition is stored as 0/1, as the interpreter stores it.
+func emitWithColumn(t *Transpiler, args map[string]*parser.ExpressionNode) string {
+	name := requiredColumn("with_column", args, "name")
+	e, ok := args["value"]
+	if !ok {
+		panic("transpiler: with_column: missing argument value")
+	}
+	data, column := t.queryData(args)
+	value := t.columnExpression(column, e)
+	if isCondition(e) {
+		value = fmt.Sprintf("(%s).astype(int)", value)
+	}
+	if column != data {
+		value = fmt.Sprintf("lambda %s: %s", column, value)
+	}
+	if isIdentifier(name) {
+		return fmt.Sprintf("%s.assign(%s=%s)", data, name, value)
+	}
+	return fmt.Sprintf("%s.assign(**{%s: %s})", data, strconv.Quote(name), value)
+}
+
+// MLite:  head(df, 10)
+// Python: df.head(10)
+func emitHead(t *Transpiler, args map[string]*parser.ExpressionNode) string {
+	return fmt.Sprintf("%s.head(%s)", t.argOr(args, "data", "df"), t.argOr(args, "n", "5"))
+}
+
+// MLite:  tail(df, 10)
+// Python: df.tail(10)
+func emitTail(t *Transpiler, args map[string]*parser.ExpressionNode) string {
+	return fmt.Sprintf("%s.tail(%s)", t.argOr(args, "data", "df"), t.argOr(args, "n", "5"))
+}
+
+// MLite:  sample(df, 100, seed: 1)
+// Python: df.sample(n=100, random_state=1)
+//
+// pandas draws different rows than the interpreter for the same seed.
+func emitSample(t *Transpiler, args map[string]*parser.ExpressionNode) string {
+	if _, ok := args["n"]; !ok {
+		panic("transpiler: sample: missing argument n")
+	}
+	return fmt.Sprintf("%s.sample(n=%s, random_state=%s)", t.argOr(args, "data", "df"), t.argOr(args, "n", ""), t.argOr(args, "seed", "0"))
+}
+
+// describeHelper mirrors the interpreter's profile: pandas' describe with
+// each column's type, missing and distinct counts, then the correlations.
+const describeHelper = `def describe(data):
+    summary = data.describe(include="all").T
+    summary.insert(0, "type", data.dtypes.astype(str))
+    summary.insert(2, "missing", data.isna().sum())
+    summary["distinct"] = data.nunique()
+    return f"{summary}\n\ncorrelation\n{data.corr(numeric_only=True).round(3)}"
+`
+
+// MLite:  describe(df)
+// Python: describe(df)
+func emitDescribe(t *Transpiler, args map[string]*parser.ExpressionNode) string {
+	t.define(describeHelper)
+	return fmt.Sprintf("describe(%s)", t.argOr(args, "data", "df"))
+}
+
+// queryData renders the data argument of a query builtin, and the name its
+// column expressions refer to it by: the variable itself, or d when the
+// data is computed and must be reached through a lambda.
+func (t *Transpiler) queryData(args map[string]*parser.ExpressionNode) (data, column string) {
+	e, ok := args["data"]
+	if !ok {
+		return "df", "df"
+	}
+	data = t.expression(e)
+	if e.Type == parser.IDENTIFIER {
+		return data, data
+	}
+	return data, t.fresh("d")
+}
+
+// columnExpression renders e with bare names as columns of data and
+// operators applied element-wise. pandas' & and | bind tighter than
+// comparisons, so the comparisons they join are parenthesized.
+func (t *Transpiler) columnExpression(data string, e *parser.ExpressionNode) string {
+	switch e.Type {
+	case parser.IDENTIFIER:
+		name := e.Value.(string)
+		if t.variables[pyName(name)] {
+			return pyName(name)
+		}
+		if name == "true" || name == "false" {
+			return t.expression(e)
+		}
+		return columnOf(data, name)
+	case parser.BINARY, parser.UNARY:
+		return pandasSpelling.operation(e, func(operand *parser.ExpressionNode) string {
+			return t.columnExpression(data, operand)
+		})
+	}
+	return t.expression(e)
+}
+
+// operation renders an operator on plain values, as in an if condition.
+func (t *Transpiler) operation(e *parser.ExpressionNode) string {
+	return plainSpelling.operation(e, t.expression)
+}
+
+// isCondition reports whether e gives true/false values.
+func isCondition(e *parser.ExpressionNode) bool {
+	switch e.Type {
+	case parser.BINARY:
+		switch e.Value {
+		case "==", "!=", "<", "<=", ">", ">=", "&&", "||":
+			return true
+		}
+	case parser.UNARY:
+		return e.Value == "!"
+	}
+	return false
+}
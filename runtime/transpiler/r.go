@@ -0,0 +1,867 @@
+package transpiler
+
+import (
+	"fmt"
+	"mlite/dataset"
+	"mlite/parser"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// RTranspiler walks the AST and builds an R script in tidyverse style:
+// readr and dplyr for data, and lm, glm and gbm for models.
+// It covers loading and saving, the query and grouping builtins, training,
+// prediction and the basic metrics; a builtin with no R counterpart here,
+// such as search or pipeline, panics naming it.
+type RTranspiler struct {
+	writer
+	libraries []string // packages to attach with library(), in first-use order
+	helpers   []string // function definitions emitted after the libraries
+
+	variables map[string]bool                   // names declared with let or set
+	specs     map[string]*parser.ExpressionNode // model variable → the constructor it was declared with
+	types     map[string]string                 // fitted model variable → MLite model type
+	fitted    map[string]*parser.TrainNode      // model variable → the train statement that last fitted it
+}
+
+func NewRTranspiler() *RTranspiler {
+	return &RTranspiler{
+		writer:    writer{tab: "  "},
+		variables: make(map[string]bool),
+		specs:     make(map[string]*parser.ExpressionNode),
+		types:     make(map[string]string),
+		fitted:    make(map[string]*parser.TrainNode),
+	}
+}
+
+// rModel is how an MLite model type is fitted in R. R fits a model from a
+// formula in one call, so the constructor in a let only records settings
+// and the fit is emitted by train.
+type rModel struct {
+	Library    string            // package providing Fit; empty for base R
+	Fit        string            // the fitting function, e.g. lm
+	Extra      string            // fixed arguments, e.g. family = binomial
+	Params     map[string]string // MLite parameter → R argument
+	Defaults   [][2]string       // R arguments given the interpreter's default unless set, in order
+	Classifier bool
+}
+
+// rModels maps the MLite model types R can fit. glm's binomial family fits
+// two classes only. gbm_regressor is fitted by the gbm package, whose own
+// defaults (depth 1, half the rows per tree) are replaced by the
+// interpreter's. gbm_classifier has no translation: gbm's bernoulli fit
+// needs 0/1 labels and predicts probabilities, not the labels MLite does.
+var rModels = map[string]rModel{
+	"linear_regression":   {Fit: "lm"},
+	"linreg":              {Fit: "lm"},
+	"logistic_regression": {Fit: "glm", Extra: "family = binomial", Classifier: true},
+	"gbm_regressor": {
+		Library: "gbm",
+		Fit:     "gbm",
+		Extra:   `distribution = "gaussian"`,
+		Params: map[string]string{
+			"n_estimators":     "n.trees",
+			"max_depth":        "interaction.depth",
+			"learning_rate":    "shrinkage",
+			"subsample":        "bag.fraction",
+			"min_samples_leaf": "n.minobsinnode",
+		},
+		Defaults: [][2]string{{"n.trees", "100"}, {"interaction.depth", "3"}, {"shrinkage", "0.1"}, {"bag.fraction", "1"}, {"n.minobsinnode", "1"}},
+	},
+}
+
+// rReaders and rWriters give the readr, jsonlite and arrow calls for each
+// file format, as format strings taking the quoted file name (and, for a
+// writer, the data first).
+var rReaders = map[dataset.Format]string{
+	dataset.CSV:       "read_csv(%s, show_col_types = FALSE)",
+	dataset.TSV:       "read_tsv(%s, show_col_types = FALSE)",
+	dataset.JSON:      "as_tibble(fromJSON(%s))",
+	dataset.JSONLines: "as_tibble(stream_in(file(%s), verbose = FALSE))",
+	dataset.Parquet:   "read_parquet(%s)",
+}
+
+var rWriters = map[dataset.Format]string{
+	dataset.CSV:       "write_csv(%s, %s)",
+	dataset.TSV:       "write_tsv(%s, %s)",
+	dataset.JSON:      "write_json(%s, %s)",
+	dataset.JSONLines: "stream_out(%s, file(%s), verbose = FALSE)",
+	dataset.Parquet:   "write_parquet(%s, %s)",
+}
+
+// rLibraries names the package each format's reader and writer come from.
+var rLibraries = map[dataset.Format]string{
+	dataset.CSV:       "readr",
+	dataset.TSV:       "readr",
+	dataset.JSON:      "jsonlite",
+	dataset.JSONLines: "jsonlite",
+	dataset.Parquet:   "arrow",
+}
+
+// library records a package the generated code attaches.
+func (r *RTranspiler) library(name string) {
+	for _, existing := range r.libraries {
+		if existing == name {
+			return
+		}
+	}
+	r.libraries = append(r.libraries, name)
+}
+
+// define records a top-level R function the generated code calls.
+func (r *RTranspiler) define(helper string) {
+	for _, existing := range r.helpers {
+		if existing == helper {
+			return
+		}
+	}
+	r.helpers = append(r.helpers, helper)
+}
+
+// Transpile returns the R script: library() calls, helper functions, then
+// the statements.
+func (r *RTranspiler) Transpile(nodes []parser.Node) string {
+	for _, node := range nodes {
+		r.transpileNode(node)
+	}
+
+	var header strings.Builder
+	libraries := append([]string(nil), r.libraries...)
+	sort.Strings(libraries)
+	for _, name := range libraries {
+		header.WriteString("library(" + name + ")\n")
+	}
+	if len(libraries) > 0 {
+		header.WriteString("\n")
+	}
+	for _, helper := range r.helpers {
+		header.WriteString(helper + "\n")
+	}
+	return header.String() + r.output.String()
+}
+
+// Extension is the file extension of an R script.
+func (r *RTranspiler) Extension() string { return ".R" }
+
+// transpileNode follows Transpiler.transpileNode case for case.
+func (r *RTranspiler) transpileNode(node parser.Node) {
+	switch n := node.(type) {
+
+	// MLite:  let x :: 10
+	// R:      x <- 10
+	//
+	// MLite:  let m :: gbm_regressor(n_estimators: 200)
+	// R:      (nothing until train)
+	//
+	// MLite:  let tr, te :: split(df, test: 0.2)
+	// R:      set.seed(0)
+	//         test_rows <- sample(nrow(df), round(nrow(df) * 0.2))
+	//         tr <- df[setdiff(seq_len(nrow(df)), test_rows), ]
+	//         te <- df[test_rows, ]
+	case *parser.LetNode:
+		if n.Names != nil {
+			r.unpack(n.Names, n.Value)
+			break
+		}
+		r.assign(n.Variable, n.Value)
+
+	// MLite:  set(x, 10)
+	// R:      x <- 10
+	case *parser.SetNode:
+		r.assign(n.Variable, n.Value)
+
+	// MLite:  load("data.csv")
+	// R:      df <- read_csv("data.csv", show_col_types = FALSE)
+	//
+	// MLite:  load(sqlite: "f.db", query: "SELECT * FROM h WHERE city = :city")
+	// R:      con <- dbConnect(SQLite(), "f.db")
+	//         df <- as_tibble(dbGetQuery(con, "SELECT * FROM h WHERE city = :city", params = list(city = city)))
+	//         dbDisconnect(con)
+	case *parser.LoadNode:
+		if n.SQLite != "" {
+			r.library("DBI")
+			r.library("RSQLite")
+			r.library("dplyr")
+			var params []string
+			for _, name := range dataset.QueryParameters(n.Query) {
+				params = append(params, fmt.Sprintf("%s = %s", rColumn(name), rName(name)))
+			}
+			query := strconv.Quote(n.Query)
+			if len(params) > 0 {
+				query += ", params = list(" + strings.Join(params, ", ") + ")"
+			}
+			r.writeLine(fmt.Sprintf("con <- dbConnect(SQLite(), %s)", strconv.Quote(n.SQLite)))
+			r.writeLine(fmt.Sprintf("df <- as_tibble(dbGetQuery(con, %s))", query))
+			r.writeLine("dbDisconnect(con)")
+			break
+		}
+		format := r.fileFormat(n.File, n.Format)
+		if format == dataset.JSON || format == dataset.JSONLines {
+			r.library("dplyr") // as_tibble
+		}
+		r.writeLine("df <- " + fmt.Sprintf(rReaders[format], strconv.Quote(n.File)))
+
+	// MLite:  save(preds, "out.csv")
+	// R:      write_csv(preds, "out.csv")
+	case *parser.SaveNode:
+		data := rName(n.Data)
+		if data == "" {
+			data = "df"
+		}
+		if n.SQLite != "" {
+			r.library("DBI")
+			r.library("RSQLite")
+			r.writeLine(fmt.Sprintf("con <- dbConnect(SQLite(), %s)", strconv.Quote(n.SQLite)))
+			r.writeLine(fmt.Sprintf("dbWriteTable(con, %s, %s, overwrite = TRUE)", strconv.Quote(n.Table), data))
+			r.writeLine("dbDisconnect(con)")
+			break
+		}
+		r.writeLine(fmt.Sprintf(rWriters[r.fileFormat(n.File, n.Format)], data, strconv.Quote(n.File)))
+
+	// MLite:  train(m, [sqft, age], price)
+	// R:      m <- lm(price ~ sqft + age, data = df)
+	case *parser.TrainNode:
+		r.train(n)
+
+	// MLite:  predict(m, [1.5, 2.0])
+	// R:      print(predict(m, newdata = tibble(sqft = 1.5, age = 2.0)))
+	//
+	// MLite:  predict(m, te, into: "price_hat")
+	// R:      te$price_hat <- predict(m, newdata = te)
+	case *parser.PredictNode:
+		model := rName(n.Model)
+		if n.Input == nil {
+			predictions := r.predictCall(model, rName(n.Data))
+			if n.Into == "" {
+				r.writeLine(fmt.Sprintf("print(%s)", predictions))
+			} else {
+				r.writeLine(fmt.Sprintf("%s <- %s", rColumnOf(rName(n.Data), n.Into), predictions))
+			}
+			break
+		}
+		fit := r.fittedModel(model, "predict")
+		if len(n.Input) != len(fit.Features) {
+			panic(fmt.Sprintf("transpiler: predict(%s) needs %d value(s), got %d", n.Model, len(fit.Features), len(n.Input)))
+		}
+		var row []string
+		for j, v := range n.Input {
+			row = append(row, fmt.Sprintf("%s = %v", rColumn(fit.Features[j]), v))
+		}
+		r.library("dplyr") // tibble
+		r.writeLine(fmt.Sprintf("print(%s)", r.predictCall(model, "tibble("+strings.Join(row, ", ")+")")))
+
+	// MLite:  evaluate(m, te)
+	// R:      print(evaluate_regressor(predict(m, newdata = te), te$price))
+	case *parser.EvaluateNode:
+		data := rName(n.Data)
+		if data == "" {
+			data = "df"
+		}
+		r.writeLine(fmt.Sprintf("print(%s)", r.evaluateCall(rName(n.Model), data)))
+
+	// MLite:  drop_na(price)
+	// R:      df <- drop_na(df, price)
+	//
+	// Other call statements print their result, as the interpreter does,
+	// unless the builtin is only called for its effect.
+	case *parser.CallNode:
+		name := n.Call.Value.(string)
+		switch {
+		case name == "drop_na":
+			target := "df"
+			if data, ok := bindArgs(n.Call, pythonBuiltins[name].params)["data"]; ok {
+				if data.Type != parser.IDENTIFIER {
+					panic("transpiler: drop_na: the data argument must be a variable")
+				}
+				target = rName(data.Value.(string))
+			}
+			r.writeLine(fmt.Sprintf("%s <- %s", target, r.expression(n.Call)))
+		case name == "save_model":
+			r.writeLine(r.expression(n.Call))
+		default:
+			r.writeLine(fmt.Sprintf("print(%s)", r.expression(n.Call)))
+		}
+
+	// MLite:  if(x > 5) { ... }
+	// R:      if (x > 5) {
+	//           ...
+	//         }
+	case *parser.IfNode:
+		condition := &parser.ExpressionNode{Type: parser.BINARY, Value: n.Operator, Args: []*parser.ExpressionNode{n.Left, n.Right}}
+		r.writeLine(fmt.Sprintf("if (%s) {", r.expression(condition)))
+		r.block(n.Commands)
+
+	// MLite:  loop(3) { ... }
+	// R:      for (i in seq_len(3)) {
+	//           ...
+	//         }
+	case *parser.LoopNode:
+		counter := "i"
+		for r.variables[counter] {
+			counter += "_"
+		}
+		r.writeLine(fmt.Sprintf("for (%s in seq_len(%s)) {", counter, r.expression(n.Count)))
+		r.block(n.Commands)
+
+	case *parser.CommentNode:
+		r.writeComment(n.Text)
+
+	default:
+		panic(fmt.Sprintf("transpiler: unsupported node type %T", node))
+	}
+}
+
+// block writes the commands of an if or loop and closes its brace.
+func (r *RTranspiler) block(commands []parser.Node) {
+	r.indent++
+	for _, cmd := range commands {
+		r.transpileNode(cmd)
+	}
+	r.indent--
+	r.writeLine("}")
+}
+
+// assign writes a let or set. A model constructor is only recorded: R fits
+// it when it is trained.
+func (r *RTranspiler) assign(name string, value *parser.ExpressionNode) {
+	variable := rName(name)
+	r.variables[variable] = true
+	delete(r.specs, variable)
+	if value.Type == parser.CALL {
+		if _, ok := sklearnModels[value.Value.(string)]; ok {
+			if _, ok := rModels[value.Value.(string)]; !ok {
+				panic(fmt.Sprintf("transpiler: %s has no R translation", value.Value))
+			}
+			r.specs[variable] = value
+			return
+		}
+	}
+	r.writeLine(fmt.Sprintf("%s <- %s", variable, r.expression(value)))
+}
+
+// unpack writes a destructuring let, which in R only split has.
+func (r *RTranspiler) unpack(names []string, value *parser.ExpressionNode) {
+	if value.Type != parser.CALL || value.Value != "split" || len(names) != 2 {
+		panic("transpiler: only let train, test :: split(...) can unpack in R")
+	}
+	args := bindArgs(value, pythonBuiltins["split"].params)
+	if _, ok := args["stratify"]; ok {
+		panic("transpiler: split: stratify has no R translation")
+	}
+	data := r.argOr(args, "data", "df")
+	rows := "test_rows"
+	for r.variables[rows] {
+		rows += "_"
+	}
+	r.writeLine(fmt.Sprintf("set.seed(%s)", r.argOr(args, "seed", "0")))
+	r.writeLine(fmt.Sprintf("%s <- sample(nrow(%s), round(nrow(%s) * %s))", rows, data, data, r.argOr(args, "test", "0.25")))
+	r.writeLine(fmt.Sprintf("%s <- %s[setdiff(seq_len(nrow(%s)), %s), ]", rName(names[0]), data, data, rows))
+	r.writeLine(fmt.Sprintf("%s <- %s[%s, ]", rName(names[1]), data, rows))
+	r.variables[rName(names[0])] = true
+	r.variables[rName(names[1])] = true
+}
+
+// train fits a model variable, or a model type used as one, by formula.
+func (r *RTranspiler) train(n *parser.TrainNode) {
+	model := rName(n.Model)
+	modelType := "linear_regression"
+	var keywords []*parser.KeywordArg
+	if spec, ok := r.specs[model]; ok {
+		modelType, keywords = spec.Value.(string), spec.Keywords
+	} else if _, ok := sklearnModels[n.Model]; ok {
+		modelType = n.Model
+	} else if fitted, ok := r.types[model]; ok {
+		modelType = fitted
+	}
+	m, ok := rModels[modelType]
+	if !ok {
+		panic(fmt.Sprintf("transpiler: %s has no R translation", modelType))
+	}
+	data := rName(n.Data)
+	if data == "" {
+		data = "df"
+	}
+
+	response := rColumn(n.Target)
+	if m.Classifier {
+		response = "as.factor(" + response + ")"
+	}
+	features := make([]string, len(n.Features))
+	for j, f := range n.Features {
+		features[j] = rColumn(f)
+	}
+	args := []string{response + " ~ " + strings.Join(features, " + "), "data = " + data}
+	if m.Extra != "" {
+		args = append(args, m.Extra)
+	}
+	set := map[string]string{}
+	var order []string
+	for _, d := range m.Defaults {
+		set[d[0]] = d[1]
+		order = append(order, d[0])
+	}
+	for _, kw := range keywords {
+		if kw.Name == "seed" {
+			r.writeLine(fmt.Sprintf("set.seed(%s)", r.expression(kw.Value)))
+			continue
+		}
+		param, ok := m.Params[kw.Name]
+		if !ok {
+			panic(fmt.Sprintf("transpiler: %s: %s has no R translation", modelType, kw.Name))
+		}
+		if _, ok := set[param]; !ok {
+			order = append(order, param)
+		}
+		set[param] = r.expression(kw.Value)
+	}
+	for _, param := range order {
+		args = append(args, fmt.Sprintf("%s = %s", param, set[param]))
+	}
+	if m.Library != "" {
+		r.library(m.Library)
+	}
+	r.writeLine(fmt.Sprintf("%s <- %s(%s)", model, m.Fit, strings.Join(args, ", ")))
+	r.variables[model] = true
+	r.types[model] = modelType
+	r.fitted[model] = &parser.TrainNode{Model: model, Features: n.Features, Target: n.Target, Data: data}
+}
+
+// fittedModel returns the train statement that fitted model, which caller
+// needs to know the model's columns.
+func (r *RTranspiler) fittedModel(model, caller string) *parser.TrainNode {
+	fit, ok := r.fitted[model]
+	if !ok {
+		panic(fmt.Sprintf("transpiler: %s(%s) needs %s to be trained first", caller, model, model))
+	}
+	return fit
+}
+
+// predictClassHelper turns glm's probability of the second class into
+// class labels, as predict does for the other models.
+const predictClassHelper = `predict_class <- function(model, data) {
+  labels <- levels(model$model[[1]])
+  labels[(predict(model, newdata = data, type = "response") > 0.5) + 1]
+}
+`
+
+// predictCall renders the predictions of a model for the rows of data. A
+// gbm model predicts with all of its trees.
+func (r *RTranspiler) predictCall(model, data string) string {
+	r.fittedModel(model, "predict")
+	switch rModels[r.types[model]].Fit {
+	case "glm":
+		r.define(predictClassHelper)
+		return fmt.Sprintf("predict_class(%s, %s)", model, data)
+	case "gbm":
+		return fmt.Sprintf("predict(%s, newdata = %s, n.trees = %s$n.trees)", model, data, model)
+	}
+	return fmt.Sprintf("predict(%s, newdata = %s)", model, data)
+}
+
+const evaluateRegressorRHelper = `evaluate_regressor <- function(predicted, actual) {
+  residual <- actual - predicted
+  c(
+    mae = mean(abs(residual)),
+    mse = mean(residual^2),
+    rmse = sqrt(mean(residual^2)),
+    r2 = 1 - sum(residual^2) / sum((actual - mean(actual))^2)
+  )
+}
+`
+
+const evaluateClassifierRHelper = `evaluate_classifier <- function(predicted, actual) {
+  list(accuracy = mean(predicted == actual), confusion_matrix = table(actual, predicted))
+}
+`
+
+// evaluateCall scores model on data with the metrics R computes without
+// further packages.
+func (r *RTranspiler) evaluateCall(model, data string) string {
+	fit := r.fittedModel(model, "evaluate")
+	helper, name := evaluateRegressorRHelper, "evaluate_regressor"
+	if rModels[r.types[model]].Classifier {
+		helper, name = evaluateClassifierRHelper, "evaluate_classifier"
+	}
+	r.define(helper)
+	return fmt.Sprintf("%s(%s, %s)", name, r.predictCall(model, data), rColumnOf(data, fit.Target))
+}
+
+// rBuiltins emits the R for the MLite builtins it translates. Arguments
+// are bound with the Python backend's parameter lists, which follow the
+// interpreter's.
+var rBuiltins map[string]func(r *RTranspiler, args map[string]*parser.ExpressionNode) string
+
+func init() {
+	rBuiltins = map[string]func(r *RTranspiler, args map[string]*parser.ExpressionNode) string{
+		"predict": func(r *RTranspiler, args map[string]*parser.ExpressionNode) string {
+			return r.predictCall(r.argOr(args, "model", ""), r.argOr(args, "data", "df"))
+		},
+		"evaluate": func(r *RTranspiler, args map[string]*parser.ExpressionNode) string {
+			return r.evaluateCall(r.argOr(args, "model", ""), r.argOr(args, "data", "df"))
+		},
+		"save_model": func(r *RTranspiler, args map[string]*parser.ExpressionNode) string {
+			return fmt.Sprintf("saveRDS(%s, %s)", r.argOr(args, "model", ""), r.argOr(args, "path", ""))
+		},
+		"drop_na": func(r *RTranspiler, args map[string]*parser.ExpressionNode) string {
+			r.library("tidyr")
+			return fmt.Sprintf("drop_na(%s)", strings.Join(append([]string{r.argOr(args, "data", "df")}, rColumns(columnNames(args, "columns"))...), ", "))
+		},
+		"select": func(r *RTranspiler, args map[string]*parser.ExpressionNode) string {
+			r.library("dplyr")
+			return fmt.Sprintf("select(%s, %s)", r.argOr(args, "data", "df"), strings.Join(rColumns(requiredColumns("select", args, "columns")), ", "))
+		},
+		"filter": func(r *RTranspiler, args map[string]*parser.ExpressionNode) string {
+			condition, ok := args["condition"]
+			if !ok {
+				panic("transpiler: filter: missing argument condition")
+			}
+			r.library("dplyr")
+			return fmt.Sprintf("filter(%s, %s)", r.argOr(args, "data", "df"), r.columnExpression(condition))
+		},
+		"sort": func(r *RTranspiler, args map[string]*parser.ExpressionNode) string {
+			r.library("dplyr")
+			keys := rColumns(requiredColumns("sort", args, "by"))
+			if desc, ok := args["desc"]; ok {
+				for j, key := range keys {
+					switch {
+					case desc.Type == parser.IDENTIFIER && desc.Value == "true" && !r.variables["true"]:
+						keys[j] = "desc(" + key + ")"
+					case desc.Type == parser.IDENTIFIER && desc.Value == "false" && !r.variables["false"]:
+					default:
+						keys[j] = fmt.Sprintf("if (%s) desc(%s) else %s", r.columnExpression(desc), key, key)
+					}
+				}
+			}
+			return fmt.Sprintf("arrange(%s, %s)", r.argOr(args, "data", "df"), strings.Join(keys, ", "))
+		},
+		"with_column": func(r *RTranspiler, args map[string]*parser.ExpressionNode) string {
+			name := requiredColumn("with_column", args, "name")
+			e, ok := args["value"]
+			if !ok {
+				panic("transpiler: with_column: missing argument value")
+			}
+			value := r.columnExpression(e)
+			if isCondition(e) {
+				value = "as.integer(" + value + ")"
+			}
+			r.library("dplyr")
+			return fmt.Sprintf("mutate(%s, %s = %s)", r.argOr(args, "data", "df"), rColumn(name), value)
+		},
+		"head": func(r *RTranspiler, args map[string]*parser.ExpressionNode) string {
+			r.library("dplyr")
+			return fmt.Sprintf("slice_head(%s, n = %s)", r.argOr(args, "data", "df"), r.argOr(args, "n", "5"))
+		},
+		"tail": func(r *RTranspiler, args map[string]*parser.ExpressionNode) string {
+			r.library("dplyr")
+			return fmt.Sprintf("slice_tail(%s, n = %s)", r.argOr(args, "data", "df"), r.argOr(args, "n", "5"))
+		},
+		// R draws different rows than the interpreter for the same seed.
+		"sample": func(r *RTranspiler, args map[string]*parser.ExpressionNode) string {
+			if _, ok := args["n"]; !ok {
+				panic("transpiler: sample: missing argument n")
+			}
+			r.library("dplyr")
+			r.writeLine(fmt.Sprintf("set.seed(%s)", r.argOr(args, "seed", "0")))
+			return fmt.Sprintf("slice_sample(%s, n = %s)", r.argOr(args, "data", "df"), r.argOr(args, "n", ""))
+		},
+		"describe": func(r *RTranspiler, args map[string]*parser.ExpressionNode) string {
+			return fmt.Sprintf("summary(%s)", r.argOr(args, "data", "df"))
+		},
+		"group_by": func(r *RTranspiler, args map[string]*parser.ExpressionNode) string {
+			r.library("dplyr")
+			return fmt.Sprintf("group_by(%s, %s)", r.argOr(args, "data", "df"), strings.Join(rColumns(requiredColumns("group_by", args, "by")), ", "))
+		},
+		"agg":  emitAggR,
+		"join": emitJoinR,
+	}
+	for _, name := range []string{"mae", "mse", "rmse", "r2", "accuracy"} {
+		rBuiltins[name] = rMetric(name)
+	}
+}
+
+// rAggregations maps MLite aggregations to dplyr summaries of a column.
+// Missing values are skipped, as in the interpreter.
+var rAggregations = map[string]string{
+	"count": "sum(!is.na(%s))", "sum": "sum(%s, na.rm = TRUE)", "mean": "mean(%s, na.rm = TRUE)",
+	"median": "median(%s, na.rm = TRUE)", "min": "min(%s, na.rm = TRUE)", "max": "max(%s, na.rm = TRUE)",
+	"std": "sd(%s, na.rm = TRUE)", "n_unique": "n_distinct(%s, na.rm = TRUE)",
+}
+
+// MLite:  group_by(df, [bedrooms]).agg(mean(price), count())
+// R:      summarise(group_by(df, bedrooms), mean_price = mean(price, na.rm = TRUE), count = n(), .groups = "drop")
+func emitAggR(r *RTranspiler, args map[string]*parser.ExpressionNode) string {
+	groups, ok := args["groups"]
+	if !ok {
+		panic("transpiler: agg: missing argument groups")
+	}
+	var summaries []string
+	for _, e := range args["aggregations"].Args {
+		if e.Type != parser.CALL || len(e.Args) > 1 || len(e.Keywords) > 0 {
+			panic("transpiler: agg: aggregations are written as mean(price) or count()")
+		}
+		a := dataset.Aggregation{Func: e.Value.(string)}
+		if len(e.Args) == 1 {
+			a.Column = fmt.Sprintf("%v", e.Args[0].Value)
+		}
+		summary, ok := rAggregations[a.Func]
+		if !ok {
+			panic(fmt.Sprintf("transpiler: agg: unknown aggregation %q (have %s)", a.Func, strings.Join(dataset.AggregateFuncs, ", ")))
+		}
+		if a.Column == "" {
+			if a.Func != "count" {
+				panic(fmt.Sprintf("transpiler: agg: %s() needs a column", a.Func))
+			}
+			summary = "n()"
+		} else {
+			summary = fmt.Sprintf(summary, rColumn(a.Column))
+		}
+		summaries = append(summaries, rColumn(a.Name())+" = "+summary)
+	}
+	if len(summaries) == 0 {
+		panic("transpiler: agg: needs an aggregation such as mean(price) or count()")
+	}
+	r.library("dplyr")
+	return fmt.Sprintf("summarise(%s, %s, .groups = \"drop\")", r.expression(groups), strings.Join(summaries, ", "))
+}
+
+// rJoins maps join's how: to the dplyr function.
+var rJoins = map[string]string{"inner": "inner_join", "left": "left_join", "right": "right_join", "outer": "full_join"}
+
+// MLite:  join(a, b, on: id, how: "left")
+// R:      left_join(a, b, by = c("id"))
+func emitJoinR(r *RTranspiler, args map[string]*parser.ExpressionNode) string {
+	left, ok := args["left"]
+	if !ok {
+		panic("transpiler: join: missing argument left")
+	}
+	right, ok := args["right"]
+	if !ok {
+		panic("transpiler: join: missing argument right")
+	}
+	how := "inner"
+	if e, ok := args["how"]; ok {
+		if e.Type != parser.STRING {
+			panic("transpiler: join: how must be a string in R")
+		}
+		how = e.Value.(string)
+	}
+	fn, ok := rJoins[how]
+	if !ok {
+		panic(fmt.Sprintf("transpiler: join: unknown how %q", how))
+	}
+	on := requiredColumns("join", args, "on")
+	quoted := make([]string, len(on))
+	for j, c := range on {
+		quoted[j] = strconv.Quote(c)
+	}
+	r.library("dplyr")
+	return fmt.Sprintf("%s(%s, %s, by = c(%s))", fn, r.expression(left), r.expression(right), strings.Join(quoted, ", "))
+}
+
+// rMetric renders a metric builtin called as (y_true, y_pred) or as
+// (model, data), as in the interpreter.
+//
+// MLite:  rmse(te.price, p)
+// R:      sqrt(mean((te$price - p)^2))
+func rMetric(name string) func(r *RTranspiler, args map[string]*parser.ExpressionNode) string {
+	return func(r *RTranspiler, args map[string]*parser.ExpressionNode) string {
+		first, ok := args["y_true"]
+		if !ok {
+			panic(fmt.Sprintf("transpiler: %s: missing argument y_true", name))
+		}
+		var actual, predicted string
+		if model := rName(fmt.Sprintf("%v", first.Value)); first.Type == parser.IDENTIFIER && r.fitted[model] != nil {
+			data := r.argOr(args, "y_pred", "df")
+			actual, predicted = rColumnOf(data, r.fitted[model].Target), r.predictCall(model, data)
+		} else {
+			second, ok := args["y_pred"]
+			if !ok {
+				panic(fmt.Sprintf("transpiler: %s: missing argument y_pred", name))
+			}
+			actual, predicted = r.primary(first), r.primary(second)
+		}
+		switch name {
+		case "mae":
+			return fmt.Sprintf("mean(abs(%s - %s))", actual, predicted)
+		case "mse":
+			return fmt.Sprintf("mean((%s - %s)^2)", actual, predicted)
+		case "rmse":
+			return fmt.Sprintf("sqrt(mean((%s - %s)^2))", actual, predicted)
+		case "r2":
+			return fmt.Sprintf("1 - sum((%s - %s)^2) / sum((%s - mean(%s))^2)", actual, predicted, actual, actual)
+		}
+		return fmt.Sprintf("mean(%s == %s)", actual, predicted)
+	}
+}
+
+// argOr renders an argument, or def when it was not given.
+func (r *RTranspiler) argOr(args map[string]*parser.ExpressionNode, name, def string) string {
+	if e, ok := args[name]; ok {
+		return r.expression(e)
+	}
+	return def
+}
+
+// fileFormat resolves the format of a load or save as the interpreter does
+// and attaches the package that reads and writes it.
+func (r *RTranspiler) fileFormat(file, name string) dataset.Format {
+	format, err := dataset.ParseFormat(name)
+	if err != nil {
+		panic(fmt.Sprintf("transpiler: %s", err))
+	}
+	if format == "" {
+		format = dataset.DetectFormat(file)
+	}
+	r.library(rLibraries[format])
+	return format
+}
+
+// R's ! binds looser than comparisons, so !a < b is !(a < b); it is
+// written that way anyway, as few readers know the rule.
+var (
+	rSpelling       = spelling{binary: map[string]string{}, not: "!", precedence: precedence, notWraps: true}
+	rColumnSpelling = spelling{binary: map[string]string{"&&": "&", "||": "|"}, not: "!", precedence: precedence, notWraps: true}
+)
+
+// expression renders an MLite expression as R source.
+func (r *RTranspiler) expression(e *parser.ExpressionNode) string {
+	switch e.Type {
+	case parser.STRING:
+		// Go's escapes are also R's, so a Go-quoted string is an R literal.
+		return strconv.Quote(e.Value.(string))
+	case parser.LITERAL:
+		return fmt.Sprintf("%v", e.Value)
+	case parser.ARRAY:
+		var elements []string
+		for _, el := range e.Args {
+			elements = append(elements, r.expression(el))
+		}
+		return "c(" + strings.Join(elements, ", ") + ")"
+	case parser.MAP:
+		var entries []string
+		for _, kw := range e.Keywords {
+			entries = append(entries, rColumn(kw.Name)+" = "+r.expression(kw.Value))
+		}
+		return "list(" + strings.Join(entries, ", ") + ")"
+	case parser.MEMBER:
+		return rColumnOf(r.primary(e.Args[0]), e.Value.(string))
+	case parser.BINARY, parser.UNARY:
+		return rSpelling.operation(e, r.expression)
+	case parser.IDENTIFIER:
+		name := rName(e.Value.(string))
+		switch {
+		case e.Value == "true" && !r.variables[name]:
+			return "TRUE"
+		case e.Value == "false" && !r.variables[name]:
+			return "FALSE"
+		}
+		return name
+	case parser.CALL:
+		name := e.Value.(string)
+		if emit, ok := rBuiltins[name]; ok {
+			params := pythonBuiltins[name].params
+			return emit(r, bindArgs(e, params))
+		}
+		if _, ok := pythonBuiltins[name]; ok {
+			panic(fmt.Sprintf("transpiler: %s has no R translation", name))
+		}
+		if _, ok := preprocessors[name]; ok {
+			panic(fmt.Sprintf("transpiler: %s has no R translation", name))
+		}
+		if _, ok := sklearnModels[name]; ok {
+			panic(fmt.Sprintf("transpiler: %s must be declared with let to be trained in R", name))
+		}
+		panic(fmt.Sprintf("transpiler: unknown function %s", name))
+	default:
+		panic(fmt.Sprintf("transpiler: unsupported expression type %s", e.Type))
+	}
+}
+
+// primary renders e so that $ or a call can follow it.
+func (r *RTranspiler) primary(e *parser.ExpressionNode) string {
+	if _, p := rSpelling.operator(e); p < atom {
+		return "(" + r.expression(e) + ")"
+	}
+	return r.expression(e)
+}
+
+// columnExpression renders e inside a dplyr verb, where bare names are
+// columns. MLite resolves a name to a variable first, so variables are
+// reached through .env, and operators apply element-wise.
+func (r *RTranspiler) columnExpression(e *parser.ExpressionNode) string {
+	switch e.Type {
+	case parser.IDENTIFIER:
+		name := e.Value.(string)
+		if r.variables[rName(name)] {
+			return ".env$" + rName(name)
+		}
+		if name == "true" || name == "false" {
+			return r.expression(e)
+		}
+		return rColumn(name)
+	case parser.BINARY, parser.UNARY:
+		return rColumnSpelling.operation(e, r.columnExpression)
+	}
+	return r.expression(e)
+}
+
+// rKeywords are R's reserved words, which cannot name anything.
+// rReservedNames adds the functions generated R code calls, which an
+// MLite variable of the same name would mask.
+var rKeywords, rReservedNames = map[string]bool{}, map[string]bool{}
+
+func init() {
+	for _, name := range strings.Fields(`if else repeat while function for in next break TRUE FALSE
+		NULL Inf NaN NA NA_integer_ NA_real_ NA_character_`) {
+		rKeywords[name] = true
+		rReservedNames[name] = true
+	}
+	for _, name := range strings.Fields(`T F c t q
+		abs arrange as_tibble desc filter group_by library list lm glm mean median mutate n
+		nrow predict print gbm sample sd select seq_len set.seed sqrt sum summarise
+		summary table tibble con test_rows evaluate_classifier evaluate_regressor predict_class`) {
+		rReservedNames[name] = true
+	}
+}
+
+// rName renders an MLite variable name as an R one, appending an
+// underscore to reserved names as rName("function") → function_.
+func rName(name string) string {
+	if rReservedNames[name] {
+		return name + "_"
+	}
+	return name
+}
+
+// isRName reports whether name can be written bare in R.
+func isRName(name string) bool {
+	for j, c := range name {
+		if !(c == '_' || c == '.' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || j > 0 && c >= '0' && c <= '9') {
+			return false
+		}
+	}
+	return name != "" && name[0] != '_' && !rKeywords[name]
+}
+
+// rColumn renders a column name inside a dplyr verb or formula:
+// bare when it can be, else in backticks.
+func rColumn(name string) string {
+	if isRName(name) {
+		return name
+	}
+	return "`" + strings.ReplaceAll(name, "`", "\\`") + "`"
+}
+
+func rColumns(names []string) []string {
+	columns := make([]string, len(names))
+	for j, name := range names {
+		columns[j] = rColumn(name)
+	}
+	return columns
+}
+
+// rColumnOf renders a column of a data frame: df$price.
+func rColumnOf(data, column string) string {
+	return data + "$" + rColumn(column)
+}
@@ -0,0 +1,171 @@
+package transpiler
+
+import (
+	"fmt"
+	"mlite/parser"
+	"strconv"
+	"strings"
+)
+
+// sklearnScoring maps MLite metric names to sklearn scoring strings. sklearn
+// always maximises, so error metrics are negated.
+var sklearnScoring = map[string]string{
+	"mae":       "neg_mean_absolute_error",
+	"mse":       "neg_mean_squared_error",
+	"rmse":      "neg_root_mean_squared_error",
+	"mape":      "neg_mean_absolute_percentage_error",
+	"r2":        "r2",
+	"accuracy":  "accuracy",
+	"precision": "precision",
+	"recall":    "recall",
+	"f1":        "f1",
+	"roc_auc":   "roc_auc",
+	"log_loss":  "neg_log_loss",
+}
+
+// searchHelper fits a search, prints the leaderboard like the interpreter
+// and returns the refitted best estimator.
+const searchHelper = `def best_of(search, X, y):
+    search.fit(X, y)
+    results = pd.DataFrame(search.cv_results_).sort_values("rank_test_score")
+    print(results[["rank_test_score", "mean_test_score", "params"]].to_string(index=False))
+    return search.best_estimator_
+`
+
+// MLite:  search(gbm_regressor, df, grid: {max_depth: [3, 5]}, cv: 5, metric: "rmse", features: [x], target: y)
+// Python: best_of(GridSearchCV(GradientBoostingRegressor(), {"max_depth": [3, 5]}, cv=KFold(...),
+//                 scoring="neg_root_mean_squared_error", n_jobs=-1), df[["x"]], df["y"])
+//
+// With n_iter: the search becomes a RandomizedSearchCV over the same grid.
+func emitSearch(t *Transpiler, args map[string]*parser.ExpressionNode) string {
+	gridExpr, ok := args["grid"]
+	if !ok || gridExpr.Type != parser.MAP {
+		panic("transpiler: search needs a grid: {name: [values]} map")
+	}
+	modelType, base := t.searchBase(args)
+	m := sklearnModels[modelType]
+	data := t.argOr(args, "data", "df")
+	features, target := t.searchColumns(args)
+
+	// A pipeline's parameters are those of its step named "model".
+	prefix := m.GridPrefix
+	if t.pipelines[pyName(columnName(args, "model"))] {
+		prefix = "model__" + prefix
+	}
+	var entries []string
+	for _, kw := range gridExpr.Keywords {
+		if _, ok := m.Values[kw.Name]; ok {
+			panic(fmt.Sprintf("transpiler: cannot search over %s of %s", kw.Name, modelType))
+		}
+		name := kw.Name
+		if renamed, ok := m.Params[name]; ok {
+			name = renamed
+		}
+		values := t.expression(kw.Value)
+		if kw.Value.Type != parser.ARRAY {
+			values = "[" + values + "]"
+		}
+		entries = append(entries, fmt.Sprintf("%s: %s", strconv.Quote(prefix+name), values))
+	}
+	grid := "{" + strings.Join(entries, ", ") + "}"
+
+	// cv: and seed: mean the same as for kfold.
+	folds := map[string]*parser.ExpressionNode{"data": args["data"], "seed": args["seed"], "stratify": args["stratify"], "k": args["cv"]}
+	for name, e := range folds {
+		if e == nil {
+			delete(folds, name)
+		}
+	}
+	splitter, _ := t.kfoldSplitter(folds)
+
+	class := "GridSearchCV"
+	options := []string{base, grid}
+	if n, ok := args["n_iter"]; ok {
+		class = "RandomizedSearchCV"
+		options = append(options, "n_iter="+t.expression(n), "random_state="+t.argOr(args, "seed", "0"))
+	}
+	options = append(options, "cv="+splitter)
+	if metric, ok := args["metric"]; ok {
+		scoring, known := sklearnScoring[fmt.Sprintf("%v", metric.Value)]
+		if !known {
+			panic(fmt.Sprintf("transpiler: unknown search metric %v", metric.Value))
+		}
+		options = append(options, "scoring="+strconv.Quote(scoring))
+	}
+	options = append(options, "n_jobs="+t.argOr(args, "workers", "-1"))
+
+	t.require("from sklearn.model_selection import " + class)
+	t.define(searchHelper)
+	return fmt.Sprintf("best_of(%s(%s), %s, %s)", class, strings.Join(options, ", "), t.featuresOf(data, features, t.steps[data]), columnOf(data, target))
+}
+
+// searchBase returns the searched model type and the Python estimator the
+// search starts from: a model variable, or a fresh constructor for a type
+// name. Searching alpha of a linear regression starts from Ridge.
+func (t *Transpiler) searchBase(args map[string]*parser.ExpressionNode) (modelType, base string) {
+	name := pyName(columnName(args, "model"))
+	var alpha *parser.ExpressionNode
+	for _, kw := range args["grid"].Keywords {
+		if kw.Name == "alpha" && kw.Value.Type == parser.ARRAY && len(kw.Value.Args) > 0 {
+			alpha = kw.Value.Args[0]
+		}
+	}
+
+	modelType = name
+	if declared := t.models[name]; declared != "" {
+		// A LinearRegression variable has no alpha to search; start from
+		// a Ridge instead, as a linear regression declared with alpha would be.
+		if alpha == nil || sklearnModels[declared].Ridge == "" || t.pipelines[name] {
+			return declared, name
+		}
+		modelType = declared
+	}
+	m, ok := sklearnModels[modelType]
+	if !ok {
+		panic(fmt.Sprintf("transpiler: search needs a model type or model variable, got %s", name))
+	}
+	call := &parser.ExpressionNode{Type: parser.CALL, Value: modelType}
+	if alpha != nil && m.Ridge != "" {
+		call.Keywords = []*parser.KeywordArg{{Name: "alpha", Value: alpha}}
+	}
+	return modelType, t.modelConstructor(m, call)
+}
+
+// searchColumns returns the features and target of a search: given
+// explicitly or taken from the model variable's last train.
+func (t *Transpiler) searchColumns(args map[string]*parser.ExpressionNode) ([]string, string) {
+	features, target := columnNames(args, "features"), columnName(args, "target")
+	if fit, ok := t.fitted[pyName(columnName(args, "model"))]; ok {
+		if features == nil {
+			features = fit.Features
+		}
+		if target == "" {
+			target = fit.Target
+		}
+	}
+	if features == nil || target == "" {
+		panic("transpiler: search needs features: and target:, or a trained model")
+	}
+	return features, target
+}
+
+// recordSearch remembers that variable holds the fitted result of a search,
+// so later evaluate or cross_validate calls know its type and columns.
+func (t *Transpiler) recordSearch(variable string, e *parser.ExpressionNode) {
+	if e.Type != parser.CALL || e.Value != "search" {
+		return
+	}
+	args := bindArgs(e, pythonBuiltins["search"].params)
+	modelType := pyName(columnName(args, "model"))
+	if declared := t.models[modelType]; declared != "" {
+		modelType = declared
+	}
+	features, target := t.searchColumns(args)
+	t.models[variable] = modelType
+	t.fitted[variable] = &parser.TrainNode{Model: variable, Features: features, Target: target, Data: pyName(columnName(args, "data"))}
+	if data, ok := args["data"]; ok {
+		t.modelSteps[variable] = t.stepsOf(data)
+	} else {
+		t.modelSteps[variable] = t.steps["df"]
+	}
+}
@@ -0,0 +1,96 @@
+package transpiler
+
+import (
+	"fmt"
+	"mlite/parser"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// SourceMap maps lines of generated Python back to the MLite statements
+// they were generated from, so an error raised by the Python can be
+// reported where the program was written. The CLI writes it as JSON next
+// to the script, e.g. housing.py.map:
+//
+//	{"version": 1, "file": "housing.py", "source": "housing.mlite",
+//	 "mappings": [{"line": 4, "span": {"start": {"line": 2, "column": 1}, "end": {"line": 2, "column": 18}}}]}
+type SourceMap struct {
+	Version  int       `json:"version"`
+	File     string    `json:"file,omitempty"`   // the generated file
+	Source   string    `json:"source,omitempty"` // the MLite file
+	Mappings []Mapping `json:"mappings"`
+}
+
+// Mapping ties a line of generated code to the statement that wrote it.
+// Lines written for no statement, such as imports, have no mapping.
+type Mapping struct {
+	Line int         `json:"line"` // 1-based
+	Span parser.Span `json:"span"`
+}
+
+// SourceMap returns the source map of the code the last Transpile or
+// TranspileModule call returned. Only statements the parser produced
+// carry spans, so hand-built nodes map to nothing.
+func (t *Transpiler) SourceMap() SourceMap {
+	m := SourceMap{Version: 1, Mappings: []Mapping{}}
+	for i, span := range t.spans {
+		if span != (parser.Span{}) {
+			m.Mappings = append(m.Mappings, Mapping{Line: t.mapOffset + i + 1, Span: span})
+		}
+	}
+	return m
+}
+
+// Lookup returns the MLite span a generated line came from.
+func (m SourceMap) Lookup(line int) (parser.Span, bool) {
+	for _, mapping := range m.Mappings {
+		if mapping.Line == line {
+			return mapping.Span, true
+		}
+	}
+	return parser.Span{}, false
+}
+
+// tracebackFrame matches a frame of a Python traceback:
+//
+//	File "housing.py", line 12, in <module>
+var tracebackFrame = regexp.MustCompile(`^(\s*)File "([^"]+)", line (\d+)(.*)$`)
+
+// RewriteTraceback rewrites the frames of a Python traceback that point
+// into the generated file to point at the MLite source instead, keeping
+// the Python line in parentheses:
+//
+//	File "housing.py", line 12, in <module>
+//
+// becomes
+//
+//	File "housing.mlite", line 5, column 1, in <module> (housing.py line 12)
+//
+// Frames in other files, and lines the map has no statement for, are left
+// as they are. When the map names no file, every frame is looked up.
+func (m SourceMap) RewriteTraceback(traceback string) string {
+	source := m.Source
+	if source == "" {
+		source = "<mlite>"
+	}
+	lines := strings.Split(traceback, "\n")
+	for i, line := range lines {
+		match := tracebackFrame.FindStringSubmatch(strings.TrimRight(line, "\r"))
+		if match == nil || m.File != "" && filepath.Base(match[2]) != filepath.Base(m.File) {
+			continue
+		}
+		number, err := strconv.Atoi(match[3])
+		if err != nil {
+			continue
+		}
+		span, ok := m.Lookup(number)
+		if !ok {
+			continue
+		}
+		lines[i] = fmt.Sprintf(`%sFile "%s", line %d, column %d%s (%s line %d)`,
+			match[1], source, span.Start.Line, span.Start.Column, match[4], filepath.Base(match[2]), number)
+	}
+	return strings.Join(lines, "\n")
+}
@@ -3,68 +3,259 @@ package transpiler
 import (
 	"fmt"
 	"mlite/parser"
+	"sort"
+	"strconv"
 	"strings"
 )
 
 // Transpiler walks the AST and builds a Python source string.
 // It never executes anything — it only writes text.
 type Transpiler struct {
-	output strings.Builder // accumulates every line of Python we generate
-	indent int             // how many levels deep are we right now?
+	writer           // accumulates every line of Python we generate
+	imports []string                     // imports needed beyond the standard header, in first-use order
+	models  map[string]string            // variable → MLite model type, for variables declared with a model constructor
+	fitted  map[string]*parser.TrainNode // model variable → the train statement that last fitted it
+	helpers []string                     // function definitions emitted after the imports, in first-use order
+
+	stepOf     map[*parser.ExpressionNode]string // preprocessing call → the Python step it fitted
+	steps      map[string][]string               // DataFrame variable → the steps it has been through
+	modelSteps map[string][]string               // model variable → the steps of its training data
+	encoded    map[string]string                 // one-hot step → the column it encoded
+	pipelines  map[string]bool                   // model variables holding a pipeline
+	variables  map[string]bool                   // names declared with let or set
+	groups     map[string][]string               // variable → grouping columns, for variables set to group_by
+
+	flags    []*flag  // command-line options of a module; nil for a plain script
+	packages []string // pip packages needed beyond those of the imports, e.g. pyarrow
+
+	mapOffset int // lines of generated code above the statements, for the source map
 }
 
 func NewTranspiler() *Transpiler {
-	return &Transpiler{}
+	return &Transpiler{
+		writer:     writer{tab: "    "},
+		models:     make(map[string]string),
+		fitted:     make(map[string]*parser.TrainNode),
+		stepOf:     make(map[*parser.ExpressionNode]string),
+		steps:      make(map[string][]string),
+		modelSteps: make(map[string][]string),
+		encoded:    make(map[string]string),
+		pipelines:  make(map[string]bool),
+		variables:  make(map[string]bool),
+		groups:     make(map[string][]string),
+	}
+}
+
+// require records an import line the generated code depends on.
+func (t *Transpiler) require(line string) {
+	for _, existing := range t.imports {
+		if existing == line {
+			return
+		}
+	}
+	t.imports = append(t.imports, line)
 }
 
-// writeLine writes one line at the correct indentation level.
-// strings.Repeat("    ", t.indent) produces the right number of spaces.
-// When indent=0: no spaces. indent=1: 4 spaces. indent=2: 8 spaces.
-func (t *Transpiler) writeLine(line string) {
-	t.output.WriteString(strings.Repeat("    ", t.indent) + line + "\n")
+// define records a top-level Python function the generated code calls.
+func (t *Transpiler) define(helper string) {
+	for _, existing := range t.helpers {
+		if existing == helper {
+			return
+		}
+	}
+	t.helpers = append(t.helpers, helper)
 }
 
 // Transpile is the main entry point — receives the same []Node the
 // interpreter used to receive, but returns Python source code instead
 // of executing anything.
 func (t *Transpiler) Transpile(nodes []parser.Node) string {
-	// Every generated file needs these imports at the top.
-	t.output.WriteString("import pandas as pd\n")
-	t.output.WriteString("from sklearn.linear_model import LinearRegression\n")
-	t.output.WriteString("\n")
-
 	for _, node := range nodes {
 		t.transpileNode(node)
 	}
 
-	return t.output.String()
+	header := t.header()
+	t.mapOffset = strings.Count(header, "\n")
+	return header + t.output.String()
+}
+
+// header renders the imports and helper functions the generated code
+// needs, to go above it.
+func (t *Transpiler) header() string {
+	var header strings.Builder
+	if lines := t.importLines(); len(lines) > 0 {
+		header.WriteString(strings.Join(lines, "\n") + "\n\n")
+	}
+	// Top-level functions get two blank lines around them, as in PEP 8.
+	for _, helper := range t.helpers {
+		header.WriteString("\n" + helper + "\n")
+	}
+	if len(t.helpers) > 0 {
+		header.WriteString("\n")
+	}
+	return header.String()
+}
+
+// importLines returns the import block of the generated file as isort
+// lays it out: standard library imports, then a blank line and third-party
+// ones, each group with plain imports before from-imports, sorted.
+func (t *Transpiler) importLines() []string {
+	var stdlib, thirdParty []string
+	for _, line := range t.imports {
+		if standardLibrary[strings.Split(strings.Fields(line)[1], ".")[0]] {
+			stdlib = append(stdlib, line)
+		} else {
+			thirdParty = append(thirdParty, line)
+		}
+	}
+	sortImports(stdlib)
+	sortImports(thirdParty)
+	if len(stdlib) > 0 && len(thirdParty) > 0 {
+		stdlib = append(stdlib, "")
+	}
+	return append(stdlib, thirdParty...)
+}
+
+// standardLibrary holds the Python standard library modules generated code
+// may import.
+var standardLibrary = map[string]bool{
+	"argparse": true,
+	"json":     true,
+	"math":     true,
+	"sqlite3":  true,
+}
+
+func sortImports(lines []string) {
+	sort.SliceStable(lines, func(a, b int) bool {
+		fromA, fromB := strings.HasPrefix(lines[a], "from "), strings.HasPrefix(lines[b], "from ")
+		if fromA != fromB {
+			return fromB
+		}
+		return lines[a] < lines[b]
+	})
 }
 
 // transpileNode switches on node type — same structure as interpreter.go's Run(),
 // but each case writes a string instead of doing something.
 func (t *Transpiler) transpileNode(node parser.Node) {
+	defer t.at(parser.SpanOf(node))()
 	switch n := node.(type) {
 
 	// MLite:  let x :: 10
 	// Python: x = 10
+	//
+	// MLite:  let m :: gbm_regressor(n_estimators: 200)
+	// Python: m = GradientBoostingRegressor(n_estimators=200)
+	//
+	// MLite:  let tr, te :: split(df, test: 0.2)
+	// Python: tr, te = train_test_split(df, test_size=0.2, random_state=0)
 	case *parser.LetNode:
-		t.writeLine(fmt.Sprintf("%s = %v", n.Variable, n.Value.Value))
+		if n.Names != nil {
+			names := make([]string, len(n.Names))
+			for i, name := range n.Names {
+				names[i] = pyName(name)
+			}
+			t.writeLine(fmt.Sprintf("%s = %s", strings.Join(names, ", "), t.expression(n.Value)))
+			t.recordSteps(names, n.Value)
+			for _, name := range names {
+				t.variables[name] = true
+			}
+			break
+		}
+		variable := pyName(n.Variable)
+		if arg, ok := t.constant(n.Variable, n.Value); ok {
+			t.writeLine(fmt.Sprintf("%s = %s", variable, arg))
+		} else {
+			t.writeLine(fmt.Sprintf("%s = %s", variable, t.expression(n.Value)))
+		}
+		t.variables[variable] = true
+		t.recordSteps([]string{variable}, n.Value)
+		t.models[variable] = modelType(n.Value)
+		t.pipelines[variable] = false
+		t.groups[variable] = t.groupKeys(n.Value)
+		t.recordPipeline(variable, n.Value)
+		t.recordSearch(variable, n.Value)
+		t.recordLoad(variable, n.Value)
 
 	// MLite:  set(x, 10)
 	// Python: x = 10
 	case *parser.SetNode:
-		t.writeLine(fmt.Sprintf("%s = %v", n.Variable, n.Value.Value))
+		variable := pyName(n.Variable)
+		t.writeLine(fmt.Sprintf("%s = %s", variable, t.expression(n.Value)))
+		t.variables[variable] = true
+		t.recordSteps([]string{variable}, n.Value)
+		t.models[variable] = modelType(n.Value)
+		t.pipelines[variable] = false
+		t.groups[variable] = t.groupKeys(n.Value)
+		t.recordPipeline(variable, n.Value)
+		t.recordSearch(variable, n.Value)
+		t.recordLoad(variable, n.Value)
+
+	// MLite:  save_model(m, "m.mlm")
+	// Python: save_model(m, "m.mlm", "price")
+	//
+	// MLite:  rmse(m, te)
+	// Python: print(mean_squared_error(te["price"], m.predict(te[["sqft"]])) ** 0.5)
+	//
+	// MLite:  one_hot(city)
+	// Python: step_1 = one_hot(df, "city")
+	//         df = step_1(df)
+	//
+	// A call statement prints its result, as the interpreter does, unless
+	// the builtin is only called for its effect. Preprocessing statements
+	// update their data variable instead. Calls to anything but a builtin
+	// or a model type are rejected, as the interpreter rejects them.
+	case *parser.CallNode:
+		if name, ok := inPlaceTarget(n.Call); ok {
+			t.writeLine(fmt.Sprintf("%s = %s", name, t.expression(n.Call)))
+			t.recordSteps([]string{name}, n.Call)
+		} else if fn, ok := pythonBuiltins[n.Call.Value.(string)]; ok && fn.action {
+			t.writeLine(t.expression(n.Call))
+		} else {
+			t.writeLine(fmt.Sprintf("print(%s)", t.expression(n.Call)))
+		}
 
 	// MLite:  load("data.csv")
 	// Python: df = pd.read_csv("data.csv")
 	// "df" is the standard pandas dataframe variable name by convention.
+	//
+	// The reader follows the format: argument or the file extension, e.g.
+	// load("prices.jsonl") becomes pd.read_json("prices.jsonl", lines=True).
+	//
+	// MLite:  load(sqlite: "f.db", query: "SELECT * FROM h WHERE city = :city")
+	// Python: con = sqlite3.connect("f.db")
+	//         df = pd.read_sql("SELECT * FROM h WHERE city = :city", con, params={"city": city})
+	//         con.close()
 	case *parser.LoadNode:
-		t.writeLine(fmt.Sprintf(`df = pd.read_csv("%s")`, n.File))
+		if n.SQLite != "" {
+			t.readSQLite(n)
+		} else {
+			t.require("import pandas as pd")
+			reader := pandasReaders[t.fileFormat(n.File, n.Format)]
+			t.writeLine("df = " + fmt.Sprintf(reader, t.path(n.File, "file read by load")))
+		}
+		t.steps["df"] = nil
 
 	// MLite:  save("output.csv")
 	// Python: df.to_csv("output.csv", index=False)
+	//
+	// save("out.parquet") becomes df.to_parquet("out.parquet", index=False).
+	//
+	// MLite:  save(preds, sqlite: "out.db", table: "preds")
+	// Python: con = sqlite3.connect("out.db")
+	//         preds.to_sql("preds", con, if_exists="replace", index=False)
+	//         con.close()
 	case *parser.SaveNode:
-		t.writeLine(fmt.Sprintf(`df.to_csv("%s", index=False)`, n.File))
+		data := pyName(n.Data)
+		if data == "" {
+			data = "df"
+		}
+		if n.SQLite != "" {
+			t.writeSQLite(data, n)
+			break
+		}
+		writer := pandasWriters[t.fileFormat(n.File, n.Format)]
+		t.writeLine(data + "." + fmt.Sprintf(writer, t.path(n.File, "file written by save")))
 
 	// MLite:  train(myModel, feature, target)
 	// Python: myModel = LinearRegression()
@@ -72,22 +263,76 @@ func (t *Transpiler) transpileNode(node parser.Node) {
 	//
 	// df[[...]] uses double brackets because sklearn needs a 2D array
 	// for features, not a 1D series. This is a sklearn convention.
+	//
+	// A model declared with let is already constructed, so only fit() is
+	// emitted. A registered type name such as "gbm_regressor" constructs
+	// that estimator with default settings.
+	//
+	// With data: tr the named DataFrame is used instead of df.
+	//
+	// MLite:  one_hot(city)
+	//         train(m, [sqft, city], price)
+	// Python: m.fit(df[["sqft", *step_1.columns]], df["price"])
+	//
+	// As in the interpreter, a column a one-hot step encoded stands for
+	// the columns that step wrote.
 	case *parser.TrainNode:
-		t.writeLine(fmt.Sprintf("%s = LinearRegression()", n.Model))
-		features := `df[["` + strings.Join(n.Features, `", "`) + `"]]`
-		t.writeLine(fmt.Sprintf(`%s.fit(%s, df["%s"])`, n.Model, features, n.Target))
+		model := pyName(n.Model)
+		if t.models[model] == "" {
+			class := "LinearRegression"
+			if m, ok := sklearnModels[n.Model]; ok {
+				t.require(fmt.Sprintf("from %s import %s", m.Module, m.Class))
+				class = m.Class
+				t.models[model] = n.Model
+			} else {
+				t.require("from sklearn.linear_model import LinearRegression")
+				t.models[model] = "linear_regression"
+			}
+			t.writeLine(fmt.Sprintf("%s = %s()", model, class))
+		}
+		data := pyName(n.Data)
+		if data == "" {
+			data = "df"
+		}
+		t.fitted[model] = &parser.TrainNode{Model: model, Features: n.Features, Target: n.Target, Data: pyName(n.Data)}
+		t.modelSteps[model] = t.steps[data]
+		t.writeLine(fmt.Sprintf("%s.fit(%s, %s)", model, t.featuresOf(data, n.Features, t.steps[data]), columnOf(data, n.Target)))
 
 	// MLite:  predict(myModel, [1.5, 2.0])
 	// Python: print(myModel.predict([[1.5, 2.0]]))
 	//
 	// The [[]] wrapping is because sklearn.predict expects a 2D array
 	// even for a single sample.
+	//
+	// MLite:  predict(myModel, te)
+	// Python: print(myModel.predict(te[["sqft"]]))
+	//
+	// MLite:  predict(myModel, te, into: "price_hat")
+	// Python: te["price_hat"] = myModel.predict(te[["sqft"]])
 	case *parser.PredictNode:
+		if n.Input == nil {
+			predictions := t.predictCall(pyName(n.Model), pyName(n.Data))
+			if n.Into == "" {
+				t.writeLine(fmt.Sprintf("print(%s)", predictions))
+			} else {
+				t.writeLine(fmt.Sprintf("%s = %s", columnOf(pyName(n.Data), n.Into), predictions))
+			}
+			break
+		}
 		var nums []string
 		for _, v := range n.Input {
 			nums = append(nums, fmt.Sprintf("%v", v))
 		}
-		t.writeLine(fmt.Sprintf("print(%s.predict([[%s]]))", n.Model, strings.Join(nums, ", ")))
+		t.writeLine(fmt.Sprintf("print(%s.predict([[%s]]))", pyName(n.Model), strings.Join(nums, ", ")))
+
+	// MLite:  evaluate(m, te)
+	// Python: print(evaluate_regressor(m, te[["sqft"]], te["price"]))
+	case *parser.EvaluateNode:
+		data := pyName(n.Data)
+		if data == "" {
+			data = "df"
+		}
+		t.writeLine(fmt.Sprintf("print(%s)", t.evaluateCall(pyName(n.Model), data)))
 
 	// MLite:  if(x > 5) { ... }
 	// Python: if x > 5:
@@ -97,7 +342,8 @@ func (t *Transpiler) transpileNode(node parser.Node) {
 	// Every writeLine call inside the block sees the higher indent value
 	// and prepends more spaces automatically.
 	case *parser.IfNode:
-		t.writeLine(fmt.Sprintf("if %v %s %v:", n.Left.Value, n.Operator, n.Right.Value))
+		condition := &parser.ExpressionNode{Type: parser.BINARY, Value: n.Operator, Args: []*parser.ExpressionNode{n.Left, n.Right}}
+		t.writeLine(fmt.Sprintf("if %s:", t.expression(condition)))
 		t.indent++
 		for _, cmd := range n.Commands {
 			t.transpileNode(cmd)
@@ -107,15 +353,170 @@ func (t *Transpiler) transpileNode(node parser.Node) {
 	// MLite:  loop(3) { ... }
 	// Python: for i in range(3):
 	//             ...       ← indented
+	//
+	// The counter is i_ when the program has a variable i of its own.
 	case *parser.LoopNode:
-		t.writeLine(fmt.Sprintf("for i in range(%v):", n.Count.Value))
+		t.writeLine(fmt.Sprintf("for %s in range(%s):", t.fresh("i"), t.expression(n.Count)))
 		t.indent++
 		for _, cmd := range n.Commands {
 			t.transpileNode(cmd)
 		}
 		t.indent--
 
+	// MLite:  # Fit on the training rows only
+	// Python: # Fit on the training rows only
+	case *parser.CommentNode:
+		t.writeComment(n.Text)
+
 	default:
 		panic(fmt.Sprintf("transpiler: unsupported node type %T", node))
 	}
-}
\ No newline at end of file
+}
+
+// expression renders an MLite expression as Python source.
+func (t *Transpiler) expression(e *parser.ExpressionNode) string {
+	switch e.Type {
+	case parser.STRING:
+		// Go's escapes (\", \\, \n, \x00, \u00e9, \U0001f600) are also
+		// Python's, so a Go-quoted string is a valid Python literal.
+		return strconv.Quote(e.Value.(string))
+	case parser.ARRAY:
+		var elements []string
+		for _, el := range e.Args {
+			elements = append(elements, t.expression(el))
+		}
+		return "[" + strings.Join(elements, ", ") + "]"
+	case parser.CALL:
+		if _, ok := preprocessors[e.Value.(string)]; ok {
+			return t.preprocess(e)
+		}
+		if m, ok := sklearnModels[e.Value.(string)]; ok {
+			return t.modelConstructor(m, e)
+		}
+		if fn, ok := pythonBuiltins[e.Value.(string)]; ok {
+			return fn.emit(t, bindArgs(e, fn.params))
+		}
+		// The interpreter has no other functions, so neither does MLite.
+		panic(fmt.Sprintf("transpiler: unknown function %s", e.Value))
+	case parser.MAP:
+		var entries []string
+		for _, kw := range e.Keywords {
+			entries = append(entries, strconv.Quote(kw.Name)+": "+t.expression(kw.Value))
+		}
+		return "{" + strings.Join(entries, ", ") + "}"
+	case parser.MEMBER:
+		// A column of a DataFrame or a key of a dict: df.price → df["price"]
+		return columnOf(t.primary(e.Args[0]), e.Value.(string))
+	case parser.BINARY, parser.UNARY:
+		// x > 5 && !done → x > 5 and not done
+		return t.operation(e)
+	case parser.IDENTIFIER:
+		name := pyName(e.Value.(string))
+		switch {
+		case e.Value == "true" && !t.variables[name]:
+			return "True"
+		case e.Value == "false" && !t.variables[name]:
+			return "False"
+		}
+		return name
+	case parser.LITERAL:
+		return fmt.Sprintf("%v", e.Value)
+	default:
+		panic(fmt.Sprintf("transpiler: unsupported expression type %s", e.Type))
+	}
+}
+
+// modelConstructor renders a model declaration as its scikit-learn class,
+// renaming parameters and values where the two vocabularies differ.
+func (t *Transpiler) modelConstructor(m sklearnModel, call *parser.ExpressionNode) string {
+	class := m.Class
+	var args []string
+	fixed := append([]string{}, m.Fixed...)
+	// Keyword arguments a value or parameter stands for give way to the
+	// same keyword given explicitly, wherever it comes in the call.
+	implied, explicit := map[int]bool{}, map[string]bool{}
+	imply := func(replacement string) {
+		for _, arg := range strings.Split(replacement, ", ") {
+			implied[len(args)] = true
+			args = append(args, arg)
+		}
+	}
+	keyword := func(name string, value *parser.ExpressionNode) {
+		if name == "alpha" && m.Ridge != "" {
+			class = m.Ridge
+		}
+		if value.Type == parser.STRING {
+			if replacement, ok := m.Values[name][value.Value.(string)]; ok {
+				imply(replacement)
+				return
+			}
+		}
+		implies := m.Implies[name]
+		if renamed, ok := m.Params[name]; ok {
+			name = renamed
+		}
+		for k, arg := range fixed {
+			if strings.HasPrefix(arg, name+"=") {
+				fixed = append(fixed[:k], fixed[k+1:]...)
+				break
+			}
+		}
+		explicit[name] = true
+		args = append(args, name+"="+t.expression(value))
+		for _, arg := range implies {
+			imply(arg)
+		}
+	}
+	for j, arg := range call.Args {
+		if j >= len(m.Positional) {
+			panic(fmt.Sprintf("transpiler: %s takes %d positional argument(s)", call.Value, len(m.Positional)))
+		}
+		keyword(m.Positional[j], arg)
+	}
+	for _, kw := range call.Keywords {
+		keyword(kw.Name, kw.Value)
+	}
+
+	kept := fixed
+	for j, arg := range args {
+		if !implied[j] || !explicit[arg[:strings.Index(arg, "=")]] {
+			kept = append(kept, arg)
+		}
+	}
+
+	t.require(fmt.Sprintf("from %s import %s", m.Module, class))
+	constructor := fmt.Sprintf("%s(%s)", class, strings.Join(kept, ", "))
+	if m.Wrap != "" {
+		for _, line := range m.Imports {
+			t.require(line)
+		}
+		constructor = fmt.Sprintf(m.Wrap, constructor)
+	}
+	return constructor
+}
+
+// modelType returns the MLite model type e constructs, or "" when e is not
+// a model constructor.
+func modelType(e *parser.ExpressionNode) string {
+	if e.Type != parser.CALL {
+		return ""
+	}
+	if _, ok := sklearnModels[e.Value.(string)]; !ok {
+		return ""
+	}
+	return e.Value.(string)
+}
+
+// columnOf renders a single column of a DataFrame: df["price"]
+func columnOf(data, column string) string {
+	return fmt.Sprintf("%s[%s]", data, strconv.Quote(column))
+}
+
+// columnsOf renders a 2D column selection: df[["sqft", "age"]]
+func columnsOf(data string, columns []string) string {
+	quoted := make([]string, len(columns))
+	for j, c := range columns {
+		quoted[j] = strconv.Quote(c)
+	}
+	return fmt.Sprintf("%s[[%s]]", data, strings.Join(quoted, ", "))
+}
@@ -1,22 +1,31 @@
 package transpiler
 
 import (
+	"encoding/json"
+	"fmt"
 	"mlite/parser"
+	"mlite/token"
 	"strings"
 	"testing"
 )
 
 // helper: runs the transpiler on a slice of nodes and returns the output
-// minus the standard import header, so each test only checks the relevant lines.
+// minus the import block, so each test only checks the relevant lines.
 func transpileNodes(nodes []parser.Node) string {
 	t := NewTranspiler()
 	result := t.Transpile(nodes)
-	// Strip the 3-line header (2 imports + blank line) so tests stay focused
-	lines := strings.SplitN(result, "\n", 4)
-	if len(lines) < 4 {
-		return result
+	// Strip the import lines, the blank line between their groups and
+	// the blank line after them so tests stay focused
+	lines := strings.SplitAfter(result, "\n")
+	i := 0
+	for i < len(lines) && (strings.HasPrefix(lines[i], "import ") || strings.HasPrefix(lines[i], "from ") ||
+		lines[i] == "\n" && i+1 < len(lines) && (strings.HasPrefix(lines[i+1], "import ") || strings.HasPrefix(lines[i+1], "from "))) {
+		i++
 	}
-	return lines[3]
+	if i > 0 && i < len(lines) && lines[i] == "\n" {
+		i++
+	}
+	return strings.Join(lines[i:], "")
 }
 
 // Checks that load() maps to pandas read_csv with the correct filename.
@@ -138,15 +147,1033 @@ func TestTranspileLoopIndentation(t *testing.T) {
 	}
 }
 
-// Checks the full import header is present in every transpiled program.
-// These imports are required for pandas and sklearn to work.
-func TestTranspileImportHeader(t *testing.T) {
+// Checks that each construct imports only what its Python uses, in one
+// sorted block with the standard library first.
+func TestTranspileImports(t *testing.T) {
+	floor := &parser.ExpressionNode{Type: parser.LITERAL, Value: "5"}
+	tests := []struct {
+		name  string
+		nodes []parser.Node
+		want  string
+	}{
+		{"let", []parser.Node{&parser.LetNode{Variable: "x", Value: floor}}, "x = 5\n"},
+		{"load", []parser.Node{&parser.LoadNode{File: "x.csv"}}, "import pandas as pd\n\n"},
+		{"train", []parser.Node{&parser.TrainNode{Model: "m", Features: []string{"x"}, Target: "y"}},
+			"from sklearn.linear_model import LinearRegression\n\n"},
+		{"model type", []parser.Node{
+			&parser.LetNode{Variable: "m", Value: &parser.ExpressionNode{Type: parser.CALL, Value: "gbm_classifier"}},
+			&parser.LoadNode{File: "x.csv"},
+		}, "import pandas as pd\nfrom sklearn.ensemble import GradientBoostingClassifier\n\n"},
+		{"ridge", []parser.Node{&parser.LetNode{Variable: "m", Value: &parser.ExpressionNode{Type: parser.CALL, Value: "linear_regression",
+			Keywords: []*parser.KeywordArg{{Name: "alpha", Value: floor}}}}},
+			"from sklearn.linear_model import Ridge\n\n"},
+		{"metric", []parser.Node{
+			&parser.TrainNode{Model: "m", Features: []string{"x"}, Target: "y"},
+			&parser.CallNode{Call: &parser.ExpressionNode{Type: parser.CALL, Value: "rmse", Args: []*parser.ExpressionNode{
+				{Type: parser.IDENTIFIER, Value: "m"}, {Type: parser.IDENTIFIER, Value: "df"},
+			}}},
+		}, "from sklearn.linear_model import LinearRegression\nfrom sklearn.metrics import mean_squared_error\n\n"},
+		{"preprocessor", []parser.Node{
+			&parser.CallNode{Call: &parser.ExpressionNode{Type: parser.CALL, Value: "one_hot", Args: []*parser.ExpressionNode{
+				{Type: parser.IDENTIFIER, Value: "city"},
+			}}},
+		}, "import pandas as pd\nfrom sklearn.preprocessing import OneHotEncoder\n\n"},
+		{"standard library", []parser.Node{&parser.LoadNode{SQLite: "f.db", Query: "SELECT 1"}},
+			"import sqlite3\n\nimport pandas as pd\n\n"},
+	}
+	for _, tc := range tests {
+		got := NewTranspiler().Transpile(tc.nodes)
+		if !strings.HasPrefix(got, tc.want) || strings.Count(got, "import ") != strings.Count(tc.want, "import ") {
+			t.Errorf("%s: got\n%s\nwant it to start with\n%s", tc.name, got, tc.want)
+		}
+	}
+}
+
+// Checks that a declared gbm model maps to GradientBoostingRegressor with
+// sklearn parameter names, is imported, and is only fitted (not rebuilt) by train.
+func TestTranspileGBMDeclaration(t *testing.T) {
+	nodes := []parser.Node{
+		&parser.LetNode{
+			Variable: "m",
+			Value: &parser.ExpressionNode{Type: parser.CALL, Value: "gbm_regressor", Keywords: []*parser.KeywordArg{
+				{Name: "n_estimators", Value: &parser.ExpressionNode{Type: parser.LITERAL, Value: "200"}},
+				{Name: "loss", Value: &parser.ExpressionNode{Type: parser.STRING, Value: "squared"}},
+				{Name: "seed", Value: &parser.ExpressionNode{Type: parser.LITERAL, Value: "42"}},
+			}},
+		},
+		&parser.TrainNode{Model: "m", Features: []string{"sqft", "age"}, Target: "price"},
+	}
+	got := NewTranspiler().Transpile(nodes)
+	wantLines := []string{
+		"from sklearn.ensemble import GradientBoostingRegressor\n",
+		`m = GradientBoostingRegressor(n_estimators=200, loss="squared_error", random_state=42)` + "\n",
+		`m.fit(df[["sqft", "age"]], df["price"])` + "\n",
+	}
+	for _, line := range wantLines {
+		if !strings.Contains(got, line) {
+			t.Errorf("gbm: output missing %q\ngot:\n%s", line, got)
+		}
+	}
+	if strings.Contains(got, "m = LinearRegression()") {
+		t.Errorf("gbm: train rebuilt the declared model\ngot:\n%s", got)
+	}
+}
+
+// Checks that linear_regression with alpha becomes sklearn's Ridge.
+func TestTranspileRidge(t *testing.T) {
+	nodes := []parser.Node{
+		&parser.LetNode{
+			Variable: "m",
+			Value: &parser.ExpressionNode{Type: parser.CALL, Value: "linear_regression", Keywords: []*parser.KeywordArg{
+				{Name: "alpha", Value: &parser.ExpressionNode{Type: parser.LITERAL, Value: "0.5"}},
+			}},
+		},
+	}
+	got := NewTranspiler().Transpile(nodes)
+	if !strings.Contains(got, "from sklearn.linear_model import Ridge\n") || !strings.Contains(got, "m = Ridge(alpha=0.5)\n") {
+		t.Errorf("ridge: got:\n%s", got)
+	}
+}
+
+// Checks that mlp([64, 32]) maps the positional layer sizes and optimizer to
+// MLPRegressor arguments inside the scaling wrapper.
+func TestTranspileMLP(t *testing.T) {
+	nodes := []parser.Node{
+		&parser.LetNode{
+			Variable: "net",
+			Value: &parser.ExpressionNode{
+				Type:  parser.CALL,
+				Value: "mlp",
+				Args: []*parser.ExpressionNode{{Type: parser.ARRAY, Args: []*parser.ExpressionNode{
+					{Type: parser.LITERAL, Value: "64"},
+					{Type: parser.LITERAL, Value: "32"},
+				}}},
+				Keywords: []*parser.KeywordArg{
+					{Name: "activation", Value: &parser.ExpressionNode{Type: parser.STRING, Value: "relu"}},
+					{Name: "optimizer", Value: &parser.ExpressionNode{Type: parser.STRING, Value: "momentum"}},
+					{Name: "epochs", Value: &parser.ExpressionNode{Type: parser.LITERAL, Value: "50"}},
+				},
+			},
+		},
+	}
+	got := NewTranspiler().Transpile(nodes)
+	wantLines := []string{
+		"from sklearn.neural_network import MLPRegressor\n",
+		"from sklearn.compose import TransformedTargetRegressor\n",
+		`net = TransformedTargetRegressor(regressor=make_pipeline(StandardScaler(), MLPRegressor(hidden_layer_sizes=[64, 32], activation="relu", solver="sgd", nesterovs_momentum=False, max_iter=50)), transformer=StandardScaler())` + "\n",
+	}
+	for _, line := range wantLines {
+		if !strings.Contains(got, line) {
+			t.Errorf("mlp: output missing %q\ngot:\n%s", line, got)
+		}
+	}
+}
+
+// Checks that sgd with a momentum of its own passes momentum once, and
+// that validation_fraction turns on the early stopping it needs.
+func TestTranspileMLPMomentumAndValidation(t *testing.T) {
+	nodes := []parser.Node{
+		&parser.LetNode{
+			Variable: "net",
+			Value: &parser.ExpressionNode{
+				Type:  parser.CALL,
+				Value: "mlp_classifier",
+				Args: []*parser.ExpressionNode{{Type: parser.ARRAY, Args: []*parser.ExpressionNode{
+					{Type: parser.LITERAL, Value: "8"},
+				}}},
+				Keywords: []*parser.KeywordArg{
+					{Name: "optimizer", Value: &parser.ExpressionNode{Type: parser.STRING, Value: "sgd"}},
+					{Name: "momentum", Value: &parser.ExpressionNode{Type: parser.LITERAL, Value: "0.9"}},
+					{Name: "validation_fraction", Value: &parser.ExpressionNode{Type: parser.LITERAL, Value: "0.2"}},
+				},
+			},
+		},
+	}
+	got := NewTranspiler().Transpile(nodes)
+	want := `MLPClassifier(hidden_layer_sizes=[8], solver="sgd", momentum=0.9, validation_fraction=0.2, early_stopping=True)`
+	if !strings.Contains(got, want) {
+		t.Errorf("mlp_classifier: output missing %q\ngot:\n%s", want, got)
+	}
+	if n := strings.Count(got, "momentum="); n != 1 {
+		t.Errorf("mlp_classifier: momentum= appears %d times, want 1\ngot:\n%s", n, got)
+	}
+
+	nodes[0].(*parser.LetNode).Value.Keywords = nodes[0].(*parser.LetNode).Value.Keywords[:1]
+	got = NewTranspiler().Transpile(nodes)
+	if !strings.Contains(got, `MLPClassifier(hidden_layer_sizes=[8], solver="sgd", momentum=0)`) {
+		t.Errorf("mlp_classifier: plain sgd should pass momentum=0\ngot:\n%s", got)
+	}
+}
+
+// Checks that sgd_classifier keeps the native log loss and step schedule,
+// with learning_rate given as eta0 in place of the default.
+func TestTranspileSGD(t *testing.T) {
+	nodes := []parser.Node{
+		&parser.LetNode{
+			Variable: "clf",
+			Value: &parser.ExpressionNode{
+				Type:  parser.CALL,
+				Value: "sgd_classifier",
+				Keywords: []*parser.KeywordArg{
+					{Name: "learning_rate", Value: &parser.ExpressionNode{Type: parser.LITERAL, Value: "0.05"}},
+					{Name: "epochs", Value: &parser.ExpressionNode{Type: parser.LITERAL, Value: "20"}},
+				},
+			},
+		},
+	}
+	got := NewTranspiler().Transpile(nodes)
+	want := `clf = make_pipeline(StandardScaler(), SGDClassifier(loss="log_loss", learning_rate="invscaling", eta0=0.05, max_iter=20))` + "\n"
+	if !strings.Contains(got, want) || !strings.Contains(got, "from sklearn.linear_model import SGDClassifier\n") {
+		t.Errorf("sgd: output missing %q\ngot:\n%s", want, got)
+	}
+}
+
+// Checks that a destructuring split becomes train_test_split with sklearn
+// argument names, and that train's data: selects the DataFrame to fit on.
+func TestTranspileSplit(t *testing.T) {
+	nodes := []parser.Node{
+		&parser.LetNode{
+			Variable: "tr",
+			Names:    []string{"tr", "te"},
+			Value: &parser.ExpressionNode{
+				Type:  parser.CALL,
+				Value: "split",
+				Args:  []*parser.ExpressionNode{{Type: parser.IDENTIFIER, Value: "df"}},
+				Keywords: []*parser.KeywordArg{
+					{Name: "test", Value: &parser.ExpressionNode{Type: parser.LITERAL, Value: "0.2"}},
+					{Name: "stratify", Value: &parser.ExpressionNode{Type: parser.IDENTIFIER, Value: "label"}},
+				},
+			},
+		},
+		&parser.TrainNode{Model: "model", Features: []string{"sqft"}, Target: "price", Data: "tr"},
+	}
+	got := NewTranspiler().Transpile(nodes)
+	wantLines := []string{
+		"from sklearn.model_selection import train_test_split\n",
+		`tr, te = train_test_split(df, test_size=0.2, random_state=0, stratify=df["label"])` + "\n",
+		`model.fit(tr[["sqft"]], tr["price"])` + "\n",
+	}
+	for _, line := range wantLines {
+		if !strings.Contains(got, line) {
+			t.Errorf("split: output missing %q\ngot:\n%s", line, got)
+		}
+	}
+}
+
+// Checks that a keyword the builtin does not take is rejected, as the
+// interpreter rejects it.
+func TestTranspileUnknownKeyword(t *testing.T) {
+	defer func() {
+		if r := recover(); r == nil || !strings.Contains(fmt.Sprint(r), "split: unknown argument tset") {
+			t.Errorf("expected an unknown argument error, got %v", r)
+		}
+	}()
+	NewTranspiler().Transpile([]parser.Node{&parser.LetNode{
+		Variable: "tr",
+		Names:    []string{"tr", "te"},
+		Value: &parser.ExpressionNode{
+			Type:     parser.CALL,
+			Value:    "split",
+			Args:     []*parser.ExpressionNode{{Type: parser.IDENTIFIER, Value: "df"}},
+			Keywords: []*parser.KeywordArg{{Name: "tset", Value: &parser.ExpressionNode{Type: parser.LITERAL, Value: "0.5"}}},
+		},
+	}})
+}
+
+// Checks that cross_validate reuses the features of the model's train call
+// and a shuffled KFold matching the interpreter's folds.
+func TestTranspileCrossValidate(t *testing.T) {
+	nodes := []parser.Node{
+		&parser.TrainNode{Model: "model", Features: []string{"sqft"}, Target: "price"},
+		&parser.LetNode{
+			Variable: "cv",
+			Value: &parser.ExpressionNode{
+				Type:  parser.CALL,
+				Value: "cross_validate",
+				Args: []*parser.ExpressionNode{
+					{Type: parser.IDENTIFIER, Value: "model"},
+					{Type: parser.IDENTIFIER, Value: "df"},
+				},
+				Keywords: []*parser.KeywordArg{{Name: "k", Value: &parser.ExpressionNode{Type: parser.LITERAL, Value: "3"}}},
+			},
+		},
+	}
+	got := NewTranspiler().Transpile(nodes)
+	want := `cv = cross_validate(model, df[["sqft"]], df["price"], cv=KFold(n_splits=3, shuffle=True, random_state=0), scoring=["r2", "neg_root_mean_squared_error", "neg_mean_absolute_error"])` + "\n"
+	if !strings.Contains(got, want) || !strings.Contains(got, "from sklearn.model_selection import KFold\n") {
+		t.Errorf("cross_validate: output missing %q\ngot:\n%s", want, got)
+	}
+}
+
+// Checks that evaluate prints a helper's metrics dict and that the helper is
+// defined once after the imports.
+func TestTranspileEvaluate(t *testing.T) {
+	nodes := []parser.Node{
+		&parser.TrainNode{Model: "model", Features: []string{"sqft"}, Target: "price"},
+		&parser.EvaluateNode{Model: "model", Data: "te"},
+		&parser.EvaluateNode{Model: "model"},
+	}
+	got := NewTranspiler().Transpile(nodes)
+	for _, want := range []string{
+		"from sklearn.metrics import r2_score\n",
+		"\n\ndef evaluate_regressor(model, X, y):\n",
+		`print(evaluate_regressor(model, te[["sqft"]], te["price"]))` + "\n",
+		`print(evaluate_regressor(model, df[["sqft"]], df["price"]))` + "\n",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("evaluate: output missing %q\ngot:\n%s", want, got)
+		}
+	}
+	if n := strings.Count(got, "def evaluate_regressor"); n != 1 {
+		t.Errorf("helper defined %d times, want 1", n)
+	}
+}
+
+// Checks metric builtins in their column form, including member access and
+// the rmse spelling, and in their (model, data) form.
+func TestTranspileMetrics(t *testing.T) {
+	column := func(data, name string) *parser.ExpressionNode {
+		return &parser.ExpressionNode{Type: parser.MEMBER, Value: name, Args: []*parser.ExpressionNode{{Type: parser.IDENTIFIER, Value: data}}}
+	}
+	nodes := []parser.Node{
+		&parser.TrainNode{Model: "model", Features: []string{"sqft"}, Target: "price"},
+		&parser.LetNode{Variable: "e", Value: &parser.ExpressionNode{
+			Type: parser.CALL, Value: "rmse",
+			Args: []*parser.ExpressionNode{column("te", "price"), {Type: parser.IDENTIFIER, Value: "p"}},
+		}},
+		&parser.LetNode{Variable: "a", Value: &parser.ExpressionNode{
+			Type: parser.CALL, Value: "mae",
+			Args: []*parser.ExpressionNode{{Type: parser.IDENTIFIER, Value: "model"}, {Type: parser.IDENTIFIER, Value: "te"}},
+		}},
+	}
+	got := NewTranspiler().Transpile(nodes)
+	for _, want := range []string{
+		`e = mean_squared_error(te["price"], p) ** 0.5` + "\n",
+		`a = mean_absolute_error(te["price"], model.predict(te[["sqft"]]))` + "\n",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("metrics: output missing %q\ngot:\n%s", want, got)
+		}
+	}
+}
+
+// Checks that search becomes a GridSearchCV with sklearn parameter names and
+// scoring, and that the result can be evaluated like a trained model.
+func TestTranspileSearch(t *testing.T) {
+	num := func(v string) *parser.ExpressionNode { return &parser.ExpressionNode{Type: parser.LITERAL, Value: v} }
+	nodes := []parser.Node{
+		&parser.LetNode{Variable: "best", Value: &parser.ExpressionNode{
+			Type:  parser.CALL,
+			Value: "search",
+			Args:  []*parser.ExpressionNode{{Type: parser.IDENTIFIER, Value: "gbm_regressor"}, {Type: parser.IDENTIFIER, Value: "df"}},
+			Keywords: []*parser.KeywordArg{
+				{Name: "grid", Value: &parser.ExpressionNode{Type: parser.MAP, Keywords: []*parser.KeywordArg{
+					{Name: "max_depth", Value: &parser.ExpressionNode{Type: parser.ARRAY, Args: []*parser.ExpressionNode{num("3"), num("5")}}},
+					{Name: "seed", Value: num("1")},
+				}}},
+				{Name: "cv", Value: num("3")},
+				{Name: "metric", Value: &parser.ExpressionNode{Type: parser.STRING, Value: "rmse"}},
+				{Name: "features", Value: &parser.ExpressionNode{Type: parser.IDENTIFIER, Value: "sqft"}},
+				{Name: "target", Value: &parser.ExpressionNode{Type: parser.IDENTIFIER, Value: "price"}},
+			},
+		}},
+		&parser.EvaluateNode{Model: "best"},
+	}
+	got := NewTranspiler().Transpile(nodes)
+	for _, want := range []string{
+		"from sklearn.model_selection import GridSearchCV\n",
+		"\n\ndef best_of(search, X, y):\n",
+		`best = best_of(GridSearchCV(GradientBoostingRegressor(), {"max_depth": [3, 5], "random_state": [1]}, cv=KFold(n_splits=3, shuffle=True, random_state=0), scoring="neg_root_mean_squared_error", n_jobs=-1), df[["sqft"]], df["price"])` + "\n",
+		`print(evaluate_regressor(best, df[["sqft"]], df["price"]))` + "\n",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("search: output missing %q\ngot:\n%s", want, got)
+		}
+	}
+}
+
+// Checks the dataset forms of predict: printing, adding a column in place,
+// and assign() when used as a value with into:.
+func TestTranspilePredictDataset(t *testing.T) {
+	nodes := []parser.Node{
+		&parser.TrainNode{Model: "model", Features: []string{"sqft", "age"}, Target: "price"},
+		&parser.PredictNode{Model: "model", Data: "te"},
+		&parser.PredictNode{Model: "model", Data: "te", Into: "price_hat"},
+		&parser.LetNode{Variable: "scored", Value: &parser.ExpressionNode{
+			Type:     parser.CALL,
+			Value:    "predict",
+			Args:     []*parser.ExpressionNode{{Type: parser.IDENTIFIER, Value: "model"}, {Type: parser.IDENTIFIER, Value: "te"}},
+			Keywords: []*parser.KeywordArg{{Name: "into", Value: &parser.ExpressionNode{Type: parser.STRING, Value: "price_hat"}}},
+		}},
+	}
+	got := transpileNodes(nodes)
+	want := `model = LinearRegression()
+model.fit(df[["sqft", "age"]], df["price"])
+print(model.predict(te[["sqft", "age"]]))
+te["price_hat"] = model.predict(te[["sqft", "age"]])
+scored = te.assign(price_hat=model.predict(te[["sqft", "age"]]))
+`
+	if got != want {
+		t.Errorf("predict:\ngot:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+// Checks that save_model and load_model use joblib, and that a loaded model
+// is evaluated with the columns and type it carries at run time.
+func TestTranspileSaveAndLoadModel(t *testing.T) {
+	str := func(s string) *parser.ExpressionNode { return &parser.ExpressionNode{Type: parser.STRING, Value: s} }
+	ident := func(s string) *parser.ExpressionNode { return &parser.ExpressionNode{Type: parser.IDENTIFIER, Value: s} }
+	nodes := []parser.Node{
+		&parser.TrainNode{Model: "model", Features: []string{"sqft"}, Target: "price"},
+		&parser.CallNode{Call: &parser.ExpressionNode{Type: parser.CALL, Value: "save_model", Args: []*parser.ExpressionNode{ident("model"), str("m.mlm")}}},
+		&parser.LetNode{Variable: "again", Value: &parser.ExpressionNode{Type: parser.CALL, Value: "load_model", Args: []*parser.ExpressionNode{str("m.mlm")}}},
+		&parser.EvaluateNode{Model: "again", Data: "te"},
+		&parser.CallNode{Call: &parser.ExpressionNode{Type: parser.CALL, Value: "r2", Args: []*parser.ExpressionNode{ident("again"), ident("te")}}},
+	}
+	got := NewTranspiler().Transpile(nodes)
+	for _, want := range []string{
+		"import joblib\n",
+		"from sklearn.base import is_classifier\n",
+		"def save_model(model, path, target):\n    model.target_name_ = target\n    joblib.dump(model, path)\n",
+		`save_model(model, "m.mlm", "price")` + "\n",
+		`again = joblib.load("m.mlm")` + "\n",
+		`print((evaluate_classifier if is_classifier(again) else evaluate_regressor)(again, te[again.feature_names_in_], te[again.target_name_]))` + "\n",
+		`print(r2_score(te[again.target_name_], again.predict(te[again.feature_names_in_])))` + "\n",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("save/load: output missing %q\ngot:\n%s", want, got)
+		}
+	}
+}
+
+// Checks that export_onnx converts with skl2onnx and that logistic_regression
+// is written as a scaled sklearn LogisticRegression.
+func TestTranspileExportONNX(t *testing.T) {
+	str := func(s string) *parser.ExpressionNode { return &parser.ExpressionNode{Type: parser.STRING, Value: s} }
+	ident := func(s string) *parser.ExpressionNode { return &parser.ExpressionNode{Type: parser.IDENTIFIER, Value: s} }
+	nodes := []parser.Node{
+		&parser.LetNode{Variable: "clf", Value: &parser.ExpressionNode{Type: parser.CALL, Value: "logistic_regression", Keywords: []*parser.KeywordArg{
+			{Name: "C", Value: &parser.ExpressionNode{Type: parser.LITERAL, Value: 0.5}},
+		}}},
+		&parser.TrainNode{Model: "clf", Features: []string{"sqft"}, Target: "sold"},
+		&parser.CallNode{Call: &parser.ExpressionNode{Type: parser.CALL, Value: "export_onnx", Args: []*parser.ExpressionNode{ident("clf"), str("clf.onnx")}}},
+	}
+	got := NewTranspiler().Transpile(nodes)
+	for _, want := range []string{
+		"from skl2onnx import convert_sklearn\n",
+		"from skl2onnx.common.data_types import FloatTensorType\n",
+		"clf = make_pipeline(StandardScaler(), LogisticRegression(C=0.5))\n",
+		"def export_onnx(model, path):\n",
+		`export_onnx(clf, "clf.onnx")` + "\n",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("export_onnx: output missing %q\ngot:\n%s", want, got)
+		}
+	}
+}
+
+// Checks that export_pmml converts with sklearn2pmml, passing the target the
+// model was trained on.
+func TestTranspileExportPMML(t *testing.T) {
+	nodes := []parser.Node{
+		&parser.TrainNode{Model: "model", Features: []string{"sqft"}, Target: "price"},
+		&parser.CallNode{Call: &parser.ExpressionNode{Type: parser.CALL, Value: "export_pmml", Args: []*parser.ExpressionNode{
+			{Type: parser.IDENTIFIER, Value: "model"}, {Type: parser.STRING, Value: "m.pmml"},
+		}}},
+	}
+	got := NewTranspiler().Transpile(nodes)
+	for _, want := range []string{
+		"from sklearn2pmml import make_pmml_pipeline, sklearn2pmml\n",
+		"def export_pmml(model, path, target):\n",
+		`export_pmml(model, "m.pmml", "price")` + "\n",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("export_pmml: output missing %q\ngot:\n%s", want, got)
+		}
+	}
+}
+
+// Checks that preprocessing statements fit a step and update their data in
+// place, and that predictions on data without the steps replay them.
+func TestTranspilePreprocessing(t *testing.T) {
+	ident := func(s string) *parser.ExpressionNode { return &parser.ExpressionNode{Type: parser.IDENTIFIER, Value: s} }
+	call := func(name string, args ...*parser.ExpressionNode) *parser.ExpressionNode {
+		return &parser.ExpressionNode{Type: parser.CALL, Value: name, Args: args}
+	}
+	nodes := []parser.Node{
+		&parser.LoadNode{File: "houses.csv"},
+		&parser.CallNode{Call: call("impute", ident("age"), &parser.ExpressionNode{Type: parser.STRING, Value: "median"})},
+		&parser.CallNode{Call: call("drop_na")},
+		&parser.LetNode{Names: []string{"tr", "te"}, Value: call("split", ident("df"))},
+		&parser.CallNode{Call: &parser.ExpressionNode{Type: parser.CALL, Value: "standardize",
+			Args: []*parser.ExpressionNode{{Type: parser.ARRAY, Args: []*parser.ExpressionNode{ident("sqft"), ident("age")}}}, Keywords: []*parser.KeywordArg{{Name: "data", Value: ident("tr")}}}},
+		&parser.TrainNode{Model: "model", Features: []string{"sqft", "age"}, Target: "price", Data: "tr"},
+		&parser.PredictNode{Model: "model", Data: "te"},
+	}
+	got := NewTranspiler().Transpile(nodes)
+	for _, want := range []string{
+		"from sklearn.impute import SimpleImputer\n",
+		"from sklearn.preprocessing import StandardScaler\n",
+		"def impute(data, column, strategy=None, value=None):\n",
+		"step_1 = impute(df, \"age\", \"median\", None)\ndf = step_1(df)\n",
+		"df = df.dropna()\n",
+		"step_2 = standardize(tr, [\"sqft\", \"age\"])\ntr = step_2(tr)\n",
+		"model.fit(tr[[\"sqft\", \"age\"]], tr[\"price\"])\n",
+		"print(model.predict(step_2(te)[[\"sqft\", \"age\"]]))\n",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("preprocessing: output missing %q\ngot:\n%s", want, got)
+		}
+	}
+}
+
+// Checks that a column one_hot encoded names the columns it wrote in a
+// train's features, as in the interpreter, and that save_model rejects a
+// model trained after preprocessing statements, whose steps joblib cannot
+// save with it.
+func TestTranspileOneHotFeatures(t *testing.T) {
+	ident := func(s string) *parser.ExpressionNode { return &parser.ExpressionNode{Type: parser.IDENTIFIER, Value: s} }
+	call := func(name string, args ...*parser.ExpressionNode) *parser.ExpressionNode {
+		return &parser.ExpressionNode{Type: parser.CALL, Value: name, Args: args}
+	}
+	nodes := []parser.Node{
+		&parser.LoadNode{File: "houses.csv"},
+		&parser.CallNode{Call: call("one_hot", ident("city"))},
+		&parser.LetNode{Names: []string{"tr", "te"}, Value: call("split", ident("df"))},
+		&parser.TrainNode{Model: "m", Features: []string{"sqft", "age", "city"}, Target: "price", Data: "tr"},
+		&parser.PredictNode{Model: "m", Data: "te"},
+		&parser.EvaluateNode{Model: "m", Data: "te"},
+	}
+	got := NewTranspiler().Transpile(nodes)
+	for _, want := range []string{
+		"    step.columns = list(encoder.get_feature_names_out())\n    return step\n",
+		"step_1 = one_hot(df, \"city\")\ndf = step_1(df)\n",
+		"m.fit(tr[[\"sqft\", \"age\", *step_1.columns]], tr[\"price\"])\n",
+		"print(m.predict(te[[\"sqft\", \"age\", *step_1.columns]]))\n",
+		"print(evaluate_regressor(m, te[[\"sqft\", \"age\", *step_1.columns]], te[\"price\"]))\n",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("one_hot features: output missing %q\ngot:\n%s", want, got)
+		}
+	}
+
+	save := append(nodes, &parser.CallNode{Call: call("save_model", ident("m"), &parser.ExpressionNode{Type: parser.STRING, Value: "m.mlm"})})
+	defer func() {
+		if r := recover(); r == nil || !strings.Contains(fmt.Sprint(r), "save_model(m): the preprocessing steps") {
+			t.Errorf("save_model after one_hot: got %v, want a preprocessing error", r)
+		}
+	}()
+	NewTranspiler().Transpile(save)
+}
+
+// Checks that a pipeline becomes a scikit-learn Pipeline of column
+// transformers ending in the model, and that searching it prefixes the
+// grid with the model step's name.
+func TestTranspilePipeline(t *testing.T) {
+	ident := func(s string) *parser.ExpressionNode { return &parser.ExpressionNode{Type: parser.IDENTIFIER, Value: s} }
+	call := func(name string, args ...*parser.ExpressionNode) *parser.ExpressionNode {
+		return &parser.ExpressionNode{Type: parser.CALL, Value: name, Args: args}
+	}
+	steps := &parser.ExpressionNode{Type: parser.ARRAY, Args: []*parser.ExpressionNode{
+		call("standardize", ident("sqft")),
+		{Type: parser.CALL, Value: "impute", Args: []*parser.ExpressionNode{ident("age")}, Keywords: []*parser.KeywordArg{
+			{Name: "strategy", Value: &parser.ExpressionNode{Type: parser.STRING, Value: "median"}},
+		}},
+		call("one_hot", ident("city")),
+		call("gbm_regressor"),
+	}}
+	nodes := []parser.Node{
+		&parser.LetNode{Variable: "p", Value: call("pipeline", steps)},
+		&parser.TrainNode{Model: "p", Features: []string{"sqft", "age", "city"}, Target: "price"},
+		&parser.LetNode{Variable: "best", Value: &parser.ExpressionNode{Type: parser.CALL, Value: "search", Args: []*parser.ExpressionNode{ident("p"), ident("df")},
+			Keywords: []*parser.KeywordArg{{Name: "grid", Value: &parser.ExpressionNode{Type: parser.MAP, Keywords: []*parser.KeywordArg{
+				{Name: "max_depth", Value: &parser.ExpressionNode{Type: parser.ARRAY, Args: []*parser.ExpressionNode{{Type: parser.LITERAL, Value: 3.0}}}},
+			}}}}}},
+	}
+	got := NewTranspiler().Transpile(nodes)
+	for _, want := range []string{
+		"from sklearn.pipeline import Pipeline\n",
+		"from sklearn.compose import ColumnTransformer\n",
+		"def on_columns(name, transformer, columns):\n",
+		`p = Pipeline([on_columns("standardize", StandardScaler(), ["sqft"]), on_columns("impute", SimpleImputer(strategy="median"), ["age"]), ` +
+			`on_columns("one_hot", OneHotEncoder(handle_unknown="ignore", sparse_output=False), ["city"]), ("model", GradientBoostingRegressor())]).set_output(transform="pandas")` + "\n",
+		`p.fit(df[["sqft", "age", "city"]], df["price"])` + "\n",
+		`{"model__max_depth": [3]}`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("pipeline: output missing %q\ngot:\n%s", want, got)
+		}
+	}
+}
+
+// Checks that query builtins become pandas methods, with bare names in
+// conditions read as columns and declared variables left as they are.
+func TestTranspileQuery(t *testing.T) {
+	ident := func(s string) *parser.ExpressionNode { return &parser.ExpressionNode{Type: parser.IDENTIFIER, Value: s} }
+	binary := func(op string, l, r *parser.ExpressionNode) *parser.ExpressionNode {
+		return &parser.ExpressionNode{Type: parser.BINARY, Value: op, Args: []*parser.ExpressionNode{l, r}}
+	}
+	call := func(name string, args ...*parser.ExpressionNode) *parser.ExpressionNode {
+		return &parser.ExpressionNode{Type: parser.CALL, Value: name, Args: args}
+	}
+	number := &parser.ExpressionNode{Type: parser.LITERAL, Value: "20"}
+	nodes := []parser.Node{
+		&parser.LetNode{Variable: "floor", Value: &parser.ExpressionNode{Type: parser.LITERAL, Value: "100000"}},
+		&parser.LetNode{Variable: "recent", Value: call("filter", ident("df"),
+			binary("&&", binary(">", ident("price"), ident("floor")), binary("<", ident("age"), number)))},
+		&parser.LetNode{Variable: "priced", Value: call("with_column", ident("recent"),
+			&parser.ExpressionNode{Type: parser.STRING, Value: "ppsf"}, binary("/", ident("price"), ident("sqft")))},
+		&parser.LetNode{Variable: "ranked", Value: &parser.ExpressionNode{Type: parser.CALL, Value: "sort", Args: []*parser.ExpressionNode{ident("priced")},
+			Keywords: []*parser.KeywordArg{{Name: "by", Value: ident("ppsf")}, {Name: "desc", Value: ident("true")}}}},
+		&parser.LetNode{Variable: "young", Value: call("filter", call("head", ident("df"), number),
+			&parser.ExpressionNode{Type: parser.UNARY, Value: "!", Args: []*parser.ExpressionNode{binary(">=", ident("age"), number)}})},
+		&parser.LetNode{Variable: "few", Value: call("sample", call("select", ident("df"),
+			&parser.ExpressionNode{Type: parser.ARRAY, Args: []*parser.ExpressionNode{ident("sqft"), ident("price")}}), number)},
+	}
+	got := NewTranspiler().Transpile(nodes)
+	for _, want := range []string{
+		`recent = df[(df["price"] > floor) & (df["age"] < 20)]` + "\n",
+		`priced = recent.assign(ppsf=recent["price"] / recent["sqft"])` + "\n",
+		`ranked = priced.sort_values(["ppsf"], ascending=False, kind="stable")` + "\n",
+		`young = df.head(20).loc[lambda d: ~(d["age"] >= 20)]` + "\n",
+		`few = df[["sqft", "price"]].sample(n=20, random_state=0)` + "\n",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("query: output missing %q\ngot:\n%s", want, got)
+		}
+	}
+}
+
+// Checks that expressions are parenthesized only where Python's
+// precedence or left-to-right grouping would read them differently, and
+// that a comparison inside a comparison is not chained.
+func TestTranspileExpressions(t *testing.T) {
+	ident := func(s string) *parser.ExpressionNode { return &parser.ExpressionNode{Type: parser.IDENTIFIER, Value: s} }
+	binary := func(op string, l, r *parser.ExpressionNode) *parser.ExpressionNode {
+		return &parser.ExpressionNode{Type: parser.BINARY, Value: op, Args: []*parser.ExpressionNode{l, r}}
+	}
+	not := func(e *parser.ExpressionNode) *parser.ExpressionNode {
+		return &parser.ExpressionNode{Type: parser.UNARY, Value: "!", Args: []*parser.ExpressionNode{e}}
+	}
+	a, b, c := ident("a"), ident("b"), ident("c")
+	tests := []struct {
+		expr *parser.ExpressionNode
+		want string
+	}{
+		{binary("+", a, binary("*", b, c)), "a + b * c"},
+		{binary("*", binary("+", a, b), c), "(a + b) * c"},
+		{binary("-", a, binary("-", b, c)), "a - (b - c)"},
+		{binary("-", binary("-", a, b), c), "a - b - c"},
+		{binary("==", binary("<", a, b), c), "(a < b) == c"},
+		{binary("||", binary("&&", a, b), not(c)), "a and b or not c"},
+		{not(binary("||", a, b)), "not (a or b)"},
+		{&parser.ExpressionNode{Type: parser.UNARY, Value: "-", Args: []*parser.ExpressionNode{binary("+", a, b)}}, "-(a + b)"},
+		{&parser.ExpressionNode{Type: parser.MEMBER, Value: "price", Args: []*parser.ExpressionNode{binary("+", a, b)}}, `(a + b)["price"]`},
+		{&parser.ExpressionNode{Type: parser.STRING, Value: "say \"hi\"\n"}, `"say \"hi\"\n"`},
+	}
+	for _, tt := range tests {
+		got := transpileNodes([]parser.Node{&parser.LetNode{Variable: "x", Value: tt.expr}})
+		if want := "x = " + tt.want + "\n"; got != want {
+			t.Errorf("got %q, want %q", got, want)
+		}
+	}
+}
+
+// Checks that variables named after Python keywords or builtins get a
+// trailing underscore wherever they are bound or used, while a column
+// named def is left alone, and that the loop counter does not hide a
+// variable named i.
+func TestTranspileReservedNames(t *testing.T) {
+	ident := func(s string) *parser.ExpressionNode { return &parser.ExpressionNode{Type: parser.IDENTIFIER, Value: s} }
+	nodes := []parser.Node{
+		&parser.LoadNode{File: "data.csv"},
+		&parser.LetNode{Variable: "class", Value: &parser.ExpressionNode{Type: parser.LITERAL, Value: "3"}},
+		&parser.LetNode{Variable: "i", Value: &parser.ExpressionNode{Type: parser.LITERAL, Value: "0"}},
+		&parser.LetNode{Variable: "big", Value: &parser.ExpressionNode{Type: parser.CALL, Value: "filter", Args: []*parser.ExpressionNode{ident("df"),
+			{Type: parser.BINARY, Value: ">", Args: []*parser.ExpressionNode{ident("def"), ident("class")}}}}},
+		&parser.TrainNode{Model: "lambda", Features: []string{"sqft"}, Target: "price", Data: "big"},
+		&parser.LoopNode{Count: ident("class"), Commands: []parser.Node{
+			&parser.SetNode{Variable: "i", Value: &parser.ExpressionNode{Type: parser.BINARY, Value: "+", Args: []*parser.ExpressionNode{ident("i"), ident("class")}}},
+		}},
+	}
+	got := transpileNodes(nodes)
+	for _, want := range []string{
+		"class_ = 3\n",
+		`big = df[df["def"] > class_]` + "\n",
+		"lambda_ = LinearRegression()\n",
+		`lambda_.fit(big[["sqft"]], big["price"])` + "\n",
+		"for i_ in range(class_):\n",
+		"    i = i + class_\n",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("output missing %q\ngot:\n%s", want, got)
+		}
+	}
+}
+
+// Checks that group_by and agg become a pandas groupby with named
+// aggregations, counting rows through a grouping column even when the
+// groups are held in a variable, and that join becomes merge.
+func TestTranspileGroupByAndJoin(t *testing.T) {
+	ident := func(s string) *parser.ExpressionNode { return &parser.ExpressionNode{Type: parser.IDENTIFIER, Value: s} }
+	call := func(name string, args ...*parser.ExpressionNode) *parser.ExpressionNode {
+		return &parser.ExpressionNode{Type: parser.CALL, Value: name, Args: args}
+	}
+	nodes := []parser.Node{
+		&parser.LetNode{Variable: "g", Value: call("group_by", ident("df"), &parser.ExpressionNode{Type: parser.ARRAY, Args: []*parser.ExpressionNode{ident("bedrooms")}})},
+		&parser.LetNode{Variable: "by", Value: call("agg", ident("g"), call("mean", ident("price")), call("n_unique", ident("city")), call("count"))},
+		&parser.LetNode{Variable: "j", Value: &parser.ExpressionNode{Type: parser.CALL, Value: "join", Args: []*parser.ExpressionNode{ident("df"), ident("areas")},
+			Keywords: []*parser.KeywordArg{{Name: "on", Value: ident("id")}, {Name: "how", Value: &parser.ExpressionNode{Type: parser.STRING, Value: "left"}}}}},
+	}
+	got := NewTranspiler().Transpile(nodes)
+	for _, want := range []string{
+		`g = df.groupby(["bedrooms"], dropna=False)` + "\n",
+		`by = g.agg(mean_price=("price", "mean"), n_unique_city=("city", "nunique"), count=("bedrooms", "size")).reset_index()` + "\n",
+		`j = df.merge(areas, on=["id"], how="left")` + "\n",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("group by: output missing %q\ngot:\n%s", want, got)
+		}
+	}
+}
+
+// Checks that describe defines a helper built on pandas' describe.
+func TestTranspileDescribe(t *testing.T) {
+	nodes := []parser.Node{
+		&parser.CallNode{Call: &parser.ExpressionNode{Type: parser.CALL, Value: "describe"}},
+	}
+	got := NewTranspiler().Transpile(nodes)
+	for _, want := range []string{
+		"def describe(data):\n",
+		`summary = data.describe(include="all").T`,
+		"print(describe(df))\n",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("describe: output missing %q\ngot:\n%s", want, got)
+		}
+	}
+}
+
+// Checks that load and save pick the pandas reader and writer from the
+// format: argument or the extension, looking past a compression suffix.
+func TestTranspileFormats(t *testing.T) {
+	nodes := []parser.Node{
+		&parser.LoadNode{File: "prices.jsonl.gz"},
+		&parser.LoadNode{File: "prices.txt", Format: "tsv"},
+		&parser.SaveNode{File: "out.parquet"},
+		&parser.SaveNode{File: "out", Format: "json"},
+	}
+	got := transpileNodes(nodes)
+	want := `df = pd.read_json("prices.jsonl.gz", lines=True)
+df = pd.read_csv("prices.txt", sep="\t")
+df.to_parquet("out.parquet", index=False)
+df.to_json("out", orient="records")
+`
+	if got != want {
+		t.Errorf("formats: got\n%s\nwant\n%s", got, want)
+	}
+}
+
+// Checks that load(sqlite:) becomes pd.read_sql with the query's named
+// parameters passed from Python variables, and save(..., sqlite:) to_sql.
+func TestTranspileSQLite(t *testing.T) {
+	nodes := []parser.Node{
+		&parser.LoadNode{SQLite: "features.db", Query: "SELECT * FROM houses WHERE city = :city"},
+		&parser.SaveNode{Data: "preds", SQLite: "out.db", Table: "preds"},
+	}
+	got := NewTranspiler().Transpile(nodes)
+	for _, want := range []string{
+		"import sqlite3\n",
+		`con = sqlite3.connect("features.db")
+df = pd.read_sql("SELECT * FROM houses WHERE city = :city", con, params={"city": city})
+con.close()
+con = sqlite3.connect("out.db")
+preds.to_sql("preds", con, if_exists="replace", index=False)
+con.close()
+`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("sqlite: output missing %q\ngot:\n%s", want, got)
+		}
+	}
+}
+
+// Checks that a module reads load and save paths and top-level constants
+// from argparse flags, runs under main, and lists its pip requirements.
+func TestTranspileModule(t *testing.T) {
+	nodes := []parser.Node{
+		&parser.LoadNode{File: "data/housing.csv"},
+		&parser.LetNode{Variable: "floor", Value: &parser.ExpressionNode{Type: parser.LITERAL, Value: "100000"}},
+		&parser.LetNode{Variable: "big", Value: &parser.ExpressionNode{Type: parser.CALL, Value: "filter", Args: []*parser.ExpressionNode{
+			{Type: parser.IDENTIFIER, Value: "df"},
+			{Type: parser.BINARY, Value: ">", Args: []*parser.ExpressionNode{
+				{Type: parser.IDENTIFIER, Value: "price"},
+				{Type: parser.IDENTIFIER, Value: "floor"},
+			}},
+		}}},
+		&parser.SaveNode{Data: "big", File: "out.parquet"},
+		&parser.SaveNode{File: "data/housing.csv"},
+	}
+	m := NewTranspiler().TranspileModule(nodes)
+	want := `def main(args):
+    df = pd.read_csv(args.housing_csv)
+    floor = args.floor
+    big = df[df["price"] > floor]
+    big.to_parquet(args.out_parquet, index=False)
+    df.to_csv(args.housing_csv, index=False)
+
+
+if __name__ == "__main__":
+    parser = argparse.ArgumentParser(description="Generated from MLite.")
+    parser.add_argument("--housing-csv", dest="housing_csv", default="data/housing.csv", help="file read by load")
+    parser.add_argument("--floor", dest="floor", type=int, default=100000, help="let floor")
+    parser.add_argument("--out-parquet", dest="out_parquet", default="out.parquet", help="file written by save")
+    main(parser.parse_args())
+`
+	if !strings.Contains(m.Script, "import argparse\n") || !strings.HasSuffix(m.Script, "\n\n\n"+want) {
+		t.Errorf("module:\n%s\nwant it to end with:\n%s", m.Script, want)
+	}
+	if m.Requirements != "pandas\npyarrow\n" {
+		t.Errorf("requirements:\n%s", m.Requirements)
+	}
+}
+
+// Checks that a module flag for a let named after a Python keyword reads
+// into a renamed destination, since args.class would not parse.
+func TestTranspileModuleKeywordFlag(t *testing.T) {
+	nodes := []parser.Node{
+		&parser.LetNode{Variable: "class", Value: &parser.ExpressionNode{Type: parser.LITERAL, Value: "5"}},
+		&parser.LetNode{Variable: "lambda", Value: &parser.ExpressionNode{Type: parser.STRING, Value: "x"}},
+	}
+	m := NewTranspiler().TranspileModule(nodes)
+	for _, want := range []string{
+		"    class_ = args.class_\n",
+		"    lambda_ = args.lambda_\n",
+		`    parser.add_argument("--class", dest="class_", type=int, default=5, help="let class")` + "\n",
+		`    parser.add_argument("--lambda", dest="lambda_", type=str, default="x", help="let lambda")` + "\n",
+	} {
+		if !strings.Contains(m.Script, want) {
+			t.Errorf("module: output missing %q\ngot:\n%s", want, m.Script)
+		}
+	}
+}
+
+// Checks that the R backend fits models by formula, queries with dplyr
+// verbs reaching variables through .env, and attaches only the packages
+// it uses.
+func TestTranspileR(t *testing.T) {
+	ident := func(s string) *parser.ExpressionNode { return &parser.ExpressionNode{Type: parser.IDENTIFIER, Value: s} }
+	nodes := []parser.Node{
+		&parser.CommentNode{Text: "Housing"},
+		&parser.LoadNode{File: "housing.csv"},
+		&parser.LetNode{Variable: "floor", Value: &parser.ExpressionNode{Type: parser.LITERAL, Value: "100000"}},
+		&parser.LetNode{Variable: "big", Value: &parser.ExpressionNode{Type: parser.CALL, Value: "filter", Args: []*parser.ExpressionNode{ident("df"),
+			{Type: parser.BINARY, Value: "&&", Args: []*parser.ExpressionNode{
+				{Type: parser.BINARY, Value: ">", Args: []*parser.ExpressionNode{ident("price"), ident("floor")}},
+				{Type: parser.UNARY, Value: "!", Args: []*parser.ExpressionNode{{Type: parser.BINARY, Value: "<", Args: []*parser.ExpressionNode{ident("age"), ident("floor")}}}},
+			}}}}},
+		&parser.LetNode{Variable: "m", Value: &parser.ExpressionNode{Type: parser.CALL, Value: "logistic_regression"}},
+		&parser.TrainNode{Model: "m", Features: []string{"sqft", "lot size"}, Target: "sold", Data: "big"},
+		&parser.EvaluateNode{Model: "m", Data: "big"},
+		&parser.LoopNode{Count: &parser.ExpressionNode{Type: parser.LITERAL, Value: "2"}, Commands: []parser.Node{
+			&parser.SetNode{Variable: "floor", Value: &parser.ExpressionNode{Type: parser.BINARY, Value: "*", Args: []*parser.ExpressionNode{ident("floor"), ident("true")}}},
+		}},
+	}
+	got := NewRTranspiler().Transpile(nodes)
+	for _, want := range []string{
+		"library(dplyr)\nlibrary(readr)\n\n",
+		"# Housing\ndf <- read_csv(\"housing.csv\", show_col_types = FALSE)\n",
+		"big <- filter(df, price > .env$floor & !(age < .env$floor))\n",
+		"m <- glm(as.factor(sold) ~ sqft + `lot size`, data = big, family = binomial)\n",
+		"print(evaluate_classifier(predict_class(m, big), big$sold))\n",
+		"for (i in seq_len(2)) {\n  floor <- floor * TRUE\n}\n",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("R output missing %q\ngot:\n%s", want, got)
+		}
+	}
+	if strings.Contains(got, "m <- logistic_regression") {
+		t.Errorf("a model declaration should only be fitted by train:\n%s", got)
+	}
+
+	func() {
+		defer func() {
+			if r := recover(); r == nil || !strings.Contains(fmt.Sprint(r), "search has no R translation") {
+				t.Errorf("expected search to have no R translation, got %v", r)
+			}
+		}()
+		NewRTranspiler().Transpile([]parser.Node{&parser.CallNode{Call: &parser.ExpressionNode{Type: parser.CALL, Value: "search"}}})
+	}()
+}
+
+// Checks that the R backend fits gbm_regressor with the gbm package and
+// the interpreter's defaults, and rejects gbm_classifier.
+func TestTranspileRGBM(t *testing.T) {
+	nodes := []parser.Node{
+		&parser.LetNode{Variable: "m", Value: &parser.ExpressionNode{Type: parser.CALL, Value: "gbm_regressor", Keywords: []*parser.KeywordArg{
+			{Name: "n_estimators", Value: &parser.ExpressionNode{Type: parser.LITERAL, Value: "200"}},
+			{Name: "seed", Value: &parser.ExpressionNode{Type: parser.LITERAL, Value: "7"}},
+		}}},
+		&parser.TrainNode{Model: "m", Features: []string{"sqft", "age"}, Target: "price"},
+		&parser.PredictNode{Model: "m", Data: "df"},
+	}
+	got := NewRTranspiler().Transpile(nodes)
+	for _, want := range []string{
+		"library(gbm)\n",
+		"set.seed(7)\n",
+		`m <- gbm(price ~ sqft + age, data = df, distribution = "gaussian", n.trees = 200, interaction.depth = 3, shrinkage = 0.1, bag.fraction = 1, n.minobsinnode = 1)` + "\n",
+		"print(predict(m, newdata = df, n.trees = m$n.trees))\n",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("R gbm: output missing %q\ngot:\n%s", want, got)
+		}
+	}
+	if strings.Contains(got, "randomForest") {
+		t.Errorf("R gbm: gbm_regressor should not be fitted as a random forest:\n%s", got)
+	}
+
+	defer func() {
+		if r := recover(); r == nil || !strings.Contains(fmt.Sprint(r), "gbm_classifier has no R translation") {
+			t.Errorf("expected gbm_classifier to have no R translation, got %v", r)
+		}
+	}()
+	NewRTranspiler().Transpile([]parser.Node{&parser.TrainNode{Model: "gbm_classifier", Features: []string{"sqft"}, Target: "sold"}})
+}
+
+// Checks that a call statement to a function MLite does not have is
+// rejected, as the interpreter rejects it, rather than printed, and that
+// an action builtin is not printed.
+func TestTranspileCallStatements(t *testing.T) {
+	call := func(name string, args ...*parser.ExpressionNode) parser.Node {
+		return &parser.CallNode{Call: &parser.ExpressionNode{Type: parser.CALL, Value: name, Args: args}}
+	}
+	h2 := &parser.ExpressionNode{Type: parser.IDENTIFIER, Value: "h2"}
+	for name, transpile := range map[string]func([]parser.Node) string{
+		"python": NewTranspiler().Transpile,
+		"r":      NewRTranspiler().Transpile,
+	} {
+		func() {
+			defer func() {
+				if r := recover(); r == nil || !strings.Contains(fmt.Sprint(r), "unknown function print") {
+					t.Errorf("%s: expected print(h2) to be rejected, got %v", name, r)
+				}
+			}()
+			transpile([]parser.Node{call("print", h2)})
+		}()
+	}
+
+	got := NewTranspiler().Transpile([]parser.Node{
+		&parser.LetNode{Variable: "m", Value: &parser.ExpressionNode{Type: parser.CALL, Value: "linreg"}},
+		&parser.TrainNode{Model: "m", Features: []string{"sqft"}, Target: "price"},
+		call("save_model", &parser.ExpressionNode{Type: parser.IDENTIFIER, Value: "m"}, &parser.ExpressionNode{Type: parser.STRING, Value: "m.mlm"}),
+	})
+	if !strings.Contains(got, "\nsave_model(m, ") || strings.Contains(got, "print(save_model") {
+		t.Errorf("save_model should be emitted without print:\n%s", got)
+	}
+}
+
+// Checks that a notebook has a cell for the imports, a code cell per
+// statement and a markdown cell per comment, in nbformat 4.
+func TestTranspileNotebook(t *testing.T) {
+	nodes := []parser.Node{
+		&parser.CommentNode{Text: "Load the data"},
+		&parser.LoadNode{File: "housing.csv"},
+		&parser.TrainNode{Model: "m", Features: []string{"sqft"}, Target: "price"},
+	}
+	var notebook struct {
+		Cells []struct {
+			Type           string   `json:"cell_type"`
+			Source         []string `json:"source"`
+			ExecutionCount *int     `json:"execution_count"`
+			Outputs        []any    `json:"outputs"`
+		} `json:"cells"`
+		NBFormat int `json:"nbformat"`
+	}
+	if err := json.Unmarshal([]byte(NewNotebook().Transpile(nodes)), &notebook); err != nil {
+		t.Fatal(err)
+	}
+	want := []struct{ kind, source string }{
+		{"code", "import pandas as pd\nfrom sklearn.linear_model import LinearRegression"},
+		{"markdown", "Load the data"},
+		{"code", `df = pd.read_csv("housing.csv")`},
+		{"code", "m = LinearRegression()\nm.fit(df[[\"sqft\"]], df[\"price\"])"},
+	}
+	if notebook.NBFormat != 4 || len(notebook.Cells) != len(want) {
+		t.Fatalf("got nbformat %d with %d cells, want 4 with %d", notebook.NBFormat, len(notebook.Cells), len(want))
+	}
+	for i, cell := range notebook.Cells {
+		if cell.Type != want[i].kind || strings.Join(cell.Source, "") != want[i].source {
+			t.Errorf("cell %d: got %s %q, want %s %q", i, cell.Type, strings.Join(cell.Source, ""), want[i].kind, want[i].source)
+		}
+		if cell.Type == "code" && cell.Outputs == nil {
+			t.Errorf("cell %d: a code cell needs an outputs list", i)
+		}
+	}
+}
+
+// Checks that backends are found by target name, and that comments carry
+// over into the Python.
+func TestBackends(t *testing.T) {
+	for target, ext := range map[string]string{"python": ".py", "r": ".R", "ipynb": ".ipynb"} {
+		b, err := NewBackend(target)
+		if err != nil || b.Extension() != ext {
+			t.Errorf("NewBackend(%q): got %v, %v", target, b, err)
+		}
+	}
+	if _, err := NewBackend("julia"); err == nil || !strings.Contains(err.Error(), "ipynb, python, r") {
+		t.Errorf("expected an error listing the targets, got %v", err)
+	}
+	got := transpileNodes([]parser.Node{&parser.CommentNode{Text: "Load\n"}, &parser.LoadNode{File: "a.csv"}})
+	if want := "# Load\n#\ndf = pd.read_csv(\"a.csv\")\n"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+// Checks that the source map ties each statement's lines to its span,
+// below the imports of a script and the def main of a module, and that a
+// traceback frame in the generated file is rewritten to the MLite line.
+func TestSourceMap(t *testing.T) {
+	span := func(line int) parser.Span {
+		return parser.Span{Start: token.Position{Line: line, Column: 1}, End: token.Position{Line: line, Column: 20}}
+	}
+	nodes := []parser.Node{
+		&parser.LoadNode{Span: span(2), File: "housing.csv"},
+		&parser.IfNode{Span: span(3), Left: &parser.ExpressionNode{Type: parser.LITERAL, Value: "1"}, Operator: ">", Right: &parser.ExpressionNode{Type: parser.LITERAL, Value: "0"},
+			Commands: []parser.Node{&parser.TrainNode{Span: span(4), Model: "m", Features: []string{"sqft"}, Target: "price"}}},
+	}
 	tr := NewTranspiler()
-	result := tr.Transpile([]parser.Node{&parser.LoadNode{File: "x.csv"}})
-	if !strings.Contains(result, "import pandas as pd") {
-		t.Error("missing pandas import")
+	code := strings.Split(tr.Transpile(nodes), "\n")
+	want := map[int]int{4: 2, 5: 3, 6: 4, 7: 4} // Python line → MLite line
+	m := tr.SourceMap()
+	if len(m.Mappings) != len(want) {
+		t.Fatalf("got %d mappings, want %d: %+v\n%s", len(m.Mappings), len(want), m.Mappings, strings.Join(code, "\n"))
 	}
-	if !strings.Contains(result, "from sklearn.linear_model import LinearRegression") {
-		t.Error("missing sklearn import")
+	for line, source := range want {
+		if got, ok := m.Lookup(line); !ok || got.Start.Line != source {
+			t.Errorf("line %d (%q): got MLite line %d, want %d", line, code[line-1], got.Start.Line, source)
+		}
+	}
+	if code[5] != "    m = LinearRegression()" {
+		t.Errorf("line 6: got %q", code[5])
+	}
+
+	module := NewTranspiler()
+	script := strings.Split(module.TranspileModule(nodes).Script, "\n")
+	first := module.SourceMap().Mappings[0]
+	if !strings.Contains(script[first.Line-1], "pd.read_csv") || first.Span.Start.Line != 2 {
+		t.Errorf("module: line %d is %q, mapped to %+v", first.Line, script[first.Line-1], first.Span)
 	}
-}
\ No newline at end of file
+
+	m.File, m.Source = "housing.py", "housing.mlite"
+	traceback := "Traceback (most recent call last):\n" +
+		"  File \"/tmp/housing.py\", line 6, in <module>\n" +
+		"    m = LinearRegression()\n" +
+		"  File \"/usr/lib/python3/site.py\", line 6, in f\n"
+	got := m.RewriteTraceback(traceback)
+	if want := "  File \"housing.mlite\", line 4, column 1, in <module> (housing.py line 6)\n"; !strings.Contains(got, want) {
+		t.Errorf("traceback: missing %q in\n%s", want, got)
+	}
+	if !strings.Contains(got, "site.py\", line 6, in f") {
+		t.Errorf("traceback: a frame in another file was rewritten:\n%s", got)
+	}
+}
@@ -1,5 +1,5 @@
 import { useState, useRef, useEffect } from "react";
-import { transpile } from "./utils/api";
+import { transpile, Target } from "./utils/api";
 
 const SAMPLE_MLITE = `# MLITE Workflow v0.1
 # Iris classification example
@@ -229,6 +229,7 @@ export default function MLITEDebugger() {
   const [glitch, setGlitch] = useState(false);
   const [pythonOutput, setPythonOutput] = useState(PYTHON_OUTPUT);
   const [transpileError, setTranspileError] = useState("");
+  const [target, setTarget] = useState<Target>("python");
   const [uploadedFile, setUploadedFile] = useState<string | null>(null);
   const [serverOnline, setServerOnline] = useState(false);
   const logRef = useRef<HTMLDivElement>(null);
@@ -278,13 +279,13 @@ export default function MLITEDebugger() {
     setTranspileError("");
     setTimeout(() => setGlitch(false), 300);
 
-    const result = await transpile(mliteCode);
+    const result = await transpile(mliteCode, target);
 
     if (result.error) {
       setTranspileError(result.error);
       setPythonOutput("");
     } else {
-      setPythonOutput(result.python ?? "");
+      setPythonOutput(result.python ?? result.r ?? result.notebook ?? "");
       setActiveTab("python"); // auto-switch to PYTHON OUT tab to show result
     }
 
@@ -616,7 +617,7 @@ export default function MLITEDebugger() {
                   ? "EXEC TRACE"
                   : tab === "vars"
                     ? "VARIABLES"
-                    : "PYTHON OUT"}
+                    : `${target === "python" ? "PYTHON" : target.toUpperCase()} OUT`}
               </div>
             ))}
           </div>
@@ -821,6 +822,22 @@ export default function MLITEDebugger() {
                   lineHeight: 1.7,
                 }}
               >
+                <div style={{ display: "flex", gap: 8, marginBottom: 12 }}>
+                  {(["python", "r", "ipynb"] as Target[]).map((t) => (
+                    <span
+                      key={t}
+                      onClick={() => setTarget(t)}
+                      style={{
+                        cursor: "pointer",
+                        fontSize: 10,
+                        letterSpacing: "0.1em",
+                        color: target === t ? "#00ff9f" : "#445",
+                      }}
+                    >
+                      {t.toUpperCase()}
+                    </span>
+                  ))}
+                </div>
                 {transpileError && (
                   <div style={{ color: "#ff4444", marginBottom: 12, whiteSpace: "pre" }}>
                     {transpileError}
@@ -1,18 +1,34 @@
 const SERVER_URL = "http://localhost:8081";
 
+export type Target = "python" | "r" | "ipynb";
+
+// Maps lines of generated Python back to the MLite statements they came
+// from (1-based lines and columns).
+export interface SourceMap {
+  version: number;
+  mappings: {
+    line: number;
+    span: { start: { line: number; column: number }; end: { line: number; column: number } };
+  }[];
+}
+
 export interface TranspileResult {
   python?: string;
+  sourceMap?: SourceMap; // only for python
+  r?: string;
+  notebook?: string; // nbformat 4 JSON
   error?: string;
 }
 
-// Sends MLite source code to the Go server and returns the transpiled Python.
+// Sends MLite source code to the Go server and returns it transpiled to the
+// target language: Python by default, R, or a Jupyter notebook.
 // On network failure (server not running) it returns a descriptive error.
-export async function transpile(code: string): Promise<TranspileResult> {
+export async function transpile(code: string, target: Target = "python"): Promise<TranspileResult> {
   try {
     const res = await fetch(`${SERVER_URL}/transpile`, {
       method: "POST",
       headers: { "Content-Type": "application/json" },
-      body: JSON.stringify({ code }),
+      body: JSON.stringify({ code, target }),
     });
     return await res.json();
   } catch (err) {